@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/refresh"
+	"github.com/Pigmice2733/peregrine-backend/internal/server"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/tba"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// openStore opens the PostgreSQL store for an administration command. The
+// in-memory store is rejected since any changes would be lost on exit.
+func openStore(ctx context.Context, configPath string) (config.Config, *store.Service, *logrus.Logger, error) {
+	c, err := config.Open(configPath)
+	if err != nil {
+		return c, nil, nil, fmt.Errorf("unable to open config: %w", err)
+	}
+
+	if c.Memory {
+		return c, nil, nil, errors.New("administration commands can not be used with the in-memory store")
+	}
+
+	logger := newLogger(c.Server)
+
+	sto, err := openPostgres(ctx, c, logger)
+	return c, sto, logger, err
+}
+
+// readPassword reads a password from stdin. If stdin is a terminal the
+// password is not echoed and must be entered twice.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return "", fmt.Errorf("unable to read password: %w", err)
+		}
+
+		return strings.TrimRight(password, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read password: %w", err)
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read password: %w", err)
+	}
+
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+
+	return string(password), nil
+}
+
+func validatePassword(password string) error {
+	return validator.New().Var(password, "gte=8,lte=128")
+}
+
+func runUser(ctx context.Context, configPath string, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(ctx, configPath, args[1:])
+	case "reset-password":
+		return runUserResetPassword(ctx, configPath, args[1:])
+	case "promote":
+		return runUserPromote(ctx, configPath, args[1:])
+	}
+
+	return errUsage
+}
+
+type newUser struct {
+	Username  string `validate:"gte=4,lte=32,alphanum"`
+	FirstName string `validate:"required"`
+	LastName  string `validate:"required"`
+}
+
+func runUserCreate(ctx context.Context, configPath string, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	realmID := fs.Int64("realm", 1, "realm ID to create the user in")
+	firstName := fs.String("first", "", "first name of the user")
+	lastName := fs.String("last", "", "last name of the user")
+	role := fs.String("role", string(store.RoleScout), "role of the user: viewer, scout, strategist, realmAdmin, or superAdmin")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	if !store.Role(*role).Valid() {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	nu := newUser{Username: fs.Arg(0), FirstName: *firstName, LastName: *lastName}
+	if err := validator.New().Struct(nu); err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	if err := validatePassword(password); err != nil {
+		return fmt.Errorf("invalid password: %w", err)
+	}
+
+	_, sto, _, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	if err := sto.CheckSimilarUsernameExists(ctx, nu.Username, nil); err != nil {
+		return err
+	}
+
+	hashedPassword, err := server.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("unable to hash password: %w", err)
+	}
+
+	err = sto.CreateUser(ctx, store.User{
+		Username:       nu.Username,
+		HashedPassword: hashedPassword,
+		RealmID:        *realmID,
+		FirstName:      nu.FirstName,
+		LastName:       nu.LastName,
+		Role:           store.Role(*role),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created user %s\n", nu.Username)
+
+	return nil
+}
+
+func runUserResetPassword(ctx context.Context, configPath string, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	if err := validatePassword(password); err != nil {
+		return fmt.Errorf("invalid password: %w", err)
+	}
+
+	_, sto, _, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	user, err := sto.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := server.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("unable to hash password: %w", err)
+	}
+
+	if err := sto.PatchUser(ctx, store.PatchUser{ID: user.ID, HashedPassword: &hashedPassword}); err != nil {
+		return err
+	}
+
+	fmt.Printf("reset password for user %s\n", user.Username)
+
+	return nil
+}
+
+func runUserPromote(ctx context.Context, configPath string, args []string) error {
+	fs := flag.NewFlagSet("user promote", flag.ExitOnError)
+	roleName := fs.String("role", string(store.RoleRealmAdmin), "role to give the user: viewer, scout, strategist, realmAdmin, or superAdmin")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	role := store.Role(*roleName)
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	_, sto, _, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	user, err := sto.GetUserByUsername(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := sto.PatchUser(ctx, store.PatchUser{ID: user.ID, Role: &role, Permissions: role.Permissions()}); err != nil {
+		return err
+	}
+
+	fmt.Printf("made user %s a %s\n", user.Username, role)
+
+	return nil
+}
+
+func runRealm(ctx context.Context, configPath string, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("realm create", flag.ExitOnError)
+	shareReports := fs.Bool("share-reports", false, "share the realm's reports and events with other realms")
+	_ = fs.Parse(args[1:])
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	realm := store.Realm{Name: fs.Arg(0), ShareReports: *shareReports}
+	if err := validator.New().Struct(realm); err != nil || realm.Name == "" {
+		return fmt.Errorf("invalid realm name %q", realm.Name)
+	}
+
+	_, sto, _, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	id, err := sto.InsertRealm(ctx, realm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created realm %s with ID %d\n", realm.Name, id)
+
+	return nil
+}
+
+func runSchema(ctx context.Context, configPath string, args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("schema import", flag.ExitOnError)
+	realmID := fs.Int64("realm", 0, "realm ID to import the schema into, instead of the year in the file")
+	_ = fs.Parse(args[1:])
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("unable to open schema: %w", err)
+	}
+	defer f.Close()
+
+	var schema store.Schema
+	if err := json.NewDecoder(f).Decode(&schema); err != nil {
+		return fmt.Errorf("unable to decode schema: %w", err)
+	}
+
+	// Like the API, schemas belong to either a year or a realm, never both.
+	if *realmID != 0 {
+		schema.Year = nil
+		schema.RealmID = realmID
+	} else if schema.Year != nil {
+		schema.RealmID = nil
+	} else {
+		return errors.New("the schema must have a year, or a realm must be given with -realm")
+	}
+
+	_, sto, _, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	if err := sto.CreateSchema(ctx, schema); err != nil {
+		return err
+	}
+
+	fmt.Println("imported schema")
+
+	return nil
+}
+
+func runEvent(ctx context.Context, configPath string, args []string) error {
+	if len(args) != 2 || args[0] != "import" {
+		return errUsage
+	}
+
+	c, sto, logger, err := openStore(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer sto.Close()
+
+	refresher := &refresh.Service{
+		TBA: &tba.Service{
+			URL:     c.TBA.URL,
+			APIKey:  c.TBA.APIKey,
+			Timeout: time.Duration(c.TBA.Timeout),
+		},
+		Store:  sto,
+		Logger: logger,
+		Year:   c.Year,
+	}
+
+	return refresher.Import(ctx, args[1])
+}
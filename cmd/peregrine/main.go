@@ -2,29 +2,69 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
+	"github.com/Pigmice2733/peregrine-backend/internal/migrate"
+	"github.com/Pigmice2733/peregrine-backend/internal/oidc"
 	"github.com/Pigmice2733/peregrine-backend/internal/refresh"
 	"github.com/Pigmice2733/peregrine-backend/internal/server"
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/Pigmice2733/peregrine-backend/internal/tba"
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
 	"github.com/sirupsen/logrus"
 )
 
+const usage = `Usage: %[1]s [-config path] <command> [arguments]
+
+Commands:
+  serve                                    run the server
+  migrate <up|down|status>                 manage the database schema
+  user create [flags] <username>           create a user, reading the password from stdin
+  user reset-password <username>           set a user's password, reading it from stdin
+  user promote [flags] <username>          change the role of a user
+  realm create [-share-reports] <name>     create a realm
+  schema import [-realm id] <file>         import a report schema from a JSON file
+  event import <tba key>                   import an event and its matches and rankings from TBA
+
+Run '%[1]s <command> -h' for a command's flags. For backwards compatibility,
+'%[1]s <config path>' is the same as '%[1]s -config <config path> serve'.
+
+The config may be JSON or YAML, and any field can be overridden with a
+PEREGRINE_* environment variable, e.g. PEREGRINE_SERVER_JWT_SECRET. If the
+config path is empty the config is read from environment variables alone.
+
+Flags:
+`
+
+// errUsage is returned by commands given invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
 func main() {
+	defaultConfigPath, ok := os.LookupEnv("PEREGRINE_CONFIG")
+	if !ok {
+		defaultConfigPath = "config.json"
+	}
+
+	configPath := flag.String("config", defaultConfigPath, "config file path, or PEREGRINE_CONFIG")
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [config path]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) != 1 {
+	if len(args) == 0 {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -39,7 +79,32 @@ func main() {
 		}
 	}()
 
-	if err := run(ctx, args[0]); err != nil {
+	var err error
+	switch args[0] {
+	case "serve":
+		err = run(ctx, *configPath)
+	case "migrate":
+		err = runMigrate(ctx, *configPath, args[1:])
+	case "user":
+		err = runUser(ctx, *configPath, args[1:])
+	case "realm":
+		err = runRealm(ctx, *configPath, args[1:])
+	case "schema":
+		err = runSchema(ctx, *configPath, args[1:])
+	case "event":
+		err = runEvent(ctx, *configPath, args[1:])
+	default:
+		if len(args) != 1 {
+			err = errUsage
+			break
+		}
+		err = run(ctx, args[0])
+	}
+
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(1)
+	} else if err != nil {
 		fmt.Printf("got error: %v\n", err)
 		os.Exit(1)
 	}
@@ -52,23 +117,63 @@ func run(ctx context.Context, configPath string) error {
 	}
 
 	tba := &tba.Service{
-		URL:    c.TBA.URL,
-		APIKey: c.TBA.APIKey,
+		URL:     c.TBA.URL,
+		APIKey:  c.TBA.APIKey,
+		Timeout: time.Duration(c.TBA.Timeout),
 	}
 
-	logger := logrus.New()
-	logger.SetLevel(c.Server.LogLevel)
-	if c.Server.LogJSON {
-		logger.Formatter = &logrus.JSONFormatter{}
-	}
+	logger := newLogger(c.Server)
 
-	logger.Info("connecting to postgres")
-	sto, err := store.New(ctx, c.DSN, logger)
+	shutdownTracing, err := tracing.Setup(ctx, c.Tracing)
 	if err != nil {
-		return fmt.Errorf("opening postgres server: %w", err)
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.WithError(err).Error("unable to flush traces")
+		}
+	}()
+
+	var sto store.Store
+	if c.Memory {
+		logger.Warn("using in-memory store, data will be lost when peregrine exits")
+		sto = store.NewMemory()
+	} else {
+		postgres, err := openPostgres(ctx, c, logger)
+		if err != nil {
+			return err
+		}
+		sto = postgres
+
+		if err := metrics.RegisterDBStats("postgres", postgres.Stats); err != nil {
+			return fmt.Errorf("registering database metrics: %w", err)
+		}
 	}
 	defer sto.Close()
-	logger.Info("connected to postgres")
+
+	var schema server.SchemaChecker
+	if !c.Memory {
+		migrator, err := openMigrator(c.DSN, logger)
+		if errors.Is(err, migrate.ErrNotEmbedded) && !c.AutoMigrate {
+			logger.Warn("migrations are not embedded, the schema version will not be checked")
+		} else if err != nil {
+			return fmt.Errorf("opening migrator: %w", err)
+		} else {
+			defer migrator.Close()
+			schema = migrator
+
+			if c.AutoMigrate {
+				applied, err := migrator.Up(ctx)
+				if err != nil {
+					return fmt.Errorf("migrating database: %w", err)
+				}
+				logger.WithField("applied", applied).Info("migrated database")
+			}
+		}
+	}
 
 	// The cool, refreshing taste of Pepsi.
 	refresher := &refresh.Service{
@@ -76,13 +181,27 @@ func run(ctx context.Context, configPath string) error {
 		Store:  sto,
 		Logger: logger,
 		Year:   c.Year,
+		Config: c.Refresh,
+	}
+
+	keys, err := signing.Open(ctx, c.Server.JWTSecret, c.Server.SigningAlgorithm, time.Duration(c.Server.KeyRotation), server.MaxTokenLifetime, sto, logger)
+	if err != nil {
+		return fmt.Errorf("opening signing keys: %w", err)
 	}
 
 	s := &server.Server{
-		TBA:    tba,
-		Store:  sto,
-		Logger: logger,
-		Server: c.Server,
+		TBA:       tba,
+		Store:     sto,
+		Refresher: refresher,
+		Schema:    schema,
+		Email:     email.New(c.Email, logger),
+		Keys:      keys,
+		Logger:    logger,
+		Server:    c.Server,
+	}
+
+	if c.OIDC.Issuer != "" {
+		s.OIDC = oidc.New(c.OIDC)
 	}
 
 	updateCtx, updateCancel := context.WithCancel(ctx)
@@ -91,6 +210,24 @@ func run(ctx context.Context, configPath string) error {
 	}()
 
 	go refresher.Run(updateCtx)
+	go keys.Run(updateCtx)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			reloaded, err := config.Open(configPath)
+			if err != nil {
+				logger.WithError(err).Error("unable to reload config, keeping current config")
+				continue
+			}
+
+			s.Reload(reloaded.Server)
+			refresher.SetConfig(reloaded.Refresh)
+			logger.Info("reloaded log level, origin, and refresh settings")
+		}
+	}()
 
 	if err := s.Run(ctx); err != nil {
 		err = fmt.Errorf("error running server: %w", err)
@@ -98,3 +235,24 @@ func run(ctx context.Context, configPath string) error {
 
 	return err
 }
+
+func newLogger(c config.Server) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetLevel(c.LogLevel)
+	if c.LogJSON {
+		logger.Formatter = &logrus.JSONFormatter{}
+	}
+
+	return logger
+}
+
+func openPostgres(ctx context.Context, c config.Config, logger *logrus.Logger) (*store.Service, error) {
+	logger.Info("connecting to postgres")
+	sto, err := store.New(ctx, c.DSN, logger)
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres server: %w", err)
+	}
+	logger.Info("connected to postgres")
+
+	return sto, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/migrate"
+	"github.com/sirupsen/logrus"
+)
+
+func openMigrator(dsn string, logger *logrus.Logger) (*migrate.Migrator, error) {
+	migrations, err := migrate.Embedded()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Open(dsn, migrations, logger)
+}
+
+// runMigrate runs a migrate subcommand: up applies every pending migration,
+// down rolls back the last applied migration, and status prints the schema
+// version.
+func runMigrate(ctx context.Context, configPath string, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	c, err := config.Open(configPath)
+	if err != nil {
+		return fmt.Errorf("unable to open config: %w", err)
+	}
+
+	if c.Memory {
+		return errors.New("the in-memory store does not use migrations")
+	}
+
+	migrator, err := openMigrator(c.DSN, newLogger(c.Server))
+	if err != nil {
+		return fmt.Errorf("opening migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		return migrator.Down(ctx)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		version := "none"
+		if status.Version != nil {
+			version = fmt.Sprint(*status.Version)
+		}
+
+		fmt.Printf("version: %s\nlatest: %d\npending: %d\ndirty: %t\n", version, status.Latest, status.Pending, status.Dirty)
+	default:
+		return errUsage
+	}
+
+	return nil
+}
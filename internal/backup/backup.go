@@ -0,0 +1,140 @@
+// Package backup reads and writes archives of all the data owned by a realm:
+// the realm itself, its users, schemas, private events and their matches, and
+// its reports. Archives are zips of JSON files with a versioned manifest, so a
+// realm can be restored into the same or a different peregrine instance.
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+// Version is the version of the archive format written by Write. Read rejects
+// archives with a newer version.
+const Version = 1
+
+// ErrUnsupportedVersion is returned by Read for archives written by a newer
+// version of peregrine.
+var ErrUnsupportedVersion = errors.New("unsupported archive version")
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Hashes is whether the archive includes the password hashes of users.
+	Hashes bool `json:"hashes"`
+}
+
+// User is a user in an archive, along with their password hash if the archive
+// includes hashes.
+type User struct {
+	store.User
+	HashedPassword string `json:"hashedPassword,omitempty"`
+}
+
+// Archive is all the data owned by a realm. IDs, and the keys of private
+// events, are the ones from the instance the archive was written on.
+type Archive struct {
+	Manifest Manifest
+	Realm    store.Realm
+	Users    []User
+	Schemas  []store.Schema
+	Events   []store.Event
+	Matches  []store.Match
+	Reports  []store.Report
+}
+
+// files returns the names of the files in an archive and the values they hold.
+func (a *Archive) files() []struct {
+	name string
+	v    interface{}
+} {
+	return []struct {
+		name string
+		v    interface{}
+	}{
+		{"manifest.json", &a.Manifest},
+		{"realm.json", &a.Realm},
+		{"users.json", &a.Users},
+		{"schemas.json", &a.Schemas},
+		{"events.json", &a.Events},
+		{"matches.json", &a.Matches},
+		{"reports.json", &a.Reports},
+	}
+}
+
+// Write writes an archive to w, setting its manifest version.
+func Write(w io.Writer, a Archive) error {
+	a.Manifest.Version = Version
+
+	zw := zip.NewWriter(w)
+	for _, file := range a.files() {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", file.name, err)
+		}
+
+		if err := json.NewEncoder(f).Encode(file.v); err != nil {
+			return fmt.Errorf("unable to write %s: %w", file.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("unable to finish archive: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads an archive of the given size from r.
+func Read(r io.ReaderAt, size int64) (Archive, error) {
+	var a Archive
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return a, fmt.Errorf("unable to open archive: %w", err)
+	}
+
+	contents := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		contents[f.Name] = f
+	}
+
+	for _, file := range a.files() {
+		f, ok := contents[file.name]
+		if !ok {
+			return a, fmt.Errorf("archive is missing %s", file.name)
+		}
+
+		if err := readFile(f, file.v); err != nil {
+			return a, err
+		}
+
+		if file.name == "manifest.json" && (a.Manifest.Version < 1 || a.Manifest.Version > Version) {
+			return a, fmt.Errorf("%w: %d", ErrUnsupportedVersion, a.Manifest.Version)
+		}
+	}
+
+	return a, nil
+}
+
+// readFile decodes the JSON in an archive file into v.
+func readFile(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("unable to read %s: %w", f.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestRoundTrip(t *testing.T) {
+	realmID := int64(3)
+	a := Archive{
+		Manifest: Manifest{CreatedAt: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), Hashes: true},
+		Realm:    store.Realm{ID: realmID, Name: "Pigmice", Settings: store.RealmSettings{HomeTeamKey: "frc2733"}},
+		Users: []User{{
+			User:           store.User{ID: 7, Username: "ada", RealmID: realmID, HashedPassword: "ignored"},
+			HashedPassword: "$2a$10$hash",
+		}},
+		Events:  []store.Event{{Key: "2019pigmice", RealmID: &realmID}},
+		Reports: []store.Report{{EventKey: "2019pigmice", MatchKey: "qm1", TeamKey: "frc2733", RealmID: &realmID}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, a); err != nil {
+		t.Fatalf("did not expect error %v writing archive", err)
+	}
+
+	got, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("did not expect error %v reading archive", err)
+	}
+
+	if got.Manifest.Version != Version || !got.Manifest.Hashes {
+		t.Errorf("expected manifest with current version and hashes, got %+v", got.Manifest)
+	}
+	if got.Realm.Name != a.Realm.Name || got.Realm.Settings.HomeTeamKey != "frc2733" {
+		t.Errorf("expected realm %+v, got %+v", a.Realm, got.Realm)
+	}
+	if len(got.Users) != 1 || got.Users[0].Username != "ada" || got.Users[0].HashedPassword != "$2a$10$hash" {
+		t.Errorf("expected user with their hash, got %+v", got.Users)
+	}
+	if len(got.Events) != 1 || len(got.Reports) != 1 || got.Schemas != nil || got.Matches != nil {
+		t.Errorf("expected 1 event and report and nothing else, got %+v", got)
+	}
+}
+
+func TestReadUnsupportedVersion(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		t.Fatalf("did not expect error %v creating manifest", err)
+	}
+	if err := json.NewEncoder(f).Encode(Manifest{Version: Version + 1}); err != nil {
+		t.Fatalf("did not expect error %v writing manifest", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("did not expect error %v closing archive", err)
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected unsupported version error, got %v", err)
+	}
+
+	if _, err := Read(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Errorf("expected error reading something that isn't an archive")
+	}
+}
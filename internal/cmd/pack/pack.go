@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 )
@@ -21,22 +22,56 @@ type templateData struct {
 	PackageName string
 	Command     string
 	Name        string
-	Value       []byte
+	Value       interface{}
+}
+
+// readInput reads a file as a []byte, or every file in a directory as a
+// map[string][]byte of file names to contents.
+func readInput(in string) (interface{}, error) {
+	info, err := os.Stat(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return ioutil.ReadFile(in)
+	}
+
+	files, err := ioutil.ReadDir(in)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		value, err := ioutil.ReadFile(filepath.Join(in, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		values[f.Name()] = value
+	}
+
+	return values, nil
 }
 
 func main() {
 	var (
 		pkg  = flag.String("package", "main", "output file package name")
 		out  = flag.String("out", "packed.go", "output file name")
-		in   = flag.String("in", "in", "input file name")
+		in   = flag.String("in", "in", "input file or directory name")
 		name = flag.String("name", "in", "variable name to set")
 	)
 
 	flag.Parse()
 
-	value, err := ioutil.ReadFile(*in)
+	value, err := readInput(*in)
 	if err != nil {
-		panic(fmt.Errorf("reading input file: %w", err))
+		panic(fmt.Errorf("reading input: %w", err))
 	}
 
 	tmpl, _ := template.New("pack").Parse(rawTemplate)
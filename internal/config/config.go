@@ -3,43 +3,195 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/validator.v9"
+	"gopkg.in/yaml.v2"
 )
 
-// Server holds information about the peregrine backend HTTP server.
+// EnvPrefix is the prefix of environment variables that override config
+// fields.
+const EnvPrefix = "PEREGRINE"
+
+// Server holds information about the peregrine backend HTTP server. Zero
+// timeouts and sizes are replaced with defaults.
 type Server struct {
-	Listen    string       `json:"listen" validate:"required"`
-	Origin    string       `json:"origin" validate:"required"`
-	LogLevel  logrus.Level `json:"logLevel"`
-	LogJSON   bool         `json:"logJSON"`
-	JWTSecret string       `json:"jwtSecret" validate:"required,min=32"`
+	Listen    string       `json:"listen" yaml:"listen" validate:"required"`
+	Origin    string       `json:"origin" yaml:"origin" validate:"required"`
+	LogLevel  logrus.Level `json:"logLevel" yaml:"logLevel"`
+	LogJSON   bool         `json:"logJSON" yaml:"logJSON"`
+	JWTSecret string       `json:"jwtSecret" yaml:"jwtSecret" validate:"required,min=32"`
+	// SigningAlgorithm is the algorithm tokens are signed with: HS256 with
+	// the JWT secret, or RS256 or EdDSA with keys generated and kept in the
+	// database. Defaults to HS256.
+	SigningAlgorithm string `json:"signingAlgorithm" yaml:"signingAlgorithm" validate:"omitempty,oneof=HS256 RS256 EdDSA"`
+	// KeyRotation is how often a new RS256 or EdDSA signing key is generated.
+	// Retired keys keep verifying tokens until they expire. If zero, keys are
+	// never rotated.
+	KeyRotation Duration `json:"keyRotation" yaml:"keyRotation"`
+	// LinkURL is the client URL that links sent to users, like invites and
+	// password resets, point to.
+	LinkURL string `json:"linkUrl" yaml:"linkUrl" validate:"omitempty,url"`
+	// RejectedUserGracePeriod is how long users who signed themselves up and
+	// were rejected are kept before they're deleted. Defaults to a week.
+	RejectedUserGracePeriod Duration `json:"rejectedUserGracePeriod" yaml:"rejectedUserGracePeriod"`
+	// RetentionSeasons is how many whole seasons a user can be inactive
+	// before they're deleted and their reports anonymized. If zero, inactive
+	// users are kept.
+	RetentionSeasons int `json:"retentionSeasons" yaml:"retentionSeasons" validate:"gte=0"`
+	// StatsCacheTTL is how long event stats are cached. Writes made by other
+	// processes don't invalidate the cache, so they show up after at most
+	// this long. Defaults to a minute.
+	StatsCacheTTL Duration `json:"statsCacheTTL" yaml:"statsCacheTTL"`
+
+	ReadTimeout  Duration `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout  Duration `json:"idleTimeout" yaml:"idleTimeout"`
+	// MaxBodySize is the largest request body in bytes the server will read.
+	MaxBodySize int64 `json:"maxBodySize" yaml:"maxBodySize" validate:"gte=0"`
+	// MaxRestoreSize is the largest realm backup in bytes the server will
+	// restore, in place of MaxBodySize. Defaults to 100 MB.
+	MaxRestoreSize int64 `json:"maxRestoreSize" yaml:"maxRestoreSize" validate:"gte=0"`
+}
+
+// Intervals holds how often each kind of data is refreshed from TBA.
+type Intervals struct {
+	Events Duration `json:"events" yaml:"events"`
+	Active Duration `json:"active" yaml:"active"`
+	Teams  Duration `json:"teams" yaml:"teams"`
+}
+
+// Refresh holds how often data is refreshed from TBA. The top level intervals
+// are used during event weeks, and the idle intervals otherwise. Zero
+// intervals and timeouts are replaced with defaults.
+type Refresh struct {
+	Intervals `yaml:",inline"`
+	Idle      Intervals `json:"idle" yaml:"idle"`
+	// Timeout bounds each TBA request and store update made while refreshing.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Tracing holds where OpenTelemetry traces are exported. Tracing is disabled
+// unless an endpoint is set.
+type Tracing struct {
+	// Endpoint is the host and port of an OTLP/HTTP collector, e.g.
+	// localhost:55681.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Insecure exports over plain HTTP instead of HTTPS.
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// SampleRatio is the fraction of new traces that are sampled. Zero samples
+	// every trace.
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio" validate:"gte=0,lte=1"`
+}
+
+// OIDC holds the OpenID Connect provider users can log in with, such as
+// Google. OIDC login is disabled unless an issuer is set.
+type OIDC struct {
+	// Issuer is the provider's issuer URL, e.g. https://accounts.google.com.
+	Issuer       string `json:"issuer" yaml:"issuer" validate:"omitempty,url"`
+	ClientID     string `json:"clientId" yaml:"clientId" validate:"required_with=Issuer"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret"`
+	// RedirectURL is the client page the provider sends users back to. It
+	// passes the code and state it receives on to /oidc/callback.
+	RedirectURL string `json:"redirectUrl" yaml:"redirectUrl" validate:"required_with=Issuer"`
+	// RealmID is the realm users are created in the first time they log in,
+	// as viewers until an admin gives them a role. If zero, only users who
+	// have linked an identity to their account can log in.
+	RealmID int64 `json:"realmId" yaml:"realmId" validate:"gte=0"`
+	// AllowedDomains limits who is created on first login to users with a
+	// verified email address at one of these domains. If empty anyone can be.
+	AllowedDomains []string `json:"allowedDomains" yaml:"allowedDomains"`
+}
+
+// Email holds the SMTP server emails like invites and password resets are
+// sent through. Emails are only logged unless a host is set.
+type Email struct {
+	Host string `json:"host" yaml:"host"`
+	// Port defaults to 587.
+	Port     int    `json:"port" yaml:"port" validate:"gte=0,lte=65535"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// From is the address emails are sent from.
+	From string `json:"from" yaml:"from" validate:"required_with=Host"`
 }
 
 // Config holds information about how the peregrine backend is configured.
 type Config struct {
-	Server Server `json:"server" validate:"dive"`
-	Year   int    `json:"year" validate:"required"`
-	TBA    struct {
-		URL    string `validate:"required"`
-		APIKey string `validate:"required"`
-	} `json:"tba"`
-	DSN string `json:"dsn" validate:"required"`
+	Server  Server  `json:"server" yaml:"server" validate:"dive"`
+	Refresh Refresh `json:"refresh" yaml:"refresh"`
+	Tracing Tracing `json:"tracing" yaml:"tracing"`
+	OIDC    OIDC    `json:"oidc" yaml:"oidc"`
+	Email   Email   `json:"email" yaml:"email"`
+	Year    int     `json:"year" yaml:"year" validate:"required"`
+	TBA     struct {
+		URL     string   `json:"url" yaml:"url" validate:"required"`
+		APIKey  string   `json:"apiKey" yaml:"apiKey" validate:"required"`
+		Timeout Duration `json:"timeout" yaml:"timeout"`
+	} `json:"tba" yaml:"tba"`
+	DSN         string `json:"dsn" yaml:"dsn" validate:"required_without=Memory"`
+	Memory      bool   `json:"memory" yaml:"memory"`
+	AutoMigrate bool   `json:"autoMigrate" yaml:"autoMigrate"`
 }
 
-// Open parses and validates the JSON config at the given path.
-func Open(path string) (Config, error) {
-	f, err := os.Open(path)
+// Duration is a time.Duration that is read from and written as a string like
+// "1m30s" in config files and environment variables.
+type Duration time.Duration
+
+// UnmarshalText parses a duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
 	if err != nil {
-		return Config{}, fmt.Errorf("unable to open file: %w", err)
+		return err
 	}
-	defer f.Close()
 
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Or returns the duration, or def if the duration is zero.
+func (d Duration) Or(def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+
+	return time.Duration(d)
+}
+
+// Open parses the JSON or YAML config at the given path, applies overrides
+// from PEREGRINE_* environment variables, and validates the result. Files
+// ending in .yaml or .yml are parsed as YAML. If the path is empty the config
+// is read from environment variables alone.
+func Open(path string) (Config, error) {
 	var c Config
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
-		return Config{}, fmt.Errorf("unable to unmarshal file: %w", err)
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to open file: %w", err)
+		}
+
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml":
+			err = yaml.UnmarshalStrict(b, &c)
+		default:
+			err = json.Unmarshal(b, &c)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to unmarshal file: %w", err)
+		}
+	}
+
+	if err := applyEnv(&c, EnvPrefix, os.LookupEnv); err != nil {
+		return Config{}, err
 	}
 
 	validate := validator.New()
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+func TestEnvName(t *testing.T) {
+	testCases := map[string]string{
+		"dsn":         "DSN",
+		"jwtSecret":   "JWT_SECRET",
+		"logJSON":     "LOG_JSON",
+		"apiKey":      "API_KEY",
+		"autoMigrate": "AUTO_MIGRATE",
+		"JSONSchema":  "JSON_SCHEMA",
+	}
+
+	for name, expected := range testCases {
+		if got := envName(name); got != expected {
+			t.Errorf("expected env name for %q to be %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"PEREGRINE_SERVER_JWT_SECRET":  "env-secret",
+		"PEREGRINE_SERVER_LOG_LEVEL":   "warning",
+		"PEREGRINE_SERVER_LOG_JSON":    "true",
+		"PEREGRINE_TBA_API_KEY":        "env-key",
+		"PEREGRINE_REFRESH_EVENTS":     "5m",
+		"PEREGRINE_REFRESH_IDLE_TEAMS": "168h",
+		"PEREGRINE_YEAR":               "2020",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	c := Config{Server: Server{Listen: ":8080", JWTSecret: "file-secret"}}
+	if err := applyEnv(&c, EnvPrefix, lookup); err != nil {
+		t.Fatalf("did not expect error applying env: %v", err)
+	}
+
+	expected := Config{
+		Server: Server{Listen: ":8080", JWTSecret: "env-secret", LogLevel: logrus.WarnLevel, LogJSON: true},
+		Refresh: Refresh{
+			Intervals: Intervals{Events: Duration(time.Minute * 5)},
+			Idle:      Intervals{Teams: Duration(time.Hour * 168)},
+		},
+		Year: 2020,
+	}
+	expected.TBA.APIKey = "env-key"
+
+	if !cmp.Equal(c, expected) {
+		t.Errorf("expected config to match, but got diff: %s", cmp.Diff(expected, c))
+	}
+
+	env["PEREGRINE_YEAR"] = "twenty"
+	if err := applyEnv(&c, EnvPrefix, lookup); err == nil {
+		t.Errorf("expected error applying invalid year")
+	}
+}
+
+func TestOpenYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peregrine-config")
+	if err != nil {
+		t.Fatalf("did not expect error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+server:
+  listen: ":8080"
+  origin: "*"
+  logLevel: info
+  jwtSecret: 0123456789abcdef0123456789abcdef
+refresh:
+  active: 1m
+  idle:
+    active: 10m
+tba:
+  url: https://www.thebluealliance.com/api/v3
+  apiKey: key
+memory: true
+year: 2019
+`), 0600)
+	if err != nil {
+		t.Fatalf("did not expect error writing config: %v", err)
+	}
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("did not expect error opening config: %v", err)
+	}
+
+	if c.Server.LogLevel != logrus.InfoLevel || c.Refresh.Active.Or(0) != time.Minute || c.Refresh.Idle.Active.Or(0) != time.Minute*10 || !c.Memory || c.TBA.APIKey != "key" {
+		t.Errorf("config was not parsed correctly: %+v", c)
+	}
+}
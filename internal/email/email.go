@@ -0,0 +1,94 @@
+// Package email sends emails to users, like invites and password resets.
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// New returns a sender for the config, which sends through SMTP if a host is
+// set and otherwise only logs emails.
+func New(c config.Email, logger logrus.FieldLogger) Sender {
+	if c.Host == "" {
+		return Log{Logger: logger}
+	}
+
+	return SMTP{Config: c}
+}
+
+// SMTP sends emails through an SMTP server, authenticating if a username is
+// set.
+type SMTP struct {
+	Config config.Email
+}
+
+// Send sends an email. The context is ignored, since net/smtp doesn't support
+// cancellation.
+func (s SMTP) Send(ctx context.Context, m Message) error {
+	port := s.Config.Port
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)
+	}
+
+	addr := net.JoinHostPort(s.Config.Host, strconv.Itoa(port))
+	if err := smtp.SendMail(addr, auth, s.Config.From, []string{m.To}, format(s.Config.From, m, time.Now())); err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+
+	return nil
+}
+
+// format returns the message as an RFC 5322 email.
+func format(from string, m Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(m.Body, "\n", "\r\n", -1))
+
+	return []byte(b.String())
+}
+
+// Log logs emails instead of sending them, for development and tests.
+type Log struct {
+	Logger logrus.FieldLogger
+}
+
+// Send logs an email.
+func (l Log) Send(ctx context.Context, m Message) error {
+	l.Logger.WithFields(logrus.Fields{
+		"to":      m.To,
+		"subject": m.Subject,
+	}).Info(m.Body)
+
+	return nil
+}
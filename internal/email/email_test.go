@@ -0,0 +1,29 @@
+package email
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2019, time.March, 2, 10, 30, 0, 0, time.UTC)
+
+	got := string(format("peregrine@pigmice.example", Message{
+		To:      "ada@pigmice.example",
+		Subject: "Reset your password",
+		Body:    "Hi Ada,\nReset your password here.",
+	}, date))
+
+	expected := "From: peregrine@pigmice.example\r\n" +
+		"To: ada@pigmice.example\r\n" +
+		"Subject: Reset your password\r\n" +
+		"Date: Sat, 02 Mar 2019 10:30:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Hi Ada,\r\nReset your password here."
+
+	if got != expected {
+		t.Errorf("expected email %q, got %q", expected, got)
+	}
+}
@@ -12,21 +12,43 @@ import (
 type contextKey string
 
 const (
-	keyRolesContext   contextKey = "peregrine_roles"
-	keySubjectContext contextKey = "peregrine_subject"
-	keyRealmContext   contextKey = "peregrine_realm"
+	keyRoleContext        contextKey = "peregrine_role"
+	keyPermissionsContext contextKey = "peregrine_permissions"
+	keySubjectContext     contextKey = "peregrine_subject"
+	keyRealmContext       contextKey = "peregrine_realm"
+	keyAPIKeyContext      contextKey = "peregrine_api_key"
 )
 
-// Claims holds the standard jwt claims, peregrine roles, and realm id.
+// The types of jwts, set in their typ claim. Access and refresh tokens are
+// signed with the same keys, so the type keeps one from being used as the
+// other.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// Claims holds the standard jwt claims, peregrine role and permissions, and
+// realm id.
 type Claims struct {
-	Roles   store.Roles `json:"peregrineRoles"`
-	RealmID int64       `json:"peregrineRealm"`
+	Role        store.Role        `json:"peregrineRole"`
+	Permissions store.Permissions `json:"peregrinePermissions"`
+	RealmID     int64             `json:"peregrineRealm"`
+	// Type is always TokenTypeAccess.
+	Type string `json:"typ"`
 	jwt.StandardClaims
 }
 
-// RefreshClaims holds the standard jwt claims plus
+// RefreshClaims holds the standard jwt claims plus when the user's password
+// was last changed, the ID of the session the token belongs to, and the realm
+// the user is acting in. The jwt ID is the session's current token ID.
 type RefreshClaims struct {
 	PasswordChanged int64 `json:"peregrinePasswordChanged"`
+	SessionID       int64 `json:"peregrineSession"`
+	// RealmID is zero in tokens issued before users could be members of
+	// several realms, meaning the user's own realm.
+	RealmID int64 `json:"peregrineRealm,omitempty"`
+	// Type is always TokenTypeRefresh.
+	Type string `json:"typ"`
 	jwt.StandardClaims
 }
 
@@ -50,19 +72,16 @@ func GetSubject(r *http.Request) (int64, error) {
 	return id, nil
 }
 
-// GetRoles retrieves the roles from the http context.
-func GetRoles(r *http.Request) store.Roles {
-	contextRoles := r.Context().Value(keyRolesContext)
-	if contextRoles == nil {
-		return store.Roles{}
-	}
-
-	roles, ok := contextRoles.(store.Roles)
-	if !ok {
-		return store.Roles{}
-	}
+// GetRole retrieves the user's role from the http context.
+func GetRole(r *http.Request) store.Role {
+	role, _ := r.Context().Value(keyRoleContext).(store.Role)
+	return role
+}
 
-	return roles
+// GetPermissions retrieves the user's permissions from the http context.
+func GetPermissions(r *http.Request) store.Permissions {
+	perms, _ := r.Context().Value(keyPermissionsContext).(store.Permissions)
+	return perms
 }
 
 // GetRealmID retrieves the ID of the user's realm from the http context.
@@ -78,3 +97,15 @@ func GetRealmID(r *http.Request) (int64, error) {
 	}
 	return realmID, nil
 }
+
+// GetAPIKeyID retrieves the ID of the API key the request was authenticated
+// with from the http context. It returns an error if the request wasn't
+// authenticated with an API key.
+func GetAPIKeyID(r *http.Request) (int64, error) {
+	id, ok := r.Context().Value(keyAPIKeyContext).(int64)
+	if !ok {
+		return 0, errors.New("no API key set on context")
+	}
+
+	return id, nil
+}
@@ -2,21 +2,32 @@ package http
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// CORS is a middleware for setting Cross Origin Resource Sharing headers.
-func CORS(next http.Handler, origin string) http.Handler {
+// CORS is a middleware for setting Cross Origin Resource Sharing headers. The
+// allowed origin is retrieved for each request so it can be changed while the
+// server is running.
+func CORS(next http.Handler, origin func() string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Origin", origin())
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			return
@@ -27,10 +38,10 @@ func CORS(next http.Handler, origin string) http.Handler {
 }
 
 // LimitBody is middleware to protect the server from requests containing
-// massive amounts of data.
-func LimitBody(next http.Handler) http.Handler {
+// massive amounts of data. Request bodies are limited to maxBytes.
+func LimitBody(next http.Handler, maxBytes int64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.Body = http.MaxBytesReader(w, r.Body, 1000000) // 1 MB
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -65,8 +76,6 @@ func Log(next http.Handler, l *logrus.Logger) http.HandlerFunc {
 		next.ServeHTTP(rr, r)
 		end := time.Now()
 
-		roles := GetRoles(r)
-
 		fields := logrus.Fields{
 			"method":      r.Method,
 			"remoteAddr":  r.RemoteAddr,
@@ -75,8 +84,7 @@ func Log(next http.Handler, l *logrus.Logger) http.HandlerFunc {
 			"requestTime": end.Sub(start).Seconds(),
 			"statusCode":  rr.code,
 			"bodySize":    rr.length,
-			"admin":       roles.IsAdmin,
-			"superAdmin":  roles.IsSuperAdmin,
+			"role":        GetRole(r),
 			"userAgent":   r.Header.Get("User-Agent"),
 		}
 
@@ -88,6 +96,10 @@ func Log(next http.Handler, l *logrus.Logger) http.HandlerFunc {
 			fields["realmId"] = realm
 		}
 
+		if key, err := GetAPIKeyID(r); err == nil {
+			fields["apiKeyId"] = key
+		}
+
 		withFields := l.WithFields(fields)
 		if rr.code >= 200 && rr.code < 300 {
 			withFields.Info("got request")
@@ -99,8 +111,100 @@ func Log(next http.Handler, l *logrus.Logger) http.HandlerFunc {
 	}
 }
 
-// Auth returns a middleware used for jwt authentication.
-func Auth(next http.Handler, secret string) http.Handler {
+// routeTemplate returns the path template of the route matched by a
+// mux.Router, or "unknown" if no route matched.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return "unknown"
+}
+
+// Metrics records the count and latency of requests by route template. It
+// must be used as middleware on a mux.Router so the matched route is known.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		rr := &recorder{ResponseWriter: w}
+
+		start := time.Now()
+		next.ServeHTTP(rr, r)
+
+		code := rr.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(code)).Inc()
+	})
+}
+
+// Trace starts a span for each request, continuing any trace passed in the
+// request's traceparent header. It should wrap every other middleware so their
+// time is included.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("peregrine", "", r)...),
+		)
+		defer span.End()
+
+		rr := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rr, r.WithContext(ctx))
+
+		code := rr.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(code)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(code))
+	})
+}
+
+// TraceRoute names the request's span after the matched route template. It
+// must be used as middleware on a mux.Router inside of a Trace middleware.
+func TraceRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRouteKey.String(route))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// APIKeyStore looks up the API keys accepted by Auth, and the users they act
+// on behalf of along with their memberships of other realms.
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (store.APIKey, error)
+	GetUserByID(ctx context.Context, id int64) (store.User, error)
+	GetMembership(ctx context.Context, userID, realmID int64) (store.Membership, error)
+	TouchAPIKey(ctx context.Context, id int64, used time.Time) error
+}
+
+// apiKeyTouchInterval limits how often the last used time of an API key is
+// written, so busy integrations don't cause a write on every request.
+const apiKeyTouchInterval = time.Minute
+
+// TokenVerifier finds the key to verify a jwt with, returning an error if the
+// jwt isn't signed with a key and algorithm that's accepted.
+type TokenVerifier interface {
+	VerifyKey(token *jwt.Token) (interface{}, error)
+}
+
+// Auth returns a middleware used for authentication with either a jwt or an
+// API key as the bearer token.
+func Auth(next http.Handler, verifier TokenVerifier, keys APIKeyStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Authorization") == "" {
 			next.ServeHTTP(w, r)
@@ -108,13 +212,18 @@ func Auth(next http.Handler, secret string) http.Handler {
 		}
 
 		ss := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-		token, err := jwt.ParseWithClaims(ss, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if strings.HasPrefix(ss, store.APIKeyPrefix) {
+			ctx, ok := apiKeyContext(r.Context(), keys, ss)
+			if !ok {
+				Error(w, http.StatusUnauthorized)
+				return
 			}
 
-			return []byte(secret), nil
-		})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		token, err := jwt.ParseWithClaims(ss, &Claims{}, verifier.VerifyKey)
 		if err != nil {
 			Error(w, http.StatusUnauthorized)
 			return
@@ -125,13 +234,16 @@ func Auth(next http.Handler, secret string) http.Handler {
 			return
 		}
 
+		// refresh tokens are signed with the same keys, but are only good for
+		// getting new access tokens from their session
 		claims, ok := token.Claims.(*Claims)
-		if !ok {
+		if !ok || claims.Type != TokenTypeAccess {
 			Error(w, http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), keyRolesContext, claims.Roles)
+		ctx := context.WithValue(r.Context(), keyRoleContext, claims.Role)
+		ctx = context.WithValue(ctx, keyPermissionsContext, claims.Permissions)
 		ctx = context.WithValue(ctx, keySubjectContext, claims.Subject)
 		ctx = context.WithValue(ctx, keyRealmContext, claims.RealmID)
 
@@ -139,19 +251,77 @@ func Auth(next http.Handler, secret string) http.Handler {
 	})
 }
 
-// ACL returns a middleware that must be used inside of an Auth middleware for
-// checking user roles. The SuperOrAdmin requirement will be satisfied by any
-// user who is either a SuperAdmin or a realm Admin.
-func ACL(next http.HandlerFunc, requireSuperOrAdmin, requireVerified, requireLoggedIn bool) http.HandlerFunc {
+// apiKeyContext looks up an API key and returns a context acting on behalf of
+// the user that created it. The key only has the permissions it was created
+// with that the user still has in the key's realm, so demoting a user also
+// limits their keys, and removing them from a realm revokes its keys.
+func apiKeyContext(ctx context.Context, keys APIKeyStore, apiKey string) (context.Context, bool) {
+	key, err := keys.GetAPIKeyByHash(ctx, store.HashAPIKey(apiKey))
+	if err != nil {
+		if !errors.Is(err, store.ErrNoResults{}) {
+			tracing.RecordError(ctx, err)
+		}
+		return nil, false
+	}
+
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, false
+	}
+
+	user, err := keys.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNoResults{}) {
+			tracing.RecordError(ctx, err)
+		}
+		return nil, false
+	}
+
+	role, userPerms := user.Role, user.Permissions
+	if key.RealmID != user.RealmID {
+		membership, err := keys.GetMembership(ctx, user.ID, key.RealmID)
+		if err != nil {
+			if !errors.Is(err, store.ErrNoResults{}) {
+				tracing.RecordError(ctx, err)
+			}
+			return nil, false
+		}
+		role, userPerms = membership.Role, membership.Permissions
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := keys.TouchAPIKey(ctx, key.ID, now); err != nil {
+			tracing.RecordError(ctx, err)
+		}
+	}
+
+	perms := store.Permissions{}
+	for _, perm := range key.Permissions {
+		if userPerms.Has(perm) {
+			perms = append(perms, perm)
+		}
+	}
+
+	ctx = context.WithValue(ctx, keyRoleContext, role)
+	ctx = context.WithValue(ctx, keyPermissionsContext, perms)
+	ctx = context.WithValue(ctx, keySubjectContext, strconv.FormatInt(user.ID, 10))
+	ctx = context.WithValue(ctx, keyRealmContext, key.RealmID)
+	ctx = context.WithValue(ctx, keyAPIKeyContext, key.ID)
+
+	return ctx, true
+}
+
+// Require returns a middleware that must be used inside of an Auth middleware
+// for checking permissions. Users that aren't logged in are rejected, as are
+// users lacking any of the given permissions.
+func Require(next http.HandlerFunc, perms ...store.Permission) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, err := GetSubject(r)
-		if err != nil && requireLoggedIn {
+		if _, err := GetSubject(r); err != nil {
 			Error(w, http.StatusUnauthorized)
 			return
 		}
 
-		roles := GetRoles(r)
-		if (requireSuperOrAdmin && !roles.IsSuperAdmin && !roles.IsAdmin) || (requireVerified && !roles.IsVerified) {
+		if !GetPermissions(r).Contains(perms) {
 			Error(w, http.StatusForbidden)
 			return
 		}
@@ -0,0 +1,177 @@
+// Package metrics defines the Prometheus metrics exported by peregrine on
+// /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "peregrine"
+
+// Registry holds every peregrine metric, along with Go runtime and process
+// metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts HTTP requests by route template, method, and status
+	// code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route template, method, and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration observes HTTP request latency by route template and method.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// TBARequests counts requests to TBA by endpoint and status code. Requests
+	// that fail without a response have the code "error".
+	TBARequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tba",
+		Name:      "requests_total",
+		Help:      "Requests to The Blue Alliance by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	// TBADuration observes TBA request latency by endpoint.
+	TBADuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "tba",
+		Name:      "request_duration_seconds",
+		Help:      "Request latency to The Blue Alliance by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// RefreshDuration observes how long each step of refreshing from TBA takes.
+	RefreshDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "refresh",
+		Name:      "duration_seconds",
+		Help:      "Duration of each step of refreshing data from The Blue Alliance.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"step"})
+
+	// RefreshFailures counts failed refresh steps.
+	RefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "refresh",
+		Name:      "failures_total",
+		Help:      "Failed steps of refreshing data from The Blue Alliance.",
+	}, []string{"step"})
+
+	// ReportsSubmitted counts submitted reports by realm ID.
+	ReportsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reports",
+		Name:      "submitted_total",
+		Help:      "Submitted scouting reports by realm ID.",
+	}, []string{"realm"})
+
+	// ReportLastSubmitted is the unix time of the last submitted report by
+	// realm ID, for alerting when scouting stalls.
+	ReportLastSubmitted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "reports",
+		Name:      "last_submitted_timestamp_seconds",
+		Help:      "Unix time of the last submitted scouting report by realm ID.",
+	}, []string{"realm"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		TBARequests,
+		TBADuration,
+		RefreshDuration,
+		RefreshFailures,
+		ReportsSubmitted,
+		ReportLastSubmitted,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRefresh records the duration of a refresh step that started at start.
+// It is meant to be deferred.
+func ObserveRefresh(step string, start time.Time) {
+	RefreshDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+// ReportSubmitted records a report submission for a realm.
+func ReportSubmitted(realmID *int64) {
+	realm := "none"
+	if realmID != nil {
+		realm = strconv.FormatInt(*realmID, 10)
+	}
+
+	ReportsSubmitted.WithLabelValues(realm).Inc()
+	ReportLastSubmitted.WithLabelValues(realm).SetToCurrentTime()
+}
+
+// RegisterDBStats registers connection pool metrics for a database. stats is
+// called on each scrape.
+func RegisterDBStats(name string, stats func() sql.DBStats) error {
+	c := &dbStatsCollector{stats: stats}
+	for _, stat := range dbStats {
+		fqName := prometheus.BuildFQName(namespace, "db", stat.name)
+		c.descs = append(c.descs, prometheus.NewDesc(fqName, stat.help, nil, prometheus.Labels{"db": name}))
+	}
+
+	return Registry.Register(c)
+}
+
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+	descs []*prometheus.Desc
+}
+
+type dbStat struct {
+	name, help string
+	valueType  prometheus.ValueType
+	value      func(sql.DBStats) float64
+}
+
+var dbStats = []dbStat{
+	{"max_open_connections", "Maximum number of open connections to the database.", prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+	{"open_connections", "Number of established connections to the database.", prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+	{"in_use_connections", "Number of connections currently in use.", prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.InUse) }},
+	{"idle_connections", "Number of idle connections.", prometheus.GaugeValue, func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	{"wait_count_total", "Number of connections waited for.", prometheus.CounterValue, func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+	{"wait_duration_seconds_total", "Time spent waiting for a connection.", prometheus.CounterValue, func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	{"max_idle_closed_total", "Connections closed due to the idle connection limit.", prometheus.CounterValue, func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+	{"max_lifetime_closed_total", "Connections closed due to the maximum connection lifetime.", prometheus.CounterValue, func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+}
+
+// Describe implements prometheus.Collector.
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	for i, stat := range dbStats {
+		ch <- prometheus.MustNewConstMetric(c.descs[i], stat.valueType, stat.value(stats))
+	}
+}
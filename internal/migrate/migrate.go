@@ -0,0 +1,319 @@
+// Package migrate applies the SQL migrations in the migrations directory to a
+// PostgreSQL database. It tracks the schema version in the same
+// schema_migrations table as golang-migrate, so databases migrated with either
+// tool can be managed by the other.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate go run ../cmd/pack/pack.go -package migrate -in ../../migrations -out files.go -name files
+var files map[string][]byte
+
+// ErrNotEmbedded is returned by Embedded if the binary was built without
+// running go generate.
+var ErrNotEmbedded = errors.New("no migrations are embedded, run go generate")
+
+// ErrDirty is returned when a previous migration failed part way through. The
+// database must be fixed by hand before migrating again.
+var ErrDirty = errors.New("database schema is dirty")
+
+// ErrNoChange is returned by Down if no migrations have been applied.
+var ErrNoChange = errors.New("no migrations to roll back")
+
+// lockID identifies the advisory lock held while migrating.
+const lockID = 5347201973
+
+const pgUndefinedTable = "42P01"
+
+// Migration is a single versioned change to the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load parses migrations from a map of file names to contents. Files must be
+// named like 1_create_table.up.sql and 1_create_table.down.sql. The migrations
+// are returned sorted by version.
+func Load(files map[string][]byte) ([]Migration, error) {
+	byVersion := make(map[int]*Migration)
+
+	for name, contents := range files {
+		match := fileName.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", name, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.Name = match[2]
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up migration", m.Version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Embedded returns the migrations embedded in the binary.
+func Embedded() ([]Migration, error) {
+	if len(files) == 0 {
+		return nil, ErrNotEmbedded
+	}
+
+	return Load(files)
+}
+
+// Status describes the schema version of a database.
+type Status struct {
+	// Version is the version of the last applied migration, or nil if no
+	// migrations have been applied.
+	Version *int
+	// Latest is the version of the newest known migration.
+	Latest int
+	// Dirty is whether the last migration failed part way through.
+	Dirty bool
+	// Pending is the number of migrations that have not been applied.
+	Pending int
+}
+
+// Current returns whether every migration has been applied successfully, and
+// no newer migrations than the known ones have been applied.
+func (s Status) Current() bool {
+	return s.Pending == 0 && !s.Dirty && (s.Version == nil || *s.Version <= s.Latest)
+}
+
+// Migrator applies migrations to a PostgreSQL database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *logrus.Logger
+}
+
+// Open creates a new migrator for the given migrations from a dataSourceName.
+func Open(dsn string, migrations []Migration, logger *logrus.Logger) (*Migrator, error) {
+	if len(migrations) == 0 {
+		return nil, errors.New("no migrations given")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// Close closes the underlying database connection.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func readVersion(ctx context.Context, q querier) (version *int, dirty bool, err error) {
+	err = q.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUndefinedTable {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("unable to read schema version: %w", err)
+	}
+
+	return version, dirty, nil
+}
+
+func setVersion(ctx context.Context, conn *sql.Conn, version *int, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("unable to clear schema version: %w", err)
+	}
+
+	if version != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", *version, dirty); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("unable to set schema version: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) status(version *int, dirty bool) Status {
+	s := Status{
+		Version: version,
+		Latest:  m.migrations[len(m.migrations)-1].Version,
+		Dirty:   dirty,
+	}
+
+	for _, migration := range m.migrations {
+		if version == nil || migration.Version > *version {
+			s.Pending++
+		}
+	}
+
+	return s
+}
+
+// Status returns the schema version of the database.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	version, dirty, err := readVersion(ctx, m.db)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return m.status(version, dirty), nil
+}
+
+// withLock calls f with a connection holding the migration advisory lock, so
+// only one process can migrate the database at a time.
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			m.logger.WithError(err).Error("unable to release migration lock")
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+		return fmt.Errorf("unable to create schema_migrations table: %w", err)
+	}
+
+	return f(conn)
+}
+
+// Up applies every pending migration, returning how many were applied.
+func (m *Migrator) Up(ctx context.Context) (applied int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, *version)
+		}
+
+		for _, migration := range m.migrations {
+			if version != nil && migration.Version <= *version {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration.Version, migration.Up, &migration.Version); err != nil {
+				return fmt.Errorf("unable to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			m.logger.WithField("version", migration.Version).WithField("name", migration.Name).Info("applied migration")
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if version == nil {
+			return ErrNoChange
+		}
+
+		if dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, *version)
+		}
+
+		var previous *int
+		for i, migration := range m.migrations {
+			if migration.Version != *version {
+				continue
+			}
+
+			if i > 0 {
+				previous = &m.migrations[i-1].Version
+			}
+
+			if err := m.apply(ctx, conn, migration.Version, migration.Down, previous); err != nil {
+				return fmt.Errorf("unable to roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			m.logger.WithField("version", migration.Version).WithField("name", migration.Name).Info("rolled back migration")
+			return nil
+		}
+
+		return fmt.Errorf("unknown schema version %d", *version)
+	})
+}
+
+// apply runs a migration script, marking the schema as dirty at the given
+// version until the script succeeds and the version is set to newVersion.
+// Scripts are not run in a transaction since some of them manage their own.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, version int, script string, newVersion *int) error {
+	if err := setVersion(ctx, conn, &version, true); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	return setVersion(ctx, conn, newVersion, false)
+}
@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name               string
+		files              map[string][]byte
+		expectedMigrations []Migration
+		expectError        bool
+	}{
+		{
+			name: "sorts by version and pairs up and down",
+			files: map[string][]byte{
+				"10_add_stars.up.sql":       []byte("CREATE TABLE stars ();"),
+				"10_add_stars.down.sql":     []byte("DROP TABLE stars;"),
+				"2_create_matches.up.sql":   []byte("CREATE TABLE matches ();"),
+				"20_add_column.up.sql":      []byte("ALTER TABLE a ADD COLUMN b INT;"),
+				"20_drop_column.down.sql":   []byte("ALTER TABLE a DROP COLUMN b;"),
+				"2_create_matches.down.sql": []byte("DROP TABLE matches;"),
+				"README.md":                 []byte("not a migration"),
+			},
+			expectedMigrations: []Migration{
+				{Version: 2, Name: "create_matches", Up: "CREATE TABLE matches ();", Down: "DROP TABLE matches;"},
+				{Version: 10, Name: "add_stars", Up: "CREATE TABLE stars ();", Down: "DROP TABLE stars;"},
+				{Version: 20, Name: "add_column", Up: "ALTER TABLE a ADD COLUMN b INT;", Down: "ALTER TABLE a DROP COLUMN b;"},
+			},
+		},
+		{
+			name: "down without up",
+			files: map[string][]byte{
+				"1_create_events.down.sql": []byte("DROP TABLE events;"),
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but didn't get one")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("did not expect error but got: %v", err)
+			}
+
+			if !cmp.Equal(migrations, tt.expectedMigrations) {
+				t.Errorf("expected migrations to match, but got diff: %s", cmp.Diff(tt.expectedMigrations, migrations))
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	m := &Migrator{migrations: []Migration{{Version: 0}, {Version: 1}, {Version: 3}}}
+
+	zero, one, three, four := 0, 1, 3, 4
+
+	testCases := []struct {
+		name            string
+		version         *int
+		dirty           bool
+		expectedStatus  Status
+		expectedCurrent bool
+	}{
+		{
+			name:            "no migrations applied",
+			expectedStatus:  Status{Latest: 3, Pending: 3},
+			expectedCurrent: false,
+		},
+		{
+			name:            "first migration applied",
+			version:         &zero,
+			expectedStatus:  Status{Version: &zero, Latest: 3, Pending: 2},
+			expectedCurrent: false,
+		},
+		{
+			name:            "dirty",
+			version:         &three,
+			dirty:           true,
+			expectedStatus:  Status{Version: &three, Latest: 3, Dirty: true},
+			expectedCurrent: false,
+		},
+		{
+			name:            "current",
+			version:         &three,
+			expectedStatus:  Status{Version: &three, Latest: 3},
+			expectedCurrent: true,
+		},
+		{
+			name:            "between versions",
+			version:         &one,
+			expectedStatus:  Status{Version: &one, Latest: 3, Pending: 1},
+			expectedCurrent: false,
+		},
+		{
+			name:            "newer than binary",
+			version:         &four,
+			expectedStatus:  Status{Version: &four, Latest: 3},
+			expectedCurrent: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			status := m.status(tt.version, tt.dirty)
+
+			if !cmp.Equal(status, tt.expectedStatus) {
+				t.Errorf("expected status to match, but got diff: %s", cmp.Diff(tt.expectedStatus, status))
+			}
+
+			if status.Current() != tt.expectedCurrent {
+				t.Errorf("expected current to be %t", tt.expectedCurrent)
+			}
+		})
+	}
+}
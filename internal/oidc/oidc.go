@@ -0,0 +1,337 @@
+// Package oidc logs users in with an OpenID Connect provider using the
+// authorization code flow. Only providers that sign ID tokens with RSA keys,
+// like Google, are supported.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ErrInvalidToken is returned if the provider's ID token fails verification.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Identity is a user as identified by the provider. Issuer and subject
+// together uniquely identify a user.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+// Provider is an OpenID Connect provider. The provider's configuration and
+// signing keys are fetched the first time they're needed, and the keys are
+// fetched again when a token is signed with an unknown key.
+type Provider struct {
+	config config.OIDC
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New creates a provider from its config.
+func New(c config.OIDC) *Provider {
+	return &Provider{
+		config: c,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// SignUpRealm returns the realm a user logging in for the first time should
+// be created in, or false if they shouldn't be created.
+func (p *Provider) SignUpRealm(identity Identity) (int64, bool) {
+	if p.config.RealmID == 0 {
+		return 0, false
+	}
+
+	if len(p.config.AllowedDomains) == 0 {
+		return p.config.RealmID, true
+	}
+
+	at := strings.LastIndex(identity.Email, "@")
+	if !identity.EmailVerified || at == -1 {
+		return 0, false
+	}
+
+	domain := identity.Email[at+1:]
+	for _, allowed := range p.config.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return p.config.RealmID, true
+		}
+	}
+
+	return 0, false
+}
+
+// AuthURL returns the provider URL to send a user to for logging in. The
+// state is passed back to the redirect URL, and the nonce is embedded in the
+// ID token.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse authorization endpoint: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange exchanges an authorization code for an ID token, verifies it was
+// issued for this client with the given nonce, and returns its identity.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (Identity, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, fmt.Errorf("unable to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req.WithContext(ctx), &token); err != nil {
+		return Identity{}, fmt.Errorf("unable to exchange code: %w", err)
+	}
+
+	return p.verify(ctx, d, token.IDToken, nonce)
+}
+
+// audience is the aud claim, which may be a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(aud string) bool {
+	for _, have := range a {
+		if have == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Valid checks that the token hasn't expired.
+func (c *idTokenClaims) Valid() error {
+	if jwt.TimeFunc().Unix() >= c.ExpiresAt {
+		return errors.New("token is expired")
+	}
+
+	return nil
+}
+
+func (p *Provider) verify(ctx context.Context, d *discovery, idToken, nonce string) (Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, d, kid)
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Issuer != d.Issuer {
+		return Identity{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+
+	if !claims.Audience.contains(p.config.ClientID) {
+		return Identity{}, fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	}
+
+	if claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return Identity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		GivenName:         claims.GivenName,
+		FamilyName:        claims.FamilyName,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create discovery request: %w", err)
+	}
+
+	var d discovery
+	if err := p.do(req.WithContext(ctx), &d); err != nil {
+		return nil, fmt.Errorf("unable to discover provider configuration: %w", err)
+	}
+
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match configured issuer %q", d.Issuer, p.config.Issuer)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// getKey returns the provider's signing key with the given ID, fetching the
+// provider's keys again if it isn't known, since providers rotate keys.
+func (p *Provider) getKey(ctx context.Context, d *discovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create keys request: %w", err)
+	}
+
+	var set jwks
+	if err := p.do(req.WithContext(ctx), &set); err != nil {
+		return nil, fmt.Errorf("unable to get provider keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode modulus of key %q: %w", k.Kid, err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode exponent of key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d from %s", resp.StatusCode, req.URL)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
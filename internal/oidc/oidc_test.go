@@ -0,0 +1,236 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+// mockProvider is a minimal OpenID Connect provider that issues an ID token
+// with the given claims for the code "good-code".
+type mockProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	kid    string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("did not expect error %v generating key", err)
+	}
+
+	p := &mockProvider{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("client_secret") != "shh" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims)
+		token.Header["kid"] = p.kid
+		idToken, err := token.SignedString(p.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func TestExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.Close()
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            mock.URL,
+			"sub":            "1234",
+			"aud":            []string{"peregrine"},
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          "nonce",
+			"email":          "ada@pigmice.example",
+			"email_verified": true,
+			"given_name":     "Ada",
+			"family_name":    "Lovelace",
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		code             string
+		kid              string
+		modify           func(jwt.MapClaims)
+		expectedIdentity Identity
+		expectError      bool
+		expectInvalid    bool
+	}{
+		{
+			name: "valid token",
+			code: "good-code",
+			expectedIdentity: Identity{
+				Issuer:        mock.URL,
+				Subject:       "1234",
+				Email:         "ada@pigmice.example",
+				EmailVerified: true,
+				GivenName:     "Ada",
+				FamilyName:    "Lovelace",
+			},
+		},
+		{
+			name:   "single audience",
+			code:   "good-code",
+			modify: func(c jwt.MapClaims) { c["aud"] = "peregrine" },
+			expectedIdentity: Identity{
+				Issuer:        mock.URL,
+				Subject:       "1234",
+				Email:         "ada@pigmice.example",
+				EmailVerified: true,
+				GivenName:     "Ada",
+				FamilyName:    "Lovelace",
+			},
+		},
+		{name: "bad code", code: "bad-code", expectError: true},
+		{name: "wrong nonce", code: "good-code", modify: func(c jwt.MapClaims) { c["nonce"] = "other" }, expectError: true, expectInvalid: true},
+		{name: "wrong audience", code: "good-code", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }, expectError: true, expectInvalid: true},
+		{name: "wrong issuer", code: "good-code", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, expectError: true, expectInvalid: true},
+		{name: "expired", code: "good-code", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, expectError: true, expectInvalid: true},
+		{name: "unknown key", code: "good-code", kid: "key-2", expectError: true, expectInvalid: true},
+	}
+
+	p := New(config.OIDC{Issuer: mock.URL, ClientID: "peregrine", ClientSecret: "shh", RedirectURL: "http://localhost:3000/login"})
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.claims = validClaims()
+			if tt.modify != nil {
+				tt.modify(mock.claims)
+			}
+
+			mock.kid = "key-1"
+			if tt.kid != "" {
+				mock.kid = tt.kid
+			}
+
+			identity, err := p.Exchange(context.Background(), tt.code, "nonce")
+			if tt.expectError != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+
+			if tt.expectInvalid != errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected invalid token error %v, got %v", tt.expectInvalid, err)
+			}
+
+			if !cmp.Equal(tt.expectedIdentity, identity) {
+				t.Errorf("expected identities to be equal, but got diff: %s", cmp.Diff(tt.expectedIdentity, identity))
+			}
+		})
+	}
+}
+
+func TestAuthURL(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.Close()
+
+	p := New(config.OIDC{Issuer: mock.URL, ClientID: "peregrine", RedirectURL: "http://localhost:3000/login"})
+
+	authURL, err := p.AuthURL(context.Background(), "state", "nonce")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting auth URL", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("did not expect error %v parsing auth URL", err)
+	}
+
+	expected := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"peregrine"},
+		"redirect_uri":  {"http://localhost:3000/login"},
+		"scope":         {"openid email profile"},
+		"state":         {"state"},
+		"nonce":         {"nonce"},
+	}
+
+	if u.Path != "/authorize" || !cmp.Equal(expected, u.Query()) {
+		t.Errorf("expected auth URL to match, got %s", authURL)
+	}
+}
+
+func TestSignUpRealm(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        config.OIDC
+		identity      Identity
+		expectedRealm int64
+		expectedOK    bool
+	}{
+		{name: "sign up disabled", identity: Identity{Email: "ada@pigmice.example", EmailVerified: true}},
+		{name: "any domain", config: config.OIDC{RealmID: 2}, identity: Identity{}, expectedRealm: 2, expectedOK: true},
+		{
+			name:          "allowed domain",
+			config:        config.OIDC{RealmID: 2, AllowedDomains: []string{"pigmice.example"}},
+			identity:      Identity{Email: "ada@Pigmice.example", EmailVerified: true},
+			expectedRealm: 2,
+			expectedOK:    true,
+		},
+		{
+			name:     "unverified email",
+			config:   config.OIDC{RealmID: 2, AllowedDomains: []string{"pigmice.example"}},
+			identity: Identity{Email: "ada@pigmice.example"},
+		},
+		{
+			name:     "other domain",
+			config:   config.OIDC{RealmID: 2, AllowedDomains: []string{"pigmice.example"}},
+			identity: Identity{Email: "ada@evil.example", EmailVerified: true},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			realm, ok := New(tt.config).SignUpRealm(tt.identity)
+			if realm != tt.expectedRealm || ok != tt.expectedOK {
+				t.Errorf("expected realm %d and ok %v, got %d and %v", tt.expectedRealm, tt.expectedOK, realm, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package refresh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
+)
+
+// Import fetches a single event from TBA along with its matches and rankings
+// and stores them. Unlike Run, it works for events from any year.
+func (s *Service) Import(ctx context.Context, eventKey string) (err error) {
+	ctx, span := tracing.Start(ctx, "refresh.import")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := s.TBA.GetEvent(ctx, eventKey)
+	if err != nil {
+		return fmt.Errorf("unable to get event from TBA: %w", err)
+	}
+
+	matches, err := s.TBA.GetMatches(ctx, eventKey)
+	if err != nil {
+		return fmt.Errorf("unable to get matches from TBA: %w", err)
+	}
+
+	rankings, err := s.TBA.GetTeamRankings(ctx, eventKey)
+	if err != nil {
+		return fmt.Errorf("unable to get rankings from TBA: %w", err)
+	}
+
+	if err := s.Store.EventsUpsert(ctx, []store.Event{event}); err != nil {
+		return fmt.Errorf("unable to upsert event: %w", err)
+	}
+
+	if err := s.Store.UpdateTBAMatches(ctx, matches); err != nil {
+		return fmt.Errorf("unable to upsert matches: %w", err)
+	}
+
+	if err := s.Store.MarkMatchesDeleted(ctx, eventKey, matches); err != nil {
+		return fmt.Errorf("unable to mark deleted matches: %w", err)
+	}
+
+	if err := s.Store.EventTeamsUpsert(ctx, rankings); err != nil {
+		return fmt.Errorf("unable to upsert rankings: %w", err)
+	}
+
+	s.Logger.WithField("eventKey", eventKey).
+		WithField("matches", len(matches)).
+		WithField("rankings", len(rankings)).
+		Info("imported event")
+
+	return nil
+}
@@ -5,19 +5,31 @@ package refresh
 import (
 	"context"
 	"errors"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/Pigmice2733/peregrine-backend/internal/tba"
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
 	"github.com/sirupsen/logrus"
 )
 
 // Service updates the store by polling TBA for the current year.
 type Service struct {
 	TBA    *tba.Service
-	Store  *store.Service
+	Store  store.Store
 	Logger *logrus.Logger
 	Year   int
+	Config config.Refresh
+
+	mu       sync.Mutex
+	manual   chan string
+	changed  chan struct{}
+	schedule []eventDates
+	status   statusTracker
 }
 
 type eventMatches struct {
@@ -25,25 +37,37 @@ type eventMatches struct {
 	Matches  []store.Match
 }
 
+type eventRankings struct {
+	EventKey string
+	Rankings []store.EventTeam
+}
+
 // Run starts the TBA updater service that will:
 // * Update all events for the configured year, including matches, and rankings, every 15 minutes.
-// * Update all teams every day.
-// * Update all active event matches and rankings every 15 seconds.
+// * Update all teams every day, including robot names for new or changed teams attending events this year.
+// * Update all active event matches and rankings every 30 seconds.
+// * Update matches and rankings for events passed to Refresh immediately.
+// Outside of event weeks the idle intervals are used instead, which default to
+// every 6 hours, every week, and every 5 minutes respectively. The intervals
+// can be changed with Config and SetConfig.
 func (s *Service) Run(ctx context.Context) {
-	const (
-		eventsInterval = time.Minute * 15
-		activeInterval = time.Second * 30
-		teamsInterval  = time.Hour * 24
-	)
-
 	events := make(chan []store.Event)
 	storeEvents := make(chan []store.Event)
 	matchEvents := make(chan string)
 	rankingEvents := make(chan string)
 	activeEvents := make(chan string)
+	manualEvents := make(chan string)
+
+	s.mu.Lock()
+	s.manual = manualEvents
+	s.mu.Unlock()
 
 	go func() {
 		defer func() {
+			s.mu.Lock()
+			s.manual = nil
+			s.mu.Unlock()
+
 			close(storeEvents)
 			close(matchEvents)
 			close(rankingEvents)
@@ -54,6 +78,9 @@ func (s *Service) Run(ctx context.Context) {
 			case event := <-activeEvents:
 				matchEvents <- event
 				rankingEvents <- event
+			case event := <-manualEvents:
+				matchEvents <- event
+				rankingEvents <- event
 			case eventGroup := <-events:
 				storeEvents <- eventGroup
 				for _, event := range eventGroup {
@@ -66,77 +93,77 @@ func (s *Service) Run(ctx context.Context) {
 		}
 	}()
 
-	go s.fetchEvents(ctx, eventsInterval, events)
+	go s.fetchEvents(ctx, events)
 	go s.storeEvents(ctx, storeEvents)
-	go s.seedActiveEvents(ctx, activeInterval, activeEvents)
+	go s.seedActiveEvents(ctx, activeEvents)
 
 	teams := make(chan []store.Team)
-	go s.fetchTeams(ctx, teamsInterval, teams)
+	changedTeams := make(chan []string)
+	go s.fetchTeams(ctx, teams, changedTeams)
 	go s.storeTeams(ctx, teams)
 
+	robots := make(chan []store.Robot)
+	go s.fetchRobots(ctx, changedTeams, robots)
+	go s.storeRobots(ctx, robots)
+
 	matches := make(chan eventMatches)
 	go s.fetchMatches(ctx, matchEvents, matches)
 	go s.storeMatches(ctx, matches)
 
-	rankings := make(chan []store.EventTeam)
+	rankings := make(chan eventRankings)
 	go s.fetchRankings(ctx, rankingEvents, rankings)
 	s.storeRankings(ctx, rankings)
 }
 
-func (s *Service) fetchEvents(ctx context.Context, interval time.Duration, events chan<- []store.Event) {
-	const timeout = time.Second * 20
-
-	eventsTicker := time.NewTicker(interval)
-
+func (s *Service) fetchEvents(ctx context.Context, events chan<- []store.Event) {
 	defer func() {
-		eventsTicker.Stop()
 		close(events)
 	}()
 
 	getEvents := func() {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "fetch_events")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout()*2)
 		defer cancel()
 
 		tbaEvents, err := s.TBA.GetEvents(timeoutContext, s.Year)
 		if errors.Is(err, tba.ErrNotModified{}) {
 			return
 		} else if err != nil {
+			stepFailed(ctx, "fetch_events", err)
 			s.Logger.WithError(err).Errorf("unable get events from TBA for year %d", s.Year)
 			return
 		}
 
+		s.setSchedule(tbaEvents)
+
 		events <- tbaEvents
 
 		s.Logger.WithField("year", s.Year).WithField("count", len(tbaEvents)).Info("sent year events")
 	}
 
 	getEvents()
-	for {
-		select {
-		case <-eventsTicker.C:
-			getEvents()
-		case <-ctx.Done():
-			return
-		}
+	for s.sleep(ctx, eventsInterval) {
+		getEvents()
 	}
 }
 
-func (s *Service) seedActiveEvents(ctx context.Context, interval time.Duration, events chan<- string) {
-	const timeout = time.Second * 10
-
-	activeTicker := time.NewTicker(interval)
-
+func (s *Service) seedActiveEvents(ctx context.Context, events chan<- string) {
 	defer func() {
-		activeTicker.Stop()
 		close(events)
 	}()
 
 	getEvents := func() {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "seed_active_events")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		activeEvents, err := s.Store.GetActiveEvents(timeoutContext)
 		if err != nil {
+			stepFailed(ctx, "seed_active_events", err)
 			s.Logger.WithError(err).Errorf("unable get active events %d", s.Year)
 			return
 		}
@@ -149,25 +176,22 @@ func (s *Service) seedActiveEvents(ctx context.Context, interval time.Duration,
 	}
 
 	getEvents()
-	for {
-		select {
-		case <-activeTicker.C:
-			getEvents()
-		case <-ctx.Done():
-			return
-		}
+	for s.sleep(ctx, activeInterval) {
+		getEvents()
 	}
 }
 
 func (s *Service) storeEvents(ctx context.Context, events <-chan []store.Event) {
-	const timeout = time.Second * 10
-
 	upsertEvents := func(eventGroup []store.Event) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "store_events")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		err := s.Store.EventsUpsert(timeoutContext, eventGroup)
 		if err != nil {
+			stepFailed(ctx, "store_events", err)
 			s.Logger.WithError(err).Errorf("unable to upsert events")
 			return
 		}
@@ -180,53 +204,75 @@ func (s *Service) storeEvents(ctx context.Context, events <-chan []store.Event)
 	}
 }
 
-func (s *Service) fetchTeams(ctx context.Context, interval time.Duration, teams chan<- []store.Team) {
-	const timeout = time.Second * 20
-
-	teamsTicker := time.NewTicker(interval)
-
+// fetchTeams fetches all teams from TBA, and after each fetch sends the keys
+// of teams that are new or changed since the last one to changedTeams.
+func (s *Service) fetchTeams(ctx context.Context, teams chan<- []store.Team, changedTeams chan<- []string) {
 	defer func() {
-		teamsTicker.Stop()
 		close(teams)
+		close(changedTeams)
 	}()
 
+	known := make(map[string]store.Team)
+
 	getTeams := func() {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		var changed []string
+		defer func() {
+			changedTeams <- changed
+		}()
+
+		ctx, end := startStep(ctx, "fetch_teams")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout()*2)
 		defer cancel()
 
 		tbaTeams, err := s.TBA.GetTeams(timeoutContext)
 		if errors.Is(err, tba.ErrNotModified{}) {
 			return
 		} else if err != nil {
+			stepFailed(ctx, "fetch_teams", err)
 			s.Logger.WithError(err).Errorf("unable get teams from TBA")
 			return
 		}
 
+		changed = changedTeamKeys(known, tbaTeams)
+
 		s.Logger.WithField("count", len(tbaTeams)).Info("sent teams")
 
 		teams <- tbaTeams
 	}
 
 	getTeams()
-	for {
-		select {
-		case <-teamsTicker.C:
-			getTeams()
-		case <-ctx.Done():
-			return
+	for s.sleep(ctx, teamsInterval) {
+		getTeams()
+	}
+}
+
+// changedTeamKeys returns the keys of teams that aren't in known or differ from
+// the team there, and adds them to known.
+func changedTeamKeys(known map[string]store.Team, teams []store.Team) []string {
+	var changed []string
+	for _, team := range teams {
+		if old, ok := known[team.Key]; !ok || !reflect.DeepEqual(old, team) {
+			changed = append(changed, team.Key)
+			known[team.Key] = team
 		}
 	}
+
+	return changed
 }
 
 func (s *Service) storeTeams(ctx context.Context, teams <-chan []store.Team) {
-	const timeout = time.Second * 10
-
 	upsertTeams := func(teamsGroup []store.Team) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "store_teams")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		err := s.Store.TeamsUpsert(timeoutContext, teamsGroup)
 		if err != nil {
+			stepFailed(ctx, "store_teams", err)
 			s.Logger.WithError(err).Errorf("unable to upsert teams")
 			return
 		}
@@ -239,21 +285,113 @@ func (s *Service) storeTeams(ctx context.Context, teams <-chan []store.Team) {
 	}
 }
 
-func (s *Service) fetchMatches(ctx context.Context, events <-chan string, matches chan<- eventMatches) {
-	const timeout = time.Second * 10
+// fetchRobots fetches the robots of teams attending events this year each time
+// fetchTeams finishes, for teams whose robots haven't been fetched yet or that
+// fetchTeams found changed.
+func (s *Service) fetchRobots(ctx context.Context, changedTeams <-chan []string, robots chan<- []store.Robot) {
+	defer func() {
+		close(robots)
+	}()
+
+	fetched := make(map[string]bool)
+
+	getRobots := func(changed []string) {
+		ctx, end := startStep(ctx, "fetch_robots")
+		defer end()
+
+		keysContext, cancel := context.WithTimeout(ctx, s.timeout())
+		defer cancel()
+
+		teamKeys, err := s.Store.GetYearTeamKeys(keysContext, s.Year)
+		if err != nil {
+			stepFailed(ctx, "fetch_robots", err)
+			s.Logger.WithError(err).Errorf("unable to get team keys for year %d", s.Year)
+			return
+		}
+
+		for _, teamKey := range changed {
+			delete(fetched, teamKey)
+		}
+
+		var yearRobots []store.Robot
+		for _, teamKey := range teamKeys {
+			if fetched[teamKey] {
+				continue
+			}
+
+			timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
+			teamRobots, err := s.TBA.GetRobots(timeoutContext, teamKey)
+			cancel()
+
+			if errors.Is(err, tba.ErrNotModified{}) {
+				fetched[teamKey] = true
+				continue
+			} else if err != nil {
+				stepFailed(ctx, "fetch_robots", err)
+				s.Logger.WithError(err).Errorf("unable get robots from TBA for team %q", teamKey)
+				continue
+			}
+
+			fetched[teamKey] = true
+			yearRobots = append(yearRobots, teamRobots...)
+		}
+
+		if len(yearRobots) == 0 {
+			return
+		}
+
+		robots <- yearRobots
+
+		s.Logger.WithField("count", len(yearRobots)).Info("sent robots")
+	}
+
+	for changed := range changedTeams {
+		getRobots(changed)
+	}
+}
+
+func (s *Service) storeRobots(ctx context.Context, robots <-chan []store.Robot) {
+	upsertRobots := func(robotsGroup []store.Robot) {
+		ctx, end := startStep(ctx, "store_robots")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
+		defer cancel()
 
+		err := s.Store.RobotsUpsert(timeoutContext, robotsGroup)
+		if err != nil {
+			stepFailed(ctx, "store_robots", err)
+			s.Logger.WithError(err).Errorf("unable to upsert robots")
+			return
+		}
+
+		s.Logger.WithField("count", len(robotsGroup)).Info("stored robots")
+	}
+
+	for robotsGroup := range robots {
+		upsertRobots(robotsGroup)
+	}
+}
+
+func (s *Service) fetchMatches(ctx context.Context, events <-chan string, matches chan<- eventMatches) {
 	defer func() {
 		close(matches)
 	}()
 
 	getMatches := func(eventKey string) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "fetch_matches")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		tbaMatches, err := s.TBA.GetMatches(timeoutContext, eventKey)
 		if errors.Is(err, tba.ErrNotModified{}) {
+			s.status.success(eventKey, time.Now(), nil)
 			return
 		} else if err != nil {
+			s.status.failure(eventKey, time.Now(), err)
+			stepFailed(ctx, "fetch_matches", err)
 			s.Logger.WithError(err).Errorf("unable get matches from TBA for event %q", eventKey)
 			return
 		}
@@ -272,24 +410,33 @@ func (s *Service) fetchMatches(ctx context.Context, events <-chan string, matche
 }
 
 func (s *Service) storeMatches(ctx context.Context, matches <-chan eventMatches) {
-	const timeout = time.Second * 10
-
 	updateMatches := func(m eventMatches) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "store_matches")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		err := s.Store.UpdateTBAMatches(timeoutContext, m.Matches)
 		if err != nil {
+			s.status.failure(m.EventKey, time.Now(), err)
+			stepFailed(ctx, "store_matches", err)
 			s.Logger.WithError(err).Errorf("unable to upsert matches")
 			return
 		}
 
 		err = s.Store.MarkMatchesDeleted(ctx, m.EventKey, m.Matches)
 		if err != nil {
+			s.status.failure(m.EventKey, time.Now(), err)
+			stepFailed(ctx, "store_matches", err)
 			s.Logger.WithError(err).Errorf("unable to mark matches deleted matches")
 			return
 		}
 
+		s.status.success(m.EventKey, time.Now(), func(status *EventStatus) {
+			status.MatchCount = len(m.Matches)
+		})
+
 		s.Logger.WithField("count", len(m.Matches)).Info("stored matches")
 	}
 
@@ -298,26 +445,33 @@ func (s *Service) storeMatches(ctx context.Context, matches <-chan eventMatches)
 	}
 }
 
-func (s *Service) fetchRankings(ctx context.Context, eventKeys <-chan string, rankings chan<- []store.EventTeam) {
-	const timeout = time.Second * 10
-
+func (s *Service) fetchRankings(ctx context.Context, eventKeys <-chan string, rankings chan<- eventRankings) {
 	defer func() {
 		close(rankings)
 	}()
 
 	getRankings := func(eventKey string) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		ctx, end := startStep(ctx, "fetch_rankings")
+		defer end()
+
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
 		tbaRankings, err := s.TBA.GetTeamRankings(timeoutContext, eventKey)
 		if errors.Is(err, tba.ErrNotModified{}) {
+			s.status.success(eventKey, time.Now(), nil)
 			return
 		} else if err != nil {
+			s.status.failure(eventKey, time.Now(), err)
+			stepFailed(ctx, "fetch_rankings", err)
 			s.Logger.WithError(err).Errorf("unable get rankings from TBA for event %q", eventKey)
 			return
 		}
 
-		rankings <- tbaRankings
+		rankings <- eventRankings{
+			EventKey: eventKey,
+			Rankings: tbaRankings,
+		}
 
 		s.Logger.WithField("count", len(tbaRankings)).Info("sent rankings")
 	}
@@ -327,23 +481,48 @@ func (s *Service) fetchRankings(ctx context.Context, eventKeys <-chan string, ra
 	}
 }
 
-func (s *Service) storeRankings(ctx context.Context, rankings <-chan []store.EventTeam) {
-	const timeout = time.Second * 10
+func (s *Service) storeRankings(ctx context.Context, rankings <-chan eventRankings) {
+	storeRankings := func(rankingGroup eventRankings) {
+		ctx, end := startStep(ctx, "store_rankings")
+		defer end()
 
-	storeRankings := func(rankingGroup []store.EventTeam) {
-		timeoutContext, cancel := context.WithTimeout(ctx, timeout)
+		timeoutContext, cancel := context.WithTimeout(ctx, s.timeout())
 		defer cancel()
 
-		err := s.Store.EventTeamsUpsert(timeoutContext, rankingGroup)
+		err := s.Store.EventTeamsUpsert(timeoutContext, rankingGroup.Rankings)
 		if err != nil {
+			s.status.failure(rankingGroup.EventKey, time.Now(), err)
+			stepFailed(ctx, "store_rankings", err)
 			s.Logger.WithError(err).Errorf("unable to upsert rankings")
 			return
 		}
 
-		s.Logger.WithField("count", len(rankingGroup)).Info("stored rankings")
+		s.status.success(rankingGroup.EventKey, time.Now(), func(status *EventStatus) {
+			status.RankingCount = len(rankingGroup.Rankings)
+		})
+
+		s.Logger.WithField("count", len(rankingGroup.Rankings)).Info("stored rankings")
 	}
 
 	for rankingGroup := range rankings {
 		storeRankings(rankingGroup)
 	}
 }
+
+// startStep starts a span for one run of a refresh step. The returned function
+// ends the span and records the step's duration, and is meant to be deferred.
+func startStep(ctx context.Context, step string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "refresh."+step)
+
+	return ctx, func() {
+		metrics.ObserveRefresh(step, start)
+		span.End()
+	}
+}
+
+// stepFailed records a failure of a refresh step on its span and in metrics.
+func stepFailed(ctx context.Context, step string, err error) {
+	metrics.RefreshFailures.WithLabelValues(step).Inc()
+	tracing.RecordError(ctx, err)
+}
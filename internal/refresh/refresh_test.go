@@ -0,0 +1,115 @@
+package refresh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetConfig(t *testing.T) {
+	s := &Service{Config: config.Refresh{Idle: config.Intervals{Teams: config.Duration(time.Hour)}}}
+
+	done := make(chan bool)
+	go func() {
+		done <- s.sleep(context.Background(), teamsInterval)
+	}()
+
+	// Wait for the sleep to start before shortening the interval.
+	time.Sleep(time.Millisecond * 10)
+	s.SetConfig(config.Refresh{Idle: config.Intervals{Teams: config.Duration(time.Millisecond)}})
+
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Errorf("expected sleep to finish after config changed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected sleep to restart with the new interval")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s.sleep(ctx, eventsInterval) {
+		t.Errorf("expected sleep to return false for a done context")
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	now := time.Now()
+
+	s := &Service{Config: config.Refresh{
+		Intervals: config.Intervals{Active: config.Duration(time.Second * 5)},
+		Idle:      config.Intervals{Teams: config.Duration(time.Hour * 48)},
+	}}
+
+	idle := config.Intervals{
+		Events: config.Duration(time.Hour * 6),
+		Active: config.Duration(time.Minute * 5),
+		Teams:  config.Duration(time.Hour * 48),
+	}
+	eventWeek := config.Intervals{
+		Events: config.Duration(time.Minute * 15),
+		Active: config.Duration(time.Second * 5),
+		Teams:  config.Duration(time.Hour * 24),
+	}
+
+	testCases := []struct {
+		name     string
+		events   []store.Event
+		expected config.Intervals
+	}{
+		{name: "no events", expected: idle},
+		{
+			name:     "event next month",
+			events:   []store.Event{{StartDate: now.AddDate(0, 1, 0), EndDate: now.AddDate(0, 1, 2)}},
+			expected: idle,
+		},
+		{
+			name:     "event in two days",
+			events:   []store.Event{{StartDate: now.AddDate(0, 0, 2), EndDate: now.AddDate(0, 0, 4)}},
+			expected: eventWeek,
+		},
+		{
+			name:     "event ended yesterday",
+			events:   []store.Event{{StartDate: now.AddDate(0, 0, -3), EndDate: now.Add(-time.Hour * 12)}},
+			expected: eventWeek,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			s.setSchedule(tt.events)
+
+			s.mu.Lock()
+			got := intervals(s.Config, s.isEventWeek(now))
+			s.mu.Unlock()
+
+			if !cmp.Equal(got, tt.expected) {
+				t.Errorf("expected intervals to match, but got diff: %s", cmp.Diff(tt.expected, got))
+			}
+		})
+	}
+}
+
+func TestChangedTeamKeys(t *testing.T) {
+	city, newCity := "Portland", "Salem"
+	known := make(map[string]store.Team)
+
+	teams := []store.Team{{Key: "frc1", City: &city}, {Key: "frc2"}}
+	if changed := changedTeamKeys(known, teams); !cmp.Equal(changed, []string{"frc1", "frc2"}) {
+		t.Errorf("expected all teams to be new, got %v", changed)
+	}
+
+	teams = []store.Team{{Key: "frc1", City: &newCity}, {Key: "frc2"}, {Key: "frc3"}}
+	if changed := changedTeamKeys(known, teams); !cmp.Equal(changed, []string{"frc1", "frc3"}) {
+		t.Errorf("expected changed and new teams, got %v", changed)
+	}
+
+	if changed := changedTeamKeys(known, teams); len(changed) != 0 {
+		t.Errorf("expected no changed teams, got %v", changed)
+	}
+}
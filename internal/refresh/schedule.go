@@ -0,0 +1,136 @@
+package refresh
+
+import (
+	"context"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+const defaultTimeout = time.Second * 10
+
+// Event weeks start a few days before an event so schedules and team lists
+// are picked up quickly, and end the day after it.
+const (
+	eventWeekLead  = time.Hour * 24 * 3
+	eventWeekTrail = time.Hour * 24
+)
+
+var (
+	defaultEventWeekIntervals = config.Intervals{
+		Events: config.Duration(time.Minute * 15),
+		Active: config.Duration(time.Second * 30),
+		Teams:  config.Duration(time.Hour * 24),
+	}
+	defaultIdleIntervals = config.Intervals{
+		Events: config.Duration(time.Hour * 6),
+		Active: config.Duration(time.Minute * 5),
+		Teams:  config.Duration(time.Hour * 24 * 7),
+	}
+)
+
+func eventsInterval(i config.Intervals) config.Duration { return i.Events }
+func activeInterval(i config.Intervals) config.Duration { return i.Active }
+func teamsInterval(i config.Intervals) config.Duration  { return i.Teams }
+
+type eventDates struct {
+	start, end time.Time
+}
+
+// intervals returns the configured intervals for either event weeks or idle
+// weeks, with defaults for any that aren't configured.
+func intervals(r config.Refresh, eventWeek bool) config.Intervals {
+	configured, defaults := r.Idle, defaultIdleIntervals
+	if eventWeek {
+		configured, defaults = r.Intervals, defaultEventWeekIntervals
+	}
+
+	return config.Intervals{
+		Events: config.Duration(configured.Events.Or(time.Duration(defaults.Events))),
+		Active: config.Duration(configured.Active.Or(time.Duration(defaults.Active))),
+		Teams:  config.Duration(configured.Teams.Or(time.Duration(defaults.Teams))),
+	}
+}
+
+// isEventWeek returns whether any of the year's events are close enough to t
+// to refresh aggressively. The caller must hold s.mu.
+func (s *Service) isEventWeek(t time.Time) bool {
+	for _, event := range s.schedule {
+		if t.After(event.start.Add(-eventWeekLead)) && t.Before(event.end.Add(eventWeekTrail)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setSchedule records the dates of the year's events. Pending waits are
+// restarted if this starts or ends an event week.
+func (s *Service) setSchedule(events []store.Event) {
+	schedule := make([]eventDates, 0, len(events))
+	for _, event := range events {
+		schedule = append(schedule, eventDates{start: event.StartDate, end: event.EndDate})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	before := s.isEventWeek(now)
+	s.schedule = schedule
+	if s.isEventWeek(now) != before {
+		s.notifyChanged()
+	}
+}
+
+// SetConfig changes how often data is refreshed and the refresh timeout.
+// Pending waits are restarted with the new intervals.
+func (s *Service) SetConfig(c config.Refresh) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Config = c
+	s.notifyChanged()
+}
+
+// notifyChanged wakes any pending waits. The caller must hold s.mu.
+func (s *Service) notifyChanged() {
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+func (s *Service) timeout() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Config.Timeout.Or(defaultTimeout)
+}
+
+// sleep waits for the interval selected by interval, restarting the wait if
+// the config changes or an event week starts or ends. It returns false if the
+// context is done first.
+func (s *Service) sleep(ctx context.Context, interval func(config.Intervals) config.Duration) bool {
+	for {
+		s.mu.Lock()
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		d := interval(intervals(s.Config, s.isEventWeek(time.Now())))
+		changed := s.changed
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Duration(d))
+		select {
+		case <-timer.C:
+			return true
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
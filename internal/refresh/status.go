@@ -0,0 +1,109 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotRunning is returned when a manual refresh is requested but the refresh
+// service has not been started with Run.
+var ErrNotRunning = errors.New("refresh service is not running")
+
+// EventStatus holds information about the most recent match and ranking
+// refreshes of a single event.
+type EventStatus struct {
+	EventKey     string     `json:"eventKey"`
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure  *time.Time `json:"lastFailure,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	MatchCount   int        `json:"matchCount"`
+	RankingCount int        `json:"rankingCount"`
+}
+
+type statusTracker struct {
+	mu     sync.Mutex
+	events map[string]*EventStatus
+}
+
+func (st *statusTracker) get(eventKey string) *EventStatus {
+	if st.events == nil {
+		st.events = make(map[string]*EventStatus)
+	}
+
+	status, ok := st.events[eventKey]
+	if !ok {
+		status = &EventStatus{EventKey: eventKey}
+		st.events[eventKey] = status
+	}
+
+	return status
+}
+
+func (st *statusTracker) success(eventKey string, at time.Time, update func(*EventStatus)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	status := st.get(eventKey)
+	status.LastSuccess = &at
+	if update != nil {
+		update(status)
+	}
+}
+
+func (st *statusTracker) failure(eventKey string, at time.Time, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	status := st.get(eventKey)
+	status.LastFailure = &at
+	status.LastError = err.Error()
+}
+
+func (st *statusTracker) all() []EventStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	statuses := make([]EventStatus, 0, len(st.events))
+	for _, status := range st.events {
+		statuses = append(statuses, *status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].EventKey < statuses[j].EventKey
+	})
+
+	return statuses
+}
+
+// Status returns the refresh status of every event that has been refreshed
+// since the service was started, sorted by event key.
+func (s *Service) Status() []EventStatus {
+	return s.status.all()
+}
+
+// Refresh enqueues an immediate match and ranking refresh for the given event.
+// Cached TBA ETags for the event are discarded so the data is stored even if
+// TBA reports it as unmodified. It returns ErrNotRunning if Run has not been
+// called.
+func (s *Service) Refresh(ctx context.Context, eventKey string) error {
+	s.mu.Lock()
+	manual := s.manual
+	s.mu.Unlock()
+
+	if manual == nil {
+		return ErrNotRunning
+	}
+
+	s.TBA.ForgetEvent(eventKey)
+
+	select {
+	case manual <- eventKey:
+		s.Logger.WithField("eventKey", eventKey).Info("enqueued manual refresh")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,44 @@
+package refresh
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatusTracker(t *testing.T) {
+	first := time.Unix(1551550000, 0)
+	second := first.Add(time.Minute)
+
+	var st statusTracker
+
+	st.success("2019orwil", first, func(status *EventStatus) {
+		status.MatchCount = 82
+	})
+	st.failure("2019orwil", second, errors.New("timeout"))
+	st.success("2019orore", second, func(status *EventStatus) {
+		status.RankingCount = 36
+	})
+	st.success("2019orore", second, nil)
+
+	expected := []EventStatus{
+		{
+			EventKey:     "2019orore",
+			LastSuccess:  &second,
+			RankingCount: 36,
+		},
+		{
+			EventKey:    "2019orwil",
+			LastSuccess: &first,
+			LastFailure: &second,
+			LastError:   "timeout",
+			MatchCount:  82,
+		},
+	}
+
+	if actual := st.all(); !cmp.Equal(actual, expected) {
+		t.Errorf("expected statuses to match, but got diff: %s", cmp.Diff(expected, actual))
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/refresh"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// Refresher reports the status of TBA refreshes and triggers immediate
+// refreshes of single events.
+type Refresher interface {
+	Status() []refresh.EventStatus
+	Refresh(ctx context.Context, eventKey string) error
+}
+
+// refreshStatusHandler returns a handler to get the last refresh status of every
+// refreshed event.
+func (s *Server) refreshStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Refresher == nil {
+			ihttp.Respond(w, []refresh.EventStatus{}, http.StatusOK)
+			return
+		}
+
+		ihttp.Respond(w, s.Refresher.Status(), http.StatusOK)
+	}
+}
+
+// refreshEventHandler returns a handler to enqueue an immediate match and ranking
+// refresh for a specific event.
+func (s *Server) refreshEventHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventKey := mux.Vars(r)["eventKey"]
+
+		_, err := s.Store.GetEventForRealm(r.Context(), eventKey, nil)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving event")
+			return
+		}
+
+		if s.Refresher == nil {
+			ihttp.Error(w, http.StatusServiceUnavailable)
+			return
+		}
+
+		err = s.Refresher.Refresh(r.Context(), eventKey)
+		if errors.Is(err, refresh.ErrNotRunning) {
+			ihttp.Error(w, http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("enqueueing event refresh")
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
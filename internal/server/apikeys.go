@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+type requestAPIKey struct {
+	Name        string            `json:"name" validate:"required,lte=64"`
+	Permissions store.Permissions `json:"permissions" validate:"required"`
+	ExpiresAt   *time.Time        `json:"expiresAt"`
+}
+
+type createdAPIKey struct {
+	store.APIKey
+	Key string `json:"key"`
+}
+
+// tokenLength is the number of random bytes in API keys and single use
+// tokens like invites.
+const tokenLength = 32
+
+// generateToken returns a new random token.
+func generateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// generateAPIKey returns a new random API key.
+func generateAPIKey() (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	return store.APIKeyPrefix + token, nil
+}
+
+// createAPIKeyHandler returns a handler to create an API key acting on behalf
+// of the requesting user in their realm. The key is only ever returned by this
+// handler.
+func (s *Server) createAPIKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ihttp.GetAPIKeyID(r); err == nil {
+			// Keys creating keys would let a leaked key outlive its revocation.
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		var rk requestAPIKey
+		if err := json.NewDecoder(r.Body).Decode(&rk); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(rk); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		now := time.Now()
+		if !rk.Permissions.Valid() || (rk.ExpiresAt != nil && !rk.ExpiresAt.After(now)) {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if !ihttp.GetPermissions(r).Contains(rk.Permissions) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		userID, err := ihttp.GetSubject(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		realmID, err := ihttp.GetRealmID(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		key, err := generateAPIKey()
+		if err != nil {
+			s.Logger.WithError(err).Error("generating API key")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		created := createdAPIKey{
+			APIKey: store.APIKey{
+				Name:        rk.Name,
+				Prefix:      key[:len(store.APIKeyPrefix)+6],
+				Hash:        store.HashAPIKey(key),
+				UserID:      userID,
+				RealmID:     realmID,
+				Permissions: rk.Permissions,
+				CreatedAt:   now.UTC(),
+				ExpiresAt:   rk.ExpiresAt,
+			},
+			Key: key,
+		}
+
+		created.ID, err = s.Store.CreateAPIKey(r.Context(), created.APIKey)
+		if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("creating API key")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, created, http.StatusCreated)
+	}
+}
+
+// apiKeysHandler returns a handler to get the API keys of the requesting
+// user's realm, or of every realm for users with global permissions.
+func (s *Server) apiKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		keys, err := s.Store.GetAPIKeys(r.Context(), realmID)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving API keys")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, keys, http.StatusOK)
+	}
+}
+
+// deleteAPIKeyHandler returns a handler to revoke an API key.
+func (s *Server) deleteAPIKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		err = s.Store.DeleteAPIKey(r.Context(), id, realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("deleting API key")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// managedRealm returns the realm whose API keys, invites, and failed logins the
+// requesting user can manage, or nil if they can manage those of every realm.
+func managedRealm(r *http.Request) (*int64, error) {
+	if ihttp.GetPermissions(r).Has(store.PermGlobal) {
+		return nil, nil
+	}
+
+	realmID, err := ihttp.GetRealmID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &realmID, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	err := sto.CreateUser(context.Background(), store.User{Username: "admin", RealmID: 1, Role: store.RoleRealmAdmin})
+	if err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+
+	admin, err := sto.GetUserByUsername(context.Background(), "admin")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting user", err)
+	}
+
+	accessToken := ts.token(admin)
+
+	createKey := func(perms store.Permissions, expiresAt *time.Time) createdAPIKey {
+		rr := ts.do(http.MethodPost, "/apikeys", accessToken, requestAPIKey{Name: "bot", Permissions: perms, ExpiresAt: expiresAt})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d creating API key, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var key createdAPIKey
+		if err := json.NewDecoder(rr.Body).Decode(&key); err != nil {
+			t.Fatalf("did not expect error %v decoding API key", err)
+		}
+
+		return key
+	}
+
+	managerKey := createKey(store.Permissions{store.PermUsersManage}, nil)
+	readOnlyKey := createKey(store.Permissions{}, nil)
+
+	if rr := ts.do(http.MethodPost, "/apikeys", accessToken, requestAPIKey{Name: "bot", Permissions: store.Permissions{store.PermGlobal}}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d creating API key with permissions the user lacks, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	if rr := ts.do(http.MethodPost, "/apikeys", accessToken, requestAPIKey{Name: "bot", Permissions: store.Permissions{}, ExpiresAt: &past}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d creating expired API key, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	testCases := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "scoped key", key: managerKey.Key, expectedStatus: http.StatusOK},
+		{name: "key without permission", key: readOnlyKey.Key, expectedStatus: http.StatusForbidden},
+		{name: "unknown key", key: store.APIKeyPrefix + "nope", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.do(http.MethodGet, "/apikeys", tt.key, nil)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	if rr := ts.do(http.MethodPost, "/apikeys", managerKey.Key, requestAPIKey{Name: "bot", Permissions: store.Permissions{}}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d creating API key with an API key, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	keys, err := sto.GetAPIKeys(context.Background(), &admin.RealmID)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting API keys", err)
+	}
+
+	if len(keys) != 2 || keys[0].LastUsedAt == nil || keys[0].UserID != admin.ID {
+		t.Errorf("expected two keys with the first used by user %d, got %+v", admin.ID, keys)
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/apikeys/%d", managerKey.ID), accessToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d revoking API key, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodGet, "/apikeys", managerKey.Key, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d using revoked API key, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// defaultRejectedUserGracePeriod is how long rejected users are kept before
+// they're deleted, if the config doesn't say.
+const defaultRejectedUserGracePeriod = 7 * 24 * time.Hour
+
+type requestRejection struct {
+	Reason string `json:"reason" validate:"required,lte=500"`
+}
+
+// notifyPendingUser emails the admins of a realm who can approve users that a
+// user signed up and is waiting for approval. Emails that fail are logged,
+// since the user is still in the pending queue.
+func (s *Server) notifyPendingUser(ctx context.Context, u store.User) {
+	users, err := s.Store.GetUsersByRealm(ctx, u.RealmID)
+	if err != nil {
+		s.Logger.WithError(err).Error("getting realm admins to notify of pending user")
+		return
+	}
+
+	for _, admin := range users {
+		if admin.Email == "" || admin.Pending() || !admin.Permissions.Has(store.PermUsersManage) {
+			continue
+		}
+
+		err := s.Email.Send(ctx, email.Message{
+			To:      admin.Email,
+			Subject: "A new user is waiting for approval",
+			Body: fmt.Sprintf("Hi %s,\n\n%s %s signed up for Peregrine as %s and is waiting for you to approve them.\n",
+				admin.FirstName, u.FirstName, u.LastName, u.Username),
+		})
+		if err != nil {
+			s.Logger.WithError(err).WithField("userId", admin.ID).Error("emailing pending user notification")
+		}
+	}
+}
+
+// pendingUser retrieves the pending user in the route and checks that the
+// requester can manage them with perms, writing an error response and
+// returning false if not.
+func (s *Server) pendingUser(w http.ResponseWriter, r *http.Request, perms store.Permissions) (store.User, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return store.User{}, false
+	}
+
+	user, err := s.Store.GetUserByID(r.Context(), id)
+	if errors.Is(err, store.ErrNoResults{}) {
+		ihttp.Error(w, http.StatusNotFound)
+		return user, false
+	} else if err != nil {
+		s.Logger.WithError(err).Error("getting user")
+		ihttp.Error(w, http.StatusInternalServerError)
+		return user, false
+	}
+
+	if !canManageUser(r, user.RealmID, perms) {
+		ihttp.Error(w, http.StatusForbidden)
+		return user, false
+	}
+
+	if !user.Pending() {
+		ihttp.Error(w, http.StatusConflict)
+		return user, false
+	}
+
+	return user, true
+}
+
+// pendingUsersHandler returns a handler to get the users waiting for approval
+// in the requesting user's realm, or in every realm for users with global
+// permissions.
+func (s *Server) pendingUsersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		users, err := s.Store.GetPendingUsers(r.Context(), realmID)
+		if err != nil {
+			s.Logger.WithError(err).Error("getting pending users")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, users, http.StatusOK)
+	}
+}
+
+// approveUserHandler returns a handler to approve a pending user, assigning
+// their role and permissions. Rejected users can be approved until they're
+// deleted.
+func (s *Server) approveUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rm requestMembership
+		if err := json.NewDecoder(r.Body).Decode(&rm); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		role, perms, err := resolvePermissions(rm.Role, rm.Permissions)
+		if err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		user, ok := s.pendingUser(w, r, perms)
+		if !ok {
+			return
+		}
+
+		err = s.Store.ApproveUser(r.Context(), user.ID, role, perms)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("approving user")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if user.Email != "" {
+			err := s.Email.Send(r.Context(), email.Message{
+				To:      user.Email,
+				Subject: "Your Peregrine account was approved",
+				Body:    fmt.Sprintf("Hi %s,\n\nYour Peregrine account %s was approved, you can log in now.\n", user.FirstName, user.Username),
+			})
+			if err != nil {
+				s.Logger.WithError(err).WithField("userId", user.ID).Error("emailing user approval")
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// rejectUserHandler returns a handler to reject a pending user with a reason.
+// Rejected users are deleted after the grace period.
+func (s *Server) rejectUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rr requestRejection
+		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(rr); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		user, ok := s.pendingUser(w, r, nil)
+		if !ok {
+			return
+		}
+
+		err := s.Store.RejectUser(r.Context(), user.ID, rr.Reason, time.Now().UTC())
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("rejecting user")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if user.Email != "" {
+			err := s.Email.Send(r.Context(), email.Message{
+				To:      user.Email,
+				Subject: "Your Peregrine account was not approved",
+				Body:    fmt.Sprintf("Hi %s,\n\nYour Peregrine account %s was not approved:\n\n%s\n", user.FirstName, user.Username, rr.Reason),
+			})
+			if err != nil {
+				s.Logger.WithError(err).WithField("userId", user.ID).Error("emailing user rejection")
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteRejectedUsers deletes rejected users once their grace period is over,
+// checking every hour until ctx is done.
+func (s *Server) deleteRejectedUsers(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.Store.DeleteRejectedUsers(ctx, time.Now().Add(-s.RejectedUserGracePeriod.Or(defaultRejectedUserGracePeriod)))
+		if err != nil {
+			s.Logger.WithError(err).Error("deleting rejected users")
+		} else if deleted > 0 {
+			s.Logger.WithField("deleted", deleted).Info("deleted rejected users")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
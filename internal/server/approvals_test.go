@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestUserApproval(t *testing.T) {
+	ctx := context.Background()
+
+	sender := &mockSender{}
+	ts := newTestServer(t, func(s *Server) { s.Email = sender })
+	sto := ts.sto
+
+	if err := sto.CreateUser(ctx, store.User{Username: "admin", RealmID: 1, Email: "admin@pigmice.example", Role: store.RoleRealmAdmin}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	admin := store.User{ID: 1, RealmID: 1, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()}
+	adminToken := ts.token(admin)
+
+	signUp := func(username string) store.User {
+		t.Helper()
+
+		ru := requestUser{baseUser: baseUser{Username: username, Password: "password"}, RealmID: 1, FirstName: "Ada", LastName: "Lovelace", Email: username + "@pigmice.example", Role: store.RoleRealmAdmin}
+		if rr := ts.do(http.MethodPost, "/users", "", ru); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d signing up, got %d", http.StatusCreated, rr.Code)
+		}
+
+		u, err := sto.GetUserByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("did not expect error %v getting user", err)
+		}
+		return u
+	}
+
+	pending := signUp("pending")
+	if !pending.Pending() || pending.Role != store.RoleViewer {
+		t.Errorf("expected signed up user to be a pending viewer, got %+v", pending)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].To != "admin@pigmice.example" {
+		t.Errorf("expected admin to be notified of pending user, got %+v", sender.sent)
+	}
+
+	login := baseUser{Username: "pending", Password: "password"}
+	if rr := ts.do(http.MethodPost, "/authenticate", "", login); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d logging in while pending, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rejected := signUp("rejected")
+
+	var users []store.User
+	rr := ts.do(http.MethodGet, "/users/pending", adminToken, nil)
+	if err := json.NewDecoder(rr.Body).Decode(&users); err != nil {
+		t.Fatalf("did not expect error %v decoding pending users", err)
+	}
+	if len(users) != 2 || users[0].ID != pending.ID || users[1].ID != rejected.ID {
+		t.Errorf("expected both signed up users to be pending, got %+v", users)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/reject", rejected.ID), adminToken, requestRejection{}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d rejecting without a reason, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/reject", rejected.ID), adminToken, requestRejection{Reason: "Not on the team"}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d rejecting user, got %d", http.StatusNoContent, rr.Code)
+	}
+	if last := sender.sent[len(sender.sent)-1]; last.To != rejected.Email || !strings.Contains(last.Body, "Not on the team") {
+		t.Errorf("expected rejected user to be emailed the reason, got %+v", last)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/approve", pending.ID), adminToken, requestMembership{Role: store.RoleSuperAdmin}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d approving with permissions the admin doesn't have, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/approve", pending.ID), adminToken, requestMembership{Role: store.RoleScout}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d approving user, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/approve", pending.ID), adminToken, requestMembership{Role: store.RoleScout}); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d approving user twice, got %d", http.StatusConflict, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/authenticate", "", login); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d logging in after approval, got %d", http.StatusOK, rr.Code)
+	}
+
+	if deleted, err := sto.DeleteRejectedUsers(ctx, time.Now().Add(-time.Hour)); err != nil || deleted != 0 {
+		t.Errorf("expected no rejected users to be deleted during the grace period, got %d, %v", deleted, err)
+	}
+	if deleted, err := sto.DeleteRejectedUsers(ctx, time.Now().Add(time.Hour)); err != nil || deleted != 1 {
+		t.Errorf("expected rejected user to be deleted after the grace period, got %d, %v", deleted, err)
+	}
+	if _, err := sto.GetUserByID(ctx, rejected.ID); !errors.Is(err, store.ErrNoResults{}) {
+		t.Errorf("expected rejected user to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/backup"
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// restoreResult describes a restored realm. Users and private events that
+// were renamed to not conflict with existing ones are listed by their old
+// names, and reports for matches that don't exist on this instance are
+// skipped.
+type restoreResult struct {
+	RealmID        int64             `json:"realmId"`
+	Name           string            `json:"name"`
+	Usernames      map[string]string `json:"usernames"`
+	EventKeys      map[string]string `json:"eventKeys"`
+	SkippedReports int               `json:"skippedReports"`
+}
+
+// availableName returns name if it isn't taken, and otherwise the first of
+// name followed by sep and 2, 3, and so on that isn't.
+func availableName(name, sep string, taken func(string) (bool, error)) (string, error) {
+	candidate := name
+	for n := 2; ; n++ {
+		t, err := taken(candidate)
+		if err != nil {
+			return "", err
+		} else if !t {
+			return candidate, nil
+		}
+
+		candidate = name + sep + strconv.Itoa(n)
+	}
+}
+
+// realmArchive collects all the data owned by a realm into an archive. Users'
+// password hashes are only included if hashes is true.
+func (s *Server) realmArchive(ctx context.Context, realmID int64, hashes bool) (backup.Archive, error) {
+	a := backup.Archive{Manifest: backup.Manifest{CreatedAt: time.Now().UTC(), Hashes: hashes}}
+
+	realm, err := s.Store.GetRealm(ctx, realmID)
+	if err != nil {
+		return a, fmt.Errorf("unable to get realm: %w", err)
+	}
+	a.Realm = realm
+
+	users, err := s.Store.GetUsersByRealm(ctx, realmID)
+	if err != nil {
+		return a, fmt.Errorf("unable to get users: %w", err)
+	}
+	for _, u := range users {
+		bu := backup.User{User: u}
+		if hashes {
+			bu.HashedPassword = u.HashedPassword
+		}
+		a.Users = append(a.Users, bu)
+	}
+
+	schemas, err := s.Store.GetSchemasForRealm(ctx, &realmID)
+	if err != nil {
+		return a, fmt.Errorf("unable to get schemas: %w", err)
+	}
+	for _, schema := range schemas {
+		if schema.RealmID != nil && *schema.RealmID == realmID {
+			a.Schemas = append(a.Schemas, schema)
+		}
+	}
+
+	events, err := s.Store.GetEventsForRealm(ctx, true, &realmID, nil)
+	if err != nil {
+		return a, fmt.Errorf("unable to get events: %w", err)
+	}
+	for _, event := range events {
+		if event.RealmID == nil || *event.RealmID != realmID {
+			continue
+		}
+
+		// events are listed without webcasts, so get each one in full
+		full, err := s.Store.GetEventForRealm(ctx, event.Key, &realmID)
+		if err != nil {
+			return a, fmt.Errorf("unable to get event %s: %w", event.Key, err)
+		}
+		a.Events = append(a.Events, full)
+
+		matches, err := s.Store.GetMatchesForRealm(ctx, event.Key, nil, true, &realmID)
+		if err != nil {
+			return a, fmt.Errorf("unable to get matches of event %s: %w", event.Key, err)
+		}
+		a.Matches = append(a.Matches, matches...)
+	}
+
+	reports, err := s.Store.GetReports(ctx, nil, nil, nil, &realmID, nil)
+	if err != nil {
+		return a, fmt.Errorf("unable to get reports: %w", err)
+	}
+	for _, report := range reports {
+		if report.RealmID != nil && *report.RealmID == realmID {
+			a.Reports = append(a.Reports, report)
+		}
+	}
+
+	return a, nil
+}
+
+// backupRealmHandler returns a handler to download an archive of all the data
+// owned by a realm. Users' password hashes are included if the hashes query
+// parameter is true, which requires global permissions.
+func (s *Server) backupRealmHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		hashes, _ := strconv.ParseBool(r.URL.Query().Get("hashes"))
+
+		if !canManageRealm(r, realmID) || (hashes && !ihttp.GetPermissions(r).Has(store.PermGlobal)) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		a, err := s.realmArchive(r.Context(), realmID, hashes)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("collecting realm backup")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="peregrine-realm-%d-%s.zip"`, realmID, a.Manifest.CreatedAt.Format("2006-01-02")))
+
+		if err := backup.Write(w, a); err != nil {
+			s.Logger.WithError(err).Error("writing realm backup")
+		}
+	}
+}
+
+// restorePath is the route to restore realms, which accepts bodies up to the
+// max restore size instead of the max body size.
+const restorePath = "/realms/restore"
+
+// restoreRealmHandler returns a handler to restore a realm archive as a new
+// realm. The realm keeps its name unless the name query parameter is given,
+// and names, usernames, and private event keys that are already taken get a
+// number added to them.
+func (s *Server) restoreRealmHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		a, err := backup.Read(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		result := restoreResult{Name: a.Realm.Name, Usernames: make(map[string]string), EventKeys: make(map[string]string)}
+		if name := r.URL.Query().Get("name"); name != "" {
+			result.Name = name
+		}
+
+		res, err := s.restoreRealm(r.Context(), a, result)
+		if errors.Is(err, store.ErrExists{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("restoring realm")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, res, http.StatusCreated)
+	}
+}
+
+// restoreRealm restores an archive as a new realm named result.Name, or a
+// numbered variant of it, filling in the rest of result.
+func (s *Server) restoreRealm(ctx context.Context, a backup.Archive, result restoreResult) (restoreResult, error) {
+	realms, err := s.Store.GetRealms(ctx)
+	if err != nil {
+		return result, fmt.Errorf("unable to get realms: %w", err)
+	}
+	realmNames := make(map[string]bool, len(realms))
+	for _, realm := range realms {
+		realmNames[realm.Name] = true
+	}
+	result.Name, _ = availableName(result.Name, " ", func(name string) (bool, error) {
+		return realmNames[name], nil
+	})
+
+	usernames := make(map[string]bool, len(a.Users))
+	for _, u := range a.Users {
+		username, err := availableName(u.Username, "", func(username string) (bool, error) {
+			if usernames[strings.ToLower(username)] {
+				return true, nil
+			}
+
+			err := s.Store.CheckSimilarUsernameExists(ctx, username, nil)
+			if errors.Is(err, store.ErrExists{}) {
+				return true, nil
+			}
+			return false, err
+		})
+		if err != nil {
+			return result, fmt.Errorf("unable to check username: %w", err)
+		}
+
+		usernames[strings.ToLower(username)] = true
+		if username != u.Username {
+			result.Usernames[u.Username] = username
+		}
+	}
+
+	private := make(map[string]bool, len(a.Events))
+	for _, event := range a.Events {
+		private[event.Key] = true
+	}
+
+	// events and matches that aren't in the archive are public ones, which
+	// are only kept if this instance has them too
+	publicEvents := make(map[string]bool)
+	for _, u := range a.Users {
+		for _, star := range u.Stars {
+			if _, ok := publicEvents[star]; ok || private[star] {
+				continue
+			}
+
+			_, err := s.Store.GetEventForRealm(ctx, star, nil)
+			if err != nil && !errors.Is(err, store.ErrNoResults{}) {
+				return result, fmt.Errorf("unable to get starred event: %w", err)
+			}
+			publicEvents[star] = err == nil
+		}
+	}
+
+	publicMatches := make(map[[2]string]bool)
+	for _, report := range a.Reports {
+		id := [2]string{report.EventKey, report.MatchKey}
+		if _, ok := publicMatches[id]; ok || private[report.EventKey] {
+			continue
+		}
+
+		_, err := s.Store.GetMatchForRealm(ctx, report.EventKey, report.MatchKey, nil)
+		if err != nil && !errors.Is(err, store.ErrNoResults{}) {
+			return result, fmt.Errorf("unable to get reported match: %w", err)
+		}
+		publicMatches[id] = err == nil
+	}
+
+	// the standard schema for a year is the one to use if a default schema
+	// wasn't one of the realm's own
+	standardSchemas := make(map[int]int64)
+	for year := range a.Realm.Settings.DefaultSchemas {
+		schema, err := s.Store.GetSchemaByYear(ctx, year)
+		if errors.Is(err, store.ErrNoResults{}) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("unable to get standard schema: %w", err)
+		}
+		standardSchemas[year] = schema.ID
+	}
+
+	err = s.Store.DoTransaction(ctx, func(tx *store.Tx) error {
+		if err := s.Store.ExclusiveLockRealmsTx(ctx, tx); err != nil {
+			return fmt.Errorf("unable to lock realms: %w", err)
+		}
+		if err := s.Store.ExclusiveLockEventsTx(ctx, tx); err != nil {
+			return fmt.Errorf("unable to lock events: %w", err)
+		}
+
+		realmID, err := s.Store.InsertRealmTx(ctx, tx, store.Realm{Name: result.Name, ShareReports: a.Realm.ShareReports})
+		if err != nil {
+			return fmt.Errorf("unable to insert realm: %w", err)
+		}
+		result.RealmID = realmID
+
+		schemaIDs := make(map[int64]int64, len(a.Schemas))
+		for _, schema := range a.Schemas {
+			id := schema.ID
+			schema.RealmID, schema.Year = &realmID, nil
+			if schemaIDs[id], err = s.Store.CreateSchemaTx(ctx, tx, schema); err != nil {
+				return fmt.Errorf("unable to insert schema: %w", err)
+			}
+		}
+
+		eventKeys := make(map[string]string, len(a.Events))
+		for _, event := range a.Events {
+			key, err := availableName(event.Key, "-", func(key string) (bool, error) {
+				_, err := s.Store.GetEventRealmIDTx(ctx, tx, key)
+				if errors.Is(err, store.ErrNoResults{}) {
+					return false, nil
+				}
+				return err == nil, err
+			})
+			if err != nil {
+				return fmt.Errorf("unable to check event key: %w", err)
+			}
+
+			eventKeys[event.Key] = key
+			if key != event.Key {
+				result.EventKeys[event.Key] = key
+			}
+
+			event.Key, event.RealmID = key, &realmID
+			if id, ok := schemaIDs[derefInt64(event.SchemaID)]; ok {
+				event.SchemaID = &id
+			} else {
+				event.SchemaID = nil
+			}
+
+			if err := s.Store.UpsertEventTx(ctx, tx, event); err != nil {
+				return fmt.Errorf("unable to insert event: %w", err)
+			}
+		}
+
+		for _, match := range a.Matches {
+			match.EventKey = eventKeys[match.EventKey]
+			if err := s.Store.UpsertMatchTx(ctx, tx, match); err != nil {
+				return fmt.Errorf("unable to insert match: %w", err)
+			}
+		}
+
+		restoredStars := func(stars []string) []string {
+			restored := make([]string, 0, len(stars))
+			for _, star := range stars {
+				if key, ok := eventKeys[star]; ok {
+					restored = append(restored, key)
+				} else if publicEvents[star] {
+					restored = append(restored, star)
+				}
+			}
+			return restored
+		}
+
+		userIDs := make(map[int64]int64, len(a.Users))
+		for _, bu := range a.Users {
+			u := bu.User
+			if username, ok := result.Usernames[u.Username]; ok {
+				u.Username = username
+			}
+			u.RealmID, u.HashedPassword, u.Stars = realmID, bu.HashedPassword, restoredStars(u.Stars)
+
+			// without a hash, the user gets one no password matches until
+			// they reset it, since logging in with an empty hash is an error
+			if u.HashedPassword == "" {
+				if u.HashedPassword, err = unusablePasswordHash(); err != nil {
+					return err
+				}
+			}
+
+			if userIDs[bu.ID], err = s.Store.CreateUserTx(ctx, tx, u); err != nil {
+				return fmt.Errorf("unable to insert user: %w", err)
+			}
+		}
+
+		for _, report := range a.Reports {
+			if key, ok := eventKeys[report.EventKey]; ok {
+				report.EventKey = key
+			} else if !publicMatches[[2]string{report.EventKey, report.MatchKey}] {
+				result.SkippedReports++
+				continue
+			}
+
+			if id, ok := userIDs[derefInt64(report.ReporterID)]; ok {
+				report.ReporterID = &id
+			} else {
+				report.ReporterID = nil
+			}
+			report.RealmID = &realmID
+
+			if _, _, err := s.Store.UpsertReportTx(ctx, tx, report); err != nil {
+				return fmt.Errorf("unable to insert report: %w", err)
+			}
+		}
+
+		settings := a.Realm.Settings
+		settings.DefaultSchemas = make(map[int]int64, len(a.Realm.Settings.DefaultSchemas))
+		for year, id := range a.Realm.Settings.DefaultSchemas {
+			if newID, ok := schemaIDs[id]; ok {
+				settings.DefaultSchemas[year] = newID
+			} else if standardID, ok := standardSchemas[year]; ok {
+				settings.DefaultSchemas[year] = standardID
+			}
+		}
+		settings.DefaultStars = restoredStars(a.Realm.Settings.DefaultStars)
+
+		if err := s.Store.UpdateRealmSettingsTx(ctx, tx, realmID, settings); err != nil {
+			return fmt.Errorf("unable to update realm settings: %w", err)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// derefInt64 returns the value of an optional ID, or 0 if it's missing, which
+// is never a valid ID.
+func derefInt64(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+
+	return *id
+}
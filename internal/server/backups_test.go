@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/backup"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestRealmBackup(t *testing.T) {
+	ctx := context.Background()
+
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+	public := ts.seedMatch()
+
+	realmID := int64(1)
+
+	if err := sto.CreateSchema(ctx, store.Schema{RealmID: &realmID}); err != nil {
+		t.Fatalf("did not expect error %v creating schema", err)
+	}
+	schemas, err := sto.GetSchemasForRealm(ctx, &realmID)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting schemas", err)
+	}
+	var schemaID int64
+	for _, schema := range schemas {
+		if schema.RealmID != nil {
+			schemaID = schema.ID
+		}
+	}
+
+	private := store.Event{Key: "2019pigmice", Name: "Scrimmage", RealmID: &realmID, SchemaID: &schemaID, StartDate: public.StartDate}
+	err = sto.DoTransaction(ctx, func(tx *store.Tx) error {
+		if err := sto.UpsertEventTx(ctx, tx, private); err != nil {
+			return err
+		}
+		return sto.UpsertMatchTx(ctx, tx, store.Match{Key: "qm1", EventKey: private.Key, RedAlliance: []string{"frc2733"}, BlueAlliance: []string{"frc1"}})
+	})
+	if err != nil {
+		t.Fatalf("did not expect error %v creating private event", err)
+	}
+
+	if err := sto.CreateUser(ctx, store.User{Username: "scout", HashedPassword: "$2a$10$hash", RealmID: realmID, Role: store.RoleScout, Stars: []string{public.Key, private.Key}}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	scout, err := sto.GetUserByUsername(ctx, "scout")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting user", err)
+	}
+
+	for _, report := range []store.Report{
+		{EventKey: public.Key, MatchKey: "qm1", TeamKey: "frc1", ReporterID: &scout.ID, RealmID: &realmID},
+		{EventKey: private.Key, MatchKey: "qm1", TeamKey: "frc2733", ReporterID: &scout.ID, RealmID: &realmID},
+	} {
+		if _, _, err := sto.UpsertReport(ctx, report); err != nil {
+			t.Fatalf("did not expect error %v upserting report", err)
+		}
+	}
+
+	token := func(perms store.Permissions) string {
+		return ts.token(store.User{ID: 100, RealmID: realmID, Role: store.RoleRealmAdmin, Permissions: perms})
+	}
+	admin, superAdmin := token(store.RoleRealmAdmin.Permissions()), token(store.RoleSuperAdmin.Permissions())
+
+	if rr := ts.do(http.MethodGet, "/realms/1/backup?hashes=true", admin, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d backing up hashes as a realm admin, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr := ts.do(http.MethodGet, "/realms/1/backup", admin, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d backing up realm, got %d", http.StatusOK, rr.Code)
+	}
+	a, err := backup.Read(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("did not expect error %v reading backup", err)
+	}
+	withoutHashes := rr.Body.Bytes()
+	if len(a.Users) != 1 || a.Users[0].HashedPassword != "" || len(a.Schemas) != 1 || len(a.Events) != 1 || len(a.Matches) != 1 || len(a.Reports) != 2 {
+		t.Errorf("expected backup of the realm's own data without hashes, got %+v", a)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/restore", admin, rr.Body.Bytes()); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d restoring as a realm admin, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr = ts.do(http.MethodGet, "/realms/1/backup?hashes=true", superAdmin, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d backing up realm with hashes, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/restore", superAdmin, []byte("not a zip")); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d restoring something that isn't a backup, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	withHashes := rr.Body.Bytes()
+
+	// backups are limited by the max restore size instead of the max body size
+	small := newTestServer(t, func(s *Server) { s.MaxBodySize = 100 })
+	if rr := small.do(http.MethodPost, "/realms/restore", superAdmin, withHashes); rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d restoring a backup larger than the max body size, got %d", http.StatusCreated, rr.Code)
+	}
+	small = newTestServer(t, func(s *Server) { s.MaxRestoreSize = 100 })
+	if rr := small.do(http.MethodPost, "/realms/restore", superAdmin, withHashes); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d restoring a backup larger than the max restore size, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	rr = ts.do(http.MethodPost, "/realms/restore", superAdmin, withHashes)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d restoring realm, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var result restoreResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("did not expect error %v decoding restore result", err)
+	}
+	if result.Name != "Pigmice 2" || result.Usernames["scout"] != "scout2" || result.EventKeys[private.Key] != "2019pigmice-2" || result.SkippedReports != 0 {
+		t.Errorf("expected conflicting names to be renamed, got %+v", result)
+	}
+
+	restored, err := sto.GetUserByUsername(ctx, "scout2")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting restored user", err)
+	}
+	if restored.RealmID != result.RealmID || restored.HashedPassword != scout.HashedPassword {
+		t.Errorf("expected restored user in the new realm with their hash, got %+v", restored)
+	}
+	if u, err := sto.GetUserByID(ctx, restored.ID); err != nil || len(u.Stars) != 2 {
+		t.Errorf("expected restored user to keep their stars, got %+v, %v", u.Stars, err)
+	}
+
+	event, err := sto.GetEventForRealm(ctx, "2019pigmice-2", &result.RealmID)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting restored event", err)
+	}
+	if event.SchemaID == nil || *event.SchemaID == schemaID || event.Name != private.Name {
+		t.Errorf("expected restored event with the restored schema, got %+v", event)
+	}
+
+	reports, err := sto.GetReports(ctx, nil, nil, nil, &result.RealmID, nil)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting restored reports", err)
+	}
+	restoredReports := 0
+	for _, report := range reports {
+		if report.RealmID != nil && *report.RealmID == result.RealmID {
+			restoredReports++
+			if report.ReporterID == nil || *report.ReporterID != restored.ID {
+				t.Errorf("expected restored report by the restored user, got %+v", report)
+			}
+		}
+	}
+	if restoredReports != 2 {
+		t.Errorf("expected 2 restored reports, got %d", restoredReports)
+	}
+
+	rr = ts.do(http.MethodPost, "/realms/restore", superAdmin, withoutHashes)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d restoring realm without hashes, got %d", http.StatusCreated, rr.Code)
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("did not expect error %v decoding restore result", err)
+	}
+
+	restored, err = sto.GetUserByUsername(ctx, result.Usernames["scout"])
+	if err != nil {
+		t.Fatalf("did not expect error %v getting restored user", err)
+	}
+	if restored.HashedPassword == "" || restored.HashedPassword == scout.HashedPassword {
+		t.Errorf("expected user restored without a hash to get a new one, got %q", restored.HashedPassword)
+	}
+
+	if rr := ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: restored.Username, Password: "password"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d logging in as a user restored without a hash, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
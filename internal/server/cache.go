@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultStatsCacheTTL is how long stats are cached if the config doesn't
+	// say. Only writes made by this process invalidate the cache, so changes
+	// made through other replicas or admin commands show up after at most this
+	// long.
+	defaultStatsCacheTTL = time.Minute
+	// maxStatsCacheEntries is how many event and realm pairs stats are cached
+	// for at once.
+	maxStatsCacheEntries = 1000
+)
+
+type statsCacheKey struct {
+	eventKey string
+	realmID  int64
+	hasRealm bool
+}
+
+func newStatsCacheKey(eventKey string, realmID *int64) statsCacheKey {
+	key := statsCacheKey{eventKey: eventKey}
+	if realmID != nil {
+		key.realmID = *realmID
+		key.hasRealm = true
+	}
+
+	return key
+}
+
+// statsCacheVersion identifies the state of the cache for an event. Results
+// computed under one version are discarded if the event is invalidated before
+// they are stored.
+type statsCacheVersion struct {
+	event  uint64
+	global uint64
+}
+
+type statsCacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// statsCache caches encoded event stats responses per event and realm. The zero
+// value is an empty cache ready to use.
+type statsCache struct {
+	mu       sync.Mutex
+	entries  map[statsCacheKey]statsCacheEntry
+	versions map[string]uint64
+	global   uint64
+}
+
+// get returns the cached stats for a key, unless they have expired as of now.
+func (c *statsCache) get(key statsCacheKey, now time.Time) (statsCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return statsCacheEntry{}, false
+	}
+
+	return entry, ok
+}
+
+// version returns the current version of an event. It should be retrieved before
+// loading the data the cached result is computed from.
+func (c *statsCache) version(eventKey string) statsCacheVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return statsCacheVersion{event: c.versions[eventKey], global: c.global}
+}
+
+// put encodes and caches the given stats until expires, returning the entry.
+// The entry is only cached if the event has not been invalidated since version
+// was called. If the cache is full, expired entries are dropped, and then an
+// arbitrary one if that isn't enough.
+func (c *statsCache) put(key statsCacheKey, version statsCacheVersion, analyses []teamAnalysis, expires time.Time) (statsCacheEntry, error) {
+	body, err := json.Marshal(analyses)
+	if err != nil {
+		return statsCacheEntry{}, fmt.Errorf("unable to encode stats: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	entry := statsCacheEntry{
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		expires: expires,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.versions[key.eventKey] != version.event || c.global != version.global {
+		return entry, nil
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[statsCacheKey]statsCacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxStatsCacheEntries {
+		c.evict()
+	}
+	c.entries[key] = entry
+
+	return entry, nil
+}
+
+// evict makes room for an entry, dropping expired entries, or an arbitrary
+// one if none have expired. c.mu must be held.
+func (c *statsCache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	for key := range c.entries {
+		if len(c.entries) < maxStatsCacheEntries {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// invalidate removes the cached stats of an event for every realm. An empty event
+// key invalidates every event.
+func (c *statsCache) invalidate(eventKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if eventKey == "" {
+		c.global++
+		c.entries = nil
+		return
+	}
+
+	if c.versions == nil {
+		c.versions = make(map[string]uint64)
+	}
+	c.versions[eventKey]++
+
+	for key := range c.entries {
+		if key.eventKey == eventKey {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsCache(t *testing.T) {
+	var c statsCache
+	now := time.Now()
+	expires := now.Add(time.Minute)
+
+	realmID := int64(3)
+	key := newStatsCacheKey("2019orwil", &realmID)
+	publicKey := newStatsCacheKey("2019orwil", nil)
+	otherKey := newStatsCacheKey("2019orore", &realmID)
+
+	analyses := []teamAnalysis{{Team: "frc2733", Summary: []summaryStat{{Name: "Cargo", Max: 4, Average: 2}}}}
+
+	entry, err := c.put(key, c.version("2019orwil"), analyses, expires)
+	if err != nil {
+		t.Fatalf("did not expect error but got: %v", err)
+	}
+
+	if cached, ok := c.get(key, now); !ok || cached.etag != entry.etag {
+		t.Errorf("expected stats to be cached with etag %s", entry.etag)
+	}
+
+	if _, ok := c.get(publicKey, now); ok {
+		t.Errorf("did not expect stats to be cached for a different realm")
+	}
+
+	if _, err := c.put(otherKey, c.version("2019orore"), analyses, expires); err != nil {
+		t.Fatalf("did not expect error but got: %v", err)
+	}
+
+	c.invalidate("2019orwil")
+
+	if _, ok := c.get(key, now); ok {
+		t.Errorf("expected stats to be invalidated")
+	}
+
+	if _, ok := c.get(otherKey, now); !ok {
+		t.Errorf("did not expect stats for another event to be invalidated")
+	}
+
+	// results computed before an invalidation must not be cached
+	version := c.version("2019orwil")
+	c.invalidate("2019orwil")
+	if _, err := c.put(key, version, analyses, expires); err != nil {
+		t.Fatalf("did not expect error but got: %v", err)
+	}
+
+	if _, ok := c.get(key, now); ok {
+		t.Errorf("did not expect stale stats to be cached")
+	}
+
+	c.invalidate("")
+
+	if _, ok := c.get(otherKey, now); ok {
+		t.Errorf("expected every event to be invalidated")
+	}
+
+	// entries expire, since writes made by other processes don't invalidate
+	// them
+	if _, err := c.put(key, c.version("2019orwil"), analyses, expires); err != nil {
+		t.Fatalf("did not expect error but got: %v", err)
+	}
+
+	if _, ok := c.get(key, expires); ok {
+		t.Errorf("expected stats to expire")
+	}
+}
+
+func TestStatsCacheBound(t *testing.T) {
+	var c statsCache
+	expires := time.Now().Add(time.Minute)
+
+	for i := int64(0); i < maxStatsCacheEntries+10; i++ {
+		if _, err := c.put(newStatsCacheKey("2019orwil", &i), c.version("2019orwil"), nil, expires); err != nil {
+			t.Fatalf("did not expect error but got: %v", err)
+		}
+	}
+
+	if len(c.entries) != maxStatsCacheEntries {
+		t.Errorf("expected %d cached entries, got %d", maxStatsCacheEntries, len(c.entries))
+	}
+
+	last := int64(maxStatsCacheEntries + 9)
+	if _, ok := c.get(newStatsCacheKey("2019orwil", &last), time.Now()); !ok {
+		t.Errorf("expected the newest entry to be cached")
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	testCases := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		expected    bool
+	}{
+		{name: "empty header", ifNoneMatch: "", etag: `"abc"`, expected: false},
+		{name: "exact match", ifNoneMatch: `"abc"`, etag: `"abc"`, expected: true},
+		{name: "weak match", ifNoneMatch: `W/"abc"`, etag: `"abc"`, expected: true},
+		{name: "list match", ifNoneMatch: `"def", "abc"`, etag: `"abc"`, expected: true},
+		{name: "wildcard", ifNoneMatch: `*`, etag: `"abc"`, expected: true},
+		{name: "no match", ifNoneMatch: `"def"`, etag: `"abc"`, expected: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := etagMatches(tt.ifNoneMatch, tt.etag); actual != tt.expected {
+				t.Errorf("expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
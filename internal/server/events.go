@@ -12,7 +12,6 @@ import (
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/gorilla/mux"
-	"github.com/jmoiron/sqlx"
 )
 
 func (s *Server) eventYearsHandler() http.HandlerFunc {
@@ -99,12 +98,12 @@ func (s *Server) upsertEventHandler() http.HandlerFunc {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
 		event.Key = eventKey
 		event.RealmID = &creatorRealm
 
-		existed, err := editEvent(r.Context(), s.Store, roles, creatorRealm, event.Key, func(tx *sqlx.Tx) error {
+		existed, err := editEvent(r.Context(), s.Store, perms, creatorRealm, event.Key, func(tx *store.Tx) error {
 			if err := s.Store.UpsertEventTx(r.Context(), tx, event); err != nil {
 				return fmt.Errorf("unable to upsert event: %w", err)
 			}
@@ -128,10 +127,10 @@ func (s *Server) upsertEventHandler() http.HandlerFunc {
 	}
 }
 
-func editEvent(ctx context.Context, sto *store.Service, roles store.Roles, userRealmID int64, eventKey string, editFunc func(tx *sqlx.Tx) error) (existed bool, err error) {
+func editEvent(ctx context.Context, sto store.Store, perms store.Permissions, userRealmID int64, eventKey string, editFunc func(tx *store.Tx) error) (existed bool, err error) {
 	existed = true
 
-	err = sto.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	err = sto.DoTransaction(ctx, func(tx *store.Tx) error {
 		if err := sto.ExclusiveLockEventsTx(ctx, tx); err != nil {
 			return err
 		}
@@ -143,10 +142,10 @@ func editEvent(ctx context.Context, sto *store.Service, roles store.Roles, userR
 			return fmt.Errorf("unable to get events: %w", err)
 		}
 
-		if realmID == nil && !roles.IsSuperAdmin {
-			return forbiddenError{errors.New("only super-admins can edit events with no realm ID")}
+		if realmID == nil && !perms.Has(store.PermGlobal) {
+			return forbiddenError{errors.New("only users with global permissions can edit events with no realm ID")}
 		} else if realmID != nil && *realmID != userRealmID {
-			return forbiddenError{errors.New("only realm admins with matching realm IDs can edit events with a specified realm ID")}
+			return forbiddenError{errors.New("only users with matching realm IDs can edit events with a specified realm ID")}
 		}
 
 		if err := editFunc(tx); err != nil {
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCustomEventVisibility(t *testing.T) {
+	const secret = "i-am-secret"
+
+	s := &Server{Store: store.NewMemory(), Logger: logrus.New()}
+	handler := ihttp.Auth(s.registerRoutes(), signing.NewHMAC(secret), s.Store)
+
+	superAdmin := store.User{ID: 1, RealmID: 1, Role: store.RoleSuperAdmin, Permissions: store.RoleSuperAdmin.Permissions()}
+	accessToken, err := generateAccessToken(superAdmin, time.Now().Add(time.Hour), signing.NewHMAC(secret))
+	if err != nil {
+		t.Fatalf("did not expect error %v generating access token", err)
+	}
+
+	event, _ := json.Marshal(store.Event{
+		Name:      "Pit Practice",
+		StartDate: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2019, 3, 2, 0, 0, 0, 0, time.UTC),
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/events/2019pit", bytes.NewReader(event))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		body, _ := ioutil.ReadAll(rr.Body)
+		t.Fatalf("expected status %d creating event, got %d: %s", http.StatusCreated, rr.Code, body)
+	}
+
+	testCases := []struct {
+		name         string
+		accessToken  string
+		expectedKeys []string
+	}{
+		{name: "anonymous", expectedKeys: []string{}},
+		{name: "realm member", accessToken: accessToken, expectedKeys: []string{"2019pit"}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if tt.accessToken != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.accessToken)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var events []store.Event
+			if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+				t.Fatalf("did not expect error %v decoding response", err)
+			}
+
+			keys := []string{}
+			for _, e := range events {
+				keys = append(keys, e.Key)
+			}
+
+			if !cmp.Equal(keys, tt.expectedKeys) {
+				t.Errorf("expected event keys to match, but got diff: %s", cmp.Diff(tt.expectedKeys, keys))
+			}
+		})
+	}
+}
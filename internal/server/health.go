@@ -6,6 +6,7 @@ import (
 	"time"
 
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/migrate"
 )
 
 func openAPIHandler(openAPI []byte) http.HandlerFunc {
@@ -21,28 +22,60 @@ type Pinger interface {
 	Ping(ctx context.Context) error
 }
 
+// SchemaChecker reports the schema version of a database compared to the
+// latest migration.
+type SchemaChecker interface {
+	Status(ctx context.Context) (migrate.Status, error)
+}
+
 type healthServices struct {
 	TBA        bool `json:"tba"`
 	PostgreSQL bool `json:"postgresql"`
 }
 
+type healthSchema struct {
+	Version *int `json:"version"`
+	Latest  int  `json:"latest"`
+	Dirty   bool `json:"dirty"`
+	Current bool `json:"current"`
+}
+
 type healthStatus struct {
 	Uptime   string         `json:"uptime"`
 	Services healthServices `json:"services"`
+	Schema   *healthSchema  `json:"schema,omitempty"`
 	Ok       bool           `json:"ok"`
 }
 
-func healthHandler(getUptime func() time.Duration, tba, postgres Pinger) http.HandlerFunc {
+// healthHandler returns a handler to report the health of peregrine and its
+// dependencies. If schema is nil the database schema version is not reported.
+func healthHandler(getUptime func() time.Duration, tba, postgres Pinger, schema SchemaChecker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		services := healthServices{
 			TBA:        tba.Ping(r.Context()) == nil,
 			PostgreSQL: postgres.Ping(r.Context()) == nil,
 		}
 
-		ihttp.Respond(w, healthStatus{
+		status := healthStatus{
 			Uptime:   getUptime().String(),
 			Services: services,
 			Ok:       services.TBA && services.PostgreSQL,
-		}, http.StatusOK)
+		}
+
+		if schema != nil {
+			status.Schema = &healthSchema{}
+			if s, err := schema.Status(r.Context()); err == nil {
+				status.Schema = &healthSchema{
+					Version: s.Version,
+					Latest:  s.Latest,
+					Dirty:   s.Dirty,
+					Current: s.Current(),
+				}
+			}
+
+			status.Ok = status.Ok && status.Schema.Current
+		}
+
+		ihttp.Respond(w, status, http.StatusOK)
 	}
 }
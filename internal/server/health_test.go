@@ -6,10 +6,19 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/migrate"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestOpenAPIHandler(t *testing.T) {
@@ -58,11 +67,23 @@ func (mp mockPinger) Ping(context.Context) error {
 	return nil
 }
 
+type mockSchemaChecker struct {
+	status migrate.Status
+	err    error
+}
+
+func (msc mockSchemaChecker) Status(context.Context) (migrate.Status, error) {
+	return msc.status, msc.err
+}
+
 func TestHealthHandler(t *testing.T) {
+	oldVersion, latestVersion := 33, 34
+
 	testCases := []struct {
 		name             string
 		tbaHealthy       bool
 		postgresHealthy  bool
+		schema           SchemaChecker
 		uptime           func() time.Duration
 		expectedResponse healthStatus
 	}{
@@ -108,6 +129,54 @@ func TestHealthHandler(t *testing.T) {
 				Ok: false,
 			},
 		},
+		{
+			name:            "schema is current",
+			tbaHealthy:      true,
+			postgresHealthy: true,
+			schema:          mockSchemaChecker{status: migrate.Status{Version: &latestVersion, Latest: 34}},
+			uptime:          func() time.Duration { return time.Second * 10 },
+			expectedResponse: healthStatus{
+				Uptime: "10s",
+				Services: healthServices{
+					TBA:        true,
+					PostgreSQL: true,
+				},
+				Schema: &healthSchema{Version: &latestVersion, Latest: 34, Current: true},
+				Ok:     true,
+			},
+		},
+		{
+			name:            "schema has drifted",
+			tbaHealthy:      true,
+			postgresHealthy: true,
+			schema:          mockSchemaChecker{status: migrate.Status{Version: &oldVersion, Latest: 34, Pending: 1}},
+			uptime:          func() time.Duration { return time.Second * 10 },
+			expectedResponse: healthStatus{
+				Uptime: "10s",
+				Services: healthServices{
+					TBA:        true,
+					PostgreSQL: true,
+				},
+				Schema: &healthSchema{Version: &oldVersion, Latest: 34, Current: false},
+				Ok:     false,
+			},
+		},
+		{
+			name:            "schema status unavailable",
+			tbaHealthy:      true,
+			postgresHealthy: false,
+			schema:          mockSchemaChecker{err: errors.New("could not connect")},
+			uptime:          func() time.Duration { return time.Second * 10 },
+			expectedResponse: healthStatus{
+				Uptime: "10s",
+				Services: healthServices{
+					TBA:        true,
+					PostgreSQL: false,
+				},
+				Schema: &healthSchema{},
+				Ok:     false,
+			},
+		},
 	}
 
 	for _, tt := range testCases {
@@ -119,7 +188,7 @@ func TestHealthHandler(t *testing.T) {
 				t.FailNow()
 			}
 
-			handler := healthHandler(tt.uptime, mockPinger{tt.tbaHealthy}, mockPinger{tt.postgresHealthy})
+			handler := healthHandler(tt.uptime, mockPinger{tt.tbaHealthy}, mockPinger{tt.postgresHealthy}, tt.schema)
 
 			handler(rr, req)
 
@@ -134,3 +203,53 @@ func TestHealthHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	ts.do(http.MethodGet, "/events/2019orwil", "", nil)
+
+	if rr := ts.do(http.MethodGet, "/metrics", "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d getting metrics without a token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := ts.do(http.MethodGet, "/metrics", ts.token(store.User{ID: 1, RealmID: 1, Role: store.RoleSuperAdmin, Permissions: store.RoleSuperAdmin.Permissions()}), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d getting metrics, got %d", http.StatusOK, rr.Code)
+	}
+
+	expected := `peregrine_http_requests_total{code="404",method="GET",route="/events/{eventKey}"}`
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("expected metrics to contain %s, got:\n%s", expected, rr.Body.String())
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := new(oteltest.StandardSpanRecorder)
+	otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	s := &Server{Store: store.NewMemory(), Logger: logrus.New()}
+	handler := ihttp.Trace(s.registerRoutes())
+
+	req := httptest.NewRequest(http.MethodGet, "/events/2019orwil/stats", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Completed()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 completed span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "GET /events/{eventKey}/stats" {
+		t.Errorf("expected span to be named after the route, got %q", span.Name())
+	}
+	if span.SpanContext().TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected span to continue the propagated trace, got trace %s with parent %s", span.SpanContext().TraceID, span.ParentSpanID())
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const inviteDuration = time.Hour * 24 * 7 // 1 week
+
+type requestInvite struct {
+	RealmID     *int64            `json:"realmId"`
+	Role        store.Role        `json:"role"`
+	Permissions store.Permissions `json:"permissions"`
+	Email       string            `json:"email" validate:"omitempty,email"`
+	ExpiresAt   *time.Time        `json:"expiresAt"`
+}
+
+type createdInvite struct {
+	store.Invite
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+type acceptInviteRequest struct {
+	baseUser
+	Token     string `json:"token" validate:"required"`
+	FirstName string `json:"firstName" validate:"required"`
+	LastName  string `json:"lastName" validate:"required"`
+	Email     string `json:"email" validate:"omitempty,email"`
+}
+
+// link returns the client URL at path for a single use token.
+func (s *Server) link(path, token string) string {
+	return strings.TrimSuffix(s.LinkURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// createInviteHandler returns a handler to invite someone to sign up in a
+// realm with a given role. The invite token is only ever returned by this
+// handler, and emailed to the invitee if an email address is given.
+func (s *Server) createInviteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ri requestInvite
+		if err := json.NewDecoder(r.Body).Decode(&ri); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(ri); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		role, perms, err := resolvePermissions(ri.Role, ri.Permissions)
+		if err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(inviteDuration)
+		if ri.ExpiresAt != nil {
+			if !ri.ExpiresAt.After(now) {
+				ihttp.Error(w, http.StatusUnprocessableEntity)
+				return
+			}
+			expiresAt = *ri.ExpiresAt
+		}
+
+		userID, err := ihttp.GetSubject(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		var realmID int64
+		if ri.RealmID != nil {
+			realmID = *ri.RealmID
+		} else if realmID, err = ihttp.GetRealmID(r); err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		if !canManageUser(r, realmID, perms) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		token, err := generateToken()
+		if err != nil {
+			s.Logger.WithError(err).Error("generating invite token")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		created := createdInvite{
+			Invite: store.Invite{
+				Hash:        store.HashToken(token),
+				RealmID:     realmID,
+				Role:        role,
+				Permissions: perms,
+				Email:       ri.Email,
+				CreatedBy:   &userID,
+				CreatedAt:   now.UTC(),
+				ExpiresAt:   expiresAt.UTC(),
+			},
+			Token: token,
+			URL:   s.link("/invite", token),
+		}
+
+		created.ID, err = s.Store.CreateInvite(r.Context(), created.Invite)
+		if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("creating invite")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if created.Email != "" {
+			// The invite still works if the email fails, the admin can share
+			// the returned link themselves.
+			err := s.Email.Send(r.Context(), email.Message{
+				To:      created.Email,
+				Subject: "You're invited to Peregrine",
+				Body: fmt.Sprintf("You've been invited to scout with Peregrine. Sign up here:\n\n%s\n\nThis invite expires %s.\n",
+					created.URL, created.ExpiresAt.Format("January 2, 2006")),
+			})
+			if err != nil {
+				s.Logger.WithError(err).WithField("inviteId", created.ID).Error("emailing invite")
+			}
+		}
+
+		ihttp.Respond(w, created, http.StatusCreated)
+	}
+}
+
+// invitesHandler returns a handler to get the invites of the requesting user's
+// realm, or of every realm for users with global permissions.
+func (s *Server) invitesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		invites, err := s.Store.GetInvites(r.Context(), realmID)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving invites")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, invites, http.StatusOK)
+	}
+}
+
+// deleteInviteHandler returns a handler to revoke an invite.
+func (s *Server) deleteInviteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		err = s.Store.DeleteInvite(r.Context(), id, realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("deleting invite")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// acceptInviteHandler returns a handler to sign up with an invite. The new
+// user gets the realm, role, and permissions of the invite.
+func (s *Server) acceptInviteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ra acceptInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&ra); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(ra); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		err := s.Store.CheckSimilarUsernameExists(r.Context(), ra.Username, nil)
+		if errors.Is(err, store.ErrExists{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("checking whether similar user exists")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		hashedPassword, err := HashPassword(ra.Password)
+		if err != nil {
+			s.Logger.WithError(err).Error("hashing user password")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		u := store.User{Username: ra.Username, HashedPassword: hashedPassword, FirstName: ra.FirstName, LastName: ra.LastName, Email: ra.Email}
+
+		err = s.Store.AcceptInvite(r.Context(), store.HashToken(ra.Token), time.Now(), u)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if errors.Is(err, store.ErrExists{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("accepting invite")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
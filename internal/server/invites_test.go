@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+// mockSender records the emails it's asked to send.
+type mockSender struct {
+	sent []email.Message
+}
+
+func (m *mockSender) Send(ctx context.Context, msg email.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// emailToken returns the token of the link in an email.
+func emailToken(t *testing.T, msg email.Message) string {
+	t.Helper()
+
+	for _, field := range strings.Fields(msg.Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("expected a link with a token in email %q", msg.Body)
+	return ""
+}
+
+func TestInvites(t *testing.T) {
+	sender := &mockSender{}
+	ts := newTestServer(t, func(s *Server) {
+		s.LinkURL = "https://peregrine.example/"
+		s.Email = sender
+	})
+	sto := ts.sto
+
+	otherRealm, err := sto.InsertRealm(context.Background(), store.Realm{Name: "Invite Testers"})
+	if err != nil {
+		t.Fatalf("did not expect error %v creating realm", err)
+	}
+
+	admin := store.User{ID: 1, RealmID: 1, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()}
+	if err := sto.CreateUser(context.Background(), store.User{Username: "admin", RealmID: 1, Role: store.RoleRealmAdmin}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	adminToken := ts.token(admin)
+
+	create := func(body requestInvite) (*httptest.ResponseRecorder, createdInvite) {
+		rr := ts.do(http.MethodPost, "/invites", adminToken, body)
+
+		var invite createdInvite
+		if rr.Code == http.StatusCreated {
+			if err := json.NewDecoder(rr.Body).Decode(&invite); err != nil {
+				t.Fatalf("did not expect error %v decoding invite", err)
+			}
+		}
+
+		return rr, invite
+	}
+
+	if rr, _ := create(requestInvite{Role: store.RoleSuperAdmin}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected inviting a super admin to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr, _ := create(requestInvite{RealmID: &otherRealm, Role: store.RoleScout}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected inviting to another realm to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr, _ := create(requestInvite{Role: "captain"}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected unknown role to get status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	rr, invite := create(requestInvite{Role: store.RoleScout, Email: "ada@pigmice.example"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected creating invite to get status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	if invite.URL != "https://peregrine.example/invite?token="+invite.Token {
+		t.Errorf("unexpected invite URL %q", invite.URL)
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0].To != "ada@pigmice.example" || emailToken(t, sender.sent[0]) != invite.Token {
+		t.Fatalf("expected invite to be emailed, got %+v", sender.sent)
+	}
+
+	rr = ts.do(http.MethodGet, "/invites", adminToken, nil)
+	var invites []store.Invite
+	if err := json.NewDecoder(rr.Body).Decode(&invites); err != nil {
+		t.Fatalf("did not expect error %v decoding invites", err)
+	}
+	if len(invites) != 1 || invites[0].ID != invite.ID || invites[0].Role != store.RoleScout {
+		t.Errorf("expected the created invite to be listed, got %+v", invites)
+	}
+
+	accept := acceptInviteRequest{
+		baseUser:  baseUser{Username: "adalovelace", Password: "password"},
+		Token:     invite.Token,
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+	}
+
+	if rr := ts.do(http.MethodPost, "/invites/accept", "", acceptInviteRequest{baseUser: accept.baseUser, Token: "wrong", FirstName: "Ada", LastName: "Lovelace"}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown invite to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/invites/accept", "", accept); rr.Code != http.StatusCreated {
+		t.Fatalf("expected accepting invite to get status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	user, err := sto.GetUserByUsername(context.Background(), "adalovelace")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting invited user", err)
+	}
+	if user.RealmID != 1 || user.Role != store.RoleScout || !user.Permissions.Has(store.PermReportsWrite) || user.Email != "ada@pigmice.example" {
+		t.Errorf("expected invited user to get the invite's realm, role, and email, got %+v", user)
+	}
+
+	accept.Username = "adalovelace2"
+	if rr := ts.do(http.MethodPost, "/invites/accept", "", accept); rr.Code != http.StatusNotFound {
+		t.Errorf("expected accepting invite twice to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	_, revoked := create(requestInvite{})
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/invites/%d", revoked.ID), adminToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected deleting invite to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	accept.Token = revoked.Token
+	if rr := ts.do(http.MethodPost, "/invites/accept", "", accept); rr.Code != http.StatusNotFound {
+		t.Errorf("expected revoked invite to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
+)
+
+// JWKSProvider provides the public keys tokens can be verified with.
+type JWKSProvider interface {
+	JWKS() signing.JWKS
+}
+
+// jwksHandler returns a handler to get the public keys tokens can be verified
+// with as a JSON Web Key Set. Services verifying tokens should fetch it again
+// when they see an unknown key ID, since keys are rotated.
+func jwksHandler(keys JWKSProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ihttp.Respond(w, keys.JWKS(), http.StatusOK)
+	}
+}
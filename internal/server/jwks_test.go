@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAsymmetricTokens(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		keys, err := signing.Open(context.Background(), testSecret, signing.EdDSA, 0, MaxTokenLifetime, s.Store, logrus.New())
+		if err != nil {
+			t.Fatalf("did not expect error %v opening signing keys", err)
+		}
+		s.Keys = keys
+	})
+	sto := ts.sto
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	if err := sto.CreateUser(context.Background(), store.User{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+
+	rr := ts.do(http.MethodGet, "/.well-known/jwks.json", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d getting JWKS, got %d", http.StatusOK, rr.Code)
+	}
+
+	var jwks signing.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&jwks); err != nil {
+		t.Fatalf("did not expect error %v decoding JWKS", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != signing.EdDSA || jwks.Keys[0].Curve != "Ed25519" {
+		t.Errorf("unexpected JWKS %+v", jwks)
+	}
+
+	rr = ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: "password"})
+	var tokens authenticateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+		t.Fatalf("did not expect error %v decoding tokens", err)
+	}
+
+	for _, ss := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		token, _, err := new(jwt.Parser).ParseUnverified(ss, &jwt.StandardClaims{})
+		if err != nil {
+			t.Fatalf("did not expect error %v parsing token", err)
+		}
+		if token.Method.Alg() != signing.EdDSA || token.Header["kid"] != jwks.Keys[0].ID {
+			t.Errorf("expected token signed with key %s, got header %v", jwks.Keys[0].ID, token.Header)
+		}
+	}
+
+	if rr := ts.do(http.MethodGet, "/users", tokens.AccessToken, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d using access token, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d refreshing, got %d", http.StatusOK, rr.Code)
+	}
+
+	legacy, err := generateAccessToken(store.User{ID: 1, RealmID: 1}, time.Now().Add(time.Hour), signing.NewHMAC("not-the-secret"))
+	if err != nil {
+		t.Fatalf("did not expect error %v generating access token", err)
+	}
+	if rr := ts.do(http.MethodGet, "/users", legacy, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with token signed by another secret, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
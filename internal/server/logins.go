@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/throttle"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Failed logins before each username or IP address has to wait, doubling
+	// from loginBackoff up to maxLoginBackoff. IP addresses get more since a
+	// whole team at an event often shares one.
+	freeUserLoginFailures = 3
+	freeIPLoginFailures   = 20
+	loginBackoff          = time.Second
+	maxLoginBackoff       = time.Minute * 5
+	forgetLoginFailures   = time.Hour
+
+	// Consecutive failed logins before a user is locked out.
+	maxFailedLogins = 10
+	lockoutDuration = time.Minute * 15
+
+	defaultLoginFailuresSince = time.Hour * 24
+)
+
+// loginLimits throttles failed logins by username and by IP address, so
+// passwords can't be guessed quickly. Failures are only known once bcrypt is
+// done, so bcrypt comparisons are also limited to one per CPU at a time, so a
+// burst of logins can't be used to exhaust the server's CPU.
+type loginLimits struct {
+	users  *throttle.Throttle
+	ips    *throttle.Throttle
+	hashes chan struct{}
+}
+
+func newLoginLimits() *loginLimits {
+	return &loginLimits{
+		users:  throttle.New(freeUserLoginFailures, loginBackoff, maxLoginBackoff, forgetLoginFailures),
+		ips:    throttle.New(freeIPLoginFailures, loginBackoff, maxLoginBackoff, forgetLoginFailures),
+		hashes: make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
+func userKey(username string) string {
+	return strings.ToLower(username)
+}
+
+// wait returns how long until a login for the username from the request's IP
+// address is allowed, or zero if it's allowed now.
+func (l *loginLimits) wait(r *http.Request, username string, now time.Time) time.Duration {
+	wait := l.users.Wait(userKey(username), now)
+	if ipWait := l.ips.Wait(remoteIP(r), now); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait
+}
+
+func (l *loginLimits) fail(r *http.Request, username string, now time.Time) {
+	l.users.Fail(userKey(username), now)
+	l.ips.Fail(remoteIP(r), now)
+}
+
+// succeed forgets the failures of a username. Failures of the IP address are
+// kept, otherwise logging in to one account would allow guessing another.
+func (l *loginLimits) succeed(username string) {
+	l.users.Reset(userKey(username))
+}
+
+// acquireHash reserves a bcrypt comparison, returning false if they're all in
+// use. Each reservation must be released with releaseHash.
+func (l *loginLimits) acquireHash() bool {
+	select {
+	case l.hashes <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *loginLimits) releaseHash() {
+	<-l.hashes
+}
+
+// retryAfter sets the Retry-After header to a wait, rounded up to seconds.
+func retryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// LoginRecorder records failed logins, locking users out after too many.
+type LoginRecorder interface {
+	RecordFailedLogin(ctx context.Context, userID int64, now time.Time, maxFailures int, lockout time.Duration) (lockedUntil *time.Time, err error)
+	UnlockUser(ctx context.Context, id int64) error
+	CreateLoginFailure(ctx context.Context, f store.LoginFailure) error
+}
+
+// auditLoginFailure logs a failed login and stores a record of it.
+func auditLoginFailure(ctx context.Context, logger *logrus.Logger, logins LoginRecorder, f store.LoginFailure) {
+	fields := logrus.Fields{"username": f.Username, "ipAddress": f.IPAddress, "reason": f.Reason}
+	if f.UserID != nil {
+		fields["userId"] = *f.UserID
+	}
+	logger.WithFields(fields).Warn("failed login")
+
+	if err := logins.CreateLoginFailure(ctx, f); err != nil {
+		logger.WithError(err).Error("storing failed login")
+	}
+}
+
+// unlockUserHandler returns a handler to clear a user's failed logins, so a
+// user who was locked out can log in again right away.
+func (s *Server) unlockUserHandler(limits *loginLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.Store.GetUserByID(r.Context(), id)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("getting user")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if !canManageUser(r, user.RealmID, user.Permissions) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		err = s.Store.UnlockUser(r.Context(), id)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("unlocking user")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		limits.succeed(user.Username)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loginFailuresHandler returns a handler to get the failed logins of users in
+// the requesting user's realm, or of everyone for users with global
+// permissions, since the time in the since query parameter or for the last
+// day.
+func (s *Server) loginFailuresHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since := time.Now().Add(-defaultLoginFailuresSince)
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, v); err != nil {
+				ihttp.Error(w, http.StatusBadRequest)
+				return
+			}
+		}
+
+		realmID, err := managedRealm(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		failures, err := s.Store.GetLoginFailures(r.Context(), realmID, since)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving login failures")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, failures, http.StatusOK)
+	}
+}
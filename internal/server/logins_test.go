@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoginLimits(t *testing.T) {
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	if err := sto.CreateUser(context.Background(), store.User{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	scout, _ := sto.GetUserByUsername(context.Background(), "scout")
+
+	admin := store.User{ID: 100, RealmID: 1, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()}
+	adminToken := ts.token(admin)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		return ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: password})
+	}
+
+	for i := 0; i <= freeUserLoginFailures; i++ {
+		if rr := login("wrong-password"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected failed login %d to get status %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	rr := login("password")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected login after too many failures to get status %d with Retry-After 1, got %d with %q",
+			http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	rr = ts.do(http.MethodGet, "/login-failures", adminToken, nil)
+	var failures []store.LoginFailure
+	if err := json.NewDecoder(rr.Body).Decode(&failures); err != nil {
+		t.Fatalf("did not expect error %v decoding login failures", err)
+	}
+	if len(failures) != freeUserLoginFailures+1 {
+		t.Fatalf("expected %d login failures, got %+v", freeUserLoginFailures+1, failures)
+	}
+	for _, f := range failures {
+		if f.Username != "scout" || f.UserID == nil || *f.UserID != scout.ID || f.Reason != store.LoginWrongPassword {
+			t.Errorf("unexpected login failure %+v", f)
+		}
+	}
+
+	if _, err := sto.RecordFailedLogin(context.Background(), scout.ID, time.Now(), 1, time.Hour); err != nil {
+		t.Fatalf("did not expect error %v locking user", err)
+	}
+
+	if rr := ts.do(http.MethodGet, fmt.Sprintf("/users/%d", scout.ID), adminToken, nil); !bytes.Contains(rr.Body.Bytes(), []byte("lockedUntil")) {
+		t.Errorf("expected locked user to have lockedUntil, got %s", rr.Body)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/users/%d/unlock", scout.ID), adminToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected unlocking user to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := login("password"); rr.Code != http.StatusOK {
+		t.Errorf("expected unlocked user to log in with status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if u, _ := sto.GetUserByID(context.Background(), scout.ID); u.Locked(time.Now()) || u.FailedLogins != 0 {
+		t.Errorf("expected user to be unlocked, got %+v", u)
+	}
+}
+
+func TestLoginHashLimit(t *testing.T) {
+	sto := store.NewMemory()
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	if err := sto.CreateUser(context.Background(), store.User{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+
+	limits := newLoginLimits()
+	handler := authenticateHandler(logrus.New(), time.Now, sto, sto, sto, sto, limits, signing.NewHMAC(testSecret))
+
+	login := func() *httptest.ResponseRecorder {
+		b, _ := json.Marshal(baseUser{Username: "scout", Password: "password"})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/authenticate", bytes.NewReader(b)))
+		return rr
+	}
+
+	for limits.acquireHash() {
+	}
+
+	if rr := login(); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected login while every bcrypt comparison is in use to get status %d with Retry-After 1, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	limits.releaseHash()
+
+	if rr := login(); rr.Code != http.StatusOK {
+		t.Errorf("expected login once a comparison is free to get status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
@@ -13,7 +13,6 @@ import (
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/gorilla/mux"
-	"github.com/jmoiron/sqlx"
 )
 
 type match struct {
@@ -137,7 +136,7 @@ func (s *Server) upsertMatchHandler() http.HandlerFunc {
 			Videos:        m.Videos,
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
 		userRealmID, err := ihttp.GetRealmID(r)
 		if err != nil {
@@ -145,7 +144,7 @@ func (s *Server) upsertMatchHandler() http.HandlerFunc {
 			return
 		}
 
-		existed, err := editMatch(r.Context(), s.Store, roles, userRealmID, sm.Key, func(tx *sqlx.Tx) error {
+		existed, err := editMatch(r.Context(), s.Store, perms, userRealmID, sm.Key, func(tx *store.Tx) error {
 			if err := s.Store.UpsertMatchTx(r.Context(), tx, sm); err != nil {
 				return fmt.Errorf("unable to upsert match: %w", err)
 			}
@@ -175,7 +174,7 @@ func (s *Server) deleteMatchHandler() http.HandlerFunc {
 		eventKey := vars["eventKey"]
 		matchKey := vars["matchKey"]
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
 		userRealmID, err := ihttp.GetRealmID(r)
 		if err != nil {
@@ -183,7 +182,7 @@ func (s *Server) deleteMatchHandler() http.HandlerFunc {
 			return
 		}
 
-		existed, err := editMatch(r.Context(), s.Store, roles, userRealmID, matchKey, func(tx *sqlx.Tx) error {
+		existed, err := editMatch(r.Context(), s.Store, perms, userRealmID, matchKey, func(tx *store.Tx) error {
 			if err := s.Store.DeleteMatchTx(r.Context(), tx, matchKey, eventKey); err != nil {
 				return fmt.Errorf("unable to delete match: %w", err)
 			}
@@ -207,10 +206,10 @@ func (s *Server) deleteMatchHandler() http.HandlerFunc {
 	}
 }
 
-func editMatch(ctx context.Context, sto *store.Service, roles store.Roles, userRealmID int64, matchKey string, editFunc func(tx *sqlx.Tx) error) (existed bool, err error) {
+func editMatch(ctx context.Context, sto store.Store, perms store.Permissions, userRealmID int64, matchKey string, editFunc func(tx *store.Tx) error) (existed bool, err error) {
 	existed = true
 
-	err = sto.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	err = sto.DoTransaction(ctx, func(tx *store.Tx) error {
 		if err := sto.ExclusiveLockMatchesTx(ctx, tx); err != nil {
 			return err
 		}
@@ -222,10 +221,10 @@ func editMatch(ctx context.Context, sto *store.Service, roles store.Roles, userR
 			return fmt.Errorf("unable to get matches: %w", err)
 		}
 
-		if realmID == nil && !roles.IsSuperAdmin {
-			return forbiddenError{errors.New("only super-admins can edit matches with no realm ID")}
+		if realmID == nil && !perms.Has(store.PermGlobal) {
+			return forbiddenError{errors.New("only users with global permissions can edit matches with no realm ID")}
 		} else if realmID != nil && *realmID != userRealmID {
-			return forbiddenError{errors.New("only realm admins with matching realm IDs can edit matches with a specified realm ID")}
+			return forbiddenError{errors.New("only users with matching realm IDs can edit matches with a specified realm ID")}
 		}
 
 		if err := editFunc(tx); err != nil {
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// MembershipGetter is used for retrieving the membership of a user in a realm
+// besides their own. It should return store.ErrNoResults if the user isn't a
+// member of the realm.
+type MembershipGetter interface {
+	GetMembership(ctx context.Context, userID, realmID int64) (store.Membership, error)
+}
+
+// inRealm returns the user acting in a realm. In their own realm, or if
+// realmID is zero, that's the user as is. In another realm the user gets the
+// realm, role, and permissions of their membership, or store.ErrNoResults is
+// returned if they aren't a member.
+func inRealm(ctx context.Context, memberships MembershipGetter, user store.User, realmID int64) (store.User, error) {
+	if realmID == 0 || realmID == user.RealmID {
+		return user, nil
+	}
+
+	membership, err := memberships.GetMembership(ctx, user.ID, realmID)
+	if err != nil {
+		return user, err
+	}
+
+	user.RealmID = membership.RealmID
+	user.Role = membership.Role
+	user.Permissions = membership.Permissions
+
+	return user, nil
+}
+
+type requestMembership struct {
+	Role        store.Role        `json:"role"`
+	Permissions store.Permissions `json:"permissions"`
+}
+
+// membershipVars parses the realm and user IDs of a membership route, writing
+// an error response and returning false if they're invalid.
+func membershipVars(w http.ResponseWriter, r *http.Request) (realmID, userID int64, ok bool) {
+	realmID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	userID, err = strconv.ParseInt(mux.Vars(r)["userId"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return realmID, userID, true
+}
+
+// userMembershipsHandler returns a handler to get the realms a user is a
+// member of besides their own. Anyone can see their own memberships, and
+// users who could edit another user can see theirs.
+func (s *Server) userMembershipsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := s.managedUserID(w, r)
+		if !ok {
+			return
+		}
+
+		memberships, err := s.Store.GetMemberships(r.Context(), &userID, nil)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving user memberships")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, memberships, http.StatusOK)
+	}
+}
+
+// realmMembersHandler returns a handler to get the members of a realm from
+// other realms.
+func (s *Server) realmMembersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		if !canManageUser(r, realmID, nil) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		memberships, err := s.Store.GetMemberships(r.Context(), nil, &realmID)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving realm members")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, memberships, http.StatusOK)
+	}
+}
+
+// putRealmMemberHandler returns a handler to add a user from another realm to
+// a realm, or to change the role and permissions of a member.
+func (s *Server) putRealmMemberHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, userID, ok := membershipVars(w, r)
+		if !ok {
+			return
+		}
+
+		var rm requestMembership
+		if err := json.NewDecoder(r.Body).Decode(&rm); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		role, perms, err := resolvePermissions(rm.Role, rm.Permissions)
+		if err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if !canManageUser(r, realmID, perms) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		existing, err := s.Store.GetMembership(r.Context(), userID, realmID)
+		if err == nil && !canManageUser(r, realmID, existing.Permissions) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		} else if err != nil && !errors.Is(err, store.ErrNoResults{}) {
+			s.Logger.WithError(err).Error("getting membership")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		created, err := s.Store.UpsertMembership(r.Context(), store.Membership{
+			UserID:      userID,
+			RealmID:     realmID,
+			Role:        role,
+			Permissions: perms,
+			CreatedAt:   time.Now().UTC(),
+		})
+		if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if errors.Is(err, store.ErrExists{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("upserting membership")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// deleteRealmMemberHandler returns a handler to remove a member from a realm.
+// Members can leave a realm themselves. Tokens already issued for the realm
+// stay valid until they expire, but can't be refreshed.
+func (s *Server) deleteRealmMemberHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, userID, ok := membershipVars(w, r)
+		if !ok {
+			return
+		}
+
+		subjectID, err := ihttp.GetSubject(r)
+		if err != nil {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		if subjectID != userID && !canManageUser(r, realmID, nil) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		membership, err := s.Store.GetMembership(r.Context(), userID, realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("getting membership")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if subjectID != userID && !canManageUser(r, realmID, membership.Permissions) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		err = s.Store.DeleteMembership(r.Context(), userID, realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("deleting membership")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
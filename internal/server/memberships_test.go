@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestMemberships(t *testing.T) {
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	otherRealm, err := sto.InsertRealm(context.Background(), store.Realm{Name: "Other"})
+	if err != nil {
+		t.Fatalf("did not expect error %v inserting realm", err)
+	}
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	for _, u := range []store.User{
+		{Username: "mentor", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout, Permissions: store.RoleScout.Permissions()},
+		{Username: "admin", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()},
+		{Username: "otheradmin", HashedPassword: hashedPassword, RealmID: otherRealm, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()},
+	} {
+		if err := sto.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("did not expect error %v creating user", err)
+		}
+	}
+
+	mentor, _ := sto.GetUserByUsername(context.Background(), "mentor")
+	admin, _ := sto.GetUserByUsername(context.Background(), "admin")
+	otherAdmin, _ := sto.GetUserByUsername(context.Background(), "otheradmin")
+
+	decodeTokens := func(rr *httptest.ResponseRecorder) (authenticateResponse, ihttp.Claims) {
+		t.Helper()
+
+		var tokens authenticateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+			t.Fatalf("did not expect error %v decoding tokens", err)
+		}
+
+		var claims ihttp.Claims
+		if _, err := jwt.ParseWithClaims(tokens.AccessToken, &claims, ts.keys().VerifyKey); err != nil {
+			t.Fatalf("did not expect error %v parsing access token", err)
+		}
+
+		return tokens, claims
+	}
+
+	memberPath := fmt.Sprintf("/realms/%d/members/%d", otherRealm, mentor.ID)
+
+	if rr := ts.do(http.MethodPut, memberPath, ts.token(admin), requestMembership{Role: store.RoleRealmAdmin}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected admin of another realm to get status %d adding member, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPut, memberPath, ts.token(otherAdmin), requestMembership{Role: store.RoleScout}); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d adding member, got %d", http.StatusCreated, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPut, memberPath, ts.token(otherAdmin), requestMembership{Role: store.RoleRealmAdmin}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d changing member role, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPut, fmt.Sprintf("/realms/1/members/%d", mentor.ID), ts.token(admin), requestMembership{}); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d adding member to their own realm, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr := ts.do(http.MethodGet, fmt.Sprintf("/realms/%d/members", otherRealm), ts.token(otherAdmin), nil)
+	var members []store.Membership
+	if err := json.NewDecoder(rr.Body).Decode(&members); err != nil {
+		t.Fatalf("did not expect error %v decoding members", err)
+	}
+	if len(members) != 1 || members[0].UserID != mentor.ID || members[0].Role != store.RoleRealmAdmin {
+		t.Errorf("unexpected realm members %+v", members)
+	}
+
+	rr = ts.do(http.MethodPost, "/authenticate", "", authenticateRequest{baseUser: baseUser{Username: "mentor", Password: "password"}, RealmID: otherRealm})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d logging in to other realm, got %d", http.StatusOK, rr.Code)
+	}
+
+	tokens, claims := decodeTokens(rr)
+	if claims.RealmID != otherRealm || claims.Role != store.RoleRealmAdmin || !claims.Permissions.Has(store.PermUsersManage) {
+		t.Errorf("expected access token for other realm as realm admin, got %+v", claims)
+	}
+
+	rr = ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d refreshing, got %d", http.StatusOK, rr.Code)
+	}
+	if tokens, claims = decodeTokens(rr); claims.RealmID != otherRealm {
+		t.Errorf("expected refreshed token to stay in realm %d, got %d", otherRealm, claims.RealmID)
+	}
+
+	ownRealm := int64(1)
+	rr = ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken, RealmID: &ownRealm})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d switching realms, got %d", http.StatusOK, rr.Code)
+	}
+	if tokens, claims = decodeTokens(rr); claims.RealmID != 1 || claims.Role != store.RoleScout {
+		t.Errorf("expected token for own realm as scout, got %+v", claims)
+	}
+
+	if rr := ts.do(http.MethodPost, "/authenticate", "", authenticateRequest{baseUser: baseUser{Username: "admin", Password: "password"}, RealmID: otherRealm}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d logging in to a realm that isn't joined, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr = ts.do(http.MethodGet, fmt.Sprintf("/users/%d/memberships", mentor.ID), tokens.AccessToken, nil)
+	var memberships []store.Membership
+	if err := json.NewDecoder(rr.Body).Decode(&memberships); err != nil {
+		t.Fatalf("did not expect error %v decoding memberships", err)
+	}
+	if len(memberships) != 1 || memberships[0].RealmID != otherRealm {
+		t.Errorf("unexpected memberships %+v", memberships)
+	}
+
+	if rr := ts.do(http.MethodDelete, memberPath, tokens.AccessToken, nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d leaving realm, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	rr = ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken, RealmID: &otherRealm})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d switching to a realm that was left, got %d", http.StatusForbidden, rr.Code)
+	}
+}
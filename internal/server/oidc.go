@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/oidc"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// OIDCProvider logs users in with an OpenID Connect provider.
+type OIDCProvider interface {
+	AuthURL(ctx context.Context, state, nonce string) (string, error)
+	Exchange(ctx context.Context, code, nonce string) (oidc.Identity, error)
+	SignUpRealm(identity oidc.Identity) (realmID int64, ok bool)
+}
+
+const (
+	oidcStateDuration   = time.Minute * 10
+	maxUsernameAttempts = 100
+)
+
+var nonAlphanumeric = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// oidcStateClaims are signed into the state passed through the provider, so
+// the callback knows the nonce the ID token must have without storing it.
+type oidcStateClaims struct {
+	Nonce string `json:"nonce"`
+	jwt.StandardClaims
+}
+
+type oidcLoginResponse struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+type oidcCallbackRequest struct {
+	Code       string `json:"code" validate:"required"`
+	State      string `json:"state" validate:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+// oidcLoginHandler returns a handler to start logging in with the OIDC
+// provider. Clients should remember the returned state, send the user to the
+// returned URL, and check that the provider sends the same state back.
+func (s *Server) oidcLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := generateTokenID()
+		if err != nil {
+			s.Logger.WithError(err).Error("generating OIDC nonce")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		state, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &oidcStateClaims{
+			Nonce:          nonce,
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(oidcStateDuration).Unix()},
+		}).SignedString([]byte(s.JWTSecret))
+		if err != nil {
+			s.Logger.WithError(err).Error("generating OIDC state")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		authURL, err := s.OIDC.AuthURL(r.Context(), state, nonce)
+		if err != nil {
+			s.Logger.WithError(err).Error("getting OIDC auth URL")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, oidcLoginResponse{authURL, state}, http.StatusOK)
+	}
+}
+
+// oidcCallbackHandler returns a handler to finish logging in with the OIDC
+// provider. Users logged in with peregrine get the identity linked to their
+// account. Otherwise the linked user is logged in, or a new user is created if
+// sign up is allowed, and they get the same tokens as from /authenticate.
+func (s *Server) oidcCallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req oidcCallbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		var state oidcStateClaims
+		_, err := jwt.ParseWithClaims(req.State, &state, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+
+			return []byte(s.JWTSecret), nil
+		})
+		if err != nil || state.Nonce == "" {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := s.OIDC.Exchange(r.Context(), req.Code, state.Nonce)
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			s.Logger.WithError(err).Warn("rejected OIDC ID token")
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("exchanging OIDC code")
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		if subjectID, err := ihttp.GetSubject(r); err == nil {
+			if _, err := ihttp.GetAPIKeyID(r); err == nil {
+				ihttp.Error(w, http.StatusForbidden)
+				return
+			}
+
+			err := s.Store.CreateIdentity(r.Context(), newIdentity(identity, subjectID))
+			if errors.Is(err, store.ErrExists{}) {
+				ihttp.Error(w, http.StatusConflict)
+				return
+			} else if err != nil {
+				s.Logger.WithError(err).Error("linking OIDC identity")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		user, err := s.Store.GetUserByIdentity(r.Context(), identity.Issuer, identity.Subject)
+		if errors.Is(err, store.ErrNoResults{}) {
+			realmID, ok := s.OIDC.SignUpRealm(identity)
+			if !ok {
+				ihttp.Error(w, http.StatusForbidden)
+				return
+			}
+
+			user, err = s.createOIDCUser(r.Context(), identity, realmID)
+		}
+		if err != nil {
+			s.Logger.WithError(err).Error("getting user for OIDC identity")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		if user.Pending() {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		tokens, err := issueTokens(r, time.Now(), s.Store, user, req.DeviceName, s.keys())
+		if err != nil {
+			s.Logger.WithError(err).Error("issuing tokens")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, tokens, http.StatusOK)
+	}
+}
+
+func newIdentity(identity oidc.Identity, userID int64) store.Identity {
+	return store.Identity{
+		Issuer:    identity.Issuer,
+		Subject:   identity.Subject,
+		UserID:    userID,
+		Email:     identity.Email,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// createOIDCUser creates a viewer in the given realm for an identity logging
+// in for the first time, and links the identity to them. Like users who sign
+// themselves up, they wait for an admin of the realm to approve them. They're
+// given a random password, so they can only log in through the provider until
+// they change it.
+func (s *Server) createOIDCUser(ctx context.Context, identity oidc.Identity, realmID int64) (store.User, error) {
+	username, err := s.oidcUsername(ctx, identity)
+	if err != nil {
+		return store.User{}, err
+	}
+
+	hashedPassword, err := unusablePasswordHash()
+	if err != nil {
+		return store.User{}, err
+	}
+
+	firstName := identity.GivenName
+	if firstName == "" {
+		firstName = identity.Name
+	}
+	if firstName == "" {
+		firstName = username
+	}
+
+	now := time.Now().UTC()
+	err = s.Store.CreateUser(ctx, store.User{
+		Username:       username,
+		HashedPassword: hashedPassword,
+		RealmID:        realmID,
+		FirstName:      firstName,
+		LastName:       identity.FamilyName,
+		Role:           store.RoleViewer,
+		PendingSince:   &now,
+	})
+	if err != nil {
+		return store.User{}, fmt.Errorf("unable to create user: %w", err)
+	}
+
+	user, err := s.Store.GetUserByUsername(ctx, username)
+	if err != nil {
+		return store.User{}, fmt.Errorf("unable to get created user: %w", err)
+	}
+
+	err = s.Store.CreateIdentity(ctx, newIdentity(identity, user.ID))
+	if errors.Is(err, store.ErrExists{}) {
+		// The same identity logged in twice at once, keep the first user.
+		if err := s.Store.DeleteUserByID(ctx, user.ID); err != nil {
+			return store.User{}, fmt.Errorf("unable to delete duplicate user: %w", err)
+		}
+
+		return s.Store.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	} else if err != nil {
+		return store.User{}, fmt.Errorf("unable to link identity: %w", err)
+	}
+
+	s.notifyPendingUser(ctx, user)
+
+	return user, nil
+}
+
+// oidcUsername picks a free username for a new user from their preferred
+// username or email address, adding a number if it's taken.
+func (s *Server) oidcUsername(ctx context.Context, identity oidc.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	base = nonAlphanumeric.ReplaceAllString(base, "")
+	if len(base) > 28 {
+		base = base[:28]
+	}
+	if len(base) < 4 {
+		base = "user" + base
+	}
+
+	for i := 1; i <= maxUsernameAttempts; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+
+		err := s.Store.CheckSimilarUsernameExists(ctx, username, nil)
+		if errors.Is(err, store.ErrExists{}) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("unable to check whether username exists: %w", err)
+		}
+
+		return username, nil
+	}
+
+	return "", fmt.Errorf("unable to find a free username like %q", base)
+}
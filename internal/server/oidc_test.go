@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/oidc"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// mockOIDC returns the identity for the code it's given, if the nonce matches
+// the one it put in the auth URL.
+type mockOIDC struct {
+	identities map[string]oidc.Identity
+	nonce      string
+	signUp     bool
+}
+
+func (m *mockOIDC) AuthURL(ctx context.Context, state, nonce string) (string, error) {
+	m.nonce = nonce
+	return "https://provider.example/authorize?state=" + state, nil
+}
+
+func (m *mockOIDC) Exchange(ctx context.Context, code, nonce string) (oidc.Identity, error) {
+	identity, ok := m.identities[code]
+	if !ok || nonce != m.nonce {
+		return oidc.Identity{}, oidc.ErrInvalidToken
+	}
+
+	return identity, nil
+}
+
+func (m *mockOIDC) SignUpRealm(identity oidc.Identity) (int64, bool) {
+	return 1, m.signUp
+}
+
+func refreshSubject(t *testing.T, refreshToken, secret string) string {
+	t.Helper()
+
+	var claims ihttp.RefreshClaims
+	_, err := jwt.ParseWithClaims(refreshToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil {
+		t.Errorf("did not expect error %v parsing refresh token", err)
+	}
+
+	return claims.Subject
+}
+
+func TestOIDC(t *testing.T) {
+	provider := &mockOIDC{identities: map[string]oidc.Identity{
+		"scout-code": {Issuer: "https://provider.example", Subject: "1", Email: "scout@pigmice.example"},
+		"new-code":   {Issuer: "https://provider.example", Subject: "2", Email: "ada.lovelace@pigmice.example", GivenName: "Ada", FamilyName: "Lovelace"},
+	}}
+
+	sender := &mockSender{}
+	ts := newTestServer(t, func(s *Server) { s.OIDC, s.Email = provider, sender })
+	sto := ts.sto
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	for _, u := range []store.User{
+		{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout},
+		{Username: "admin", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleRealmAdmin, Email: "admin@pigmice.example"},
+	} {
+		if err := sto.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("did not expect error %v creating user", err)
+		}
+	}
+	scout, _ := sto.GetUserByUsername(context.Background(), "scout")
+
+	start := func() string {
+		rr := ts.do(http.MethodGet, "/oidc/login", "", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d starting login, got %d", http.StatusOK, rr.Code)
+		}
+
+		var resp oidcLoginResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("did not expect error %v decoding login response", err)
+		}
+
+		return resp.State
+	}
+
+	callback := func(code, state, token string) (*httptest.ResponseRecorder, authenticateResponse) {
+		rr := ts.do(http.MethodPost, "/oidc/callback", token, oidcCallbackRequest{Code: code, State: state})
+
+		var tokens authenticateResponse
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+				t.Fatalf("did not expect error %v decoding tokens", err)
+			}
+		}
+
+		return rr, tokens
+	}
+
+	if rr, _ := callback("scout-code", start(), ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected unlinked identity without sign up to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr, _ := callback("scout-code", "not-a-state", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected invalid state to get status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	state := start()
+	provider.nonce = "replayed"
+	if rr, _ := callback("scout-code", state, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected mismatched nonce to get status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: "password"})
+	var scoutTokens authenticateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&scoutTokens); err != nil {
+		t.Fatalf("did not expect error %v decoding tokens", err)
+	}
+
+	if rr, _ := callback("scout-code", start(), scoutTokens.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected linking identity to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr, _ := callback("scout-code", start(), scoutTokens.AccessToken); rr.Code != http.StatusConflict {
+		t.Errorf("expected linking identity again to get status %d, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr, tokens := callback("scout-code", start(), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected linked identity to log in with status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if id := refreshSubject(t, tokens.RefreshToken, testSecret); id != strconv.FormatInt(scout.ID, 10) {
+		t.Errorf("expected linked identity to log in as user %d, got %s", scout.ID, id)
+	}
+
+	provider.signUp = true
+	if rr, _ := callback("new-code", start(), ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected new identity to sign up pending approval with status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	user, err := sto.GetUserByIdentity(context.Background(), "https://provider.example", "2")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting signed up user", err)
+	}
+
+	if user.Username != "adalovelace" || user.FirstName != "Ada" || user.LastName != "Lovelace" || user.Role != store.RoleViewer || user.RealmID != 1 || !user.Pending() {
+		t.Errorf("unexpected signed up user %+v", user)
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0].To != "admin@pigmice.example" {
+		t.Errorf("expected the realm admin to be notified of the pending user, got %+v", sender.sent)
+	}
+
+	if rr, _ := callback("new-code", start(), ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected pending user to get status %d logging in again, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if err := sto.ApproveUser(context.Background(), user.ID, store.RoleViewer, store.RoleViewer.Permissions()); err != nil {
+		t.Fatalf("did not expect error %v approving user", err)
+	}
+
+	rr, tokens = callback("new-code", start(), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected approved user to log in with status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if id := refreshSubject(t, tokens.RefreshToken, testSecret); id != strconv.FormatInt(user.ID, 10) {
+		t.Errorf("expected signed up identity to log in as user %d, got %s", user.ID, id)
+	}
+
+	if len(sender.sent) != 1 {
+		t.Errorf("expected logging in as an existing user to notify no one, got %+v", sender.sent)
+	}
+}
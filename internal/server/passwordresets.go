@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/throttle"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	passwordResetDuration = time.Hour
+
+	// Reset requests for each username or email address, and from each IP
+	// address, before they have to wait, doubling from resetBackoff up to
+	// maxResetBackoff.
+	freeTargetResets = 3
+	freeIPResets     = 10
+	resetBackoff     = time.Minute
+	maxResetBackoff  = time.Hour
+	forgetResets     = time.Hour * 24
+)
+
+// resetLimits throttles password reset requests by the username or email
+// address they're for and by IP address, so they can't be used to flood
+// users with emails. Every request counts, whether or not it matched a user.
+type resetLimits struct {
+	targets *throttle.Throttle
+	ips     *throttle.Throttle
+}
+
+func newResetLimits() *resetLimits {
+	return &resetLimits{
+		targets: throttle.New(freeTargetResets, resetBackoff, maxResetBackoff, forgetResets),
+		ips:     throttle.New(freeIPResets, resetBackoff, maxResetBackoff, forgetResets),
+	}
+}
+
+func resetTargetKey(rr requestPasswordReset) string {
+	if rr.Username != "" {
+		return "username:" + strings.ToLower(rr.Username)
+	}
+
+	return "email:" + strings.ToLower(rr.Email)
+}
+
+// request returns how long until a reset request is allowed, or records it and
+// returns zero if it's allowed now.
+func (l *resetLimits) request(r *http.Request, rr requestPasswordReset, now time.Time) time.Duration {
+	target := resetTargetKey(rr)
+
+	wait := l.targets.Wait(target, now)
+	if ipWait := l.ips.Wait(remoteIP(r), now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	l.targets.Fail(target, now)
+	l.ips.Fail(remoteIP(r), now)
+
+	return 0
+}
+
+type requestPasswordReset struct {
+	Username string `json:"username" validate:"required_without=Email"`
+	Email    string `json:"email" validate:"omitempty,email"`
+}
+
+type confirmPasswordReset struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"gte=8,lte=128"`
+}
+
+// passwordResetHandler returns a handler to email password reset links to the
+// user with a username, or to every user with an email address. It responds
+// the same whether or not any user was found or the email could be sent, so it
+// can't be used to find out who has an account.
+func (s *Server) passwordResetHandler(limits *resetLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rr requestPasswordReset
+		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(rr); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		now := time.Now()
+		if wait := limits.request(r, rr, now); wait > 0 {
+			retryAfter(w, wait)
+			ihttp.Error(w, http.StatusTooManyRequests)
+			return
+		}
+
+		var users []store.User
+		if rr.Username != "" {
+			user, err := s.Store.GetUserByUsername(r.Context(), rr.Username)
+			if err == nil {
+				users = append(users, user)
+			} else if !errors.Is(err, store.ErrNoResults{}) {
+				s.Logger.WithError(err).Error("getting user")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+		} else {
+			var err error
+			users, err = s.Store.GetUsersByEmail(r.Context(), rr.Email)
+			if err != nil {
+				s.Logger.WithError(err).Error("getting users by email")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		for _, user := range users {
+			if user.Email == "" {
+				continue
+			}
+
+			token, err := generateToken()
+			if err != nil {
+				s.Logger.WithError(err).Error("generating password reset token")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+
+			reset := store.PasswordReset{Hash: store.HashToken(token), UserID: user.ID, ExpiresAt: now.Add(passwordResetDuration)}
+			if err := s.Store.CreatePasswordReset(r.Context(), reset, now); err != nil {
+				s.Logger.WithError(err).Error("creating password reset")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+
+			err = s.Email.Send(r.Context(), email.Message{
+				To:      user.Email,
+				Subject: "Reset your Peregrine password",
+				Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Peregrine account %s. Choose a new password here:\n\n%s\n\n"+
+					"This link expires in an hour. If you didn't ask to reset your password, you can ignore this email.\n",
+					user.FirstName, user.Username, s.link("/reset-password", token)),
+			})
+			if err != nil {
+				s.Logger.WithError(err).WithField("userId", user.ID).Error("emailing password reset")
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// confirmPasswordResetHandler returns a handler to choose a new password with
+// a password reset token. Changing the password invalidates every refresh
+// token of the user, logging them out everywhere.
+func (s *Server) confirmPasswordResetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rc confirmPasswordReset
+		if err := json.NewDecoder(r.Body).Decode(&rc); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(rc); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		hashedPassword, err := HashPassword(rc.Password)
+		if err != nil {
+			s.Logger.WithError(err).Error("hashing user password")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := s.Store.ResetPassword(r.Context(), store.HashToken(rc.Token), time.Now(), hashedPassword)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("resetting password")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		s.Logger.WithField("userId", userID).Info("reset password")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
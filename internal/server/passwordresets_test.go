@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestPasswordReset(t *testing.T) {
+	sender := &mockSender{}
+	ts := newTestServer(t, func(s *Server) { s.Email = sender })
+	sto := ts.sto
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	for _, u := range []store.User{
+		{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, FirstName: "Ada", Email: "ada@pigmice.example"},
+		{Username: "noemail", HashedPassword: hashedPassword, RealmID: 1},
+	} {
+		if err := sto.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("did not expect error %v creating user", err)
+		}
+	}
+
+	rr := ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: "password"})
+	var tokens authenticateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+		t.Fatalf("did not expect error %v decoding tokens", err)
+	}
+
+	for _, body := range []requestPasswordReset{{Username: "nobody"}, {Username: "noemail"}, {Email: "nobody@pigmice.example"}} {
+		if rr := ts.do(http.MethodPost, "/password-reset", "", body); rr.Code != http.StatusNoContent {
+			t.Errorf("expected reset for %+v to get status %d, got %d", body, http.StatusNoContent, rr.Code)
+		}
+	}
+
+	if rr := ts.do(http.MethodPost, "/password-reset", "", requestPasswordReset{}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected empty reset request to get status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	if len(sender.sent) != 0 {
+		t.Fatalf("expected no emails to be sent, got %+v", sender.sent)
+	}
+
+	if rr := ts.do(http.MethodPost, "/password-reset", "", requestPasswordReset{Email: "ADA@pigmice.example"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected reset by email to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0].To != "ada@pigmice.example" {
+		t.Fatalf("expected a reset email to be sent to the user, got %+v", sender.sent)
+	}
+	token := emailToken(t, sender.sent[0])
+
+	if rr := ts.do(http.MethodPost, "/password-reset/confirm", "", confirmPasswordReset{Token: "wrong", Password: "new-password"}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown reset token to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/password-reset/confirm", "", confirmPasswordReset{Token: token, Password: "new-password"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected resetting password to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/password-reset/confirm", "", confirmPasswordReset{Token: token, Password: "another-password"}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected reusing reset token to get status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}); rr.Code == http.StatusOK {
+		t.Errorf("expected refresh token from before the reset to be rejected")
+	}
+
+	if rr := ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: "password"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected old password to get status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/authenticate", "", baseUser{Username: "scout", Password: "new-password"}); rr.Code != http.StatusOK {
+		t.Errorf("expected new password to get status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+type failingSender struct{}
+
+func (failingSender) Send(ctx context.Context, msg email.Message) error {
+	return errors.New("mail server is down")
+}
+
+func TestPasswordResetLimits(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) { s.Email = failingSender{} })
+
+	if err := ts.sto.CreateUser(context.Background(), store.User{Username: "scout", RealmID: 1, Email: "ada@pigmice.example"}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+
+	// a failed email looks the same as an unknown user
+	for i := 0; i <= freeTargetResets; i++ {
+		if rr := ts.do(http.MethodPost, "/password-reset", "", requestPasswordReset{Username: "scout"}); rr.Code != http.StatusNoContent {
+			t.Fatalf("expected reset %d to get status %d, got %d", i, http.StatusNoContent, rr.Code)
+		}
+	}
+
+	rr := ts.do(http.MethodPost, "/password-reset", "", requestPasswordReset{Username: "Scout"})
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected too many resets for a user to get status %d with Retry-After, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/password-reset", "", requestPasswordReset{Username: "nobody"}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected reset for another user to get status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+// What happens to the reports of a deleted user.
+const (
+	// deletedUserReportsAnonymize keeps the reports without a reporter.
+	deletedUserReportsAnonymize = "anonymize"
+	// deletedUserReportsDelete deletes the reports along with the user.
+	deletedUserReportsDelete = "delete"
+)
+
+// exportComment is a comment a user left on a report.
+type exportComment struct {
+	EventKey string `json:"eventKey"`
+	MatchKey string `json:"matchKey"`
+	TeamKey  string `json:"teamKey"`
+	Comment  string `json:"comment"`
+}
+
+// exportUserHandler returns a handler to export the data held about a user as
+// a zip of JSON files: their profile, reports, comments, and stars.
+func (s *Server) exportUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := s.managedUserID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := s.Store.GetUserByID(r.Context(), userID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("getting user to export")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		reports, err := s.Store.GetReportsByReporter(r.Context(), userID)
+		if err != nil {
+			s.Logger.WithError(err).Error("getting reports to export")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		comments := make([]exportComment, 0)
+		for _, report := range reports {
+			if report.Comment != "" {
+				comments = append(comments, exportComment{report.EventKey, report.MatchKey, report.TeamKey, report.Comment})
+			}
+		}
+
+		stars := []string(user.Stars)
+		if stars == nil {
+			stars = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="peregrine-%s.zip"`, user.Username))
+
+		zw := zip.NewWriter(w)
+		files := []struct {
+			name string
+			v    interface{}
+		}{
+			{"profile.json", user},
+			{"reports.json", reports},
+			{"comments.json", comments},
+			{"stars.json", stars},
+		}
+		for _, file := range files {
+			f, err := zw.Create(file.name)
+			if err != nil {
+				s.Logger.WithError(err).Error("creating user export file")
+				return
+			}
+
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(file.v); err != nil {
+				s.Logger.WithError(err).Error("writing user export file")
+				return
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			s.Logger.WithError(err).Error("finishing user export")
+		}
+	}
+}
+
+// retentionCutoff returns the time users must have been active since to not
+// have been inactive for the given number of whole seasons before now.
+func retentionCutoff(now time.Time, seasons int) time.Time {
+	return time.Date(now.Year()-seasons, time.January, 1, 0, 0, 0, 0, now.Location())
+}
+
+// purgeInactiveUsers deletes users who have been inactive for longer than the
+// retention period, checking every hour until ctx is done.
+func (s *Server) purgeInactiveUsers(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.Store.PurgeInactiveUsers(ctx, retentionCutoff(time.Now().UTC(), s.RetentionSeasons))
+		if err != nil {
+			s.Logger.WithError(err).Error("purging inactive users")
+		} else if deleted > 0 {
+			s.Logger.WithField("deleted", deleted).Info("purged inactive users")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
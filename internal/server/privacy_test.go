@@ -0,0 +1,151 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestUserPrivacy(t *testing.T) {
+	ctx := context.Background()
+
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+	event := ts.seedMatch()
+
+	realmID := int64(1)
+	scouts := make([]store.User, 0)
+	for _, username := range []string{"anonymized", "deleted"} {
+		if err := sto.CreateUser(ctx, store.User{Username: username, RealmID: realmID, Role: store.RoleScout, Stars: []string{event.Key}}); err != nil {
+			t.Fatalf("did not expect error %v creating user", err)
+		}
+
+		u, err := sto.GetUserByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("did not expect error %v getting user", err)
+		}
+		scouts = append(scouts, u)
+
+		if _, _, err := sto.UpsertReport(ctx, store.Report{EventKey: event.Key, MatchKey: "qm1", TeamKey: "frc1", ReporterID: &u.ID, RealmID: &realmID, Comment: "Fast climber"}); err != nil {
+			t.Fatalf("did not expect error %v upserting report", err)
+		}
+	}
+	anonymized, deleted := scouts[0], scouts[1]
+
+	admin := ts.token(store.User{ID: 100, RealmID: realmID, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()})
+
+	if rr := ts.do(http.MethodGet, fmt.Sprintf("/users/%d/export", deleted.ID), ts.token(anonymized), nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d exporting another user as a scout, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr := ts.do(http.MethodGet, fmt.Sprintf("/users/%d/export", anonymized.ID), ts.token(anonymized), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d exporting own data, got %d", http.StatusOK, rr.Code)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("did not expect error %v reading export", err)
+	}
+
+	files := make(map[string]interface{})
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("did not expect error %v opening %s", err, f.Name)
+		}
+
+		var v interface{}
+		if err := json.NewDecoder(rc).Decode(&v); err != nil {
+			t.Errorf("did not expect error %v decoding %s", err, f.Name)
+		}
+		rc.Close()
+
+		files[f.Name] = v
+	}
+
+	if profile, ok := files["profile.json"].(map[string]interface{}); !ok || profile["username"] != anonymized.Username {
+		t.Errorf("expected export to have the user's profile, got %v", files["profile.json"])
+	}
+	for _, name := range []string{"reports.json", "comments.json", "stars.json"} {
+		if v, ok := files[name].([]interface{}); !ok || len(v) != 1 {
+			t.Errorf("expected export %s to have 1 entry, got %v", name, files[name])
+		}
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/users/%d?reports=shred", anonymized.ID), admin, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d deleting with an unknown reports mode, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/users/%d", anonymized.ID), admin, nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d deleting user, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/users/%d?reports=delete", deleted.ID), admin, nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d deleting user with reports, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	reports, err := sto.GetReports(ctx, &event.Key, nil, nil, &realmID, nil)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting reports", err)
+	}
+	if len(reports) != 1 || reports[0].ReporterID != nil || reports[0].Comment != "Fast climber" {
+		t.Errorf("expected only the anonymized report to be left, got %+v", reports)
+	}
+
+	if err := sto.CreateUser(ctx, store.User{Username: "inactive", RealmID: realmID}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	inactive, err := sto.GetUserByUsername(ctx, "inactive")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting user", err)
+	}
+
+	if err := sto.CreateUser(ctx, store.User{Username: "scripted", RealmID: realmID}); err != nil {
+		t.Fatalf("did not expect error %v creating user", err)
+	}
+	scripted, err := sto.GetUserByUsername(ctx, "scripted")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting user", err)
+	}
+
+	keyID, err := sto.CreateAPIKey(ctx, store.APIKey{Name: "Scouting sheet", UserID: scripted.ID, RealmID: realmID})
+	if err != nil {
+		t.Fatalf("did not expect error %v creating API key", err)
+	}
+
+	// a user who only uses an API key is still active
+	now := time.Now().UTC()
+	if err := sto.TouchAPIKey(ctx, keyID, now.AddDate(1, 0, 0)); err != nil {
+		t.Fatalf("did not expect error %v touching API key", err)
+	}
+
+	if deleted, err := sto.PurgeInactiveUsers(ctx, retentionCutoff(now, 1)); err != nil || deleted != 0 {
+		t.Errorf("expected recently active user to be kept, got %d, %v", deleted, err)
+	}
+	if deleted, err := sto.PurgeInactiveUsers(ctx, retentionCutoff(now.AddDate(2, 0, 0), 1)); err != nil || deleted != 1 {
+		t.Errorf("expected user inactive for a season to be purged, got %d, %v", deleted, err)
+	}
+	if _, err := sto.GetUserByID(ctx, inactive.ID); !errors.Is(err, store.ErrNoResults{}) {
+		t.Errorf("expected inactive user to be gone, got %v", err)
+	}
+	if _, err := sto.GetUserByID(ctx, scripted.ID); err != nil {
+		t.Errorf("expected user active through an API key to be kept, got %v", err)
+	}
+}
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	if cutoff := retentionCutoff(now, 2); !cutoff.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected cutoff at the start of 2024, got %v", cutoff)
+	}
+}
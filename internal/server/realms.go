@@ -12,7 +12,6 @@ import (
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/gorilla/mux"
-	"github.com/jmoiron/sqlx"
 	validator "gopkg.in/go-playground/validator.v9"
 )
 
@@ -30,6 +29,10 @@ func (s *Server) createRealmHandler() http.HandlerFunc {
 			return
 		}
 
+		// settings are checked against the realm, so they're set after it
+		// exists
+		realm.Settings = store.RealmSettings{}
+
 		id, err := s.Store.InsertRealm(r.Context(), realm)
 		if errors.Is(err, store.ErrExists{}) {
 			ihttp.Error(w, http.StatusConflict)
@@ -103,14 +106,14 @@ func (s *Server) updateRealmHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 		userRealmID, err := ihttp.GetRealmID(r)
 		if err != nil {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
 
-		existed, err := editRealm(r.Context(), s.Store, roles, userRealmID, id, func(tx *sqlx.Tx) error {
+		existed, err := editRealm(r.Context(), s.Store, perms, userRealmID, id, func(tx *store.Tx) error {
 			if err := s.Store.UpdateRealmTx(r.Context(), tx, realm); err != nil {
 				return fmt.Errorf("unable to update realm %d: %w", realm.ID, err)
 			}
@@ -143,14 +146,14 @@ func (s *Server) deleteRealmHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 		userRealmID, err := ihttp.GetRealmID(r)
 		if err != nil {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
 
-		existed, err := editRealm(r.Context(), s.Store, roles, userRealmID, id, func(tx *sqlx.Tx) error {
+		existed, err := editRealm(r.Context(), s.Store, perms, userRealmID, id, func(tx *store.Tx) error {
 			if err := s.Store.DeleteRealmTx(r.Context(), tx, id); err != nil {
 				return fmt.Errorf("unable to delete realm %d: %w", id, err)
 			}
@@ -174,10 +177,10 @@ func (s *Server) deleteRealmHandler() http.HandlerFunc {
 	}
 }
 
-func editRealm(ctx context.Context, sto *store.Service, roles store.Roles, userRealmID, realmID int64, editFunc func(tx *sqlx.Tx) error) (existed bool, err error) {
+func editRealm(ctx context.Context, sto store.Store, perms store.Permissions, userRealmID, realmID int64, editFunc func(tx *store.Tx) error) (existed bool, err error) {
 	existed = true
 
-	err = sto.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	err = sto.DoTransaction(ctx, func(tx *store.Tx) error {
 		if err := sto.ExclusiveLockRealmsTx(ctx, tx); err != nil {
 			return fmt.Errorf("unable to lock realms for edit: %w", err)
 		}
@@ -189,12 +192,12 @@ func editRealm(ctx context.Context, sto *store.Service, roles store.Roles, userR
 
 		existed = exists
 
-		if !roles.IsAdmin && !roles.IsSuperAdmin {
-			return forbiddenError{errors.New("only super-admins and admins can edit realms")}
+		if !perms.Has(store.PermRealmsManage) {
+			return forbiddenError{errors.New("only users who manage realms can edit realms")}
 		}
 
-		if !roles.IsSuperAdmin && userRealmID != realmID {
-			return forbiddenError{errors.New("realm admins can only edit realms they belong to")}
+		if !perms.Has(store.PermGlobal) && userRealmID != realmID {
+			return forbiddenError{errors.New("users without global permissions can only edit realms they belong to")}
 		}
 
 		if err := editFunc(tx); err != nil {
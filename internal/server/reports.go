@@ -9,9 +9,9 @@ import (
 	"strconv"
 
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
-	"github.com/jmoiron/sqlx"
 
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
 	"github.com/gorilla/mux"
 )
 
@@ -57,7 +57,14 @@ func (s *Server) reportsHandler() http.HandlerFunc {
 			return
 		}
 
-		ihttp.Respond(w, reports, http.StatusOK)
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("getting realm settings")
+			return
+		}
+
+		ihttp.Respond(w, visibleReports(settings, realmID, reports), http.StatusOK)
 	}
 }
 
@@ -85,6 +92,18 @@ func (s *Server) reportHandler() http.HandlerFunc {
 			return
 		}
 
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("getting realm settings")
+			return
+		}
+
+		if len(visibleReports(settings, realmID, []store.Report{report})) == 0 {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		}
+
 		ihttp.Respond(w, report, http.StatusOK)
 	}
 }
@@ -131,7 +150,7 @@ func (s *Server) postReportHandler() http.HandlerFunc {
 		var status int
 		var reportID int64
 		err = editReport(r.Context(), s.Store, nil, nil,
-			func(tx *sqlx.Tx) error {
+			func(tx *store.Tx) error {
 				// make sure team is present at match, and the event is visible to user
 				present, err := s.Store.LockAlliance(r.Context(), tx, report.EventKey, report.MatchKey, report.TeamKey, &realmID)
 				if err != nil {
@@ -146,8 +165,8 @@ func (s *Server) postReportHandler() http.HandlerFunc {
 			},
 			func(_ *store.Report, _ *store.User) error {
 				return nil
-			}, func(tx *sqlx.Tx) error {
-				created, id, err := s.Store.UpsertReport(r.Context(), report)
+			}, func(tx *store.Tx) error {
+				created, id, err := s.Store.UpsertReportTx(r.Context(), tx, report)
 				if created {
 					status = http.StatusCreated
 				} else {
@@ -166,6 +185,8 @@ func (s *Server) postReportHandler() http.HandlerFunc {
 			return
 		}
 
+		metrics.ReportSubmitted(report.RealmID)
+
 		ihttp.Respond(w, reportID, status)
 	}
 }
@@ -195,7 +216,7 @@ func (s *Server) putReportHandler() http.HandlerFunc {
 
 		report.ID = id
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
 		reporterID, err := ihttp.GetSubject(r)
 		if err != nil {
@@ -211,13 +232,13 @@ func (s *Server) putReportHandler() http.HandlerFunc {
 		}
 
 		err = editReport(r.Context(), s.Store, &id, report.ReporterID,
-			func(tx *sqlx.Tx) error { return nil },
+			func(tx *store.Tx) error { return nil },
 			func(oldReport *store.Report, targetUser *store.User) error {
 				if oldReport == nil {
 					return store.ErrNoResults{}
 				}
 
-				if !roles.IsSuperAdmin && !roles.IsAdmin {
+				if !perms.Has(store.PermReportsManage) {
 					if report.ReporterID == nil || reporterID != *report.ReporterID ||
 						oldReport.ReporterID == nil || reporterID != *oldReport.ReporterID {
 						return forbiddenError{}
@@ -230,12 +251,12 @@ func (s *Server) putReportHandler() http.HandlerFunc {
 						return badRequestError{}
 					}
 
-					if !roles.IsSuperAdmin && targetUser.RealmID != realmID {
+					if !perms.Has(store.PermGlobal) && targetUser.RealmID != realmID {
 						return forbiddenError{}
 					}
 				}
 
-				if !roles.IsSuperAdmin {
+				if !perms.Has(store.PermGlobal) {
 					if (report.RealmID == nil || realmID != *report.RealmID) ||
 						(oldReport.RealmID == nil || realmID != *oldReport.RealmID) {
 						return forbiddenError{}
@@ -243,7 +264,7 @@ func (s *Server) putReportHandler() http.HandlerFunc {
 				}
 
 				return nil
-			}, func(tx *sqlx.Tx) error {
+			}, func(tx *store.Tx) error {
 				return s.Store.UpdateReportTx(r.Context(), tx, report, replace)
 			})
 
@@ -283,7 +304,7 @@ func (s *Server) deleteReportHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 		userRealmID, err := ihttp.GetRealmID(r)
 		if err != nil {
 			ihttp.Error(w, http.StatusForbidden)
@@ -297,17 +318,17 @@ func (s *Server) deleteReportHandler() http.HandlerFunc {
 		}
 
 		err = editReport(r.Context(), s.Store, &id, nil,
-			func(tx *sqlx.Tx) error { return nil },
+			func(tx *store.Tx) error { return nil },
 			func(report *store.Report, _ *store.User) error {
 				if report == nil {
 					return store.ErrNoResults{}
 				}
 
-				if roles.IsSuperAdmin {
+				if perms.Has(store.PermGlobal) {
 					return nil
 				}
 
-				if report.RealmID != nil && userRealmID == *report.RealmID && roles.IsAdmin {
+				if report.RealmID != nil && userRealmID == *report.RealmID && perms.Has(store.PermReportsManage) {
 					return nil
 				}
 
@@ -316,7 +337,7 @@ func (s *Server) deleteReportHandler() http.HandlerFunc {
 				}
 
 				return forbiddenError{}
-			}, func(tx *sqlx.Tx) error {
+			}, func(tx *store.Tx) error {
 				return s.Store.DeleteReportTx(r.Context(), tx, id)
 			})
 
@@ -360,11 +381,11 @@ func (s *Server) leaderboardHandler() http.HandlerFunc {
 	}
 }
 
-func editReport(ctx context.Context, s *store.Service, reportID, userID *int64,
-	lockFunc func(tx *sqlx.Tx) error,
+func editReport(ctx context.Context, s store.Store, reportID, userID *int64,
+	lockFunc func(tx *store.Tx) error,
 	validationFunc func(oldReport *store.Report, targetUser *store.User) error,
-	editFunc func(tx *sqlx.Tx) error) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	editFunc func(tx *store.Tx) error) error {
+	return s.DoTransaction(ctx, func(tx *store.Tx) error {
 		var oldReport *store.Report
 		if reportID != nil {
 			report, err := s.LockReport(ctx, tx, *reportID)
@@ -5,61 +5,111 @@ import (
 	"time"
 
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/gorilla/mux"
 )
 
 func (s *Server) registerRoutes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(ihttp.Metrics, ihttp.TraceRoute, s.limitBody)
 
-	r.Handle("/", healthHandler(s.uptime, s.TBA, s.Store)).Methods(http.MethodGet)
+	r.Handle("/", healthHandler(s.uptime, s.TBA, s.Store, s.Schema)).Methods(http.MethodGet)
 	r.Handle("/openapi.yaml", openAPIHandler(openAPI)).Methods(http.MethodGet)
+	r.Handle("/metrics", ihttp.Require(metrics.Handler().ServeHTTP, store.PermGlobal)).Methods(http.MethodGet)
+	r.Handle("/.well-known/jwks.json", jwksHandler(s.keys())).Methods(http.MethodGet)
 
-	r.Handle("/authenticate", authenticateHandler(s.Logger, time.Now, s.Store, s.JWTSecret)).Methods(http.MethodPost)
-	r.Handle("/refresh", refreshHandler(s.Logger, time.Now, s.Store, s.JWTSecret)).Methods(http.MethodPost)
+	limits := newLoginLimits()
 
-	r.Handle("/users", s.createUserHandler()).Methods(http.MethodPost)
-	r.Handle("/users", ihttp.ACL(s.getUsersHandler(), false, false, true)).Methods(http.MethodGet)
-	r.Handle("/users/{id}", ihttp.ACL(s.getUserByIDHandler(), false, false, true)).Methods(http.MethodGet)
-	r.Handle("/users/{id}", ihttp.ACL(s.patchUserHandler(), false, false, true)).Methods(http.MethodPatch)
-	r.Handle("/users/{id}", ihttp.ACL(s.deleteUserHandler(), false, false, true)).Methods(http.MethodDelete)
+	r.Handle("/authenticate", authenticateHandler(s.Logger, time.Now, s.Store, s.Store, s.Store, s.Store, limits, s.keys())).Methods(http.MethodPost)
+	r.Handle("/refresh", refreshHandler(s.Logger, time.Now, s.Store, s.Store, s.Store, s.keys())).Methods(http.MethodPost)
+
+	if s.OIDC != nil {
+		r.Handle("/oidc/login", s.oidcLoginHandler()).Methods(http.MethodGet)
+		r.Handle("/oidc/callback", s.oidcCallbackHandler()).Methods(http.MethodPost)
+	}
 
-	r.Handle("/schemas", ihttp.ACL(s.getSchemasHandler(), false, false, false)).Methods(http.MethodGet)
-	r.Handle("/schemas", ihttp.ACL(s.createSchemaHandler(), true, true, true)).Methods(http.MethodPost)
-	r.Handle("/schemas/{id}", ihttp.ACL(s.getSchemaByIDHandler(), false, false, false)).Methods(http.MethodGet)
+	r.Handle("/password-reset", s.passwordResetHandler(newResetLimits())).Methods(http.MethodPost)
+	r.Handle("/password-reset/confirm", s.confirmPasswordResetHandler()).Methods(http.MethodPost)
+
+	r.Handle("/users", s.createUserHandler()).Methods(http.MethodPost)
+	r.Handle("/users", ihttp.Require(s.getUsersHandler())).Methods(http.MethodGet)
+	r.Handle("/users/pending", ihttp.Require(s.pendingUsersHandler(), store.PermUsersManage)).Methods(http.MethodGet)
+	r.Handle("/users/{id}", ihttp.Require(s.getUserByIDHandler())).Methods(http.MethodGet)
+	r.Handle("/users/{id}", ihttp.Require(s.patchUserHandler())).Methods(http.MethodPatch)
+	r.Handle("/users/{id}", ihttp.Require(s.deleteUserHandler())).Methods(http.MethodDelete)
+	r.Handle("/users/{id}/unlock", ihttp.Require(s.unlockUserHandler(limits), store.PermUsersManage)).Methods(http.MethodPost)
+	r.Handle("/users/{id}/approve", ihttp.Require(s.approveUserHandler(), store.PermUsersManage)).Methods(http.MethodPost)
+	r.Handle("/users/{id}/reject", ihttp.Require(s.rejectUserHandler(), store.PermUsersManage)).Methods(http.MethodPost)
+	r.Handle("/users/{id}/export", ihttp.Require(s.exportUserHandler())).Methods(http.MethodGet)
+	r.Handle("/users/{id}/sessions", ihttp.Require(s.sessionsHandler())).Methods(http.MethodGet)
+	r.Handle("/users/{id}/memberships", ihttp.Require(s.userMembershipsHandler())).Methods(http.MethodGet)
+	r.Handle("/users/{id}/sessions", ihttp.Require(s.deleteSessionsHandler())).Methods(http.MethodDelete)
+	r.Handle("/users/{id}/sessions/{sessionId}", ihttp.Require(s.deleteSessionHandler())).Methods(http.MethodDelete)
+
+	r.Handle("/apikeys", ihttp.Require(s.apiKeysHandler(), store.PermUsersManage)).Methods(http.MethodGet)
+	r.Handle("/apikeys", ihttp.Require(s.createAPIKeyHandler(), store.PermUsersManage)).Methods(http.MethodPost)
+	r.Handle("/apikeys/{id}", ihttp.Require(s.deleteAPIKeyHandler(), store.PermUsersManage)).Methods(http.MethodDelete)
+
+	r.Handle("/login-failures", ihttp.Require(s.loginFailuresHandler(), store.PermUsersManage)).Methods(http.MethodGet)
+
+	r.Handle("/invites", ihttp.Require(s.invitesHandler(), store.PermUsersManage)).Methods(http.MethodGet)
+	r.Handle("/invites", ihttp.Require(s.createInviteHandler(), store.PermUsersManage)).Methods(http.MethodPost)
+	r.Handle("/invites/accept", s.acceptInviteHandler()).Methods(http.MethodPost)
+	r.Handle("/invites/{id}", ihttp.Require(s.deleteInviteHandler(), store.PermUsersManage)).Methods(http.MethodDelete)
+
+	r.Handle("/schemas", s.getSchemasHandler()).Methods(http.MethodGet)
+	r.Handle("/schemas", ihttp.Require(s.createSchemaHandler(), store.PermSchemasManage)).Methods(http.MethodPost)
+	r.Handle("/schemas/{id}", s.getSchemaByIDHandler()).Methods(http.MethodGet)
 
 	r.Handle("/years", s.eventYearsHandler()).Methods(http.MethodGet)
 
 	r.Handle("/events", s.eventsHandler()).Methods(http.MethodGet)
-	r.Handle("/events/{eventKey}", ihttp.ACL(s.upsertEventHandler(), true, true, true)).Methods(http.MethodPut)
+	r.Handle("/events/{eventKey}", ihttp.Require(s.upsertEventHandler(), store.PermEventsManage)).Methods(http.MethodPut)
 	r.Handle("/events/{eventKey}", s.eventHandler()).Methods(http.MethodGet)
 
 	r.Handle("/events/{eventKey}/stats", s.eventStats()).Methods(http.MethodGet)
 
 	r.Handle("/events/{eventKey}/matches", s.matchesHandler()).Methods(http.MethodGet)
 	r.Handle("/events/{eventKey}/matches/{matchKey}", s.matchHandler()).Methods(http.MethodGet)
-	r.Handle("/events/{eventKey}/matches/{matchKey}", ihttp.ACL(s.upsertMatchHandler(), true, true, true)).Methods(http.MethodPut)
-	r.Handle("/events/{eventKey}/matches/{matchKey}", ihttp.ACL(s.deleteMatchHandler(), true, true, true)).Methods(http.MethodDelete)
+	r.Handle("/events/{eventKey}/matches/{matchKey}", ihttp.Require(s.upsertMatchHandler(), store.PermEventsManage)).Methods(http.MethodPut)
+	r.Handle("/events/{eventKey}/matches/{matchKey}", ihttp.Require(s.deleteMatchHandler(), store.PermEventsManage)).Methods(http.MethodDelete)
 
 	r.Handle("/events/{eventKey}/teams", s.eventTeamsHandler()).Methods(http.MethodGet)
 	r.Handle("/events/{eventKey}/teams/{teamKey}", s.eventTeamHandler()).Methods(http.MethodGet)
 
 	r.Handle("/events/{eventKey}/matches/{matchKey}/teams/{teamKey}/stats", s.matchTeamStats()).Methods(http.MethodGet)
 
-	r.Handle("/reports", ihttp.ACL(s.reportsHandler(), false, false, false)).Methods(http.MethodGet)
-	r.Handle("/reports", ihttp.ACL(s.postReportHandler(), false, true, true)).Methods(http.MethodPost)
-	r.Handle("/reports/{id}", ihttp.ACL(s.reportHandler(), false, false, false)).Methods(http.MethodGet)
-	r.Handle("/reports/{id}", ihttp.ACL(s.putReportHandler(), false, true, true)).Methods(http.MethodPut)
-	r.Handle("/reports/{id}", ihttp.ACL(s.deleteReportHandler(), false, true, true)).Methods(http.MethodDelete)
+	r.Handle("/reports", s.reportsHandler()).Methods(http.MethodGet)
+	r.Handle("/reports", ihttp.Require(s.postReportHandler(), store.PermReportsWrite)).Methods(http.MethodPost)
+	r.Handle("/reports/{id}", s.reportHandler()).Methods(http.MethodGet)
+	r.Handle("/reports/{id}", ihttp.Require(s.putReportHandler(), store.PermReportsWrite)).Methods(http.MethodPut)
+	r.Handle("/reports/{id}", ihttp.Require(s.deleteReportHandler(), store.PermReportsWrite)).Methods(http.MethodDelete)
 
 	r.Handle("/leaderboard", s.leaderboardHandler()).Methods(http.MethodGet)
 
 	r.Handle("/realms", s.realmsHandler()).Methods(http.MethodGet)
 	r.Handle("/realms", s.createRealmHandler()).Methods(http.MethodPost)
+	r.Handle(restorePath, ihttp.Require(s.restoreRealmHandler(), store.PermRealmsManage, store.PermGlobal)).Methods(http.MethodPost)
 	r.Handle("/realms/{id}", s.realmHandler()).Methods(http.MethodGet)
-	r.Handle("/realms/{id}", ihttp.ACL(s.updateRealmHandler(), true, true, true)).Methods(http.MethodPost)
-	r.Handle("/realms/{id}", ihttp.ACL(s.deleteRealmHandler(), true, true, true)).Methods(http.MethodDelete)
+	r.Handle("/realms/{id}", ihttp.Require(s.updateRealmHandler(), store.PermRealmsManage)).Methods(http.MethodPost)
+	r.Handle("/realms/{id}", ihttp.Require(s.deleteRealmHandler(), store.PermRealmsManage)).Methods(http.MethodDelete)
+	r.Handle("/realms/{id}/backup", ihttp.Require(s.backupRealmHandler(), store.PermRealmsManage)).Methods(http.MethodGet)
+	r.Handle("/realms/{id}/settings", ihttp.Require(s.updateRealmSettingsHandler(), store.PermRealmsManage)).Methods(http.MethodPut)
+	r.Handle("/realms/{id}/members", ihttp.Require(s.realmMembersHandler(), store.PermUsersManage)).Methods(http.MethodGet)
+	r.Handle("/realms/{id}/members/{userId}", ihttp.Require(s.putRealmMemberHandler(), store.PermUsersManage)).Methods(http.MethodPut)
+	r.Handle("/realms/{id}/members/{userId}", ihttp.Require(s.deleteRealmMemberHandler())).Methods(http.MethodDelete)
+	r.Handle("/realms/{id}/shares", ihttp.Require(s.realmSharesHandler(), store.PermRealmsManage)).Methods(http.MethodGet)
+	r.Handle("/realms/{id}/shares", ihttp.Require(s.createRealmShareHandler(), store.PermRealmsManage)).Methods(http.MethodPost)
+	r.Handle("/realms/{id}/shares/{shareId}/accept", ihttp.Require(s.acceptRealmShareHandler(), store.PermRealmsManage)).Methods(http.MethodPost)
+	r.Handle("/realms/{id}/shares/{shareId}", ihttp.Require(s.deleteRealmShareHandler(), store.PermRealmsManage)).Methods(http.MethodDelete)
 
 	r.Handle("/teams/{teamKey}", s.teamHandler()).Methods(http.MethodGet)
+	r.Handle("/teams/{teamKey}/history", s.teamHistoryHandler()).Methods(http.MethodGet)
+	r.Handle("/teams/{teamKey}/stats", s.teamStatsHandler()).Methods(http.MethodGet)
+
+	r.Handle("/admin/refresh/status", ihttp.Require(s.refreshStatusHandler(), store.PermRefreshManage)).Methods(http.MethodGet)
+	r.Handle("/admin/refresh/events/{eventKey}", ihttp.Require(s.refreshEventHandler(), store.PermRefreshManage)).Methods(http.MethodPost)
 
 	return r
 }
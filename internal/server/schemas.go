@@ -19,8 +19,8 @@ func (s *Server) createSchemaHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
-		if schema.Year != nil && !roles.IsSuperAdmin {
+		perms := ihttp.GetPermissions(r)
+		if schema.Year != nil && !perms.Has(store.PermGlobal) {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
@@ -110,7 +110,7 @@ func (s *Server) getSchemaByIDHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
 		var realmID *int64
 		userRealmID, err := ihttp.GetRealmID(r)
@@ -118,7 +118,7 @@ func (s *Server) getSchemaByIDHandler() http.HandlerFunc {
 			realmID = &userRealmID
 		}
 
-		if schema.Year == nil && !roles.IsSuperAdmin && schema.RealmID != realmID {
+		if schema.Year == nil && !perms.Has(store.PermGlobal) && schema.RealmID != realmID {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
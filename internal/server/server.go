@@ -3,13 +3,17 @@ package server
 import (
 	"context"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	"github.com/Pigmice2733/peregrine-backend/internal/email"
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/signing"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	"github.com/Pigmice2733/peregrine-backend/internal/tba"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,39 +24,124 @@ var openAPI []byte
 type Server struct {
 	config.Server
 
-	TBA    *tba.Service
-	Store  *store.Service
+	TBA       *tba.Service
+	Store     store.Store
+	Refresher Refresher
+	Schema    SchemaChecker
+	// OIDC is the OpenID Connect provider users can log in with, or nil if
+	// OIDC login is disabled.
+	OIDC OIDCProvider
+	// Email sends invites and password resets.
+	Email email.Sender
+	// Keys signs and verifies tokens. If nil, tokens are signed with HS256
+	// and the JWT secret.
+	Keys   *signing.KeySet
 	Logger *logrus.Logger
 	start  time.Time
+	stats  statsCache
+	origin atomic.Value
+}
+
+const (
+	defaultReadTimeout  = time.Second * 15
+	defaultWriteTimeout = time.Second * 15
+	defaultIdleTimeout  = time.Second * 30
+	defaultMaxBodySize  = 1000000 // 1 MB
+
+	defaultMaxRestoreSize = 100000000 // 100 MB
+)
+
+func (s *Server) maxBodySize() int64 {
+	if s.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+
+	return s.MaxBodySize
+}
+
+func (s *Server) maxRestoreSize() int64 {
+	if s.MaxRestoreSize == 0 {
+		return defaultMaxRestoreSize
+	}
+
+	return s.MaxRestoreSize
+}
+
+// limitBody is middleware that limits request bodies to the max body size,
+// except for restoring realms, since backups are often larger.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	limited := ihttp.LimitBody(next, s.maxBodySize())
+	restore := ihttp.LimitBody(next, s.maxRestoreSize())
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if path, _ := route.GetPathTemplate(); path == restorePath {
+				restore.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) keys() *signing.KeySet {
+	if s.Keys == nil {
+		return signing.NewHMAC(s.JWTSecret)
+	}
+
+	return s.Keys
 }
 
 func (s *Server) uptime() time.Duration {
 	return time.Since(s.start)
 }
 
+// Reload applies the settings from c that can be changed while the server is
+// running: the log level and the CORS origin. Other settings are ignored.
+func (s *Server) Reload(c config.Server) {
+	s.Logger.SetLevel(c.LogLevel)
+	s.origin.Store(c.Origin)
+}
+
+func (s *Server) allowedOrigin() string {
+	if origin, ok := s.origin.Load().(string); ok {
+		return origin
+	}
+
+	return s.Origin
+}
+
 // Run starts the server, and returns if it runs into an error
 func (s *Server) Run(ctx context.Context) error {
+	s.Store.OnEventChange(s.stats.invalidate)
+
 	router := s.registerRoutes()
 
 	var handler http.Handler = router
-	handler = ihttp.LimitBody(handler)
 	handler = gziphandler.GzipHandler(handler)
 	handler = ihttp.Log(handler, s.Logger)
-	handler = ihttp.Auth(handler, s.JWTSecret)
-	handler = ihttp.CORS(handler, s.Origin)
+	handler = ihttp.Auth(handler, s.keys(), s.Store)
+	handler = ihttp.CORS(handler, s.allowedOrigin)
+	handler = ihttp.Trace(handler)
 
 	httpServer := &http.Server{
 		Addr:              s.Listen,
 		Handler:           handler,
-		ReadTimeout:       time.Second * 15,
-		ReadHeaderTimeout: time.Second * 15,
-		WriteTimeout:      time.Second * 15,
-		IdleTimeout:       time.Second * 30,
+		ReadTimeout:       s.ReadTimeout.Or(defaultReadTimeout),
+		ReadHeaderTimeout: s.ReadTimeout.Or(defaultReadTimeout),
+		WriteTimeout:      s.WriteTimeout.Or(defaultWriteTimeout),
+		IdleTimeout:       s.IdleTimeout.Or(defaultIdleTimeout),
 		MaxHeaderBytes:    4096,
 	}
 
 	s.start = time.Now()
 
+	go s.deleteRejectedUsers(ctx)
+	if s.RetentionSeasons > 0 {
+		go s.purgeInactiveUsers(ctx)
+	}
+
 	errs := make(chan error)
 	go func() {
 		s.Logger.WithField("httpAddress", s.Listen).Info("serving http")
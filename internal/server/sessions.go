@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+)
+
+const (
+	tokenIDLength       = 16
+	maxDeviceNameLength = 64
+)
+
+// SessionCreator is used for starting a session when a user logs in.
+type SessionCreator interface {
+	CreateSession(ctx context.Context, session store.Session) (int64, error)
+}
+
+// SessionRotator is used for replacing the refresh token of a session. It
+// should return store.ErrNoResults if the session doesn't exist, and false if
+// the old token ID has already been replaced.
+type SessionRotator interface {
+	RotateSession(ctx context.Context, session store.Session, oldTokenID string) (rotated bool, err error)
+}
+
+// generateTokenID returns a new random refresh token ID.
+func generateTokenID() (string, error) {
+	b := make([]byte, tokenIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func generateRefreshToken(user store.User, session store.Session, signer TokenSigner) (string, error) {
+	return signer.Sign(&ihttp.RefreshClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: session.ExpiresAt.Unix(),
+			Id:        session.TokenID,
+			Subject:   strconv.FormatInt(user.ID, 10),
+		},
+		PasswordChanged: user.PasswordChanged.Unix(),
+		SessionID:       session.ID,
+		RealmID:         user.RealmID,
+		Type:            ihttp.TokenTypeRefresh,
+	})
+}
+
+// issueTokens starts a new session for a user who just logged in, and returns
+// an access token and the session's first refresh token.
+func issueTokens(r *http.Request, now time.Time, sessions SessionCreator, user store.User, device string, signer TokenSigner) (authenticateResponse, error) {
+	accessToken, err := generateAccessToken(user, now.Add(accessTokenDuration), signer)
+	if err != nil {
+		return authenticateResponse{}, fmt.Errorf("unable to generate access token: %w", err)
+	}
+
+	tokenID, err := generateTokenID()
+	if err != nil {
+		return authenticateResponse{}, fmt.Errorf("unable to generate refresh token ID: %w", err)
+	}
+
+	session := store.Session{
+		UserID:     user.ID,
+		TokenID:    tokenID,
+		DeviceName: deviceName(r, device),
+		IPAddress:  remoteIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenDuration),
+	}
+
+	session.ID, err = sessions.CreateSession(r.Context(), session)
+	if err != nil {
+		return authenticateResponse{}, fmt.Errorf("unable to create session: %w", err)
+	}
+
+	refreshToken, err := generateRefreshToken(user, session, signer)
+	if err != nil {
+		return authenticateResponse{}, fmt.Errorf("unable to generate refresh token: %w", err)
+	}
+
+	return authenticateResponse{accessToken, refreshToken}, nil
+}
+
+// remoteIP returns the IP address a request came from.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// deviceName returns the name of the device a user is logging in from,
+// falling back to the user agent if the client didn't name it.
+func deviceName(r *http.Request, name string) string {
+	if name == "" {
+		name = r.UserAgent()
+	}
+
+	if len(name) > maxDeviceNameLength {
+		name = name[:maxDeviceNameLength]
+	}
+
+	return name
+}
+
+// managedUserID returns the ID of the user in the route, or writes an error
+// response and returns false if the requester can't manage them. Anyone can
+// manage themselves, like their own sessions, and users who could edit another
+// user can manage them too.
+func (s *Server) managedUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	targetID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return 0, false
+	}
+
+	subjectID, err := ihttp.GetSubject(r)
+	if err != nil {
+		ihttp.Error(w, http.StatusForbidden)
+		return 0, false
+	}
+
+	if targetID == subjectID {
+		return targetID, true
+	}
+
+	if !ihttp.GetPermissions(r).Has(store.PermUsersManage) {
+		ihttp.Error(w, http.StatusForbidden)
+		return 0, false
+	}
+
+	targetUser, err := s.Store.GetUserByID(r.Context(), targetID)
+	if errors.Is(err, store.ErrNoResults{}) {
+		ihttp.Error(w, http.StatusNotFound)
+		return 0, false
+	} else if err != nil {
+		s.Logger.WithError(err).Error("getting user")
+		ihttp.Error(w, http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if !canManageUser(r, targetUser.RealmID, targetUser.Permissions) {
+		ihttp.Error(w, http.StatusForbidden)
+		return 0, false
+	}
+
+	return targetID, true
+}
+
+// sessionsHandler returns a handler to get the unexpired sessions of a user.
+func (s *Server) sessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := s.managedUserID(w, r)
+		if !ok {
+			return
+		}
+
+		sessions, err := s.Store.GetSessions(r.Context(), userID, time.Now())
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving sessions")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, sessions, http.StatusOK)
+	}
+}
+
+// deleteSessionHandler returns a handler to revoke a session of a user. Access
+// tokens issued to the session remain valid until they expire.
+func (s *Server) deleteSessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := s.managedUserID(w, r)
+		if !ok {
+			return
+		}
+
+		sessionID, err := strconv.ParseInt(mux.Vars(r)["sessionId"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		err = s.Store.DeleteSession(r.Context(), userID, sessionID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("deleting session")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteSessionsHandler returns a handler to revoke every session of a user.
+func (s *Server) deleteSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := s.managedUserID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.Store.DeleteSessions(r.Context(), userID); err != nil {
+			s.Logger.WithError(err).Error("deleting sessions")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("did not expect error %v hashing password", err)
+	}
+
+	for _, u := range []store.User{
+		{Username: "scout", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleScout},
+		{Username: "admin", HashedPassword: hashedPassword, RealmID: 1, Role: store.RoleRealmAdmin},
+	} {
+		if err := sto.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("did not expect error %v creating user", err)
+		}
+	}
+
+	scout, _ := sto.GetUserByUsername(context.Background(), "scout")
+	admin, _ := sto.GetUserByUsername(context.Background(), "admin")
+
+	login := func(username string) authenticateResponse {
+		rr := ts.do(http.MethodPost, "/authenticate", "", authenticateRequest{
+			baseUser:   baseUser{Username: username, Password: "password"},
+			DeviceName: "Pit tablet",
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d logging in, got %d", http.StatusOK, rr.Code)
+		}
+
+		var tokens authenticateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+			t.Fatalf("did not expect error %v decoding tokens", err)
+		}
+
+		return tokens
+	}
+
+	refresh := func(refreshToken string) (*httptest.ResponseRecorder, authenticateResponse) {
+		rr := ts.do(http.MethodPost, "/refresh", "", refreshRequest{RefreshToken: refreshToken})
+
+		var tokens authenticateResponse
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+				t.Fatalf("did not expect error %v decoding tokens", err)
+			}
+		}
+
+		return rr, tokens
+	}
+
+	first := login("scout")
+
+	rr, second := refresh(first.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d refreshing, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr, _ := refresh(first.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d reusing refresh token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	if rr, _ := refresh(second.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d refreshing after reuse revoked the session, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	tablet := login("scout")
+
+	sessions, err := sto.GetSessions(context.Background(), scout.ID, time.Now())
+	if err != nil {
+		t.Fatalf("did not expect error %v getting sessions", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].DeviceName != "Pit tablet" {
+		t.Fatalf("expected one session for the pit tablet, got %+v", sessions)
+	}
+
+	sessionsPath := fmt.Sprintf("/users/%d/sessions", scout.ID)
+	if rr := ts.do(http.MethodGet, sessionsPath, tablet.RefreshToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d using a refresh token as an access token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	if rr, _ := refresh(tablet.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d refreshing with an access token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodGet, sessionsPath, tablet.AccessToken, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d getting own sessions, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodGet, fmt.Sprintf("/users/%d/sessions", admin.ID), tablet.AccessToken, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d getting another user's sessions, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	adminTokens := login("admin")
+	if rr := ts.do(http.MethodGet, sessionsPath, adminTokens.AccessToken, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d getting realm member's sessions, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("%s/%d", sessionsPath, sessions[0].ID), adminTokens.AccessToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d revoking realm member's session, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr, _ := refresh(tablet.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d refreshing revoked session, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
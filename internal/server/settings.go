@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// realmSettings retrieves the settings of the realm a request acts in.
+// Requests outside of a realm, or in a realm that no longer exists, get the
+// default settings.
+func (s *Server) realmSettings(ctx context.Context, realmID *int64) (store.RealmSettings, error) {
+	if realmID == nil {
+		return store.RealmSettings{}, nil
+	}
+
+	realm, err := s.Store.GetRealm(ctx, *realmID)
+	if errors.Is(err, store.ErrNoResults{}) {
+		return store.RealmSettings{}, nil
+	} else if err != nil {
+		return store.RealmSettings{}, fmt.Errorf("unable to get realm settings: %w", err)
+	}
+
+	return realm.Settings, nil
+}
+
+// visibleReports filters reports down to the realm's own reports if its
+// settings say to only use those.
+func visibleReports(settings store.RealmSettings, realmID *int64, reports []store.Report) []store.Report {
+	if !settings.OnlyOwnReports() || realmID == nil {
+		return reports
+	}
+
+	own := make([]store.Report, 0, len(reports))
+	for _, r := range reports {
+		if r.RealmID != nil && *r.RealmID == *realmID {
+			own = append(own, r)
+		}
+	}
+
+	return own
+}
+
+// eventSchemaID returns the schema a realm summarizes an event with. Events
+// that don't belong to a realm use the realm's default schema for their year
+// if it has one.
+func eventSchemaID(settings store.RealmSettings, eventRealmID *int64, start time.Time, schemaID *int64) *int64 {
+	if eventRealmID == nil {
+		if id, ok := settings.DefaultSchemas[start.Year()]; ok {
+			return &id
+		}
+	}
+
+	return schemaID
+}
+
+// checkRealmSettings checks the settings that struct tags can't: that the
+// timezone exists, that default schemas are the realm's own schemas or the
+// standard schema for their year, and that default stars are events visible to
+// the realm.
+func (s *Server) checkRealmSettings(ctx context.Context, realmID int64, settings store.RealmSettings) (bool, error) {
+	if settings.Timezone != "" {
+		if _, err := time.LoadLocation(settings.Timezone); err != nil {
+			return false, nil
+		}
+	}
+
+	for year, schemaID := range settings.DefaultSchemas {
+		schema, err := s.Store.GetSchemaByID(ctx, schemaID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("unable to get default schema: %w", err)
+		}
+
+		own := schema.RealmID != nil && *schema.RealmID == realmID
+		standard := schema.RealmID == nil && schema.Year != nil && *schema.Year == int64(year)
+		if !own && !standard {
+			return false, nil
+		}
+	}
+
+	for _, eventKey := range settings.DefaultStars {
+		_, err := s.Store.GetEventForRealm(ctx, eventKey, &realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("unable to get default star event: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// updateRealmSettingsHandler returns a handler to replace the settings of a
+// realm.
+func (s *Server) updateRealmSettingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
+		var settings store.RealmSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(settings); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		perms := ihttp.GetPermissions(r)
+		userRealmID, err := ihttp.GetRealmID(r)
+		if err != nil || !canManageRealm(r, id) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		if ok, err := s.checkRealmSettings(r.Context(), id, settings); err != nil {
+			s.Logger.WithError(err).Error("checking realm settings")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		} else if !ok {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		existed, err := editRealm(r.Context(), s.Store, perms, userRealmID, id, func(tx *store.Tx) error {
+			if err := s.Store.UpdateRealmSettingsTx(r.Context(), tx, id, settings); err != nil {
+				return fmt.Errorf("unable to update realm %d settings: %w", id, err)
+			}
+
+			return nil
+		})
+		if errors.Is(err, forbiddenError{}) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		} else if errors.Is(err, store.ErrNoResults{}) || (err == nil && !existed) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("updating realm settings")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestRealmSettings(t *testing.T) {
+	ctx := context.Background()
+
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	publicRealm, err := sto.InsertRealm(ctx, store.Realm{Name: "Public", ShareReports: true})
+	if err != nil {
+		t.Fatalf("did not expect error %v inserting realm", err)
+	}
+
+	event := ts.seedMatch()
+
+	ownRealm := int64(1)
+	for _, realmID := range []int64{ownRealm, publicRealm} {
+		realmID := realmID
+		if _, _, err := sto.UpsertReport(ctx, store.Report{EventKey: event.Key, MatchKey: "qm1", TeamKey: "frc1", RealmID: &realmID}); err != nil {
+			t.Fatalf("did not expect error %v upserting report", err)
+		}
+	}
+
+	token := func(realmID int64) string {
+		return ts.token(store.User{ID: realmID, RealmID: realmID, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()})
+	}
+	admin, publicAdmin := token(ownRealm), token(publicRealm)
+
+	reports := func() int {
+		t.Helper()
+
+		var reports []store.Report
+		rr := ts.do(http.MethodGet, "/reports?event="+event.Key, admin, nil)
+		if err := json.NewDecoder(rr.Body).Decode(&reports); err != nil {
+			t.Fatalf("did not expect error %v decoding reports", err)
+		}
+		return len(reports)
+	}
+
+	if n := reports(); n != 2 {
+		t.Errorf("expected to see own and public reports by default, got %d", n)
+	}
+
+	invalid := []store.RealmSettings{
+		{PrimaryColor: "blue"},
+		{Timezone: "Mars/Olympus_Mons"},
+		{ReportVisibility: "everyone"},
+		{DefaultSchemas: map[int]int64{2019: 42}},
+		{DefaultStars: []string{"2019nope"}},
+	}
+	for _, settings := range invalid {
+		if rr := ts.do(http.MethodPut, "/realms/1/settings", admin, settings); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d for settings %+v, got %d", http.StatusUnprocessableEntity, settings, rr.Code)
+		}
+	}
+
+	if err := sto.CreateSchema(ctx, store.Schema{RealmID: &ownRealm}); err != nil {
+		t.Fatalf("did not expect error %v creating schema", err)
+	}
+	schemas, err := sto.GetSchemasForRealm(ctx, &ownRealm)
+	if err != nil {
+		t.Fatalf("did not expect error %v getting schemas", err)
+	}
+	var ownSchema int64
+	for _, schema := range schemas {
+		if schema.RealmID != nil && *schema.RealmID == ownRealm {
+			ownSchema = schema.ID
+		}
+	}
+
+	settings := store.RealmSettings{
+		HomeTeamKey:      "frc2733",
+		DefaultSchemas:   map[int]int64{2019: ownSchema},
+		Timezone:         "America/Los_Angeles",
+		DefaultStars:     []string{event.Key},
+		ReportVisibility: store.ReportVisibilityRealm,
+		PrimaryColor:     "#1a2b3c",
+	}
+
+	if rr := ts.do(http.MethodPut, "/realms/1/settings", publicAdmin, settings); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d updating another realm's settings, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPut, "/realms/1/settings", admin, settings); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d updating settings, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	var realm store.Realm
+	rr := ts.do(http.MethodGet, "/realms/1", "", nil)
+	if err := json.NewDecoder(rr.Body).Decode(&realm); err != nil {
+		t.Fatalf("did not expect error %v decoding realm", err)
+	}
+	if realm.Settings.HomeTeamKey != settings.HomeTeamKey || realm.Settings.Timezone != settings.Timezone || realm.Settings.PrimaryColor != settings.PrimaryColor {
+		t.Errorf("expected realm to have updated settings, got %+v", realm.Settings)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/1", admin, store.Realm{ID: ownRealm, Name: "Renamed"}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d updating realm, got %d", http.StatusNoContent, rr.Code)
+	}
+	if realm, err := sto.GetRealm(ctx, ownRealm); err != nil || realm.Settings.HomeTeamKey != settings.HomeTeamKey {
+		t.Errorf("expected updating realm to keep settings, got %+v, %v", realm.Settings, err)
+	}
+
+	if n := reports(); n != 1 {
+		t.Errorf("expected to only see own reports, got %d", n)
+	}
+
+	ru := requestUser{baseUser: baseUser{Username: "scout", Password: "password"}, RealmID: ownRealm, FirstName: "Ada", LastName: "Lovelace", Role: store.RoleViewer}
+	if rr := ts.do(http.MethodPost, "/users", admin, ru); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d creating user, got %d", http.StatusCreated, rr.Code)
+	}
+	scout, err := sto.GetUserByUsername(ctx, "scout")
+	if err != nil {
+		t.Fatalf("did not expect error %v getting user", err)
+	}
+	if u, err := sto.GetUserByID(ctx, scout.ID); err != nil || len(u.Stars) != 1 || u.Stars[0] != event.Key {
+		t.Errorf("expected new user to start with default stars, got %+v, %v", u.Stars, err)
+	}
+}
+
+func TestEventSchemaID(t *testing.T) {
+	eventSchema, defaultSchema, realmID := int64(1), int64(2), int64(3)
+	settings := store.RealmSettings{DefaultSchemas: map[int]int64{2019: defaultSchema}}
+	start := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if id := eventSchemaID(settings, nil, start, &eventSchema); id == nil || *id != defaultSchema {
+		t.Errorf("expected default schema for public event, got %v", id)
+	}
+
+	if id := eventSchemaID(settings, &realmID, start, &eventSchema); id == nil || *id != eventSchema {
+		t.Errorf("expected realm event to keep its schema, got %v", id)
+	}
+
+	if id := eventSchemaID(settings, nil, start.AddDate(1, 0, 0), &eventSchema); id == nil || *id != eventSchema {
+		t.Errorf("expected event without a default for its year to keep its schema, got %v", id)
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/gorilla/mux"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// canManageRealm returns whether the requester can manage the sharing of a
+// realm.
+func canManageRealm(r *http.Request, realmID int64) bool {
+	perms := ihttp.GetPermissions(r)
+	if !perms.Has(store.PermRealmsManage) {
+		return false
+	}
+
+	if perms.Has(store.PermGlobal) {
+		return true
+	}
+
+	id, err := ihttp.GetRealmID(r)
+	return err == nil && id == realmID
+}
+
+// realmShareVars parses the realm ID of a share route and checks that the
+// requester manages the realm, writing an error response and returning false
+// if not.
+func realmShareVars(w http.ResponseWriter, r *http.Request) (realmID int64, ok bool) {
+	realmID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return 0, false
+	}
+
+	if !canManageRealm(r, realmID) {
+		ihttp.Error(w, http.StatusForbidden)
+		return 0, false
+	}
+
+	return realmID, true
+}
+
+// realmShare retrieves the share in the route, writing an error response and
+// returning false if it doesn't exist or the realm isn't a party to it.
+func (s *Server) realmShare(w http.ResponseWriter, r *http.Request, realmID int64) (store.RealmShare, bool) {
+	shareID, err := strconv.ParseInt(mux.Vars(r)["shareId"], 10, 64)
+	if err != nil {
+		ihttp.Error(w, http.StatusBadRequest)
+		return store.RealmShare{}, false
+	}
+
+	share, err := s.Store.GetRealmShare(r.Context(), shareID)
+	if errors.Is(err, store.ErrNoResults{}) || (err == nil && share.RealmID != realmID && share.PartnerRealmID != realmID) {
+		ihttp.Error(w, http.StatusNotFound)
+		return share, false
+	} else if err != nil {
+		s.Logger.WithError(err).Error("getting realm share")
+		ihttp.Error(w, http.StatusInternalServerError)
+		return share, false
+	}
+
+	return share, true
+}
+
+// realmSharesHandler returns a handler to get the shares a realm has offered
+// and been offered.
+func (s *Server) realmSharesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, ok := realmShareVars(w, r)
+		if !ok {
+			return
+		}
+
+		shares, err := s.Store.GetRealmShares(r.Context(), realmID)
+		if err != nil {
+			s.Logger.WithError(err).Error("retrieving realm shares")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, shares, http.StatusOK)
+	}
+}
+
+// createRealmShareHandler returns a handler to offer to share a realm's
+// reports with a partner realm. Shares for an event are scoped to the year of
+// the event too.
+func (s *Server) createRealmShareHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, ok := realmShareVars(w, r)
+		if !ok {
+			return
+		}
+
+		var share store.RealmShare
+		if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := validator.New().Struct(share); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if share.PartnerRealmID == realmID {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if share.EventKey != nil {
+			event, err := s.Store.GetEventForRealm(r.Context(), *share.EventKey, &realmID)
+			if errors.Is(err, store.ErrNoResults{}) {
+				ihttp.Error(w, http.StatusUnprocessableEntity)
+				return
+			} else if err != nil {
+				s.Logger.WithError(err).Error("getting realm share event")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+
+			year := event.StartDate.Year()
+			share.Year = &year
+		}
+
+		share.RealmID = realmID
+		share.CreatedAt = time.Now().UTC()
+		share.AcceptedAt = nil
+
+		id, err := s.Store.InsertRealmShare(r.Context(), share)
+		if errors.Is(err, store.ErrExists{}) {
+			ihttp.Error(w, http.StatusConflict)
+			return
+		} else if errors.Is(err, store.ErrFKeyViolation{}) {
+			ihttp.Error(w, http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("inserting realm share")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		share.ID = id
+
+		ihttp.Respond(w, share, http.StatusCreated)
+	}
+}
+
+// acceptRealmShareHandler returns a handler for a partner realm to accept a
+// share offered to it.
+func (s *Server) acceptRealmShareHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, ok := realmShareVars(w, r)
+		if !ok {
+			return
+		}
+
+		share, ok := s.realmShare(w, r, realmID)
+		if !ok {
+			return
+		}
+
+		if share.PartnerRealmID != realmID {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+
+		err := s.Store.AcceptRealmShare(r.Context(), share.ID, time.Now().UTC())
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("accepting realm share")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteRealmShareHandler returns a handler for either realm of a share to
+// revoke it, or for the partner realm to decline it.
+func (s *Server) deleteRealmShareHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		realmID, ok := realmShareVars(w, r)
+		if !ok {
+			return
+		}
+
+		share, ok := s.realmShare(w, r, realmID)
+		if !ok {
+			return
+		}
+
+		err := s.Store.DeleteRealmShare(r.Context(), share.ID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("deleting realm share")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
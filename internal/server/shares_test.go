@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+)
+
+func TestRealmShares(t *testing.T) {
+	ctx := context.Background()
+
+	ts := newTestServer(t, nil)
+	sto := ts.sto
+
+	partnerRealm, err := sto.InsertRealm(ctx, store.Realm{Name: "Partner"})
+	if err != nil {
+		t.Fatalf("did not expect error %v inserting realm", err)
+	}
+
+	year := int64(2019)
+	schema := store.SchemaFields{{FieldDescriptor: store.FieldDescriptor{Name: "Cubes"}, ReportReference: "Cubes"}}
+	if err := sto.CreateSchema(ctx, store.Schema{Year: &year, Schema: schema}); err != nil {
+		t.Fatalf("did not expect error %v creating schema", err)
+	}
+
+	event := ts.seedMatch()
+
+	ownRealm := int64(1)
+	if _, _, err := sto.UpsertReport(ctx, store.Report{EventKey: event.Key, MatchKey: "qm1", TeamKey: "frc1", RealmID: &ownRealm, Data: store.ReportData{{Name: "Cubes", Value: 3}}}); err != nil {
+		t.Fatalf("did not expect error %v upserting report", err)
+	}
+
+	token := func(realmID int64) string {
+		return ts.token(store.User{ID: realmID, RealmID: realmID, Role: store.RoleRealmAdmin, Permissions: store.RoleRealmAdmin.Permissions()})
+	}
+	admin, partnerAdmin := token(ownRealm), token(partnerRealm)
+
+	partnerReports := func() int {
+		t.Helper()
+
+		var reports []store.Report
+		rr := ts.do(http.MethodGet, "/reports?event="+event.Key, partnerAdmin, nil)
+		if err := json.NewDecoder(rr.Body).Decode(&reports); err != nil {
+			t.Fatalf("did not expect error %v decoding reports", err)
+		}
+		return len(reports)
+	}
+
+	// the partner's stats are cached between requests, so they only follow
+	// the share if accepting and revoking it invalidates the cache
+	partnerCubes := func() float64 {
+		t.Helper()
+
+		var stats []teamAnalysis
+		rr := ts.do(http.MethodGet, "/events/"+event.Key+"/stats", partnerAdmin, nil)
+		if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+			t.Fatalf("did not expect error %v decoding stats", err)
+		}
+
+		for _, team := range stats {
+			for _, stat := range team.Summary {
+				if team.Team == "frc1" && stat.Name == "Cubes" {
+					return stat.Max
+				}
+			}
+		}
+		return 0
+	}
+
+	if n := partnerReports(); n != 0 {
+		t.Errorf("expected partner to see no reports before sharing, got %d", n)
+	}
+
+	if n := partnerCubes(); n != 0 {
+		t.Errorf("expected partner's stats to have no cubes before sharing, got %v", n)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/1/shares", partnerAdmin, store.RealmShare{PartnerRealmID: partnerRealm}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d sharing another realm's reports, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/1/shares", admin, store.RealmShare{PartnerRealmID: ownRealm}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d sharing with own realm, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	rr := ts.do(http.MethodPost, "/realms/1/shares", admin, store.RealmShare{PartnerRealmID: partnerRealm, EventKey: &event.Key})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d sharing event, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var share store.RealmShare
+	if err := json.NewDecoder(rr.Body).Decode(&share); err != nil {
+		t.Fatalf("did not expect error %v decoding share", err)
+	}
+	if share.Year == nil || *share.Year != 2019 || share.AcceptedAt != nil {
+		t.Errorf("expected pending share scoped to 2019, got %+v", share)
+	}
+
+	if rr := ts.do(http.MethodPost, "/realms/1/shares", admin, store.RealmShare{PartnerRealmID: partnerRealm, EventKey: &event.Key}); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d sharing event twice, got %d", http.StatusConflict, rr.Code)
+	}
+
+	if n := partnerReports(); n != 0 {
+		t.Errorf("expected partner to see no reports before accepting, got %d", n)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/realms/1/shares/%d/accept", share.ID), admin, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d accepting own share, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := ts.do(http.MethodPost, fmt.Sprintf("/realms/%d/shares/%d/accept", partnerRealm, share.ID), partnerAdmin, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d accepting share, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if n := partnerReports(); n != 1 {
+		t.Errorf("expected partner to see 1 report after accepting, got %d", n)
+	}
+
+	if n := partnerCubes(); n != 3 {
+		t.Errorf("expected partner's stats to have 3 cubes after accepting, got %v", n)
+	}
+
+	var shares []store.RealmShare
+	rr = ts.do(http.MethodGet, fmt.Sprintf("/realms/%d/shares", partnerRealm), partnerAdmin, nil)
+	if err := json.NewDecoder(rr.Body).Decode(&shares); err != nil {
+		t.Fatalf("did not expect error %v decoding shares", err)
+	}
+	if len(shares) != 1 || shares[0].ID != share.ID || shares[0].AcceptedAt == nil {
+		t.Errorf("expected accepted share offered to partner, got %+v", shares)
+	}
+
+	if rr := ts.do(http.MethodDelete, fmt.Sprintf("/realms/1/shares/%d", share.ID), admin, nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d revoking share, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if n := partnerReports(); n != 0 {
+		t.Errorf("expected partner to see no reports after revoking, got %d", n)
+	}
+
+	if n := partnerCubes(); n != 0 {
+		t.Errorf("expected partner's stats to have no cubes after revoking, got %v", n)
+	}
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
@@ -10,7 +15,9 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// eventStats analyzes the event-wide statistics of every team at an event with submitted reports
+// eventStats analyzes the event-wide statistics of every team at an event with submitted reports.
+// Results are cached per event and realm until the event's reports or matches change, and
+// clients can skip downloading unchanged stats with If-None-Match.
 func (s *Server) eventStats() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -22,6 +29,14 @@ func (s *Server) eventStats() http.HandlerFunc {
 			realmID = &userRealmID
 		}
 
+		cacheKey := newStatsCacheKey(eventKey, realmID)
+		if entry, ok := s.stats.get(cacheKey, time.Now()); ok {
+			respondStats(w, r, entry)
+			return
+		}
+
+		version := s.stats.version(eventKey)
+
 		event, err := s.Store.GetEventForRealm(r.Context(), eventKey, realmID)
 		if errors.Is(err, store.ErrNoResults{}) {
 			ihttp.Error(w, http.StatusNotFound)
@@ -32,7 +47,15 @@ func (s *Server) eventStats() http.HandlerFunc {
 			return
 		}
 
-		if event.SchemaID == nil {
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving realm settings")
+			return
+		}
+
+		schemaID := eventSchemaID(settings, event.RealmID, event.StartDate, event.SchemaID)
+		if schemaID == nil {
 			ihttp.Respond(w, errors.New("no schema found"), http.StatusBadRequest)
 			return
 		}
@@ -43,8 +66,9 @@ func (s *Server) eventStats() http.HandlerFunc {
 			s.Logger.WithError(err).Error("retrieving reports")
 			return
 		}
+		reports = visibleReports(settings, realmID, reports)
 
-		storeSchema, err := s.Store.GetSchemaByID(r.Context(), *event.SchemaID)
+		storeSchema, err := s.Store.GetSchemaByID(r.Context(), *schemaID)
 		if errors.Is(err, store.ErrNoResults{}) {
 			ihttp.Error(w, http.StatusNotFound)
 			return
@@ -66,7 +90,7 @@ func (s *Server) eventStats() http.HandlerFunc {
 
 		teamAnalyses := make([]teamAnalysis, 0)
 		for team, teamToMatch := range teamToMatches {
-			summary, err := summary.SummarizeTeam(schema, teamToMatch)
+			summary, err := summary.SummarizeTeam(r.Context(), schema, teamToMatch)
 			if err != nil {
 				ihttp.Error(w, http.StatusInternalServerError)
 				s.Logger.WithError(err).WithField("team", team).Error("retrieving match summary")
@@ -76,10 +100,49 @@ func (s *Server) eventStats() http.HandlerFunc {
 			teamAnalyses = append(teamAnalyses, teamAnalysisFromSummary(summary, team))
 		}
 
-		ihttp.Respond(w, teamAnalyses, http.StatusOK)
+		sort.Slice(teamAnalyses, func(i, j int) bool {
+			return teamAnalyses[i].Team < teamAnalyses[j].Team
+		})
+
+		entry, err := s.stats.put(cacheKey, version, teamAnalyses, time.Now().Add(s.StatsCacheTTL.Or(defaultStatsCacheTTL)))
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("caching event stats")
+			return
+		}
+
+		respondStats(w, r, entry)
 	}
 }
 
+// respondStats responds with cached stats, or with 304 Not Modified if the
+// client already has them.
+func respondStats(w http.ResponseWriter, r *http.Request, entry statsCacheEntry) {
+	w.Header().Set("ETag", entry.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), entry.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(entry.body)
+}
+
+// etagMatches returns whether an If-None-Match header value matches the etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *Server) matchTeamStats() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -103,7 +166,15 @@ func (s *Server) matchTeamStats() http.HandlerFunc {
 			return
 		}
 
-		if event.SchemaID == nil {
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving realm settings")
+			return
+		}
+
+		schemaID := eventSchemaID(settings, event.RealmID, event.StartDate, event.SchemaID)
+		if schemaID == nil {
 			ihttp.Respond(w, errors.New("no schema found"), http.StatusBadRequest)
 			return
 		}
@@ -124,8 +195,9 @@ func (s *Server) matchTeamStats() http.HandlerFunc {
 			s.Logger.WithError(err).Error("retrieving reports")
 			return
 		}
+		reports = visibleReports(settings, realmID, reports)
 
-		storeSchema, err := s.Store.GetSchemaByID(r.Context(), *event.SchemaID)
+		storeSchema, err := s.Store.GetSchemaByID(r.Context(), *schemaID)
 		if errors.Is(err, store.ErrNoResults{}) {
 			ihttp.Error(w, http.StatusNotFound)
 			return
@@ -138,7 +210,7 @@ func (s *Server) matchTeamStats() http.HandlerFunc {
 		schema := storeSummaryToSummarySchema(storeSchema)
 		teamToMatches := selectTeamMatches([]store.Match{match}, reports)
 
-		summary, err := summary.SummarizeTeam(schema, teamToMatches[teamKey])
+		summary, err := summary.SummarizeTeam(r.Context(), schema, teamToMatches[teamKey])
 		if err != nil {
 			ihttp.Error(w, http.StatusInternalServerError)
 			s.Logger.WithError(err).WithField("team", teamKey).Error("retrieving match summary")
@@ -150,6 +222,23 @@ func (s *Server) matchTeamStats() http.HandlerFunc {
 	}
 }
 
+// eventTeamMatches retrieves a single team's matches at an event along with the
+// reports for that team visible to the given realm with the given settings.
+func (s *Server) eventTeamMatches(ctx context.Context, eventKey, teamKey string, realmID *int64, settings store.RealmSettings) ([]summary.Match, error) {
+	reports, err := s.Store.GetEventTeamReportsForRealm(ctx, eventKey, teamKey, realmID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get reports: %w", err)
+	}
+	reports = visibleReports(settings, realmID, reports)
+
+	storeMatches, err := s.Store.GetEventAnalysisInfoForRealm(ctx, eventKey, realmID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get match analysis info: %w", err)
+	}
+
+	return selectTeamMatches(storeMatches, reports)[teamKey], nil
+}
+
 func selectTeamMatches(storeMatches []store.Match, reports []store.Report) map[string][]summary.Match {
 	teamToMatchToReports := make(map[string]map[string][]summary.Report)
 	for _, report := range reports {
@@ -3,9 +3,12 @@ package server
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/summary"
 	"github.com/gorilla/mux"
 )
 
@@ -76,3 +79,219 @@ func (s *Server) eventTeamsHandler() http.HandlerFunc {
 		ihttp.Respond(w, teams, http.StatusOK)
 	}
 }
+
+type teamHistoryEvent struct {
+	EventKey     string        `json:"eventKey"`
+	EventName    string        `json:"eventName"`
+	StartDate    time.Time     `json:"startDate"`
+	Rank         *int          `json:"rank,omitempty"`
+	RankingScore *float64      `json:"rankingScore,omitempty"`
+	Record       *store.Record `json:"record,omitempty"`
+	Summary      []summaryStat `json:"summary"`
+}
+
+// teamHistoryHandler returns a handler to get every event a team attended, with
+// their rank and summarized stats at each event.
+func (s *Server) teamHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamKey := mux.Vars(r)["teamKey"]
+
+		var filterYear *int
+		if year, err := strconv.Atoi(r.URL.Query().Get("year")); err == nil {
+			filterYear = &year
+		}
+
+		var realmID *int64
+		userRealmID, err := ihttp.GetRealmID(r)
+		if err == nil {
+			realmID = &userRealmID
+		}
+
+		if _, err := s.Store.GetTeam(r.Context(), teamKey); errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving team info")
+			return
+		}
+
+		teamEvents, err := s.Store.GetTeamEventsForRealm(r.Context(), teamKey, realmID, filterYear)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving team events")
+			return
+		}
+
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving realm settings")
+			return
+		}
+
+		for i, teamEvent := range teamEvents {
+			teamEvents[i].SchemaID = eventSchemaID(settings, teamEvent.EventRealmID, teamEvent.StartDate, teamEvent.SchemaID)
+		}
+
+		schemas := make(map[int64]summary.Schema)
+		history := make([]teamHistoryEvent, 0)
+		for _, teamEvent := range teamEvents {
+			event := teamHistoryEvent{
+				EventKey:     teamEvent.EventKey,
+				EventName:    teamEvent.EventName,
+				StartDate:    teamEvent.StartDate,
+				Rank:         teamEvent.Rank,
+				RankingScore: teamEvent.RankingScore,
+				Record:       teamEvent.Record,
+				Summary:      make([]summaryStat, 0),
+			}
+
+			if teamEvent.SchemaID != nil {
+				schema, ok := schemas[*teamEvent.SchemaID]
+				if !ok {
+					storeSchema, err := s.Store.GetSchemaByID(r.Context(), *teamEvent.SchemaID)
+					if err != nil {
+						ihttp.Error(w, http.StatusInternalServerError)
+						s.Logger.WithError(err).Error("retrieving event schema")
+						return
+					}
+
+					schema = storeSummaryToSummarySchema(storeSchema)
+					schemas[*teamEvent.SchemaID] = schema
+				}
+
+				teamMatches, err := s.eventTeamMatches(r.Context(), teamEvent.EventKey, teamKey, realmID, settings)
+				if err != nil {
+					ihttp.Error(w, http.StatusInternalServerError)
+					s.Logger.WithError(err).Error("retrieving team matches")
+					return
+				}
+
+				teamSummary, err := summary.SummarizeTeam(r.Context(), schema, teamMatches)
+				if err != nil {
+					ihttp.Error(w, http.StatusInternalServerError)
+					s.Logger.WithError(err).WithField("event", teamEvent.EventKey).Error("retrieving team summary")
+					return
+				}
+
+				event.Summary = teamAnalysisFromSummary(teamSummary, teamKey).Summary
+			}
+
+			history = append(history, event)
+		}
+
+		ihttp.Respond(w, history, http.StatusOK)
+	}
+}
+
+type teamStats struct {
+	teamAnalysis
+	SchemaID *int64   `json:"schemaId,omitempty"`
+	Events   []string `json:"events"`
+}
+
+// teamStatsHandler returns a handler to summarize a team's performance across
+// every event they attended in a year. Only events using the same schema as the
+// team's most recent event are included. If weighted is true, matches from later
+// events count more towards averages than matches from earlier events.
+func (s *Server) teamStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamKey := mux.Vars(r)["teamKey"]
+
+		year, err := strconv.Atoi(r.URL.Query().Get("year"))
+		if err != nil {
+			ihttp.Respond(w, errors.New("year is required"), http.StatusBadRequest)
+			return
+		}
+
+		weighted, _ := strconv.ParseBool(r.URL.Query().Get("weighted"))
+
+		var realmID *int64
+		userRealmID, err := ihttp.GetRealmID(r)
+		if err == nil {
+			realmID = &userRealmID
+		}
+
+		teamEvents, err := s.Store.GetTeamEventsForRealm(r.Context(), teamKey, realmID, &year)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving team events")
+			return
+		}
+
+		settings, err := s.realmSettings(r.Context(), realmID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving realm settings")
+			return
+		}
+
+		for i, teamEvent := range teamEvents {
+			teamEvents[i].SchemaID = eventSchemaID(settings, teamEvent.EventRealmID, teamEvent.StartDate, teamEvent.SchemaID)
+		}
+
+		// use the schema of the most recent event with a schema, and only
+		// include events sharing it
+		var schemaID *int64
+		for i := len(teamEvents) - 1; i >= 0; i-- {
+			if teamEvents[i].SchemaID != nil {
+				schemaID = teamEvents[i].SchemaID
+				break
+			}
+		}
+
+		stats := teamStats{
+			teamAnalysis: teamAnalysis{Team: teamKey, Summary: make([]summaryStat, 0)},
+			SchemaID:     schemaID,
+			Events:       make([]string, 0),
+		}
+
+		if schemaID == nil {
+			ihttp.Respond(w, stats, http.StatusOK)
+			return
+		}
+
+		storeSchema, err := s.Store.GetSchemaByID(r.Context(), *schemaID)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).Error("retrieving event schema")
+			return
+		}
+
+		var teamMatches []summary.Match
+		for _, teamEvent := range teamEvents {
+			if teamEvent.SchemaID == nil || *teamEvent.SchemaID != *schemaID {
+				continue
+			}
+
+			eventMatches, err := s.eventTeamMatches(r.Context(), teamEvent.EventKey, teamKey, realmID, settings)
+			if err != nil {
+				ihttp.Error(w, http.StatusInternalServerError)
+				s.Logger.WithError(err).Error("retrieving team matches")
+				return
+			}
+
+			stats.Events = append(stats.Events, teamEvent.EventKey)
+
+			for _, match := range eventMatches {
+				if weighted {
+					match.Weight = float64(len(stats.Events))
+				}
+
+				teamMatches = append(teamMatches, match)
+			}
+		}
+
+		teamSummary, err := summary.SummarizeTeam(r.Context(), storeSummaryToSummarySchema(storeSchema), teamMatches)
+		if err != nil {
+			ihttp.Error(w, http.StatusInternalServerError)
+			s.Logger.WithError(err).WithField("team", teamKey).Error("retrieving team summary")
+			return
+		}
+
+		stats.teamAnalysis = teamAnalysisFromSummary(teamSummary, teamKey)
+
+		ihttp.Respond(w, stats, http.StatusOK)
+	}
+}
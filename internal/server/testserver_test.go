@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/config"
+	ihttp "github.com/Pigmice2733/peregrine-backend/internal/http"
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const testSecret = "i-am-secret"
+
+// testServer is a server backed by an in-memory store, with the auth
+// middleware in front of its routes. Like a running server, it invalidates
+// cached stats when the store reports an event change.
+type testServer struct {
+	*Server
+	t       *testing.T
+	sto     *store.Memory
+	handler http.Handler
+}
+
+// newTestServer returns a test server that signs tokens with testSecret.
+// configure, if not nil, is called to set up the server before its routes are
+// registered.
+func newTestServer(t *testing.T, configure func(*Server)) *testServer {
+	sto := store.NewMemory()
+	s := &Server{Server: config.Server{JWTSecret: testSecret}, Store: sto, Logger: logrus.New()}
+	if configure != nil {
+		configure(s)
+	}
+
+	sto.OnEventChange(s.stats.invalidate)
+
+	return &testServer{Server: s, t: t, sto: sto, handler: ihttp.Auth(s.registerRoutes(), s.keys(), sto)}
+}
+
+// token returns an access token for u that expires in an hour.
+func (ts *testServer) token(u store.User) string {
+	ts.t.Helper()
+
+	accessToken, err := generateAccessToken(u, time.Now().Add(time.Hour), ts.keys())
+	if err != nil {
+		ts.t.Fatalf("did not expect error %v generating access token", err)
+	}
+
+	return accessToken
+}
+
+// do sends a request to the server with token as the bearer token, unless it's
+// empty. A []byte body is sent as is, and anything else as JSON.
+func (ts *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	b, ok := body.([]byte)
+	if !ok {
+		b, _ = json.Marshal(body)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// seedMatch adds the public event 2019orwil with the match qm1 between frc1 and
+// frc2, and returns the event.
+func (ts *testServer) seedMatch() store.Event {
+	ts.t.Helper()
+	ctx := context.Background()
+
+	event := store.Event{Key: "2019orwil", StartDate: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := ts.sto.EventsUpsert(ctx, []store.Event{event}); err != nil {
+		ts.t.Fatalf("did not expect error %v upserting event", err)
+	}
+	if err := ts.sto.UpdateTBAMatches(ctx, []store.Match{{Key: "qm1", EventKey: event.Key, RedAlliance: []string{"frc1"}, BlueAlliance: []string{"frc2"}}}); err != nil {
+		ts.t.Fatalf("did not expect error %v upserting match", err)
+	}
+
+	return event
+}
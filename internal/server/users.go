@@ -13,7 +13,6 @@ import (
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
-	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -26,28 +25,76 @@ type baseUser struct {
 
 type requestUser struct {
 	baseUser
-	RealmID   int64       `json:"realmId" validate:"required"`
-	FirstName string      `json:"firstName" validate:"required"`
-	LastName  string      `json:"lastName" validate:"required"`
-	Roles     store.Roles `json:"roles"`
-	Stars     []string    `json:"stars"`
+	RealmID     int64             `json:"realmId" validate:"required"`
+	FirstName   string            `json:"firstName" validate:"required"`
+	LastName    string            `json:"lastName" validate:"required"`
+	Email       string            `json:"email" validate:"omitempty,email"`
+	Role        store.Role        `json:"role"`
+	Permissions store.Permissions `json:"permissions"`
+	Stars       []string          `json:"stars"`
 }
 
 const (
 	accessTokenDuration  = time.Minute * 5        // 5 minutes
 	refreshTokenDuration = time.Hour * 24 * 7 * 4 // 4 weeks
 	bcryptCost           = 13
+
+	// MaxTokenLifetime is the longest any token issued by the server stays
+	// valid, so it's how long retired signing keys have to keep verifying.
+	MaxTokenLifetime = refreshTokenDuration
 )
 
-func generateAccessToken(user store.User, expires time.Time, secret string) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, &ihttp.Claims{
+// TokenSigner signs the claims of access and refresh tokens.
+type TokenSigner interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// TokenKeys signs tokens and finds the keys to verify them with.
+type TokenKeys interface {
+	TokenSigner
+	ihttp.TokenVerifier
+}
+
+// HashPassword hashes a user password for storage.
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return string(hashedPassword), err
+}
+
+// unusablePasswordHash hashes a random password that's thrown away, for users
+// who can't log in with a password until they change or reset it.
+func unusablePasswordHash() (string, error) {
+	password, err := generateTokenID()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate password: %w", err)
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash password: %w", err)
+	}
+
+	return hashedPassword, nil
+}
+
+func generateAccessToken(user store.User, expires time.Time, signer TokenSigner) (string, error) {
+	return signer.Sign(&ihttp.Claims{
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expires.Unix(),
 			Subject:   strconv.FormatInt(user.ID, 10),
 		},
-		Roles:   user.Roles,
-		RealmID: user.RealmID,
-	}).SignedString([]byte(secret))
+		Role:        user.Role,
+		Permissions: user.Permissions,
+		RealmID:     user.RealmID,
+		Type:        ihttp.TokenTypeAccess,
+	})
+}
+
+type authenticateRequest struct {
+	baseUser
+	DeviceName string `json:"deviceName"`
+	// RealmID is the realm to act in, the user's own realm if zero.
+	RealmID int64 `json:"realmId"`
 }
 
 type authenticateResponse struct {
@@ -61,23 +108,36 @@ type UserByNameGetter interface {
 	GetUserByUsername(ctx context.Context, username string) (user store.User, err error)
 }
 
-func authenticateHandler(logger *logrus.Logger, now func() time.Time, userStore UserByNameGetter, secret string) http.HandlerFunc {
+func authenticateHandler(logger *logrus.Logger, now func() time.Time, userStore UserByNameGetter, memberships MembershipGetter, sessions SessionCreator, logins LoginRecorder, limits *loginLimits, signer TokenSigner) http.HandlerFunc {
 	validate := validator.New()
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var ru baseUser
-		if err := json.NewDecoder(r.Body).Decode(&ru); err != nil {
+		var ar authenticateRequest
+		if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
 			ihttp.Error(w, http.StatusUnprocessableEntity)
 			return
 		}
 
+		ru := ar.baseUser
 		if err := validate.Struct(ru); err != nil {
 			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
 			return
 		}
 
+		attempted := now()
+		if wait := limits.wait(r, ru.Username, attempted); wait > 0 {
+			retryAfter(w, wait)
+			ihttp.Error(w, http.StatusTooManyRequests)
+			return
+		}
+
+		failure := store.LoginFailure{Username: ru.Username, IPAddress: remoteIP(r), CreatedAt: attempted.UTC()}
+
 		user, err := userStore.GetUserByUsername(r.Context(), ru.Username)
 		if errors.Is(err, store.ErrNoResults{}) {
+			limits.fail(r, ru.Username, attempted)
+			failure.Reason = store.LoginUnknownUser
+			auditLoginFailure(r.Context(), logger, logins, failure)
 			ihttp.Error(w, http.StatusUnauthorized)
 			return
 		} else if err != nil {
@@ -86,8 +146,35 @@ func authenticateHandler(logger *logrus.Logger, now func() time.Time, userStore
 			return
 		}
 
+		failure.UserID = &user.ID
+
+		if user.Locked(attempted) {
+			failure.Reason = store.LoginLocked
+			auditLoginFailure(r.Context(), logger, logins, failure)
+			retryAfter(w, user.LockedUntil.Sub(attempted))
+			ihttp.Error(w, http.StatusLocked)
+			return
+		}
+
+		if !limits.acquireHash() {
+			retryAfter(w, time.Second)
+			ihttp.Error(w, http.StatusTooManyRequests)
+			return
+		}
 		err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(ru.Password))
+		limits.releaseHash()
 		if err == bcrypt.ErrMismatchedHashAndPassword {
+			limits.fail(r, ru.Username, attempted)
+			failure.Reason = store.LoginWrongPassword
+			auditLoginFailure(r.Context(), logger, logins, failure)
+
+			lockedUntil, err := logins.RecordFailedLogin(r.Context(), user.ID, attempted, maxFailedLogins, lockoutDuration)
+			if err != nil {
+				logger.WithError(err).Error("recording failed login")
+			} else if lockedUntil != nil {
+				logger.WithField("userId", user.ID).Warn("locked out user after too many failed logins")
+			}
+
 			ihttp.Error(w, http.StatusUnauthorized)
 			return
 		} else if err != nil {
@@ -96,27 +183,38 @@ func authenticateHandler(logger *logrus.Logger, now func() time.Time, userStore
 			return
 		}
 
-		accessToken, err := generateAccessToken(user, now().Add(accessTokenDuration), secret)
-		if err != nil {
-			logger.WithError(err).Error("generating jwt access token signed string")
+		limits.succeed(ru.Username)
+
+		if user.Pending() {
+			failure.Reason = store.LoginPending
+			auditLoginFailure(r.Context(), logger, logins, failure)
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		}
+		if user.FailedLogins > 0 {
+			if err := logins.UnlockUser(r.Context(), user.ID); err != nil {
+				logger.WithError(err).Error("clearing failed logins")
+			}
+		}
+
+		user, err = inRealm(r.Context(), memberships, user, ar.RealmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		} else if err != nil {
+			logger.WithError(err).Error("retrieving membership")
 			ihttp.Error(w, http.StatusInternalServerError)
 			return
 		}
 
-		refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &ihttp.RefreshClaims{
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: now().Add(refreshTokenDuration).Unix(),
-				Subject:   strconv.FormatInt(user.ID, 10),
-			},
-			PasswordChanged: user.PasswordChanged.Unix(),
-		}).SignedString([]byte(secret))
+		tokens, err := issueTokens(r, now(), sessions, user, ar.DeviceName, signer)
 		if err != nil {
-			logger.WithError(err).Error("generating jwt refresh token signed string")
+			logger.WithError(err).Error("issuing tokens")
 			ihttp.Error(w, http.StatusInternalServerError)
 			return
 		}
 
-		ihttp.Respond(w, authenticateResponse{accessToken, refreshToken}, http.StatusOK)
+		ihttp.Respond(w, tokens, http.StatusOK)
 	}
 }
 
@@ -128,13 +226,16 @@ type UserByIDGetter interface {
 
 type refreshRequest struct {
 	RefreshToken string `json:"refreshToken"`
+	// RealmID is the realm to switch to, if set.
+	RealmID *int64 `json:"realmId"`
 }
 
-type refreshResponse struct {
-	AccessToken string `json:"accessToken"`
-}
-
-func refreshHandler(logger *logrus.Logger, now func() time.Time, userStore UserByIDGetter, secret string) http.HandlerFunc {
+// refreshHandler exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can only be used once; if an old one is
+// used again it has probably been stolen, so its session is revoked. The new
+// tokens act in the same realm as the old one, or in the requested realm to
+// switch between the realms the user is a member of.
+func refreshHandler(logger *logrus.Logger, now func() time.Time, userStore UserByIDGetter, memberships MembershipGetter, sessions SessionRotator, keys TokenKeys) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var rr refreshRequest
 		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
@@ -142,20 +243,14 @@ func refreshHandler(logger *logrus.Logger, now func() time.Time, userStore UserB
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(rr.RefreshToken, &ihttp.RefreshClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return []byte(secret), nil
-		})
+		token, err := jwt.ParseWithClaims(rr.RefreshToken, &ihttp.RefreshClaims{}, keys.VerifyKey)
 		if err != nil || !token.Valid {
 			ihttp.Error(w, http.StatusUnauthorized)
 			return
 		}
 
 		claims, ok := token.Claims.(*ihttp.RefreshClaims)
-		if !ok {
+		if !ok || claims.Type != ihttp.TokenTypeRefresh || claims.SessionID == 0 {
 			ihttp.Error(w, http.StatusUnauthorized)
 			return
 		}
@@ -182,14 +277,66 @@ func refreshHandler(logger *logrus.Logger, now func() time.Time, userStore UserB
 			return
 		}
 
-		accessToken, err := generateAccessToken(user, now().Add(accessTokenDuration), secret)
+		realmID := claims.RealmID
+		if rr.RealmID != nil {
+			realmID = *rr.RealmID
+		}
+
+		user, err = inRealm(r.Context(), memberships, user, realmID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		} else if err != nil {
+			logger.WithError(err).Error("retrieving membership")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		tokenID, err := generateTokenID()
+		if err != nil {
+			logger.WithError(err).Error("generating refresh token ID")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		session := store.Session{
+			ID:         claims.SessionID,
+			UserID:     user.ID,
+			TokenID:    tokenID,
+			IPAddress:  remoteIP(r),
+			LastUsedAt: now(),
+			ExpiresAt:  now().Add(refreshTokenDuration),
+		}
+
+		rotated, err := sessions.RotateSession(r.Context(), session, claims.Id)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			logger.WithError(err).Error("rotating session refresh token")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		} else if !rotated {
+			logger.WithFields(logrus.Fields{"userId": user.ID, "sessionId": session.ID}).Warn("refresh token reused, revoked session")
+			ihttp.Error(w, http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, err := generateAccessToken(user, now().Add(accessTokenDuration), keys)
 		if err != nil {
 			logger.WithError(err).Error("generating jwt access token signed string")
 			ihttp.Error(w, http.StatusInternalServerError)
 			return
 		}
 
-		ihttp.Respond(w, refreshResponse{accessToken}, http.StatusOK)
+		refreshToken, err := generateRefreshToken(user, session, keys)
+		if err != nil {
+			logger.WithError(err).Error("generating jwt refresh token signed string")
+			ihttp.Error(w, http.StatusInternalServerError)
+			return
+		}
+
+		ihttp.Respond(w, authenticateResponse{accessToken, refreshToken}, http.StatusOK)
 	}
 }
 
@@ -201,31 +348,28 @@ func (s *Server) createUserHandler() http.HandlerFunc {
 			return
 		}
 
-		// If the creator user isn't an admin, reset their roles
-		roles := ihttp.GetRoles(r)
-		if !roles.IsAdmin && !roles.IsSuperAdmin {
-			ru.Roles = store.Roles{}
-		}
-
-		// Only super-admins can create super-admins
-		if !roles.IsSuperAdmin {
-			ru.Roles.IsSuperAdmin = false
-		}
-
-		// Only super-admins can create verified users in realms other than their own.
-		if !roles.IsSuperAdmin {
-			if id, err := ihttp.GetRealmID(r); err != nil || id != ru.RealmID {
-				ru.Roles.IsVerified = false
-				ru.Roles.IsAdmin = false
-			}
+		if err := validator.New().Struct(ru); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
 		}
 
-		if err := validator.New().Struct(ru); err != nil {
+		role, perms, err := resolvePermissions(ru.Role, ru.Permissions)
+		if err != nil {
 			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
 			return
 		}
 
-		err := s.Store.CheckSimilarUsernameExists(r.Context(), ru.Username, nil)
+		// Users signing themselves up, or created by someone who can't grant
+		// the requested permissions, start out as viewers waiting for an admin
+		// of the realm to approve them.
+		var pendingSince *time.Time
+		if !canManageUser(r, ru.RealmID, perms) {
+			role, perms = store.RoleViewer, store.RoleViewer.Permissions()
+			now := time.Now().UTC()
+			pendingSince = &now
+		}
+
+		err = s.Store.CheckSimilarUsernameExists(r.Context(), ru.Username, nil)
 		if errors.Is(err, store.ErrExists{}) {
 			ihttp.Error(w, http.StatusConflict)
 			return
@@ -235,16 +379,28 @@ func (s *Server) createUserHandler() http.HandlerFunc {
 			return
 		}
 
-		u := store.User{Username: ru.Username, RealmID: ru.RealmID, Roles: ru.Roles, Stars: ru.Stars, FirstName: ru.FirstName, LastName: ru.LastName}
+		// users who don't star any events start with the realm's default stars
+		stars := ru.Stars
+		if len(stars) == 0 {
+			settings, err := s.realmSettings(r.Context(), &ru.RealmID)
+			if err != nil {
+				s.Logger.WithError(err).Error("getting realm settings")
+				ihttp.Error(w, http.StatusInternalServerError)
+				return
+			}
+			stars = settings.DefaultStars
+		}
+
+		u := store.User{Username: ru.Username, RealmID: ru.RealmID, Role: role, Permissions: perms, Stars: stars, FirstName: ru.FirstName, LastName: ru.LastName, Email: ru.Email, PendingSince: pendingSince}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(ru.Password), bcryptCost)
+		hashedPassword, err := HashPassword(ru.Password)
 		if err != nil {
 			s.Logger.WithError(err).Error("hashing user password")
 			ihttp.Error(w, http.StatusInternalServerError)
 			return
 		}
 
-		u.HashedPassword = string(hashedPassword)
+		u.HashedPassword = hashedPassword
 
 		err = s.Store.CreateUser(r.Context(), u)
 
@@ -260,18 +416,20 @@ func (s *Server) createUserHandler() http.HandlerFunc {
 			return
 		}
 
+		if u.Pending() {
+			s.notifyPendingUser(r.Context(), u)
+		}
+
 		w.WriteHeader(http.StatusCreated)
 	}
 }
 
 func (s *Server) getUsersHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		roles := ihttp.GetRoles(r)
-
 		var users []store.User
 		var err error
 
-		if roles.IsSuperAdmin {
+		if ihttp.GetPermissions(r).Has(store.PermGlobal) {
 			users, err = s.Store.GetUsers(r.Context())
 		} else {
 			var realmID int64
@@ -307,8 +465,6 @@ func (s *Server) getUserByIDHandler() http.HandlerFunc {
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
-
 		user, err := s.Store.GetUserByID(r.Context(), id)
 		if errors.Is(err, store.ErrNoResults{}) {
 			ihttp.Error(w, http.StatusNotFound)
@@ -319,9 +475,9 @@ func (s *Server) getUserByIDHandler() http.HandlerFunc {
 			return
 		}
 
-		// only allow users to get other users within their realm if they aren't a super
-		// admin
-		if !roles.IsSuperAdmin && realmID != user.RealmID {
+		// only allow users to get other users within their realm unless they
+		// have global permissions
+		if !ihttp.GetPermissions(r).Has(store.PermGlobal) && realmID != user.RealmID {
 			if realmID, err := ihttp.GetRealmID(r); err != nil || realmID != user.RealmID {
 				ihttp.Error(w, http.StatusNotFound)
 				return
@@ -334,12 +490,14 @@ func (s *Server) getUserByIDHandler() http.HandlerFunc {
 
 func (s *Server) patchUserHandler() http.HandlerFunc {
 	type patchUser struct {
-		Username  *string      `json:"username" validate:"omitempty,gte=4,lte=32,alphanum"`
-		Password  *string      `json:"password" validate:"omitempty,gte=8,lte=128"`
-		FirstName *string      `json:"firstName" validate:"omitempty,gte=0"`
-		LastName  *string      `json:"lastName" validate:"omitempty,gte=0"`
-		Roles     *store.Roles `json:"roles"`
-		Stars     []string     `json:"stars"`
+		Username    *string           `json:"username" validate:"omitempty,gte=4,lte=32,alphanum"`
+		Password    *string           `json:"password" validate:"omitempty,gte=8,lte=128"`
+		FirstName   *string           `json:"firstName" validate:"omitempty,gte=0"`
+		LastName    *string           `json:"lastName" validate:"omitempty,gte=0"`
+		Email       *string           `json:"email" validate:"omitempty,email"`
+		Role        *store.Role       `json:"role"`
+		Permissions store.Permissions `json:"permissions"`
+		Stars       []string          `json:"stars"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -354,9 +512,8 @@ func (s *Server) patchUserHandler() http.HandlerFunc {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
-		roles := ihttp.GetRoles(r)
 
-		if targetID != subjectID && !roles.IsAdmin && !roles.IsSuperAdmin {
+		if targetID != subjectID && !ihttp.GetPermissions(r).Has(store.PermUsersManage) {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
@@ -367,38 +524,48 @@ func (s *Server) patchUserHandler() http.HandlerFunc {
 			return
 		}
 
-		// Admins can only patch users in the same realm, only super-admins can edit super-admins
-		if targetID != subjectID && !roles.IsSuperAdmin {
-			targetUser, err := s.Store.GetUserByID(r.Context(), targetID)
-			if err != nil {
-				s.Logger.WithError(err).Error("getting user")
-				ihttp.Error(w, http.StatusInternalServerError)
-				return
-			}
-			if realmID, err := ihttp.GetRealmID(r); err != nil || realmID != targetUser.RealmID {
-				ihttp.Error(w, http.StatusForbidden)
-				return
-			}
-			if targetUser.Roles.IsSuperAdmin {
-				ihttp.Error(w, http.StatusForbidden)
-				return
-			}
+		if err := validator.New().Struct(ru); err != nil {
+			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+			return
 		}
 
-		// Only (super)admins can create admins or verify users
-		if ru.Roles != nil && (ru.Roles.IsAdmin || ru.Roles.IsVerified) && !(roles.IsAdmin || roles.IsSuperAdmin) {
-			ihttp.Error(w, http.StatusForbidden)
+		targetUser, err := s.Store.GetUserByID(r.Context(), targetID)
+		if errors.Is(err, store.ErrNoResults{}) {
+			ihttp.Error(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.Logger.WithError(err).Error("getting user")
+			ihttp.Error(w, http.StatusInternalServerError)
 			return
 		}
 
-		// Only super-admins can create super-admins
-		if ru.Roles != nil && !roles.IsSuperAdmin {
-			ru.Roles.IsSuperAdmin = false
+		// Only users who could have granted another user's permissions can
+		// edit them
+		if targetID != subjectID && !canManageUser(r, targetUser.RealmID, targetUser.Permissions) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
 		}
 
-		if err := validator.New().Struct(ru); err != nil {
-			ihttp.Respond(w, err, http.StatusUnprocessableEntity)
-			return
+		var role *store.Role
+		var perms store.Permissions
+		if ru.Role != nil || ru.Permissions != nil {
+			newRole := targetUser.Role
+			if ru.Role != nil {
+				newRole = *ru.Role
+			}
+
+			newRole, perms, err = resolvePermissions(newRole, ru.Permissions)
+			if err != nil {
+				ihttp.Respond(w, err, http.StatusUnprocessableEntity)
+				return
+			}
+
+			if !canManageUser(r, targetUser.RealmID, perms) {
+				ihttp.Error(w, http.StatusForbidden)
+				return
+			}
+
+			role = &newRole
 		}
 
 		if ru.Username != nil {
@@ -413,18 +580,17 @@ func (s *Server) patchUserHandler() http.HandlerFunc {
 			}
 		}
 
-		u := store.PatchUser{ID: targetID, Username: ru.Username, Roles: ru.Roles, FirstName: ru.FirstName, LastName: ru.LastName, Stars: ru.Stars}
+		u := store.PatchUser{ID: targetID, Username: ru.Username, Role: role, Permissions: perms, FirstName: ru.FirstName, LastName: ru.LastName, Email: ru.Email, Stars: ru.Stars}
 
 		if ru.Password != nil {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*ru.Password), bcryptCost)
+			hashedPassword, err := HashPassword(*ru.Password)
 			if err != nil {
 				s.Logger.WithError(err).Error("hashing user password")
 				ihttp.Error(w, http.StatusInternalServerError)
 				return
 			}
 
-			hashedPasswordString := string(hashedPassword)
-			u.HashedPassword = &hashedPasswordString
+			u.HashedPassword = &hashedPassword
 		}
 
 		err = s.Store.PatchUser(r.Context(), u)
@@ -444,6 +610,9 @@ func (s *Server) patchUserHandler() http.HandlerFunc {
 	}
 }
 
+// deleteUserHandler returns a handler to delete a user. The user's reports are
+// anonymized by default, or deleted with them if the reports query parameter
+// is delete.
 func (s *Server) deleteUserHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
@@ -452,53 +621,60 @@ func (s *Server) deleteUserHandler() http.HandlerFunc {
 			return
 		}
 
+		reports := r.URL.Query().Get("reports")
+		if reports == "" {
+			reports = deletedUserReportsAnonymize
+		}
+		if reports != deletedUserReportsAnonymize && reports != deletedUserReportsDelete {
+			ihttp.Error(w, http.StatusBadRequest)
+			return
+		}
+
 		requesterSubject, err := ihttp.GetSubject(r)
 		if err != nil {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
 
-		roles := ihttp.GetRoles(r)
+		perms := ihttp.GetPermissions(r)
 
-		// only allow people to delete themselves if they're not an admin or super admin
-		if id != requesterSubject && !roles.IsAdmin && !roles.IsSuperAdmin {
+		// only allow people to delete other users if they manage users
+		if id != requesterSubject && !perms.Has(store.PermUsersManage) {
 			ihttp.Error(w, http.StatusForbidden)
 			return
 		}
 
-		if roles.IsSuperAdmin {
-			err = s.Store.DeleteUserByID(r.Context(), id)
-		} else {
-			// Only super-admins can delete super-admins
-			err := s.Store.DoTransaction(r.Context(), func(tx *sqlx.Tx) error {
-				targetUser, err := s.Store.GetUserByID(r.Context(), id)
-				if err != nil {
-					return fmt.Errorf("unable to get target user: %w", err)
-				}
-				if targetUser.Roles.IsSuperAdmin {
-					return forbiddenError{}
+		err = s.Store.DoTransaction(r.Context(), func(tx *store.Tx) error {
+			if reports == deletedUserReportsDelete {
+				if err := s.Store.DeleteReportsByReporterTx(r.Context(), tx, id); err != nil {
+					return fmt.Errorf("unable to delete user reports: %w", err)
 				}
+			}
 
-				var realmID int64
-				realmID, err = ihttp.GetRealmID(r)
-				if err != nil {
-					return forbiddenError{}
-				}
+			if perms.Has(store.PermGlobal) {
+				return s.Store.DeleteUserByIDTx(r.Context(), tx, id)
+			}
 
-				return s.Store.DeleteUserByIDRealmTx(r.Context(), tx, id, realmID)
-			})
+			// Users can't delete users with permissions they don't have
+			targetUser, err := s.Store.GetUserByID(r.Context(), id)
+			if err != nil {
+				return fmt.Errorf("unable to get target user: %w", err)
+			}
+			if id != requesterSubject && !perms.Contains(targetUser.Permissions) {
+				return forbiddenError{}
+			}
 
-			if errors.Is(err, forbiddenError{}) {
-				ihttp.Error(w, http.StatusForbidden)
-				return
-			} else if err != nil {
-				s.Logger.WithError(err).Error("unable to delete user")
-				ihttp.Error(w, http.StatusInternalServerError)
-				return
+			realmID, err := ihttp.GetRealmID(r)
+			if err != nil {
+				return forbiddenError{}
 			}
-		}
 
-		if errors.Is(err, store.ErrNoResults{}) {
+			return s.Store.DeleteUserByIDRealmTx(r.Context(), tx, id, realmID)
+		})
+		if errors.Is(err, forbiddenError{}) {
+			ihttp.Error(w, http.StatusForbidden)
+			return
+		} else if errors.Is(err, store.ErrNoResults{}) {
 			ihttp.Error(w, http.StatusNotFound)
 			return
 		} else if err != nil {
@@ -510,3 +686,45 @@ func (s *Server) deleteUserHandler() http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// resolvePermissions returns the role and permissions a user should be given
+// when a request asks for them. A missing role means viewer, and missing
+// permissions mean the role's default permissions.
+func resolvePermissions(role store.Role, perms store.Permissions) (store.Role, store.Permissions, error) {
+	if role == "" {
+		role = store.RoleViewer
+	}
+
+	if !role.Valid() {
+		return "", nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	if perms == nil {
+		return role, role.Permissions(), nil
+	}
+
+	if !perms.Valid() {
+		return "", nil, errors.New("unknown permissions")
+	}
+
+	return role, perms, nil
+}
+
+// canManageUser returns whether the requesting user may give a user in the
+// given realm the given permissions, or edit a user who has them. That takes
+// permission to manage users, membership of the same realm unless the
+// requester has global permissions, and every permission being granted.
+func canManageUser(r *http.Request, realmID int64, perms store.Permissions) bool {
+	requester := ihttp.GetPermissions(r)
+	if !requester.Has(store.PermUsersManage) {
+		return false
+	}
+
+	if !requester.Has(store.PermGlobal) {
+		if id, err := ihttp.GetRealmID(r); err != nil || id != realmID {
+			return false
+		}
+	}
+
+	return requester.Contains(perms)
+}
@@ -0,0 +1,434 @@
+// Package signing signs and verifies the JWTs peregrine issues. By default
+// tokens are signed with HS256 and the JWT secret. With RS256 or EdDSA, tokens
+// are signed with private keys kept in the store instead, so every server signs
+// with the same keys. Each key is identified by the kid header of the tokens it
+// signs, new keys can be generated on a schedule, and the public keys are
+// published as a JSON Web Key Set so other services can verify tokens without
+// holding any secret.
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Algorithms tokens can be signed with.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits  = 2048
+	keyIDLength = 12
+
+	// How often keys are reloaded from the store to pick up keys rotated by
+	// other servers, and how often at most they're reloaded early because a
+	// token was signed with an unknown key.
+	reloadInterval    = time.Minute
+	minReloadInterval = time.Second * 10
+	reloadTimeout     = time.Second * 5
+)
+
+// key is a parsed signing key.
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// KeySet signs tokens with the current key and finds the key to verify tokens
+// with. Tokens without a kid header are verified with the JWT secret, so tokens
+// issued before switching from HS256 stay valid until they expire. After that,
+// they're rejected, so the secret can no longer be used to make tokens.
+type KeySet struct {
+	secret    []byte
+	algorithm string
+	rotation  time.Duration
+	verifyFor time.Duration
+	store     store.SigningKeyStore
+	logger    *logrus.Logger
+
+	mu      sync.RWMutex
+	current *key
+	keys    map[string]*key
+	loaded  time.Time
+	// legacyUntil is when tokens signed with the secret before switching
+	// from HS256 have expired: verifyFor after the oldest stored key was
+	// generated. A key is only deleted once the key that replaced it is
+	// older than verifyFor, so deleting keys never reopens the window.
+	legacyUntil time.Time
+}
+
+// NewHMAC returns a key set that signs and verifies tokens with HS256 and the
+// secret.
+func NewHMAC(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret), algorithm: HS256}
+}
+
+// Open returns a key set that signs tokens with the algorithm. For RS256 and
+// EdDSA, keys are loaded from the store, and a key is generated if there is
+// none for the algorithm yet. A new key is generated every rotation while Run
+// is running, or never if rotation is zero. Retired keys keep verifying tokens
+// for verifyFor, which should be the longest lifetime of any token.
+func Open(ctx context.Context, secret, algorithm string, rotation, verifyFor time.Duration, s store.SigningKeyStore, logger *logrus.Logger) (*KeySet, error) {
+	switch algorithm {
+	case "", HS256:
+		return NewHMAC(secret), nil
+	case RS256, EdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	k := &KeySet{
+		secret:    []byte(secret),
+		algorithm: algorithm,
+		rotation:  rotation,
+		verifyFor: verifyFor,
+		store:     s,
+		logger:    logger,
+		keys:      make(map[string]*key),
+	}
+
+	if err := k.refresh(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Run reloads the keys periodically, rotates the current key when it's due,
+// and deletes keys that can no longer have signed a valid token. It returns
+// when ctx is done.
+func (k *KeySet) Run(ctx context.Context) {
+	if k.store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.refresh(ctx, time.Now()); err != nil {
+				k.logger.WithError(err).Error("refreshing signing keys")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh loads the keys, generates a new key if the current one is due for
+// rotation or uses a different algorithm, and deletes expired keys.
+func (k *KeySet) refresh(ctx context.Context, now time.Time) error {
+	if err := k.load(ctx, now); err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	current := k.current
+	k.mu.RUnlock()
+
+	switch {
+	case current == nil || current.method.Alg() != k.algorithm:
+		if err := k.rotate(ctx, now, now); err != nil {
+			return err
+		}
+	case k.rotation > 0 && !current.createdAt.After(now.Add(-k.rotation)):
+		if err := k.rotate(ctx, now, now.Add(-k.rotation)); err != nil {
+			return err
+		}
+	}
+
+	if err := k.store.DeleteSigningKeys(ctx, k.expiredBefore(now)); err != nil {
+		return fmt.Errorf("unable to delete expired signing keys: %w", err)
+	}
+
+	return nil
+}
+
+// expiredBefore returns the time before which retired keys can't have signed
+// any valid token. Other servers may sign with a key until they reload after
+// it's retired, so they're given an extra reload interval.
+func (k *KeySet) expiredBefore(now time.Time) time.Time {
+	return now.Add(-k.verifyFor - reloadInterval)
+}
+
+// rotate generates a new key and makes it the current key, unless another
+// server rotated the key after rotateBefore.
+func (k *KeySet) rotate(ctx context.Context, now, rotateBefore time.Time) error {
+	sk, err := generateKey(k.algorithm, now)
+	if err != nil {
+		return fmt.Errorf("unable to generate signing key: %w", err)
+	}
+
+	rotated, err := k.store.RotateSigningKey(ctx, sk, rotateBefore)
+	if err != nil {
+		return fmt.Errorf("unable to rotate signing key: %w", err)
+	}
+
+	if rotated {
+		k.logger.WithFields(logrus.Fields{"kid": sk.ID, "algorithm": sk.Algorithm}).Info("rotated signing key")
+	}
+
+	return k.load(ctx, now)
+}
+
+// load replaces the keys with the unexpired keys from the store.
+func (k *KeySet) load(ctx context.Context, now time.Time) error {
+	stored, err := k.store.GetSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get signing keys: %w", err)
+	}
+
+	expiredBefore := k.expiredBefore(now)
+	keys := make(map[string]*key, len(stored))
+	var current *key
+	var oldest time.Time
+	for _, sk := range stored {
+		if oldest.IsZero() || sk.CreatedAt.Before(oldest) {
+			oldest = sk.CreatedAt
+		}
+
+		if sk.RetiredAt != nil && sk.RetiredAt.Before(expiredBefore) {
+			continue
+		}
+
+		parsed, err := parseKey(sk)
+		if err != nil {
+			return fmt.Errorf("unable to parse signing key %s: %w", sk.ID, err)
+		}
+		keys[parsed.id] = parsed
+
+		if sk.RetiredAt == nil && (current == nil || parsed.createdAt.After(current.createdAt)) {
+			current = parsed
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.current = current
+	k.loaded = time.Now()
+	if !oldest.IsZero() {
+		k.legacyUntil = oldest.Add(k.verifyFor)
+	}
+	k.mu.Unlock()
+
+	return nil
+}
+
+// Sign returns a token with the claims signed by the current key.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	current := k.current
+	k.mu.RUnlock()
+
+	if current == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.id
+
+	return token.SignedString(current.private)
+}
+
+// VerifyKey returns the key to verify a token with. It can be used as a
+// jwt.Keyfunc.
+func (k *KeySet) VerifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		if k.store != nil && !k.acceptsLegacy(time.Now()) {
+			return nil, errors.New("tokens without a key ID are no longer accepted")
+		}
+
+		return k.secret, nil
+	}
+
+	key := k.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.private.Public(), nil
+}
+
+// acceptsLegacy returns whether tokens signed with the secret before switching
+// from HS256 may still be valid as of now.
+func (k *KeySet) acceptsLegacy(now time.Time) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return now.Before(k.legacyUntil)
+}
+
+// lookup returns the key with an ID, reloading the keys if it isn't known yet
+// since another server may have just rotated the key.
+func (k *KeySet) lookup(kid string) *key {
+	k.mu.Lock()
+	key, ok := k.keys[kid]
+	reload := !ok && k.store != nil && time.Since(k.loaded) >= minReloadInterval
+	if reload {
+		// Claim the reload so concurrent requests don't all reload too.
+		k.loaded = time.Now()
+	}
+	k.mu.Unlock()
+
+	if !reload {
+		return key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+	defer cancel()
+
+	if err := k.load(ctx, time.Now()); err != nil {
+		k.logger.WithError(err).Error("reloading signing keys")
+		return nil
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[kid]
+}
+
+// JWK is a public key in a JSON Web Key Set.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and public key of Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that tokens may be verified with, newest
+// first. It's empty for HS256, since the secret can't be published.
+func (k *KeySet) JWKS() JWKS {
+	k.mu.RLock()
+	keys := make([]*key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	k.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range keys {
+		jwk := JWK{ID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// generateKey returns a new random key for the algorithm.
+func generateKey(algorithm string, now time.Time) (store.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return store.SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return store.SigningKey{}, err
+	}
+
+	id := make([]byte, keyIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return store.SigningKey{}, err
+	}
+
+	return store.SigningKey{
+		ID:         base64.RawURLEncoding.EncodeToString(id),
+		Algorithm:  algorithm,
+		PrivateKey: der,
+		CreatedAt:  now,
+	}, nil
+}
+
+// parseKey parses a stored key, checking it matches its algorithm.
+func parseKey(sk store.SigningKey) (*key, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(sk.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &key{id: sk.ID, createdAt: sk.CreatedAt}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if sk.Algorithm != RS256 {
+			return nil, fmt.Errorf("algorithm %s used with an RSA key", sk.Algorithm)
+		}
+		k.method, k.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		if sk.Algorithm != EdDSA {
+			return nil, fmt.Errorf("algorithm %s used with an Ed25519 key", sk.Algorithm)
+		}
+		k.method, k.private = SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return k, nil
+}
@@ -0,0 +1,166 @@
+package signing
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	secret    = "i-am-secret"
+	rotation  = time.Hour
+	verifyFor = time.Hour * 24
+)
+
+func newLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+func sign(t *testing.T, k *KeySet) string {
+	t.Helper()
+
+	ss, err := k.Sign(&jwt.StandardClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("did not expect error %v signing token", err)
+	}
+
+	return ss
+}
+
+func verify(k *KeySet, ss string) error {
+	_, err := jwt.ParseWithClaims(ss, &jwt.StandardClaims{}, k.VerifyKey)
+	return err
+}
+
+func TestHMAC(t *testing.T) {
+	k := NewHMAC(secret)
+
+	ss := sign(t, k)
+	if err := verify(k, ss); err != nil {
+		t.Errorf("did not expect error %v verifying token", err)
+	}
+
+	if err := verify(NewHMAC("not-the-secret"), ss); err == nil {
+		t.Errorf("expected token signed with another secret to fail verifying")
+	}
+
+	if jwks := k.JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("expected no published keys for HS256, got %+v", jwks.Keys)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	for _, tt := range []struct {
+		algorithm string
+		keyType   string
+	}{
+		{algorithm: RS256, keyType: "RSA"},
+		{algorithm: EdDSA, keyType: "OKP"},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			ctx := context.Background()
+			sto := store.NewMemory()
+
+			k, err := Open(ctx, secret, tt.algorithm, rotation, verifyFor, sto, newLogger())
+			if err != nil {
+				t.Fatalf("did not expect error %v opening key set", err)
+			}
+
+			first := sign(t, k)
+			token, err := jwt.ParseWithClaims(first, &jwt.StandardClaims{}, k.VerifyKey)
+			if err != nil {
+				t.Fatalf("did not expect error %v verifying token", err)
+			}
+			if token.Method.Alg() != tt.algorithm || token.Header["kid"] == "" {
+				t.Errorf("expected token signed with %s and a key ID, got header %v", tt.algorithm, token.Header)
+			}
+
+			jwks := k.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyType != tt.keyType || jwks.Keys[0].Algorithm != tt.algorithm || jwks.Keys[0].ID != token.Header["kid"] {
+				t.Errorf("unexpected JWKS %+v", jwks)
+			}
+
+			legacy, err := NewHMAC(secret).Sign(&jwt.StandardClaims{Subject: "1"})
+			if err != nil {
+				t.Fatalf("did not expect error %v signing legacy token", err)
+			}
+			if err := verify(k, legacy); err != nil {
+				t.Errorf("expected HS256 token without key ID to verify, got %v", err)
+			}
+
+			// once every token from before the switch has expired, the
+			// secret can't be used to make tokens anymore
+			switched := store.NewMemory()
+			old, err := generateKey(tt.algorithm, time.Now().Add(-verifyFor-time.Minute))
+			if err != nil {
+				t.Fatalf("did not expect error %v generating key", err)
+			}
+			if _, err := switched.RotateSigningKey(ctx, old, old.CreatedAt); err != nil {
+				t.Fatalf("did not expect error %v storing key", err)
+			}
+			afterSwitch, err := Open(ctx, secret, tt.algorithm, rotation, verifyFor, switched, newLogger())
+			if err != nil {
+				t.Fatalf("did not expect error %v opening key set", err)
+			}
+			if err := verify(afterSwitch, legacy); err == nil {
+				t.Errorf("expected HS256 token without key ID to fail verifying long after switching from HS256")
+			}
+
+			confused := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{})
+			confused.Header["kid"] = token.Header["kid"]
+			ss, err := confused.SignedString([]byte(secret))
+			if err != nil {
+				t.Fatalf("did not expect error %v signing token", err)
+			}
+			if err := verify(k, ss); err == nil {
+				t.Errorf("expected HS256 token with an %s key ID to fail verifying", tt.algorithm)
+			}
+
+			other, err := Open(ctx, secret, tt.algorithm, rotation, verifyFor, sto, newLogger())
+			if err != nil {
+				t.Fatalf("did not expect error %v opening second key set", err)
+			}
+			if jwks := other.JWKS(); len(jwks.Keys) != 1 {
+				t.Errorf("expected second key set to share the stored key, got %+v", jwks)
+			}
+
+			if err := k.refresh(ctx, time.Now().Add(rotation)); err != nil {
+				t.Fatalf("did not expect error %v rotating keys", err)
+			}
+
+			second := sign(t, k)
+			if err := verify(k, first); err != nil {
+				t.Errorf("expected token signed with retired key to verify, got %v", err)
+			}
+
+			if len(k.JWKS().Keys) != 2 {
+				t.Errorf("expected current and retired keys to be published, got %+v", k.JWKS())
+			}
+
+			other.loaded = time.Time{}
+			if err := verify(other, second); err != nil {
+				t.Errorf("expected other key set to reload and verify rotated key, got %v", err)
+			}
+
+			if err := k.refresh(ctx, time.Now().Add(rotation+verifyFor+reloadInterval+time.Minute)); err != nil {
+				t.Fatalf("did not expect error %v refreshing keys", err)
+			}
+
+			if err := verify(k, first); err == nil {
+				t.Errorf("expected token signed with expired key to fail verifying")
+			}
+
+			keys, _ := sto.GetSigningKeys(ctx)
+			if len(keys) != 2 {
+				t.Errorf("expected expired key to be deleted, got %d keys", len(keys))
+			}
+		})
+	}
+}
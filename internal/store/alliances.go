@@ -4,14 +4,13 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
 // AlliancesUpsertTx upserts the red and blue alliances for a specific match.
 // matchKey is the key of the match. The upsert is done within the given
 // transaction.
-func (s *Service) AlliancesUpsertTx(ctx context.Context, tx *sqlx.Tx, eventKey, matchKey string, blueAlliance []string, redAlliance []string) error {
+func (s *Service) AlliancesUpsertTx(ctx context.Context, tx *Tx, eventKey, matchKey string, blueAlliance []string, redAlliance []string) error {
 	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO alliances (team_keys, event_key, match_key, is_blue)
 		VALUES ($1, $2, $3, $4)
@@ -39,7 +38,7 @@ func (s *Service) AlliancesUpsertTx(ctx context.Context, tx *sqlx.Tx, eventKey,
 }
 
 // LockAlliance returns whether the specified team is on an alliance in the specified match, and if so selects the alliance for update
-func (s *Service) LockAlliance(ctx context.Context, tx *sqlx.Tx, eventKey, matchKey, teamKey string, realmID *int64) (present bool, err error) {
+func (s *Service) LockAlliance(ctx context.Context, tx *Tx, eventKey, matchKey, teamKey string, realmID *int64) (present bool, err error) {
 	err = tx.QueryRowContext(ctx, `
 			SELECT EXISTS(
 				SELECT FROM alliances
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix starts every API key, so they can be told apart from JWTs.
+const APIKeyPrefix = "pgk_"
+
+// APIKey lets scripts and integrations act on behalf of the user that created
+// it, limited to the key's permissions and realm. Only a hash of the key is
+// stored, the key itself is shown once when it's created.
+type APIKey struct {
+	ID          int64       `json:"id" db:"id"`
+	Name        string      `json:"name" db:"name"`
+	Prefix      string      `json:"prefix" db:"prefix"`
+	Hash        string      `json:"-" db:"hash"`
+	UserID      int64       `json:"userId" db:"user_id"`
+	RealmID     int64       `json:"realmId" db:"realm_id"`
+	Permissions Permissions `json:"permissions" db:"permissions"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
+	ExpiresAt   *time.Time  `json:"expiresAt" db:"expires_at"`
+	LastUsedAt  *time.Time  `json:"lastUsedAt" db:"last_used_at"`
+}
+
+// Expired returns whether the key has expired as of now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// HashAPIKey hashes an API key for storage and lookup. Keys are long and
+// random, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	return HashToken(key)
+}
+
+// CreateAPIKey inserts an API key, returning its ID.
+func (s *Service) CreateAPIKey(ctx context.Context, key APIKey) (int64, error) {
+	stmt, err := s.db.PrepareNamedContext(ctx, `
+	INSERT
+		INTO
+			api_keys (name, prefix, hash, user_id, realm_id, permissions, created_at, expires_at)
+		VALUES (:name, :prefix, :hash, :user_id, :realm_id, :permissions, :created_at, :expires_at)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare API key insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var id int64
+	err = stmt.GetContext(ctx, &id, key)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgFKeyViolation {
+		return 0, ErrFKeyViolation{fmt.Errorf("API key fk violation on user ID %d or realm ID %d: %w", key.UserID, key.RealmID, err)}
+	} else if err != nil {
+		return 0, fmt.Errorf("unable to insert API key: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetAPIKeys retrieves the API keys of a realm, or of every realm if realmID
+// is nil.
+func (s *Service) GetAPIKeys(ctx context.Context, realmID *int64) ([]APIKey, error) {
+	keys := []APIKey{}
+
+	err := s.db.SelectContext(ctx, &keys, `
+	SELECT *
+	FROM api_keys
+	WHERE $1::INTEGER IS NULL OR realm_id = $1
+	ORDER BY id
+	`, realmID)
+	if err != nil {
+		return keys, fmt.Errorf("unable to select API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (s *Service) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	var key APIKey
+
+	err := s.db.GetContext(ctx, &key, "SELECT * FROM api_keys WHERE hash = $1", hash)
+	if err == sql.ErrNoRows {
+		return key, ErrNoResults{fmt.Errorf("API key does not exist: %w", err)}
+	} else if err != nil {
+		return key, fmt.Errorf("unable to select API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// TouchAPIKey records that an API key was used at the given time, which also
+// marks the user it acts for as active.
+func (s *Service) TouchAPIKey(ctx context.Context, id int64, used time.Time) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", used, id)
+		if err != nil {
+			return fmt.Errorf("unable to update API key last used time: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE users
+			SET last_active_at = $1
+			FROM api_keys
+			WHERE api_keys.id = $2 AND users.id = api_keys.user_id
+		`, used, id)
+		if err != nil {
+			return fmt.Errorf("unable to mark user active: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteAPIKey revokes an API key. If realmID is not nil the key must belong
+// to that realm.
+func (s *Service) DeleteAPIKey(ctx context.Context, id int64, realmID *int64) error {
+	res, err := s.db.ExecContext(ctx, `
+	DELETE FROM api_keys
+	WHERE id = $1 AND ($2::INTEGER IS NULL OR realm_id = $2)
+	`, id, realmID)
+	if err != nil {
+		return fmt.Errorf("unable to delete API key: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected deleting API key: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("API key %d does not exist", id)}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GetPendingUsers retrieves the users waiting for approval, including
+// rejected users that haven't been deleted yet, oldest first. If realmID is
+// nil pending users of every realm are retrieved. It does not retrieve the
+// users stars.
+func (s *Service) GetPendingUsers(ctx context.Context, realmID *int64) ([]User, error) {
+	users := []User{}
+
+	err := s.db.SelectContext(ctx, &users, `
+	SELECT *
+	FROM users
+	WHERE
+		pending_since IS NOT NULL AND
+		($1::INTEGER IS NULL OR realm_id = $1)
+	ORDER BY pending_since, id
+	`, realmID)
+	if err != nil {
+		return users, fmt.Errorf("unable to select pending users: %w", err)
+	}
+
+	return users, nil
+}
+
+// ApproveUser approves a pending user, giving them a role and permissions.
+// Rejected users that haven't been deleted yet can still be approved.
+// ErrNoResults is returned if the user doesn't exist or isn't pending.
+func (s *Service) ApproveUser(ctx context.Context, id int64, role Role, perms Permissions) error {
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE users
+	SET
+		role = $2,
+		permissions = $3,
+		pending_since = NULL,
+		rejected_at = NULL,
+		rejection_reason = ''
+	WHERE id = $1 AND pending_since IS NOT NULL
+	`, id, role, perms)
+	if err != nil {
+		return fmt.Errorf("unable to approve user: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected approving user: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("user %d is not pending", id)}
+	}
+
+	return nil
+}
+
+// RejectUser rejects a pending user with a reason. The user stays pending
+// until DeleteRejectedUsers deletes them. ErrNoResults is returned if the
+// user doesn't exist or isn't pending.
+func (s *Service) RejectUser(ctx context.Context, id int64, reason string, rejectedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE users
+	SET
+		rejected_at = $2,
+		rejection_reason = $3
+	WHERE id = $1 AND pending_since IS NOT NULL
+	`, id, rejectedAt, reason)
+	if err != nil {
+		return fmt.Errorf("unable to reject user: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected rejecting user: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("user %d is not pending", id)}
+	}
+
+	return nil
+}
+
+// DeleteRejectedUsers deletes the pending users that were rejected before
+// rejectedBefore, returning how many were deleted.
+func (s *Service) DeleteRejectedUsers(ctx context.Context, rejectedBefore time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE pending_since IS NOT NULL AND rejected_at < $1", rejectedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete rejected users: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get rows affected deleting rejected users: %w", err)
+	}
+
+	return n, nil
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
@@ -120,7 +119,7 @@ func (s *Service) GetActiveEvents(ctx context.Context) ([]string, error) {
 // EventsUpsert upserts multiple events into the database. It will set tba_deleted
 // to false for all updated events. schema_id will only be updated if null.
 func (s *Service) EventsUpsert(ctx context.Context, events []Event) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
 		eventStmt, err := tx.PrepareNamedContext(ctx, `
 		INSERT INTO events (key, name, district, full_district, week, start_date, end_date, webcasts, location_name, gmaps_url, lat, lon, realm_id, schema_id, tba_deleted)
 		VALUES (:key, :name, :district, :full_district, :week, :start_date, :end_date, :webcasts, :location_name, :gmaps_url, :lat, :lon, :realm_id, :schema_id, :tba_deleted)
@@ -190,7 +189,7 @@ func (s *Service) MarkEventsDeleted(ctx context.Context, events []Event) error {
 }
 
 // ExclusiveLockEventsTx acquires an exclusive lock on the events table.
-func (s *Service) ExclusiveLockEventsTx(ctx context.Context, tx *sqlx.Tx) error {
+func (s *Service) ExclusiveLockEventsTx(ctx context.Context, tx *Tx) error {
 	_, err := tx.ExecContext(ctx, "LOCK TABLE events IN EXCLUSIVE MODE")
 	if err != nil {
 		return fmt.Errorf("unable to lock events: %w", err)
@@ -200,7 +199,7 @@ func (s *Service) ExclusiveLockEventsTx(ctx context.Context, tx *sqlx.Tx) error
 }
 
 // GetEventRealmIDTx returns the realm ID of an event by key.
-func (s *Service) GetEventRealmIDTx(ctx context.Context, tx *sqlx.Tx, eventKey string) (realmID *int64, err error) {
+func (s *Service) GetEventRealmIDTx(ctx context.Context, tx *Tx, eventKey string) (realmID *int64, err error) {
 	err = tx.QueryRowContext(ctx, "SELECT realm_id FROM events WHERE key = $1", eventKey).Scan(&realmID)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoResults{fmt.Errorf("couldn't find event by key")}
@@ -213,7 +212,7 @@ func (s *Service) GetEventRealmIDTx(ctx context.Context, tx *sqlx.Tx, eventKey s
 
 // UpsertEventTx upserts a single event into the database and returns whether
 // the event was created or updated.
-func (s *Service) UpsertEventTx(ctx context.Context, tx *sqlx.Tx, event Event) error {
+func (s *Service) UpsertEventTx(ctx context.Context, tx *Tx, event Event) error {
 	_, err := tx.NamedExecContext(ctx, `
 			INSERT INTO events (key, name, district, full_district, week, start_date, end_date, webcasts, location_name, gmaps_url, lat, lon, realm_id, schema_id, tba_deleted)
 				VALUES (:key, :name, :district, :full_district, :week, :start_date, :end_date, :webcasts, :location_name, :gmaps_url, :lat, :lon, :realm_id, :schema_id, :tba_deleted)
@@ -239,5 +238,7 @@ func (s *Service) UpsertEventTx(ctx context.Context, tx *sqlx.Tx, event Event) e
 		return fmt.Errorf("unable to upsert event: %w", err)
 	}
 
+	s.eventChangedTx(tx, event.Key)
+
 	return nil
 }
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Identity links a user to their account with an OpenID Connect provider.
+type Identity struct {
+	Issuer    string    `json:"issuer" db:"issuer"`
+	Subject   string    `json:"subject" db:"subject"`
+	UserID    int64     `json:"userId" db:"user_id"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// GetUserByIdentity retrieves the user linked to an identity. It does not
+// retrieve the users stars.
+func (s *Service) GetUserByIdentity(ctx context.Context, issuer, subject string) (User, error) {
+	var u User
+
+	err := s.db.GetContext(ctx, &u, `
+	SELECT users.*
+	FROM users
+	INNER JOIN user_identities
+		ON user_identities.user_id = users.id
+	WHERE user_identities.issuer = $1 AND user_identities.subject = $2
+	`, issuer, subject)
+	if err == sql.ErrNoRows {
+		return u, ErrNoResults{fmt.Errorf("no user with identity %s from %s: %w", subject, issuer, err)}
+	} else if err != nil {
+		return u, fmt.Errorf("unable to select user by identity: %w", err)
+	}
+
+	return u, nil
+}
+
+// CreateIdentity links an identity to a user. ErrExists is returned if the
+// identity is already linked to a user.
+func (s *Service) CreateIdentity(ctx context.Context, identity Identity) error {
+	_, err := s.db.NamedExecContext(ctx, `
+	INSERT
+		INTO
+			user_identities (issuer, subject, user_id, email, created_at)
+		VALUES (:issuer, :subject, :user_id, :email, :created_at)
+	`, identity)
+	if err, ok := err.(*pq.Error); ok {
+		if err.Code == pgExists {
+			return ErrExists{fmt.Errorf("identity %s from %s is already linked: %w", identity.Subject, identity.Issuer, err)}
+		}
+		if err.Code == pgFKeyViolation {
+			return ErrFKeyViolation{fmt.Errorf("identity fk violation on user ID %d: %w", identity.UserID, err)}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to insert identity: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// EventStore stores TBA and custom events.
+type EventStore interface {
+	GetEvents(ctx context.Context, tbaDeleted bool, year *int) ([]Event, error)
+	GetEventsForRealm(ctx context.Context, tbaDeleted bool, realmID *int64, year *int) ([]Event, error)
+	GetEventYearsForRealm(ctx context.Context, realmID *int64) ([]int, error)
+	GetEventForRealm(ctx context.Context, eventKey string, realmID *int64) (Event, error)
+	GetActiveEvents(ctx context.Context) ([]string, error)
+	EventsUpsert(ctx context.Context, events []Event) error
+	MarkEventsDeleted(ctx context.Context, events []Event) error
+	ExclusiveLockEventsTx(ctx context.Context, tx *Tx) error
+	GetEventRealmIDTx(ctx context.Context, tx *Tx, eventKey string) (*int64, error)
+	UpsertEventTx(ctx context.Context, tx *Tx, event Event) error
+}
+
+// MatchStore stores matches and their alliances.
+type MatchStore interface {
+	GetMatchesForRealm(ctx context.Context, eventKey string, teamKeys []string, tbaDeleted bool, realmID *int64) ([]Match, error)
+	GetMatchForRealm(ctx context.Context, eventKey, matchKey string, realmID *int64) (Match, error)
+	GetEventAnalysisInfoForRealm(ctx context.Context, eventKey string, realmID *int64) ([]Match, error)
+	GetMatchAnalysisInfoForRealm(ctx context.Context, eventKey, matchKey string, realmID *int64) (Match, error)
+	GetEventRealmIDByMatchKeyTx(ctx context.Context, tx *Tx, matchKey string) (*int64, error)
+	ExclusiveLockMatchesTx(ctx context.Context, tx *Tx) error
+	LockAlliance(ctx context.Context, tx *Tx, eventKey, matchKey, teamKey string, realmID *int64) (bool, error)
+	DeleteMatchTx(ctx context.Context, tx *Tx, matchKey, eventKey string) error
+	UpsertMatchTx(ctx context.Context, tx *Tx, match Match) error
+	MarkMatchesDeleted(ctx context.Context, eventKey string, matches []Match) error
+	UpdateTBAMatches(ctx context.Context, matches []Match) error
+}
+
+// TeamStore stores teams, their robots, and their rankings at events.
+type TeamStore interface {
+	GetEventTeamForRealm(ctx context.Context, teamKey string, eventKey string, realmID *int64) (EventTeam, error)
+	GetEventTeamsForRealm(ctx context.Context, eventKey string, realmID *int64) ([]EventTeam, error)
+	GetTeam(ctx context.Context, teamKey string) (Team, error)
+	GetTeamEventsForRealm(ctx context.Context, teamKey string, realmID *int64, year *int) ([]TeamEvent, error)
+	GetYearTeamKeys(ctx context.Context, year int) ([]string, error)
+	EventTeamsUpsert(ctx context.Context, teams []EventTeam) error
+	TeamsUpsert(ctx context.Context, teams []Team) error
+	RobotsUpsert(ctx context.Context, robots []Robot) error
+}
+
+// ReportStore stores scouting reports.
+type ReportStore interface {
+	GetReportForRealm(ctx context.Context, id int64, realmID *int64) (Report, error)
+	GetReports(ctx context.Context, eventKey *string, matchKey *string, teamKey *string, realmID *int64, reporterID *int64) ([]Report, error)
+	GetEventReportsForRealm(ctx context.Context, eventKey string, realmID *int64) ([]Report, error)
+	GetEventTeamReportsForRealm(ctx context.Context, eventKey string, teamKey string, realmID *int64) ([]Report, error)
+	GetMatchTeamReportsForRealm(ctx context.Context, eventKey, matchKey string, teamKey string, realmID *int64) ([]Report, error)
+	GetLeaderboardForRealm(ctx context.Context, realmID int64, year *int) (Leaderboard, error)
+	UpsertReport(ctx context.Context, r Report) (created bool, id int64, err error)
+	UpsertReportTx(ctx context.Context, tx *Tx, r Report) (created bool, id int64, err error)
+	LockReport(ctx context.Context, tx *Tx, id int64) (Report, error)
+	UpdateReportTx(ctx context.Context, tx *Tx, r Report, replace bool) error
+	DeleteReportTx(ctx context.Context, tx *Tx, id int64) error
+}
+
+// RealmStore stores realms.
+type RealmStore interface {
+	GetRealms(ctx context.Context) ([]Realm, error)
+	GetRealm(ctx context.Context, id int64) (Realm, error)
+	InsertRealm(ctx context.Context, realm Realm) (int64, error)
+	InsertRealmTx(ctx context.Context, tx *Tx, realm Realm) (int64, error)
+	GetRealmExistsTx(ctx context.Context, tx *Tx, id int64) (bool, error)
+	ExclusiveLockRealmsTx(ctx context.Context, tx *Tx) error
+	DeleteRealmTx(ctx context.Context, tx *Tx, id int64) error
+	UpdateRealmTx(ctx context.Context, tx *Tx, realm Realm) error
+	UpdateRealmSettingsTx(ctx context.Context, tx *Tx, id int64, settings RealmSettings) error
+}
+
+// UserStore stores users, their starred events, and their linked identities.
+type UserStore interface {
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUsersByEmail(ctx context.Context, email string) ([]User, error)
+	GetUserByID(ctx context.Context, id int64) (User, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUsersByRealm(ctx context.Context, realmID int64) ([]User, error)
+	CheckSimilarUsernameExists(ctx context.Context, username string, id *int64) error
+	CreateUser(ctx context.Context, u User) error
+	CreateUserTx(ctx context.Context, tx *Tx, u User) (int64, error)
+	PatchUser(ctx context.Context, pu PatchUser) error
+	DeleteUserByID(ctx context.Context, id int64) error
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (User, error)
+	CreateIdentity(ctx context.Context, identity Identity) error
+	LockUser(ctx context.Context, tx *Tx, id int64) (User, error)
+	ExclusiveLockUsersTx(ctx context.Context, tx *Tx) error
+	DeleteUserByIDRealmTx(ctx context.Context, tx *Tx, id, realmID int64) error
+}
+
+// ApprovalStore stores the approval of users who signed themselves up.
+type ApprovalStore interface {
+	GetPendingUsers(ctx context.Context, realmID *int64) ([]User, error)
+	ApproveUser(ctx context.Context, id int64, role Role, perms Permissions) error
+	RejectUser(ctx context.Context, id int64, reason string, rejectedAt time.Time) error
+	DeleteRejectedUsers(ctx context.Context, rejectedBefore time.Time) (int64, error)
+}
+
+// PrivacyStore exports and erases the personal data of users.
+type PrivacyStore interface {
+	GetReportsByReporter(ctx context.Context, reporterID int64) ([]Report, error)
+	DeleteReportsByReporterTx(ctx context.Context, tx *Tx, reporterID int64) error
+	DeleteUserByIDTx(ctx context.Context, tx *Tx, id int64) error
+	PurgeInactiveUsers(ctx context.Context, activeBefore time.Time) (int64, error)
+}
+
+// MembershipStore stores the memberships of users in realms besides their
+// own.
+type MembershipStore interface {
+	GetMemberships(ctx context.Context, userID, realmID *int64) ([]Membership, error)
+	GetMembership(ctx context.Context, userID, realmID int64) (Membership, error)
+	UpsertMembership(ctx context.Context, m Membership) (created bool, err error)
+	DeleteMembership(ctx context.Context, userID, realmID int64) error
+}
+
+// RealmShareStore stores the agreements of realms to share reports with
+// partner realms.
+type RealmShareStore interface {
+	GetRealmShares(ctx context.Context, realmID int64) ([]RealmShare, error)
+	GetRealmShare(ctx context.Context, id int64) (RealmShare, error)
+	InsertRealmShare(ctx context.Context, share RealmShare) (int64, error)
+	AcceptRealmShare(ctx context.Context, id int64, acceptedAt time.Time) error
+	DeleteRealmShare(ctx context.Context, id int64) error
+}
+
+// APIKeyStore stores API keys.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key APIKey) (int64, error)
+	GetAPIKeys(ctx context.Context, realmID *int64) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	TouchAPIKey(ctx context.Context, id int64, used time.Time) error
+	DeleteAPIKey(ctx context.Context, id int64, realmID *int64) error
+}
+
+// SessionStore stores the login sessions that refresh tokens belong to.
+type SessionStore interface {
+	CreateSession(ctx context.Context, session Session) (int64, error)
+	GetSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error)
+	RotateSession(ctx context.Context, session Session, oldTokenID string) (rotated bool, err error)
+	DeleteSession(ctx context.Context, userID, id int64) error
+	DeleteSessions(ctx context.Context, userID int64) error
+}
+
+// LoginStore stores failed logins, both to lock users out after too many
+// and as an audit log.
+type LoginStore interface {
+	RecordFailedLogin(ctx context.Context, userID int64, now time.Time, maxFailures int, lockout time.Duration) (lockedUntil *time.Time, err error)
+	UnlockUser(ctx context.Context, id int64) error
+	CreateLoginFailure(ctx context.Context, f LoginFailure) error
+	GetLoginFailures(ctx context.Context, realmID *int64, since time.Time) ([]LoginFailure, error)
+}
+
+// InviteStore stores invites to sign up in a realm.
+type InviteStore interface {
+	CreateInvite(ctx context.Context, invite Invite) (int64, error)
+	GetInvites(ctx context.Context, realmID *int64) ([]Invite, error)
+	DeleteInvite(ctx context.Context, id int64, realmID *int64) error
+	AcceptInvite(ctx context.Context, hash string, now time.Time, u User) error
+}
+
+// PasswordResetStore stores password resets for users who forgot their
+// password.
+type PasswordResetStore interface {
+	CreatePasswordReset(ctx context.Context, reset PasswordReset, now time.Time) error
+	ResetPassword(ctx context.Context, hash string, now time.Time, hashedPassword string) (userID int64, err error)
+}
+
+// SigningKeyStore stores the keys tokens are signed with.
+type SigningKeyStore interface {
+	GetSigningKeys(ctx context.Context) ([]SigningKey, error)
+	RotateSigningKey(ctx context.Context, key SigningKey, rotateBefore time.Time) (rotated bool, err error)
+	DeleteSigningKeys(ctx context.Context, retiredBefore time.Time) error
+}
+
+// SchemaStore stores report schemas.
+type SchemaStore interface {
+	CreateSchema(ctx context.Context, schema Schema) error
+	CreateSchemaTx(ctx context.Context, tx *Tx, schema Schema) (int64, error)
+	GetSchemaByID(ctx context.Context, id int64) (Schema, error)
+	GetSchemaByYear(ctx context.Context, year int) (Schema, error)
+	GetSchemasForRealm(ctx context.Context, realmID *int64) ([]Schema, error)
+}
+
+// Store is a complete storage backend. Service stores data in PostgreSQL, and
+// Memory stores data in memory for demos, offline use, and tests.
+type Store interface {
+	EventStore
+	MatchStore
+	TeamStore
+	ReportStore
+	RealmStore
+	UserStore
+	ApprovalStore
+	PrivacyStore
+	MembershipStore
+	RealmShareStore
+	APIKeyStore
+	SessionStore
+	LoginStore
+	InviteStore
+	PasswordResetStore
+	SigningKeyStore
+	SchemaStore
+
+	// Ping returns an error if the backend is unavailable.
+	Ping(ctx context.Context) error
+	// Close releases any resources held by the backend.
+	Close() error
+	// DoTransaction calls txWrapper with a transaction, rolling back any
+	// changes made with the transaction if txWrapper returns an error.
+	DoTransaction(ctx context.Context, txWrapper func(*Tx) error) error
+	// OnEventChange registers a function to be called with the key of an
+	// event whenever its reports or matches change, or with an empty key if
+	// every event may have changed.
+	OnEventChange(f func(eventKey string))
+}
+
+var (
+	_ Store = (*Service)(nil)
+	_ Store = (*Memory)(nil)
+)
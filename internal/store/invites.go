@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Invite lets someone sign up in a realm with the role and permissions chosen
+// by the realm admin who created it. Only a hash of the invite token is
+// stored, and an invite can only be accepted once.
+type Invite struct {
+	ID          int64       `json:"id" db:"id"`
+	Hash        string      `json:"-" db:"hash"`
+	RealmID     int64       `json:"realmId" db:"realm_id"`
+	Role        Role        `json:"role" db:"role"`
+	Permissions Permissions `json:"permissions" db:"permissions"`
+	Email       string      `json:"email,omitempty" db:"email"`
+	CreatedBy   *int64      `json:"createdBy" db:"created_by"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
+	ExpiresAt   time.Time   `json:"expiresAt" db:"expires_at"`
+}
+
+// HashToken hashes a single use token, like an invite or password reset
+// token, for storage and lookup. Tokens are long and random, so a fast
+// unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateInvite inserts an invite, returning its ID.
+func (s *Service) CreateInvite(ctx context.Context, invite Invite) (int64, error) {
+	stmt, err := s.db.PrepareNamedContext(ctx, `
+	INSERT
+		INTO
+			invites (hash, realm_id, role, permissions, email, created_by, created_at, expires_at)
+		VALUES (:hash, :realm_id, :role, :permissions, :email, :created_by, :created_at, :expires_at)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare invite insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var id int64
+	err = stmt.GetContext(ctx, &id, invite)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgFKeyViolation {
+		return 0, ErrFKeyViolation{fmt.Errorf("invite fk violation on realm ID %d: %w", invite.RealmID, err)}
+	} else if err != nil {
+		return 0, fmt.Errorf("unable to insert invite: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetInvites retrieves the invites of a realm, or of every realm if realmID is
+// nil.
+func (s *Service) GetInvites(ctx context.Context, realmID *int64) ([]Invite, error) {
+	invites := []Invite{}
+
+	err := s.db.SelectContext(ctx, &invites, `
+	SELECT *
+	FROM invites
+	WHERE $1::INTEGER IS NULL OR realm_id = $1
+	ORDER BY id
+	`, realmID)
+	if err != nil {
+		return invites, fmt.Errorf("unable to select invites: %w", err)
+	}
+
+	return invites, nil
+}
+
+// DeleteInvite revokes an invite. If realmID is not nil the invite must belong
+// to that realm.
+func (s *Service) DeleteInvite(ctx context.Context, id int64, realmID *int64) error {
+	res, err := s.db.ExecContext(ctx, `
+	DELETE FROM invites
+	WHERE id = $1 AND ($2::INTEGER IS NULL OR realm_id = $2)
+	`, id, realmID)
+	if err != nil {
+		return fmt.Errorf("unable to delete invite: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected deleting invite: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("invite %d does not exist", id)}
+	}
+
+	return nil
+}
+
+// AcceptInvite creates a user from the invite with the given token hash and
+// deletes the invite. The user's realm, role, and permissions come from the
+// invite, as does their email address if they don't give one. ErrNoResults is
+// returned if the invite doesn't exist or has expired.
+func (s *Service) AcceptInvite(ctx context.Context, hash string, now time.Time, u User) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		var invite Invite
+		err := tx.GetContext(ctx, &invite, "DELETE FROM invites WHERE hash = $1 RETURNING *", hash)
+		if err == sql.ErrNoRows {
+			return ErrNoResults{fmt.Errorf("invite does not exist: %w", err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to delete invite: %w", err)
+		}
+
+		if !now.Before(invite.ExpiresAt) {
+			return ErrNoResults{fmt.Errorf("invite %d has expired", invite.ID)}
+		}
+
+		u.RealmID, u.Role, u.Permissions = invite.RealmID, invite.Role, invite.Permissions
+		if u.Email == "" {
+			u.Email = invite.Email
+		}
+
+		_, err = s.CreateUserTx(ctx, tx, u)
+		return err
+	})
+}
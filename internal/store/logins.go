@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LoginFailure is an audit record of a failed login.
+type LoginFailure struct {
+	ID        int64     `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	UserID    *int64    `json:"userId" db:"user_id"`
+	IPAddress string    `json:"ipAddress" db:"ip_address"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Reasons a login failed.
+const (
+	LoginUnknownUser   = "unknown user"
+	LoginWrongPassword = "wrong password"
+	LoginLocked        = "locked"
+	LoginPending       = "pending approval"
+)
+
+// RecordFailedLogin counts a consecutive failed login of a user. Once a user
+// has failed maxFailures times in a row they're locked out until now plus
+// lockout, and their count starts over. The time the user is locked until is
+// returned, or nil if they aren't locked.
+func (s *Service) RecordFailedLogin(ctx context.Context, userID int64, now time.Time, maxFailures int, lockout time.Duration) (lockedUntil *time.Time, err error) {
+	err = s.db.GetContext(ctx, &lockedUntil, `
+	UPDATE users
+	SET
+		failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END,
+		locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3 ELSE locked_until END
+	WHERE id = $1
+	RETURNING locked_until
+	`, userID, maxFailures, now.Add(lockout))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoResults{fmt.Errorf("user %d does not exist: %w", userID, err)}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to record failed login: %w", err)
+	}
+
+	if lockedUntil != nil && !now.Before(*lockedUntil) {
+		return nil, nil
+	}
+
+	return lockedUntil, nil
+}
+
+// UnlockUser clears a user's failed logins and lockout.
+func (s *Service) UnlockUser(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("unable to unlock user: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected unlocking user: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("user %d does not exist", id)}
+	}
+
+	return nil
+}
+
+// CreateLoginFailure inserts an audit record of a failed login.
+func (s *Service) CreateLoginFailure(ctx context.Context, f LoginFailure) error {
+	_, err := s.db.NamedExecContext(ctx, `
+	INSERT
+		INTO
+			login_failures (username, user_id, ip_address, reason, created_at)
+		VALUES (:username, :user_id, :ip_address, :reason, :created_at)
+	`, f)
+	if err != nil {
+		return fmt.Errorf("unable to insert login failure: %w", err)
+	}
+
+	return nil
+}
+
+// GetLoginFailures retrieves the failed logins since a time, newest first. If
+// realmID is not nil only failures of users in that realm are retrieved,
+// otherwise failures of unknown users are included too.
+func (s *Service) GetLoginFailures(ctx context.Context, realmID *int64, since time.Time) ([]LoginFailure, error) {
+	failures := []LoginFailure{}
+
+	err := s.db.SelectContext(ctx, &failures, `
+	SELECT login_failures.*
+	FROM login_failures
+	LEFT JOIN users ON users.id = login_failures.user_id
+	WHERE login_failures.created_at >= $1 AND ($2::INTEGER IS NULL OR users.realm_id = $2)
+	ORDER BY login_failures.created_at DESC, login_failures.id DESC
+	`, since, realmID)
+	if err != nil {
+		return failures, fmt.Errorf("unable to select login failures: %w", err)
+	}
+
+	return failures, nil
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
@@ -122,7 +121,7 @@ func (s *Service) GetMatchesForRealm(ctx context.Context, eventKey string, teamK
 
 // GetEventRealmIDByMatchKeyTx returns the realm ID for the event that the match associated
 // identified by the given key is associated with.
-func (s *Service) GetEventRealmIDByMatchKeyTx(ctx context.Context, tx *sqlx.Tx, matchKey string) (realmID *int64, err error) {
+func (s *Service) GetEventRealmIDByMatchKeyTx(ctx context.Context, tx *Tx, matchKey string) (realmID *int64, err error) {
 	err = tx.QueryRowContext(ctx, `
 	SELECT events.realm_id
 	FROM matches
@@ -156,7 +155,7 @@ func (s *Service) GetMatchForRealm(ctx context.Context, eventKey, matchKey strin
 
 // ExclusiveLockMatchesTx locks the matches table so no changes can be made to it by anything other
 // than the given transaction.
-func (s *Service) ExclusiveLockMatchesTx(ctx context.Context, tx *sqlx.Tx) error {
+func (s *Service) ExclusiveLockMatchesTx(ctx context.Context, tx *Tx) error {
 	_, err := tx.ExecContext(ctx, "LOCK TABLE matches IN EXCLUSIVE MODE")
 	if err != nil {
 		return fmt.Errorf("unable to lock matches: %w", err)
@@ -166,17 +165,19 @@ func (s *Service) ExclusiveLockMatchesTx(ctx context.Context, tx *sqlx.Tx) error
 }
 
 // DeleteMatchTx deletes a specific match using the given transaction.
-func (s *Service) DeleteMatchTx(ctx context.Context, tx *sqlx.Tx, matchKey, eventKey string) error {
+func (s *Service) DeleteMatchTx(ctx context.Context, tx *Tx, matchKey, eventKey string) error {
 	_, err := tx.ExecContext(ctx, `DELETE FROM matches WHERE key = $1 AND event_key = $2`, matchKey, eventKey)
 	if err != nil {
 		return fmt.Errorf("unable to delete match: %w", err)
 	}
 
+	s.eventChangedTx(tx, eventKey)
+
 	return nil
 }
 
 // UpsertMatchTx upserts a match and its alliances into the database in the given transaction.
-func (s *Service) UpsertMatchTx(ctx context.Context, tx *sqlx.Tx, match Match) error {
+func (s *Service) UpsertMatchTx(ctx context.Context, tx *Tx, match Match) error {
 	_, err := tx.NamedExecContext(ctx, `
 		INSERT INTO matches (key, event_key, predicted_time, scheduled_time, actual_time, red_score, blue_score, tba_deleted, red_score_breakdown, blue_score_breakdown, tba_url, videos)
 		VALUES (:key, :event_key, :predicted_time, :scheduled_time, :actual_time, :red_score, :blue_score, :tba_deleted, :red_score_breakdown, :blue_score_breakdown, :tba_url, :videos)
@@ -207,6 +208,8 @@ func (s *Service) UpsertMatchTx(ctx context.Context, tx *sqlx.Tx, match Match) e
 		return fmt.Errorf("unable to upsert event team keys: %w", err)
 	}
 
+	s.eventChangedTx(tx, match.EventKey)
+
 	return nil
 }
 
@@ -230,6 +233,8 @@ func (s *Service) MarkMatchesDeleted(ctx context.Context, eventKey string, match
 		return fmt.Errorf("unable to mark tba_deleted on missing matches: %w", err)
 	}
 
+	s.eventChanged(eventKey)
+
 	return nil
 }
 
@@ -238,7 +243,7 @@ func (s *Service) MarkMatchesDeleted(ctx context.Context, eventKey string, match
 // and matches deleted from TBA will be deleted from the database. User-created
 // matches will be unaffected. It will set tba_deleted to false for all updated matches.
 func (s *Service) UpdateTBAMatches(ctx context.Context, matches []Match) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
 		upsert, err := tx.PrepareNamedContext(ctx, `
 		INSERT INTO matches (key, event_key, predicted_time, scheduled_time, actual_time, red_score, blue_score, tba_deleted, red_score_breakdown, blue_score_breakdown, tba_url, videos)
 		VALUES (:key, :event_key, :predicted_time, :scheduled_time, :actual_time, :red_score, :blue_score, :tba_deleted, :red_score_breakdown, :blue_score_breakdown, :tba_url, :videos)
@@ -269,6 +274,8 @@ func (s *Service) UpdateTBAMatches(ctx context.Context, matches []Match) error {
 			if err = s.AlliancesUpsertTx(ctx, tx, match.EventKey, match.Key, match.BlueAlliance, match.RedAlliance); err != nil {
 				return fmt.Errorf("unable to upsert alliances: %w", err)
 			}
+
+			s.eventChangedTx(tx, match.EventKey)
 		}
 
 		return nil
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Membership gives a user a role in a realm besides their own, like a mentor
+// helping several teams. The user's own realm, role, and permissions are still
+// those of the user, and a membership can't be in the user's own realm.
+type Membership struct {
+	UserID      int64       `json:"userId" db:"user_id"`
+	RealmID     int64       `json:"realmId" db:"realm_id"`
+	Role        Role        `json:"role" db:"role"`
+	Permissions Permissions `json:"permissions" db:"permissions"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
+}
+
+// GetMemberships retrieves the memberships of a user, of a realm, or of both
+// if either is nil.
+func (s *Service) GetMemberships(ctx context.Context, userID, realmID *int64) ([]Membership, error) {
+	memberships := []Membership{}
+
+	err := s.db.SelectContext(ctx, &memberships, `
+	SELECT *
+	FROM memberships
+	WHERE
+		($1::INTEGER IS NULL OR user_id = $1) AND
+		($2::INTEGER IS NULL OR realm_id = $2)
+	ORDER BY user_id, realm_id
+	`, userID, realmID)
+	if err != nil {
+		return memberships, fmt.Errorf("unable to select memberships: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// GetMembership retrieves the membership of a user in a realm. ErrNoResults is
+// returned if the user isn't a member of the realm.
+func (s *Service) GetMembership(ctx context.Context, userID, realmID int64) (Membership, error) {
+	var m Membership
+
+	err := s.db.GetContext(ctx, &m, "SELECT * FROM memberships WHERE user_id = $1 AND realm_id = $2", userID, realmID)
+	if err == sql.ErrNoRows {
+		return m, ErrNoResults{fmt.Errorf("user %d is not a member of realm %d: %w", userID, realmID, err)}
+	} else if err != nil {
+		return m, fmt.Errorf("unable to get membership: %w", err)
+	}
+
+	return m, nil
+}
+
+// UpsertMembership adds a user to a realm, or changes their role and
+// permissions if they're already a member. It returns whether the membership
+// was created. ErrExists is returned if the realm is the user's own realm, and
+// ErrFKeyViolation if the user or realm doesn't exist.
+func (s *Service) UpsertMembership(ctx context.Context, m Membership) (created bool, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		var ownRealmID int64
+		err := tx.GetContext(ctx, &ownRealmID, "SELECT realm_id FROM users WHERE id = $1", m.UserID)
+		if err == sql.ErrNoRows {
+			return ErrFKeyViolation{fmt.Errorf("membership fk violation on user ID %d: %w", m.UserID, err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to get realm of user: %w", err)
+		}
+
+		if ownRealmID == m.RealmID {
+			return ErrExists{fmt.Errorf("realm %d is the own realm of user %d", m.RealmID, m.UserID)}
+		}
+
+		stmt, err := tx.PrepareNamedContext(ctx, `
+		INSERT
+			INTO
+				memberships (user_id, realm_id, role, permissions, created_at)
+			VALUES (:user_id, :realm_id, :role, :permissions, :created_at)
+			ON CONFLICT (user_id, realm_id) DO UPDATE
+				SET
+					role = :role,
+					permissions = :permissions
+			RETURNING (xmax = 0) AS created
+		`)
+		if err != nil {
+			return fmt.Errorf("unable to prepare membership upsert statement: %w", err)
+		}
+		defer stmt.Close()
+
+		err = stmt.GetContext(ctx, &created, m)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgFKeyViolation {
+			return ErrFKeyViolation{fmt.Errorf("membership fk violation on realm ID %d: %w", m.RealmID, err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to upsert membership: %w", err)
+		}
+
+		return nil
+	})
+
+	return created, err
+}
+
+// DeleteMembership removes a user from a realm that isn't their own.
+func (s *Service) DeleteMembership(ctx context.Context, userID, realmID int64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM memberships WHERE user_id = $1 AND realm_id = $2", userID, realmID)
+	if err != nil {
+		return fmt.Errorf("unable to delete membership: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected deleting membership: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("user %d is not a member of realm %d", userID, realmID)}
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// matchID identifies a match, since match keys are only unique within an event.
+type matchID struct {
+	eventKey string
+	key      string
+}
+
+// eventTeamID identifies a team at a specific event.
+type eventTeamID struct {
+	eventKey string
+	key      string
+}
+
+// robotID identifies the robot of a team in a specific year.
+type robotID struct {
+	teamKey string
+	year    int
+}
+
+// memoryData holds every table of a Memory store. Committed data is never
+// modified, transactions modify a copy that replaces the committed data when
+// the transaction commits. Values held in the maps must be replaced rather than
+// modified in place, since they are shared between copies.
+type memoryData struct {
+	events     map[string]Event
+	matches    map[matchID]Match
+	eventTeams map[eventTeamID]EventTeam
+	teams      map[string]Team
+	robots     map[robotID]Robot
+	reports    map[int64]Report
+	realms     map[int64]Realm
+	users      map[int64]User
+	schemas    map[int64]Schema
+	apiKeys    map[int64]APIKey
+	sessions   map[int64]Session
+	identities map[identityID]Identity
+	invites    map[int64]Invite
+
+	passwordResets map[string]PasswordReset
+	loginFailures  map[int64]LoginFailure
+	signingKeys    map[string]SigningKey
+	memberships    map[membershipID]Membership
+	realmShares    map[int64]RealmShare
+
+	lastReportID  int64
+	lastRealmID   int64
+	lastUserID    int64
+	lastSchemaID  int64
+	lastAPIKeyID  int64
+	lastSessionID int64
+	lastInviteID  int64
+
+	lastLoginFailureID int64
+	lastRealmShareID   int64
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+
+	c.events = make(map[string]Event, len(d.events))
+	for k, v := range d.events {
+		c.events[k] = v
+	}
+
+	c.matches = make(map[matchID]Match, len(d.matches))
+	for k, v := range d.matches {
+		c.matches[k] = v
+	}
+
+	c.eventTeams = make(map[eventTeamID]EventTeam, len(d.eventTeams))
+	for k, v := range d.eventTeams {
+		c.eventTeams[k] = v
+	}
+
+	c.teams = make(map[string]Team, len(d.teams))
+	for k, v := range d.teams {
+		c.teams[k] = v
+	}
+
+	c.robots = make(map[robotID]Robot, len(d.robots))
+	for k, v := range d.robots {
+		c.robots[k] = v
+	}
+
+	c.reports = make(map[int64]Report, len(d.reports))
+	for k, v := range d.reports {
+		c.reports[k] = v
+	}
+
+	c.realms = make(map[int64]Realm, len(d.realms))
+	for k, v := range d.realms {
+		c.realms[k] = v
+	}
+
+	c.users = make(map[int64]User, len(d.users))
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+
+	c.schemas = make(map[int64]Schema, len(d.schemas))
+	for k, v := range d.schemas {
+		c.schemas[k] = v
+	}
+
+	c.apiKeys = make(map[int64]APIKey, len(d.apiKeys))
+	for k, v := range d.apiKeys {
+		c.apiKeys[k] = v
+	}
+
+	c.sessions = make(map[int64]Session, len(d.sessions))
+	for k, v := range d.sessions {
+		c.sessions[k] = v
+	}
+
+	c.identities = make(map[identityID]Identity, len(d.identities))
+	for k, v := range d.identities {
+		c.identities[k] = v
+	}
+
+	c.invites = make(map[int64]Invite, len(d.invites))
+	for k, v := range d.invites {
+		c.invites[k] = v
+	}
+
+	c.passwordResets = make(map[string]PasswordReset, len(d.passwordResets))
+	for k, v := range d.passwordResets {
+		c.passwordResets[k] = v
+	}
+
+	c.loginFailures = make(map[int64]LoginFailure, len(d.loginFailures))
+	for k, v := range d.loginFailures {
+		c.loginFailures[k] = v
+	}
+
+	c.signingKeys = make(map[string]SigningKey, len(d.signingKeys))
+	for k, v := range d.signingKeys {
+		c.signingKeys[k] = v
+	}
+
+	c.memberships = make(map[membershipID]Membership, len(d.memberships))
+	for k, v := range d.memberships {
+		c.memberships[k] = v
+	}
+
+	c.realmShares = make(map[int64]RealmShare, len(d.realmShares))
+	for k, v := range d.realmShares {
+		c.realmShares[k] = v
+	}
+
+	return &c
+}
+
+// Memory provides methods for storing data in memory. It behaves like Service
+// without needing a database server, which makes it useful for demos, offline
+// use, and tests. All data is lost when the process exits. Transactions are
+// serialized, so a function passed to DoTransaction must not start another
+// transaction.
+type Memory struct {
+	txMu sync.Mutex
+
+	mu      sync.RWMutex
+	data    *memoryData
+	tx      *Tx
+	working *memoryData
+	pending []string
+
+	listenersMu sync.Mutex
+	listeners   []func(eventKey string)
+}
+
+// NewMemory creates a new empty in-memory store. Like a freshly migrated
+// database it holds a single realm and a single empty schema.
+func NewMemory() *Memory {
+	d := &memoryData{
+		events:     make(map[string]Event),
+		matches:    make(map[matchID]Match),
+		eventTeams: make(map[eventTeamID]EventTeam),
+		teams:      make(map[string]Team),
+		robots:     make(map[robotID]Robot),
+		reports:    make(map[int64]Report),
+		realms:     make(map[int64]Realm),
+		users:      make(map[int64]User),
+		schemas:    make(map[int64]Schema),
+		apiKeys:    make(map[int64]APIKey),
+		sessions:   make(map[int64]Session),
+		identities: make(map[identityID]Identity),
+		invites:    make(map[int64]Invite),
+
+		passwordResets: make(map[string]PasswordReset),
+		loginFailures:  make(map[int64]LoginFailure),
+		signingKeys:    make(map[string]SigningKey),
+		memberships:    make(map[membershipID]Membership),
+		realmShares:    make(map[int64]RealmShare),
+	}
+
+	d.lastRealmID++
+	d.realms[d.lastRealmID] = Realm{ID: d.lastRealmID, Name: "Pigmice"}
+
+	d.lastSchemaID++
+	d.schemas[d.lastSchemaID] = Schema{ID: d.lastSchemaID, Schema: SchemaFields{}}
+
+	return &Memory{data: d}
+}
+
+// Ping always succeeds, since there is no server to connect to.
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, since the store holds no resources.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// OnEventChange registers a function to be called with an event key whenever
+// the reports or matches of that event change. It is called with an empty key
+// when a change may affect every event. Changes are only announced once the
+// transaction making them commits.
+func (m *Memory) OnEventChange(f func(eventKey string)) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+
+	m.listeners = append(m.listeners, f)
+}
+
+func (m *Memory) eventChanged(eventKeys ...string) {
+	m.listenersMu.Lock()
+	listeners := m.listeners
+	m.listenersMu.Unlock()
+
+	for _, eventKey := range eventKeys {
+		for _, f := range listeners {
+			f(eventKey)
+		}
+	}
+}
+
+// eventChangedTx queues an event change to be announced when the current
+// transaction commits.
+func (m *Memory) eventChangedTx(eventKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = append(m.pending, eventKey)
+}
+
+// DoTransaction calls txWrapper with a new transaction. Changes made with the
+// transaction are only visible outside of it once txWrapper returns, and are
+// discarded if txWrapper returns an error.
+func (m *Memory) DoTransaction(ctx context.Context, txWrapper func(*Tx) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	tx := &Tx{}
+
+	m.mu.Lock()
+	m.tx, m.working = tx, m.data.clone()
+	m.mu.Unlock()
+
+	err := txWrapper(tx)
+
+	m.mu.Lock()
+	if err == nil {
+		m.data = m.working
+	}
+	pending := m.pending
+	m.tx, m.working, m.pending = nil, nil, nil
+	m.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("error in transaction wrapper: %w", err)
+	}
+
+	m.eventChanged(pending...)
+
+	return nil
+}
+
+// snapshot returns the committed data. It must not be modified.
+func (m *Memory) snapshot() *memoryData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.data
+}
+
+// txData returns the data of the given transaction, which may be modified.
+func (m *Memory) txData(tx *Tx) (*memoryData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if tx == nil || tx != m.tx {
+		return nil, errors.New("transaction is not active")
+	}
+
+	return m.working, nil
+}
+
+// update calls f with the data of a new transaction.
+func (m *Memory) update(ctx context.Context, f func(d *memoryData) error) error {
+	return m.DoTransaction(ctx, func(tx *Tx) error {
+		d, err := m.txData(tx)
+		if err != nil {
+			return err
+		}
+
+		return f(d)
+	})
+}
+
+// lockTx checks that the transaction is active. Since transactions are
+// serialized, it does not need to lock anything.
+func (m *Memory) lockTx(tx *Tx) error {
+	_, err := m.txData(tx)
+	return err
+}
+
+// realmMatches returns whether data in a realm is visible to the given realm,
+// following "realm_id IS NULL OR realm_id = $1".
+func realmMatches(dataRealmID, realmID *int64) bool {
+	return dataRealmID == nil || (realmID != nil && *dataRealmID == *realmID)
+}
+
+func cloneStrings(s []string) pq.StringArray {
+	if s == nil {
+		return nil
+	}
+
+	return append(pq.StringArray{}, s...)
+}
+
+// date truncates a time to midnight UTC of the same day, like PostgreSQL's DATE.
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CreateAPIKey inserts an API key, returning its ID.
+func (m *Memory) CreateAPIKey(ctx context.Context, key APIKey) (int64, error) {
+	err := m.update(ctx, func(d *memoryData) error {
+		if _, ok := d.users[key.UserID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("API key fk violation on user ID %d", key.UserID)}
+		}
+
+		if _, ok := d.realms[key.RealmID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("API key fk violation on realm ID %d", key.RealmID)}
+		}
+
+		for _, existing := range d.apiKeys {
+			if existing.Hash == key.Hash {
+				return ErrExists{fmt.Errorf("API key hash already exists")}
+			}
+		}
+
+		d.lastAPIKeyID++
+		key.ID = d.lastAPIKeyID
+		key.Permissions = append(Permissions{}, key.Permissions...)
+		d.apiKeys[key.ID] = key
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return key.ID, nil
+}
+
+// GetAPIKeys retrieves the API keys of a realm, or of every realm if realmID
+// is nil.
+func (m *Memory) GetAPIKeys(ctx context.Context, realmID *int64) ([]APIKey, error) {
+	keys := []APIKey{}
+	for _, key := range m.snapshot().apiKeys {
+		if realmID == nil || key.RealmID == *realmID {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	for _, key := range m.snapshot().apiKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+
+	return APIKey{}, ErrNoResults{fmt.Errorf("API key does not exist")}
+}
+
+// TouchAPIKey records that an API key was used at the given time, which also
+// marks the user it acts for as active.
+func (m *Memory) TouchAPIKey(ctx context.Context, id int64, used time.Time) error {
+	return m.update(ctx, func(d *memoryData) error {
+		if key, ok := d.apiKeys[id]; ok {
+			key.LastUsedAt = &used
+			d.apiKeys[id] = key
+
+			if u, ok := d.users[key.UserID]; ok {
+				u.LastActiveAt = used
+				d.users[u.ID] = u
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteAPIKey revokes an API key. If realmID is not nil the key must belong
+// to that realm.
+func (m *Memory) DeleteAPIKey(ctx context.Context, id int64, realmID *int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		key, ok := d.apiKeys[id]
+		if !ok || (realmID != nil && key.RealmID != *realmID) {
+			return ErrNoResults{fmt.Errorf("API key %d does not exist", id)}
+		}
+
+		delete(d.apiKeys, id)
+
+		return nil
+	})
+}
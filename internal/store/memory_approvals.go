@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GetPendingUsers retrieves the users waiting for approval, including
+// rejected users that haven't been deleted yet, oldest first. If realmID is
+// nil pending users of every realm are retrieved. It does not retrieve the
+// users stars.
+func (m *Memory) GetPendingUsers(ctx context.Context, realmID *int64) ([]User, error) {
+	users := []User{}
+	for _, u := range m.snapshot().users {
+		if u.Pending() && (realmID == nil || u.RealmID == *realmID) {
+			u.Stars = nil
+			users = append(users, u)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].PendingSince.Equal(*users[j].PendingSince) {
+			return users[i].PendingSince.Before(*users[j].PendingSince)
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// ApproveUser approves a pending user, giving them a role and permissions.
+// Rejected users that haven't been deleted yet can still be approved.
+// ErrNoResults is returned if the user doesn't exist or isn't pending.
+func (m *Memory) ApproveUser(ctx context.Context, id int64, role Role, perms Permissions) error {
+	return m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[id]
+		if !ok || !u.Pending() {
+			return ErrNoResults{fmt.Errorf("user %d is not pending", id)}
+		}
+
+		u.Role = role
+		u.Permissions = append(Permissions{}, perms...)
+		u.PendingSince = nil
+		u.RejectedAt = nil
+		u.RejectionReason = ""
+		d.users[id] = u
+
+		return nil
+	})
+}
+
+// RejectUser rejects a pending user with a reason. The user stays pending
+// until DeleteRejectedUsers deletes them. ErrNoResults is returned if the
+// user doesn't exist or isn't pending.
+func (m *Memory) RejectUser(ctx context.Context, id int64, reason string, rejectedAt time.Time) error {
+	return m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[id]
+		if !ok || !u.Pending() {
+			return ErrNoResults{fmt.Errorf("user %d is not pending", id)}
+		}
+
+		u.RejectedAt = &rejectedAt
+		u.RejectionReason = reason
+		d.users[id] = u
+
+		return nil
+	})
+}
+
+// DeleteRejectedUsers deletes the pending users that were rejected before
+// rejectedBefore, returning how many were deleted.
+func (m *Memory) DeleteRejectedUsers(ctx context.Context, rejectedBefore time.Time) (deleted int64, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		for id, u := range d.users {
+			if u.Pending() && u.RejectedAt != nil && u.RejectedAt.Before(rejectedBefore) {
+				d.deleteUser(id)
+				deleted++
+			}
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// eventSchemaID returns the schema of an event, falling back to the schema for
+// the year of the event.
+func (d *memoryData) eventSchemaID(e Event) *int64 {
+	if e.SchemaID != nil {
+		return e.SchemaID
+	}
+
+	for _, schema := range d.schemas {
+		if schema.Year != nil && int(*schema.Year) == e.StartDate.Year() {
+			id := schema.ID
+			return &id
+		}
+	}
+
+	return nil
+}
+
+func (d *memoryData) getEvents(tbaDeleted bool, year *int, include func(Event) bool) []Event {
+	events := make([]Event, 0)
+	for _, e := range d.events {
+		if (year != nil && e.StartDate.Year() != *year) || (!tbaDeleted && e.TBADeleted) || !include(e) {
+			continue
+		}
+
+		e.SchemaID = d.eventSchemaID(e)
+		events = append(events, e)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+
+	return events
+}
+
+// checkEventFKeys returns an ErrFKeyViolation if the realm or schema of an
+// event does not exist.
+func (d *memoryData) checkEventFKeys(e Event) error {
+	if e.RealmID != nil {
+		if _, ok := d.realms[*e.RealmID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("realm %d does not exist", *e.RealmID)}
+		}
+	}
+
+	if e.SchemaID != nil {
+		if _, ok := d.schemas[*e.SchemaID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("schema %d does not exist", *e.SchemaID)}
+		}
+	}
+
+	return nil
+}
+
+// GetEvents returns all events. If tbaDeleted is true, events that have been
+// deleted from TBA will be returned in addition to events that have not been
+// deleted. Otherwise, only events that have not been deleted will be returned.
+func (m *Memory) GetEvents(ctx context.Context, tbaDeleted bool, year *int) ([]Event, error) {
+	return m.snapshot().getEvents(tbaDeleted, year, func(Event) bool { return true }), nil
+}
+
+// GetEventsForRealm returns all events from a specific realm along with all TBA
+// events. If no realm is specified (nil) then just the TBA events will be
+// retrieved.
+func (m *Memory) GetEventsForRealm(ctx context.Context, tbaDeleted bool, realmID *int64, year *int) ([]Event, error) {
+	return m.snapshot().getEvents(tbaDeleted, year, func(e Event) bool {
+		return realmMatches(e.RealmID, realmID)
+	}), nil
+}
+
+// GetEventYearsForRealm returns a list of the years for all events from GetEventsForRealm.
+func (m *Memory) GetEventYearsForRealm(ctx context.Context, realmID *int64) ([]int, error) {
+	seen := make(map[int]bool)
+	years := make([]int, 0)
+
+	for _, e := range m.snapshot().events {
+		if year := e.StartDate.Year(); realmMatches(e.RealmID, realmID) && !seen[year] {
+			seen[year] = true
+			years = append(years, year)
+		}
+	}
+
+	sort.Ints(years)
+
+	return years, nil
+}
+
+// GetEventForRealm retrieves a specific event in a specific realm (or no realm for TBA events).
+func (m *Memory) GetEventForRealm(ctx context.Context, eventKey string, realmID *int64) (Event, error) {
+	d := m.snapshot()
+
+	e, ok := d.events[eventKey]
+	if !ok || !realmMatches(e.RealmID, realmID) {
+		return Event{}, ErrNoResults{fmt.Errorf("event %s does not exist", eventKey)}
+	}
+
+	e.SchemaID = d.eventSchemaID(e)
+
+	return e, nil
+}
+
+// GetActiveEvents returns all event keys for events that are currently happening.
+func (m *Memory) GetActiveEvents(ctx context.Context) ([]string, error) {
+	today := date(time.Now())
+
+	keys := make([]string, 0)
+	for _, e := range m.snapshot().events {
+		if !date(e.StartDate).After(today) && !date(e.EndDate).Before(today) {
+			keys = append(keys, e.Key)
+		}
+	}
+
+	return keys, nil
+}
+
+// EventsUpsert upserts multiple events. It will set TBADeleted to false for all
+// updated events. The schema ID will only be updated if unset.
+func (m *Memory) EventsUpsert(ctx context.Context, events []Event) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for _, e := range events {
+			if err := d.checkEventFKeys(e); err != nil {
+				return err
+			}
+
+			if existing, ok := d.events[e.Key]; ok {
+				if existing.SchemaID != nil {
+					e.SchemaID = existing.SchemaID
+				}
+				e.TBADeleted = false
+			}
+
+			e.Webcasts = cloneStrings(e.Webcasts)
+			d.events[e.Key] = e
+		}
+
+		return nil
+	})
+}
+
+// MarkEventsDeleted will set TBADeleted to true on all events that were *not*
+// included in the events slice and are not custom events (have no realm).
+func (m *Memory) MarkEventsDeleted(ctx context.Context, events []Event) error {
+	keep := make(map[string]bool, len(events))
+	for _, e := range events {
+		keep[e.Key] = true
+	}
+
+	return m.update(ctx, func(d *memoryData) error {
+		for key, e := range d.events {
+			if !keep[key] && e.RealmID == nil && !e.TBADeleted {
+				e.TBADeleted = true
+				d.events[key] = e
+			}
+		}
+
+		return nil
+	})
+}
+
+// ExclusiveLockEventsTx is a no-op, since transactions are serialized.
+func (m *Memory) ExclusiveLockEventsTx(ctx context.Context, tx *Tx) error {
+	return m.lockTx(tx)
+}
+
+// GetEventRealmIDTx returns the realm ID of an event by key.
+func (m *Memory) GetEventRealmIDTx(ctx context.Context, tx *Tx, eventKey string) (*int64, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := d.events[eventKey]
+	if !ok {
+		return nil, ErrNoResults{fmt.Errorf("couldn't find event by key")}
+	}
+
+	return e.RealmID, nil
+}
+
+// UpsertEventTx upserts a single event using the given transaction.
+func (m *Memory) UpsertEventTx(ctx context.Context, tx *Tx, event Event) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkEventFKeys(event); err != nil {
+		return fmt.Errorf("unable to upsert event: %w", err)
+	}
+
+	event.Webcasts = cloneStrings(event.Webcasts)
+	d.events[event.Key] = event
+
+	m.eventChangedTx(event.Key)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// identityID identifies an identity, since subjects are only unique for an
+// issuer.
+type identityID struct {
+	issuer  string
+	subject string
+}
+
+// GetUserByIdentity retrieves the user linked to an identity. It does not
+// retrieve the users stars.
+func (m *Memory) GetUserByIdentity(ctx context.Context, issuer, subject string) (User, error) {
+	d := m.snapshot()
+
+	identity, ok := d.identities[identityID{issuer, subject}]
+	if !ok {
+		return User{}, ErrNoResults{fmt.Errorf("no user with identity %s from %s", subject, issuer)}
+	}
+
+	return withoutStars(d.users[identity.UserID]), nil
+}
+
+// CreateIdentity links an identity to a user. ErrExists is returned if the
+// identity is already linked to a user.
+func (m *Memory) CreateIdentity(ctx context.Context, identity Identity) error {
+	return m.update(ctx, func(d *memoryData) error {
+		id := identityID{identity.Issuer, identity.Subject}
+		if _, ok := d.identities[id]; ok {
+			return ErrExists{fmt.Errorf("identity %s from %s is already linked", identity.Subject, identity.Issuer)}
+		}
+
+		if _, ok := d.users[identity.UserID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("identity fk violation on user ID %d", identity.UserID)}
+		}
+
+		d.identities[id] = identity
+
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CreateInvite inserts an invite, returning its ID.
+func (m *Memory) CreateInvite(ctx context.Context, invite Invite) (int64, error) {
+	err := m.update(ctx, func(d *memoryData) error {
+		if _, ok := d.realms[invite.RealmID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("invite fk violation on realm ID %d", invite.RealmID)}
+		}
+
+		for _, existing := range d.invites {
+			if existing.Hash == invite.Hash {
+				return ErrExists{fmt.Errorf("invite hash already exists")}
+			}
+		}
+
+		d.lastInviteID++
+		invite.ID = d.lastInviteID
+		invite.Permissions = append(Permissions{}, invite.Permissions...)
+		d.invites[invite.ID] = invite
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return invite.ID, nil
+}
+
+// GetInvites retrieves the invites of a realm, or of every realm if realmID is
+// nil.
+func (m *Memory) GetInvites(ctx context.Context, realmID *int64) ([]Invite, error) {
+	invites := []Invite{}
+	for _, invite := range m.snapshot().invites {
+		if realmID == nil || invite.RealmID == *realmID {
+			invites = append(invites, invite)
+		}
+	}
+
+	sort.Slice(invites, func(i, j int) bool { return invites[i].ID < invites[j].ID })
+
+	return invites, nil
+}
+
+// DeleteInvite revokes an invite. If realmID is not nil the invite must belong
+// to that realm.
+func (m *Memory) DeleteInvite(ctx context.Context, id int64, realmID *int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		invite, ok := d.invites[id]
+		if !ok || (realmID != nil && invite.RealmID != *realmID) {
+			return ErrNoResults{fmt.Errorf("invite %d does not exist", id)}
+		}
+
+		delete(d.invites, id)
+
+		return nil
+	})
+}
+
+// AcceptInvite creates a user from the invite with the given token hash and
+// deletes the invite. The user's realm, role, and permissions come from the
+// invite, as does their email address if they don't give one. ErrNoResults is
+// returned if the invite doesn't exist or has expired.
+func (m *Memory) AcceptInvite(ctx context.Context, hash string, now time.Time, u User) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for id, invite := range d.invites {
+			if invite.Hash != hash {
+				continue
+			}
+
+			if !now.Before(invite.ExpiresAt) {
+				return ErrNoResults{fmt.Errorf("invite %d has expired", id)}
+			}
+
+			delete(d.invites, id)
+
+			u.RealmID, u.Role, u.Permissions = invite.RealmID, invite.Role, append(Permissions{}, invite.Permissions...)
+			if u.Email == "" {
+				u.Email = invite.Email
+			}
+
+			_, err := d.createUser(u)
+			return err
+		}
+
+		return ErrNoResults{fmt.Errorf("invite does not exist")}
+	})
+}
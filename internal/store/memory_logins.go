@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RecordFailedLogin counts a consecutive failed login of a user. Once a user
+// has failed maxFailures times in a row they're locked out until now plus
+// lockout, and their count starts over. The time the user is locked until is
+// returned, or nil if they aren't locked.
+func (m *Memory) RecordFailedLogin(ctx context.Context, userID int64, now time.Time, maxFailures int, lockout time.Duration) (lockedUntil *time.Time, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[userID]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("user %d does not exist", userID)}
+		}
+
+		u.FailedLogins++
+		if u.FailedLogins >= maxFailures {
+			until := now.Add(lockout)
+			u.FailedLogins = 0
+			u.LockedUntil = &until
+		}
+		d.users[userID] = u
+
+		if u.Locked(now) {
+			until := *u.LockedUntil
+			lockedUntil = &until
+		}
+
+		return nil
+	})
+
+	return lockedUntil, err
+}
+
+// UnlockUser clears a user's failed logins and lockout.
+func (m *Memory) UnlockUser(ctx context.Context, id int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[id]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("user %d does not exist", id)}
+		}
+
+		u.FailedLogins = 0
+		u.LockedUntil = nil
+		d.users[id] = u
+
+		return nil
+	})
+}
+
+// CreateLoginFailure inserts an audit record of a failed login.
+func (m *Memory) CreateLoginFailure(ctx context.Context, f LoginFailure) error {
+	return m.update(ctx, func(d *memoryData) error {
+		if f.UserID != nil {
+			if _, ok := d.users[*f.UserID]; !ok {
+				return ErrFKeyViolation{fmt.Errorf("login failure fk violation on user ID %d", *f.UserID)}
+			}
+		}
+
+		d.lastLoginFailureID++
+		f.ID = d.lastLoginFailureID
+		d.loginFailures[f.ID] = f
+
+		return nil
+	})
+}
+
+// GetLoginFailures retrieves the failed logins since a time, newest first. If
+// realmID is not nil only failures of users in that realm are retrieved,
+// otherwise failures of unknown users are included too.
+func (m *Memory) GetLoginFailures(ctx context.Context, realmID *int64, since time.Time) ([]LoginFailure, error) {
+	d := m.snapshot()
+
+	failures := []LoginFailure{}
+	for _, f := range d.loginFailures {
+		if f.CreatedAt.Before(since) {
+			continue
+		}
+
+		if realmID != nil {
+			if f.UserID == nil {
+				continue
+			}
+
+			if u, ok := d.users[*f.UserID]; !ok || u.RealmID != *realmID {
+				continue
+			}
+		}
+
+		failures = append(failures, f)
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		if !failures[i].CreatedAt.Equal(failures[j].CreatedAt) {
+			return failures[i].CreatedAt.After(failures[j].CreatedAt)
+		}
+		return failures[i].ID > failures[j].ID
+	})
+
+	return failures, nil
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+func (d *memoryData) eventRealmMatches(eventKey string, realmID *int64) bool {
+	e, ok := d.events[eventKey]
+	return ok && realmMatches(e.RealmID, realmID)
+}
+
+// hasTeams returns whether all of the given teams are on one of the alliances
+// of the match.
+func (m Match) hasTeams(teamKeys []string) bool {
+	for _, teamKey := range teamKeys {
+		if !m.hasTeam(teamKey) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m Match) hasTeam(teamKey string) bool {
+	for _, key := range m.RedAlliance {
+		if key == teamKey {
+			return true
+		}
+	}
+
+	for _, key := range m.BlueAlliance {
+		if key == teamKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+// analysisInfo returns only the match fields that are retrieved for analysis.
+func (m Match) analysisInfo() Match {
+	return Match{
+		Key:                m.Key,
+		RedAlliance:        m.RedAlliance,
+		BlueAlliance:       m.BlueAlliance,
+		RedScoreBreakdown:  m.RedScoreBreakdown,
+		BlueScoreBreakdown: m.BlueScoreBreakdown,
+	}
+}
+
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Key < matches[j].Key })
+}
+
+// putMatch stores a match, replacing an existing match with the same key at the
+// same event.
+func (d *memoryData) putMatch(match Match) error {
+	if _, ok := d.events[match.EventKey]; !ok {
+		return ErrFKeyViolation{fmt.Errorf("event %s does not exist", match.EventKey)}
+	}
+
+	match.RedAlliance = cloneStrings(match.RedAlliance)
+	match.BlueAlliance = cloneStrings(match.BlueAlliance)
+	match.Videos = cloneStrings(match.Videos)
+	d.matches[matchID{eventKey: match.EventKey, key: match.Key}] = match
+
+	return nil
+}
+
+// GetMatchesForRealm returns all matches for a realm from a specific event that
+// include the given teams. If teams is nil or empty a list of all the matches
+// for that event are returned. If tbaDeleted is true, matches that have been
+// deleted from TBA will be returned in addition to matches that have not been
+// deleted. Otherwise, only matches that have not been deleted will be returned.
+func (m *Memory) GetMatchesForRealm(ctx context.Context, eventKey string, teamKeys []string, tbaDeleted bool, realmID *int64) ([]Match, error) {
+	d := m.snapshot()
+
+	matches := make([]Match, 0)
+	if !d.eventRealmMatches(eventKey, realmID) {
+		return matches, nil
+	}
+
+	for id, match := range d.matches {
+		if id.eventKey == eventKey && (tbaDeleted || !match.TBADeleted) && match.hasTeams(teamKeys) {
+			matches = append(matches, match)
+		}
+	}
+
+	sortMatches(matches)
+
+	return matches, nil
+}
+
+// GetMatchForRealm returns a specific match by key in the given realm.
+func (m *Memory) GetMatchForRealm(ctx context.Context, eventKey, matchKey string, realmID *int64) (Match, error) {
+	d := m.snapshot()
+
+	match, ok := d.matches[matchID{eventKey: eventKey, key: matchKey}]
+	if !ok || !d.eventRealmMatches(eventKey, realmID) {
+		return Match{}, ErrNoResults{fmt.Errorf("unable to get match %s at event %s", matchKey, eventKey)}
+	}
+
+	return match, nil
+}
+
+// GetEventAnalysisInfoForRealm returns match information that's pertinent to
+// doing analysis for all the matches of the given event.
+func (m *Memory) GetEventAnalysisInfoForRealm(ctx context.Context, eventKey string, realmID *int64) ([]Match, error) {
+	d := m.snapshot()
+
+	matches := make([]Match, 0)
+	if !d.eventRealmMatches(eventKey, realmID) {
+		return matches, nil
+	}
+
+	for id, match := range d.matches {
+		if id.eventKey == eventKey {
+			matches = append(matches, match.analysisInfo())
+		}
+	}
+
+	sortMatches(matches)
+
+	return matches, nil
+}
+
+// GetMatchAnalysisInfoForRealm returns match information that's pertinent to
+// doing analysis for a single match.
+func (m *Memory) GetMatchAnalysisInfoForRealm(ctx context.Context, eventKey, matchKey string, realmID *int64) (Match, error) {
+	match, err := m.GetMatchForRealm(ctx, eventKey, matchKey, realmID)
+	if err != nil {
+		return Match{}, err
+	}
+
+	return match.analysisInfo(), nil
+}
+
+// GetEventRealmIDByMatchKeyTx returns the realm ID for the event that the match
+// identified by the given key is associated with.
+func (m *Memory) GetEventRealmIDByMatchKeyTx(ctx context.Context, tx *Tx, matchKey string) (*int64, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range d.matches {
+		if id.key == matchKey {
+			return d.events[id.eventKey].RealmID, nil
+		}
+	}
+
+	return nil, ErrNoResults{fmt.Errorf("couldn't find match by key")}
+}
+
+// ExclusiveLockMatchesTx is a no-op, since transactions are serialized.
+func (m *Memory) ExclusiveLockMatchesTx(ctx context.Context, tx *Tx) error {
+	return m.lockTx(tx)
+}
+
+// LockAlliance returns whether the specified team is on an alliance in the specified match.
+func (m *Memory) LockAlliance(ctx context.Context, tx *Tx, eventKey, matchKey, teamKey string, realmID *int64) (bool, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return false, err
+	}
+
+	match, ok := d.matches[matchID{eventKey: eventKey, key: matchKey}]
+
+	return ok && d.eventRealmMatches(eventKey, realmID) && match.hasTeam(teamKey), nil
+}
+
+// DeleteMatchTx deletes a specific match using the given transaction. Matches
+// with reports can't be deleted.
+func (m *Memory) DeleteMatchTx(ctx context.Context, tx *Tx, matchKey, eventKey string) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range d.reports {
+		if report.EventKey == eventKey && report.MatchKey == matchKey {
+			return ErrFKeyViolation{fmt.Errorf("unable to delete match with reports")}
+		}
+	}
+
+	delete(d.matches, matchID{eventKey: eventKey, key: matchKey})
+	m.eventChangedTx(eventKey)
+
+	return nil
+}
+
+// UpsertMatchTx upserts a match and its alliances in the given transaction. The
+// teams on the alliances are added to the event.
+func (m *Memory) UpsertMatchTx(ctx context.Context, tx *Tx, match Match) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := d.putMatch(match); err != nil {
+		return fmt.Errorf("unable to upsert match: %w", err)
+	}
+
+	for _, alliance := range [][]string{match.BlueAlliance, match.RedAlliance} {
+		for _, teamKey := range alliance {
+			if _, ok := d.teams[teamKey]; !ok {
+				d.teams[teamKey] = Team{Key: teamKey}
+			}
+
+			id := eventTeamID{eventKey: match.EventKey, key: teamKey}
+			if _, ok := d.eventTeams[id]; !ok {
+				d.eventTeams[id] = EventTeam{Key: teamKey, EventKey: match.EventKey}
+			}
+		}
+	}
+
+	m.eventChangedTx(match.EventKey)
+
+	return nil
+}
+
+// MarkMatchesDeleted will set TBADeleted to true on all matches for an event
+// that were *not* included in the passed matches slice.
+func (m *Memory) MarkMatchesDeleted(ctx context.Context, eventKey string, matches []Match) error {
+	keep := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		keep[match.Key] = true
+	}
+
+	return m.update(ctx, func(d *memoryData) error {
+		for id, match := range d.matches {
+			if id.eventKey == eventKey && !keep[id.key] && !match.TBADeleted {
+				match.TBADeleted = true
+				d.matches[id] = match
+			}
+		}
+
+		m.eventChangedTx(eventKey)
+
+		return nil
+	})
+}
+
+// UpdateTBAMatches upserts multiple matches and their alliances from TBA. It
+// will set TBADeleted to false for all updated matches.
+func (m *Memory) UpdateTBAMatches(ctx context.Context, matches []Match) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for _, match := range matches {
+			if _, ok := d.matches[matchID{eventKey: match.EventKey, key: match.Key}]; ok {
+				match.TBADeleted = false
+			}
+
+			if err := d.putMatch(match); err != nil {
+				return fmt.Errorf("unable to upsert match: %w", err)
+			}
+
+			m.eventChangedTx(match.EventKey)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// membershipID identifies the membership of a user in a realm.
+type membershipID struct {
+	userID  int64
+	realmID int64
+}
+
+// GetMemberships retrieves the memberships of a user, of a realm, or of both
+// if either is nil.
+func (m *Memory) GetMemberships(ctx context.Context, userID, realmID *int64) ([]Membership, error) {
+	memberships := []Membership{}
+	for _, membership := range m.snapshot().memberships {
+		if (userID == nil || membership.UserID == *userID) && (realmID == nil || membership.RealmID == *realmID) {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool {
+		if memberships[i].UserID != memberships[j].UserID {
+			return memberships[i].UserID < memberships[j].UserID
+		}
+		return memberships[i].RealmID < memberships[j].RealmID
+	})
+
+	return memberships, nil
+}
+
+// GetMembership retrieves the membership of a user in a realm. ErrNoResults is
+// returned if the user isn't a member of the realm.
+func (m *Memory) GetMembership(ctx context.Context, userID, realmID int64) (Membership, error) {
+	membership, ok := m.snapshot().memberships[membershipID{userID, realmID}]
+	if !ok {
+		return Membership{}, ErrNoResults{fmt.Errorf("user %d is not a member of realm %d", userID, realmID)}
+	}
+
+	return membership, nil
+}
+
+// UpsertMembership adds a user to a realm, or changes their role and
+// permissions if they're already a member. It returns whether the membership
+// was created. ErrExists is returned if the realm is the user's own realm, and
+// ErrFKeyViolation if the user or realm doesn't exist.
+func (m *Memory) UpsertMembership(ctx context.Context, membership Membership) (created bool, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[membership.UserID]
+		if !ok {
+			return ErrFKeyViolation{fmt.Errorf("membership fk violation on user ID %d", membership.UserID)}
+		}
+
+		if u.RealmID == membership.RealmID {
+			return ErrExists{fmt.Errorf("realm %d is the own realm of user %d", membership.RealmID, membership.UserID)}
+		}
+
+		if _, ok := d.realms[membership.RealmID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("membership fk violation on realm ID %d", membership.RealmID)}
+		}
+
+		id := membershipID{membership.UserID, membership.RealmID}
+		if existing, ok := d.memberships[id]; ok {
+			membership.CreatedAt = existing.CreatedAt
+		} else {
+			created = true
+		}
+
+		d.memberships[id] = membership
+
+		return nil
+	})
+
+	return created, err
+}
+
+// DeleteMembership removes a user from a realm that isn't their own.
+func (m *Memory) DeleteMembership(ctx context.Context, userID, realmID int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		id := membershipID{userID, realmID}
+		if _, ok := d.memberships[id]; !ok {
+			return ErrNoResults{fmt.Errorf("user %d is not a member of realm %d", userID, realmID)}
+		}
+
+		delete(d.memberships, id)
+
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CreatePasswordReset inserts a password reset. Expired resets of the same
+// user are cleaned up.
+func (m *Memory) CreatePasswordReset(ctx context.Context, reset PasswordReset, now time.Time) error {
+	return m.update(ctx, func(d *memoryData) error {
+		if _, ok := d.users[reset.UserID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("password reset fk violation on user ID %d", reset.UserID)}
+		}
+
+		if _, ok := d.passwordResets[reset.Hash]; ok {
+			return ErrExists{fmt.Errorf("password reset hash already exists")}
+		}
+
+		for hash, existing := range d.passwordResets {
+			if existing.UserID == reset.UserID && !now.Before(existing.ExpiresAt) {
+				delete(d.passwordResets, hash)
+			}
+		}
+
+		d.passwordResets[reset.Hash] = reset
+
+		return nil
+	})
+}
+
+// ResetPassword replaces the password of the user a password reset with the
+// given token hash belongs to, returning their ID, and unlocks them. Changing
+// the password invalidates the user's refresh tokens, so their sessions and
+// any other password resets are deleted too. ErrNoResults is returned if the reset
+// doesn't exist or has expired.
+func (m *Memory) ResetPassword(ctx context.Context, hash string, now time.Time, hashedPassword string) (userID int64, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		reset, ok := d.passwordResets[hash]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("password reset does not exist")}
+		}
+
+		if !now.Before(reset.ExpiresAt) {
+			return ErrNoResults{fmt.Errorf("password reset for user %d has expired", reset.UserID)}
+		}
+		userID = reset.UserID
+
+		u, ok := d.users[userID]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("user %d does not exist", userID)}
+		}
+
+		u.HashedPassword = hashedPassword
+		u.PasswordChanged = time.Now()
+		u.FailedLogins = 0
+		u.LockedUntil = nil
+		d.users[userID] = u
+
+		for hash, existing := range d.passwordResets {
+			if existing.UserID == userID {
+				delete(d.passwordResets, hash)
+			}
+		}
+
+		for id, session := range d.sessions {
+			if session.UserID == userID {
+				delete(d.sessions, id)
+			}
+		}
+
+		return nil
+	})
+
+	return userID, err
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// GetReportsByReporter retrieves every report a user submitted, in any realm.
+func (m *Memory) GetReportsByReporter(ctx context.Context, reporterID int64) ([]Report, error) {
+	return m.snapshot().filterReports(func(r Report) bool {
+		return r.ReporterID != nil && *r.ReporterID == reporterID
+	}), nil
+}
+
+// DeleteReportsByReporterTx deletes every report a user submitted using the
+// given transaction.
+func (m *Memory) DeleteReportsByReporterTx(ctx context.Context, tx *Tx, reporterID int64) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	for id, r := range d.reports {
+		if r.ReporterID != nil && *r.ReporterID == reporterID {
+			delete(d.reports, id)
+			m.eventChangedTx(r.EventKey)
+		}
+	}
+
+	return nil
+}
+
+// DeleteUserByIDTx deletes a specific user using the given transaction.
+func (m *Memory) DeleteUserByIDTx(ctx context.Context, tx *Tx, id int64) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := d.users[id]; !ok {
+		return ErrNoResults{errors.New("got 0 affected rows")}
+	}
+
+	d.deleteUser(id)
+
+	return nil
+}
+
+// PurgeInactiveUsers deletes the users who haven't been active since
+// activeBefore, returning how many were deleted. Their reports are kept
+// without a reporter. Users with global permissions are never purged.
+func (m *Memory) PurgeInactiveUsers(ctx context.Context, activeBefore time.Time) (deleted int64, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		for id, u := range d.users {
+			if u.LastActiveAt.Before(activeBefore) && !u.Permissions.Has(PermGlobal) {
+				d.deleteUser(id)
+				deleted++
+			}
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+func (d *memoryData) checkRealmName(realm Realm) error {
+	for _, existing := range d.realms {
+		if existing.ID != realm.ID && existing.Name == realm.Name {
+			return ErrExists{fmt.Errorf("realm with name: %s already exists", realm.Name)}
+		}
+	}
+
+	return nil
+}
+
+// GetRealms returns all realms.
+func (m *Memory) GetRealms(ctx context.Context) ([]Realm, error) {
+	realms := make([]Realm, 0)
+	for _, realm := range m.snapshot().realms {
+		realms = append(realms, realm)
+	}
+
+	sort.Slice(realms, func(i, j int) bool { return realms[i].ID < realms[j].ID })
+
+	return realms, nil
+}
+
+// GetRealm retrieves a specific realm.
+func (m *Memory) GetRealm(ctx context.Context, id int64) (Realm, error) {
+	realm, ok := m.snapshot().realms[id]
+	if !ok {
+		return realm, ErrNoResults{fmt.Errorf("realm with id %d not found", id)}
+	}
+
+	return realm, nil
+}
+
+// InsertRealm inserts a realm, returning its ID.
+func (m *Memory) InsertRealm(ctx context.Context, realm Realm) (id int64, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		id, err = d.insertRealm(realm)
+		return err
+	})
+
+	return id, err
+}
+
+// InsertRealmTx inserts a realm using the given transaction, returning its ID.
+func (m *Memory) InsertRealmTx(ctx context.Context, tx *Tx, realm Realm) (int64, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.insertRealm(realm)
+}
+
+func (d *memoryData) insertRealm(realm Realm) (int64, error) {
+	realm.ID = 0
+	if err := d.checkRealmName(realm); err != nil {
+		return 0, err
+	}
+
+	d.lastRealmID++
+	realm.ID = d.lastRealmID
+	d.realms[realm.ID] = realm
+
+	return realm.ID, nil
+}
+
+// GetRealmExistsTx returns whether the given realm exists using the given transaction.
+func (m *Memory) GetRealmExistsTx(ctx context.Context, tx *Tx, id int64) (bool, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := d.realms[id]
+	return ok, nil
+}
+
+// ExclusiveLockRealmsTx is a no-op, since transactions are serialized.
+func (m *Memory) ExclusiveLockRealmsTx(ctx context.Context, tx *Tx) error {
+	return m.lockTx(tx)
+}
+
+// DeleteRealmTx deletes a realm along with its users and API keys using the
+// given transaction. Realms with events or schemas can't be deleted.
+func (m *Memory) DeleteRealmTx(ctx context.Context, tx *Tx, id int64) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range d.events {
+		if e.RealmID != nil && *e.RealmID == id {
+			return ErrFKeyViolation{fmt.Errorf("unable to delete realm %d with events", id)}
+		}
+	}
+
+	for _, schema := range d.schemas {
+		if schema.RealmID != nil && *schema.RealmID == id {
+			return ErrFKeyViolation{fmt.Errorf("unable to delete realm %d with schemas", id)}
+		}
+	}
+
+	for userID, u := range d.users {
+		if u.RealmID == id {
+			d.deleteUser(userID)
+		}
+	}
+
+	for keyID, key := range d.apiKeys {
+		if key.RealmID == id {
+			delete(d.apiKeys, keyID)
+		}
+	}
+
+	for inviteID, invite := range d.invites {
+		if invite.RealmID == id {
+			delete(d.invites, inviteID)
+		}
+	}
+
+	for membershipID, membership := range d.memberships {
+		if membership.RealmID == id {
+			delete(d.memberships, membershipID)
+		}
+	}
+
+	for shareID, share := range d.realmShares {
+		if share.RealmID == id || share.PartnerRealmID == id {
+			delete(d.realmShares, shareID)
+		}
+	}
+
+	for reportID, r := range d.reports {
+		if r.RealmID != nil && *r.RealmID == id {
+			r.RealmID = nil
+			d.reports[reportID] = r
+		}
+	}
+
+	delete(d.realms, id)
+	m.eventChangedTx("")
+
+	return nil
+}
+
+// UpdateRealmTx updates the name of a realm and whether it shares reports
+// using the given transaction. Its settings are left as they are.
+func (m *Memory) UpdateRealmTx(ctx context.Context, tx *Tx, realm Realm) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	existing, ok := d.realms[realm.ID]
+	if !ok {
+		return ErrNoResults{fmt.Errorf("could not update non-existent realm %d", realm.ID)}
+	}
+
+	if err := d.checkRealmName(realm); err != nil {
+		return err
+	}
+
+	realm.Settings = existing.Settings
+	d.realms[realm.ID] = realm
+	m.eventChangedTx("")
+
+	return nil
+}
+
+// UpdateRealmSettingsTx replaces the settings of a realm using the given
+// transaction.
+func (m *Memory) UpdateRealmSettingsTx(ctx context.Context, tx *Tx, id int64, settings RealmSettings) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	realm, ok := d.realms[id]
+	if !ok {
+		return ErrNoResults{fmt.Errorf("could not update settings of non-existent realm %d", id)}
+	}
+
+	realm.Settings = settings
+	d.realms[id] = realm
+	m.eventChangedTx("")
+
+	return nil
+}
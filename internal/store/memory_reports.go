@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// reportVisible returns whether a report is visible to the given realm,
+// following the reportVisible SQL condition.
+func (d *memoryData) reportVisible(r Report, realmID *int64) bool {
+	var year *int
+	if e, ok := d.events[r.EventKey]; ok {
+		y := e.StartDate.Year()
+		year = &y
+	}
+
+	return d.visibleToRealm(r.RealmID, &r.EventKey, year, realmID)
+}
+
+// reportShared is like reportVisible, but excludes reports with no realm.
+func (d *memoryData) reportShared(r Report, realmID *int64) bool {
+	return r.RealmID != nil && d.reportVisible(r, realmID)
+}
+
+// filterReports returns the reports accepted by include sorted by ID.
+func (d *memoryData) filterReports(include func(Report) bool) []Report {
+	reports := []Report{}
+	for _, r := range d.reports {
+		if include(r) {
+			reports = append(reports, r)
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
+
+	return reports
+}
+
+// sameReport returns whether two reports are by the same reporter for the same
+// team in the same match. Reports with no reporter are never the same.
+func sameReport(a, b Report) bool {
+	return a.EventKey == b.EventKey && a.MatchKey == b.MatchKey && a.TeamKey == b.TeamKey &&
+		a.ReporterID != nil && b.ReporterID != nil && *a.ReporterID == *b.ReporterID
+}
+
+func (d *memoryData) checkReportFKeys(r Report) error {
+	if _, ok := d.matches[matchID{eventKey: r.EventKey, key: r.MatchKey}]; !ok {
+		return ErrFKeyViolation{fmt.Errorf("report fk violation: match %s at event %s does not exist", r.MatchKey, r.EventKey)}
+	}
+
+	if r.ReporterID != nil {
+		if _, ok := d.users[*r.ReporterID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("report fk violation: user %d does not exist", *r.ReporterID)}
+		}
+	}
+
+	if r.RealmID != nil {
+		if _, ok := d.realms[*r.RealmID]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("report fk violation: realm %d does not exist", *r.RealmID)}
+		}
+	}
+
+	return nil
+}
+
+// GetReportForRealm retrieves a report in a specific realm.
+func (m *Memory) GetReportForRealm(ctx context.Context, id int64, realmID *int64) (Report, error) {
+	d := m.snapshot()
+
+	r, ok := d.reports[id]
+	if !ok || !d.reportVisible(r, realmID) {
+		return Report{}, ErrNoResults{fmt.Errorf("report with ID %d does not exist", id)}
+	}
+
+	return r, nil
+}
+
+// GetReports returns all reports matching the specified filters.
+func (m *Memory) GetReports(ctx context.Context, eventKey *string, matchKey *string, teamKey *string, realmID *int64, reporterID *int64) ([]Report, error) {
+	d := m.snapshot()
+
+	return d.filterReports(func(r Report) bool {
+		return d.reportVisible(r, realmID) &&
+			(eventKey == nil || r.EventKey == *eventKey) &&
+			(matchKey == nil || r.MatchKey == *matchKey) &&
+			(teamKey == nil || r.TeamKey == *teamKey) &&
+			(reporterID == nil || (r.ReporterID != nil && *r.ReporterID == *reporterID))
+	}), nil
+}
+
+// GetEventReportsForRealm returns all event reports for a specific event and realm.
+func (m *Memory) GetEventReportsForRealm(ctx context.Context, eventKey string, realmID *int64) ([]Report, error) {
+	d := m.snapshot()
+
+	return d.filterReports(func(r Report) bool {
+		return r.EventKey == eventKey && d.reportShared(r, realmID)
+	}), nil
+}
+
+// GetEventTeamReportsForRealm retrieves all reports for a specific team and
+// event, filtering to only retrieve reports for realms that are sharing reports
+// or have a matching realm ID.
+func (m *Memory) GetEventTeamReportsForRealm(ctx context.Context, eventKey string, teamKey string, realmID *int64) ([]Report, error) {
+	d := m.snapshot()
+
+	return d.filterReports(func(r Report) bool {
+		return r.EventKey == eventKey && r.TeamKey == teamKey && d.reportShared(r, realmID)
+	}), nil
+}
+
+// GetMatchTeamReportsForRealm retrieves all reports for a specific match, team,
+// and event, filtering to only retrieve reports for realms that are sharing
+// reports or have a matching realm ID.
+func (m *Memory) GetMatchTeamReportsForRealm(ctx context.Context, eventKey, matchKey string, teamKey string, realmID *int64) ([]Report, error) {
+	d := m.snapshot()
+
+	return d.filterReports(func(r Report) bool {
+		return r.EventKey == eventKey && r.MatchKey == matchKey && r.TeamKey == teamKey && d.reportShared(r, realmID)
+	}), nil
+}
+
+// GetLeaderboardForRealm retrieves how many reports each user or member of the
+// given realm has submitted for it. Specify year to only count reports for
+// events in the given year, in which case users with no reports are left out.
+func (m *Memory) GetLeaderboardForRealm(ctx context.Context, realmID int64, year *int) (Leaderboard, error) {
+	d := m.snapshot()
+
+	member := func(u User) bool {
+		_, ok := d.memberships[membershipID{u.ID, realmID}]
+		return u.RealmID == realmID || ok
+	}
+
+	counts := make(map[int64]int64)
+	for _, u := range d.users {
+		if member(u) && year == nil {
+			counts[u.ID] = 0
+		}
+	}
+
+	for _, r := range d.reports {
+		if r.ReporterID == nil || r.RealmID == nil || *r.RealmID != realmID {
+			continue
+		}
+
+		u, ok := d.users[*r.ReporterID]
+		if !ok || !member(u) || (year != nil && d.events[r.EventKey].StartDate.Year() != *year) {
+			continue
+		}
+
+		counts[u.ID]++
+	}
+
+	leaderboard := make(Leaderboard, 0, len(counts))
+	for id, count := range counts {
+		leaderboard = append(leaderboard, Leaderboard{{ReporterID: id, Reports: count}}...)
+	}
+
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Reports != leaderboard[j].Reports {
+			return leaderboard[i].Reports > leaderboard[j].Reports
+		}
+		return leaderboard[i].ReporterID < leaderboard[j].ReporterID
+	})
+
+	return leaderboard, nil
+}
+
+// UpsertReport creates a new report, or replaces the existing one if the same
+// reporter already has a report for that team and match. It returns a boolean
+// that is true when the report was created, and false when it was updated.
+func (m *Memory) UpsertReport(ctx context.Context, r Report) (created bool, id int64, err error) {
+	err = m.DoTransaction(ctx, func(tx *Tx) error {
+		created, id, err = m.UpsertReportTx(ctx, tx, r)
+		return err
+	})
+
+	return created, id, err
+}
+
+// UpsertReportTx is like UpsertReport, but uses the given transaction.
+func (m *Memory) UpsertReportTx(ctx context.Context, tx *Tx, r Report) (created bool, id int64, err error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err := d.checkReportFKeys(r); err != nil {
+		return false, 0, err
+	}
+
+	r.ID = 0
+	for _, existing := range d.reports {
+		if sameReport(existing, r) {
+			r.ID = existing.ID
+			break
+		}
+	}
+
+	created = r.ID == 0
+	if created {
+		d.lastReportID++
+		r.ID = d.lastReportID
+	}
+
+	d.reports[r.ID] = r
+	m.eventChangedTx(r.EventKey)
+
+	return created, r.ID, nil
+}
+
+// LockReport retrieves a report.
+func (m *Memory) LockReport(ctx context.Context, tx *Tx, id int64) (Report, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r, ok := d.reports[id]
+	if !ok {
+		return r, ErrNoResults{fmt.Errorf("report with ID %d does not exist", id)}
+	}
+
+	return r, nil
+}
+
+// UpdateReportTx updates an existing report. If another report by the same
+// reporter for the same team and match exists, it is deleted if replace is
+// true, otherwise an ErrConflictingReport is returned.
+func (m *Memory) UpdateReportTx(ctx context.Context, tx *Tx, r Report, replace bool) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	old, ok := d.reports[r.ID]
+	if !ok {
+		return ErrNoResults{fmt.Errorf("could not update non-existent report %d", r.ID)}
+	}
+
+	if err := d.checkReportFKeys(r); err != nil {
+		return err
+	}
+
+	for id, existing := range d.reports {
+		if id == r.ID || !sameReport(existing, r) {
+			continue
+		}
+
+		if !replace {
+			return ErrConflictingReport{ID: id}
+		}
+
+		delete(d.reports, id)
+	}
+
+	d.reports[r.ID] = r
+	m.eventChangedTx(old.EventKey)
+	m.eventChangedTx(r.EventKey)
+
+	return nil
+}
+
+// DeleteReportTx deletes the specified report using the given transaction.
+func (m *Memory) DeleteReportTx(ctx context.Context, tx *Tx, id int64) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	r, ok := d.reports[id]
+	if !ok {
+		return nil
+	}
+
+	delete(d.reports, id)
+	m.eventChangedTx(r.EventKey)
+
+	return nil
+}
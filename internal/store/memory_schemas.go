@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// CreateSchema creates a new schema.
+func (m *Memory) CreateSchema(ctx context.Context, schema Schema) error {
+	return m.update(ctx, func(d *memoryData) error {
+		_, err := d.createSchema(schema)
+		return err
+	})
+}
+
+// CreateSchemaTx creates a new schema using the given transaction, returning
+// its ID.
+func (m *Memory) CreateSchemaTx(ctx context.Context, tx *Tx, schema Schema) (int64, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.createSchema(schema)
+}
+
+func (d *memoryData) createSchema(schema Schema) (int64, error) {
+	if schema.Year != nil {
+		for _, existing := range d.schemas {
+			if existing.Year != nil && *existing.Year == *schema.Year {
+				return 0, &ErrExists{fmt.Errorf("schema for year %d already exists", *schema.Year)}
+			}
+		}
+	}
+
+	if schema.RealmID != nil {
+		if _, ok := d.realms[*schema.RealmID]; !ok {
+			return 0, ErrFKeyViolation{fmt.Errorf("realm %d does not exist", *schema.RealmID)}
+		}
+	}
+
+	d.lastSchemaID++
+	schema.ID = d.lastSchemaID
+	d.schemas[schema.ID] = schema
+
+	return schema.ID, nil
+}
+
+// GetSchemaByID retrieves a schema given its ID.
+func (m *Memory) GetSchemaByID(ctx context.Context, id int64) (Schema, error) {
+	schema, ok := m.snapshot().schemas[id]
+	if !ok {
+		return schema, ErrNoResults{fmt.Errorf("schema %d does not exist", id)}
+	}
+
+	return schema, nil
+}
+
+// GetSchemaByYear retrieves the schema for a given year.
+func (m *Memory) GetSchemaByYear(ctx context.Context, year int) (Schema, error) {
+	for _, schema := range m.snapshot().schemas {
+		if schema.Year != nil && int(*schema.Year) == year {
+			return schema, nil
+		}
+	}
+
+	return Schema{}, ErrNoResults{fmt.Errorf("no schema for year %d exists", year)}
+}
+
+// GetSchemasForRealm retrieves schemas from a specific realm, from realms
+// sharing with it, and standard FRC schemas. If the realm ID is nil, no private
+// realms' schemas will be retrieved.
+func (m *Memory) GetSchemasForRealm(ctx context.Context, realmID *int64) ([]Schema, error) {
+	d := m.snapshot()
+
+	schemas := []Schema{}
+	for _, schema := range d.schemas {
+		if schema.Year == nil {
+			schemas = append(schemas, schema)
+			continue
+		}
+
+		year := int(*schema.Year)
+		if schema.RealmID != nil && d.visibleToRealm(schema.RealmID, nil, &year, realmID) {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].ID < schemas[j].ID })
+
+	return schemas, nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CreateSession inserts a session, returning its ID. Expired sessions of the
+// same user are cleaned up, and the user is marked active.
+func (m *Memory) CreateSession(ctx context.Context, session Session) (int64, error) {
+	err := m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[session.UserID]
+		if !ok {
+			return ErrFKeyViolation{fmt.Errorf("session fk violation on user ID %d", session.UserID)}
+		}
+
+		u.LastActiveAt = session.CreatedAt
+		d.users[u.ID] = u
+
+		for id, existing := range d.sessions {
+			if existing.UserID == session.UserID && !existing.ExpiresAt.After(session.CreatedAt) {
+				delete(d.sessions, id)
+			}
+		}
+
+		d.lastSessionID++
+		session.ID = d.lastSessionID
+		d.sessions[session.ID] = session
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return session.ID, nil
+}
+
+// GetSessions retrieves the unexpired sessions of a user.
+func (m *Memory) GetSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error) {
+	sessions := []Session{}
+	for _, session := range m.snapshot().sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+
+	return sessions, nil
+}
+
+// RotateSession replaces the token ID, last use, IP address, and expiry of a
+// session if its current token ID is oldTokenID. If the session has a
+// different token ID, an old refresh token has been reused, so the session is
+// deleted and rotated is false. The user is marked active if the session is
+// rotated. ErrNoResults is returned if the session doesn't exist or has
+// expired.
+func (m *Memory) RotateSession(ctx context.Context, session Session, oldTokenID string) (rotated bool, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		existing, ok := d.sessions[session.ID]
+		if !ok || existing.UserID != session.UserID || !existing.ExpiresAt.After(session.LastUsedAt) {
+			return ErrNoResults{fmt.Errorf("session %d does not exist", session.ID)}
+		}
+
+		if existing.TokenID != oldTokenID {
+			delete(d.sessions, session.ID)
+			return nil
+		}
+
+		existing.TokenID = session.TokenID
+		existing.IPAddress = session.IPAddress
+		existing.LastUsedAt = session.LastUsedAt
+		existing.ExpiresAt = session.ExpiresAt
+		d.sessions[session.ID] = existing
+
+		if u, ok := d.users[session.UserID]; ok {
+			u.LastActiveAt = session.LastUsedAt
+			d.users[u.ID] = u
+		}
+
+		rotated = true
+		return nil
+	})
+
+	return rotated, err
+}
+
+// DeleteSession revokes a session of a user.
+func (m *Memory) DeleteSession(ctx context.Context, userID, id int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		session, ok := d.sessions[id]
+		if !ok || session.UserID != userID {
+			return ErrNoResults{fmt.Errorf("session %d of user %d does not exist", id, userID)}
+		}
+
+		delete(d.sessions, id)
+
+		return nil
+	})
+}
+
+// DeleteSessions revokes every session of a user.
+func (m *Memory) DeleteSessions(ctx context.Context, userID int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for id, session := range d.sessions {
+			if session.UserID == userID {
+				delete(d.sessions, id)
+			}
+		}
+
+		return nil
+	})
+}
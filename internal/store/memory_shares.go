@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// visibleToRealm returns whether data owned by a realm is visible to the
+// viewing realm, following the visibleToRealm SQL condition. A nil event key
+// is covered by any share for the year.
+func (d *memoryData) visibleToRealm(realmID *int64, eventKey *string, year *int, viewer *int64) bool {
+	if realmID == nil || (viewer != nil && *realmID == *viewer) {
+		return true
+	}
+
+	if realm, ok := d.realms[*realmID]; ok && realm.ShareReports {
+		return true
+	}
+
+	if viewer == nil {
+		return false
+	}
+
+	for _, share := range d.realmShares {
+		if share.RealmID != *realmID || share.PartnerRealmID != *viewer || share.AcceptedAt == nil {
+			continue
+		}
+
+		if share.EventKey != nil && eventKey != nil && *share.EventKey != *eventKey {
+			continue
+		}
+
+		if share.Year != nil && (year == nil || *share.Year != *year) {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// GetRealmShares retrieves the shares a realm has offered to other realms and
+// the shares other realms have offered to it.
+func (m *Memory) GetRealmShares(ctx context.Context, realmID int64) ([]RealmShare, error) {
+	shares := []RealmShare{}
+	for _, share := range m.snapshot().realmShares {
+		if share.RealmID == realmID || share.PartnerRealmID == realmID {
+			shares = append(shares, share)
+		}
+	}
+
+	sort.Slice(shares, func(i, j int) bool { return shares[i].ID < shares[j].ID })
+
+	return shares, nil
+}
+
+// GetRealmShare retrieves a specific realm share.
+func (m *Memory) GetRealmShare(ctx context.Context, id int64) (RealmShare, error) {
+	share, ok := m.snapshot().realmShares[id]
+	if !ok {
+		return RealmShare{}, ErrNoResults{fmt.Errorf("realm share %d does not exist", id)}
+	}
+
+	return share, nil
+}
+
+// InsertRealmShare offers a new share to a partner realm, returning its ID.
+// ErrExists is returned if the realms already have a share with the same
+// scope, and ErrFKeyViolation if either realm or the event doesn't exist.
+func (m *Memory) InsertRealmShare(ctx context.Context, share RealmShare) (id int64, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		for _, realmID := range []int64{share.RealmID, share.PartnerRealmID} {
+			if _, ok := d.realms[realmID]; !ok {
+				return ErrFKeyViolation{fmt.Errorf("realm share fk violation on realm ID %d", realmID)}
+			}
+		}
+
+		if share.EventKey != nil {
+			if _, ok := d.events[*share.EventKey]; !ok {
+				return ErrFKeyViolation{fmt.Errorf("realm share fk violation on event key %s", *share.EventKey)}
+			}
+		}
+
+		for _, existing := range d.realmShares {
+			if existing.RealmID == share.RealmID && existing.PartnerRealmID == share.PartnerRealmID &&
+				sameString(existing.EventKey, share.EventKey) && sameInt(existing.Year, share.Year) {
+				return ErrExists{fmt.Errorf("realm %d already shares with realm %d", share.RealmID, share.PartnerRealmID)}
+			}
+		}
+
+		d.lastRealmShareID++
+		share.ID = d.lastRealmShareID
+		share.AcceptedAt = nil
+		d.realmShares[share.ID] = share
+		id = share.ID
+
+		return nil
+	})
+
+	return id, err
+}
+
+// AcceptRealmShare accepts a realm share on behalf of the partner realm.
+// Accepting a share that's already accepted keeps the original time.
+func (m *Memory) AcceptRealmShare(ctx context.Context, id int64, acceptedAt time.Time) error {
+	return m.update(ctx, func(d *memoryData) error {
+		share, ok := d.realmShares[id]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("realm share %d does not exist", id)}
+		}
+
+		if share.AcceptedAt == nil {
+			share.AcceptedAt = &acceptedAt
+			d.realmShares[id] = share
+		}
+		m.eventChangedTx("")
+
+		return nil
+	})
+}
+
+// DeleteRealmShare revokes or declines a realm share.
+func (m *Memory) DeleteRealmShare(ctx context.Context, id int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		if _, ok := d.realmShares[id]; !ok {
+			return ErrNoResults{fmt.Errorf("realm share %d does not exist", id)}
+		}
+
+		delete(d.realmShares, id)
+		m.eventChangedTx("")
+
+		return nil
+	})
+}
+
+// sameString returns whether two optional strings are both nil or equal.
+func sameString(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// sameInt returns whether two optional ints are both nil or equal.
+func sameInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
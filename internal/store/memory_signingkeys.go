@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// GetSigningKeys retrieves every signing key, oldest first.
+func (m *Memory) GetSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	keys := []SigningKey{}
+	for _, key := range m.snapshot().signingKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// RotateSigningKey inserts a key and retires every other key at the time the
+// key was created, unless a key that hasn't been retired was created after
+// rotateBefore. That means another server already rotated the key, so nothing
+// changes and rotated is false.
+func (m *Memory) RotateSigningKey(ctx context.Context, key SigningKey, rotateBefore time.Time) (rotated bool, err error) {
+	err = m.update(ctx, func(d *memoryData) error {
+		for _, existing := range d.signingKeys {
+			if existing.RetiredAt == nil && existing.CreatedAt.After(rotateBefore) {
+				return nil
+			}
+		}
+
+		for id, existing := range d.signingKeys {
+			if existing.RetiredAt == nil {
+				retiredAt := key.CreatedAt
+				existing.RetiredAt = &retiredAt
+				d.signingKeys[id] = existing
+			}
+		}
+
+		d.signingKeys[key.ID] = key
+
+		rotated = true
+		return nil
+	})
+
+	return rotated, err
+}
+
+// DeleteSigningKeys deletes the keys that were retired before retiredBefore,
+// once no token they signed can still be valid.
+func (m *Memory) DeleteSigningKeys(ctx context.Context, retiredBefore time.Time) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for id, key := range d.signingKeys {
+			if key.RetiredAt != nil && key.RetiredAt.Before(retiredBefore) {
+				delete(d.signingKeys, id)
+			}
+		}
+
+		return nil
+	})
+}
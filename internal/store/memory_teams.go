@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// GetEventTeamForRealm retrieves a team specified by teamKey from an event
+// specified by eventKey with a null or matching realm ID.
+func (m *Memory) GetEventTeamForRealm(ctx context.Context, teamKey string, eventKey string, realmID *int64) (EventTeam, error) {
+	d := m.snapshot()
+
+	t, ok := d.eventTeams[eventTeamID{eventKey: eventKey, key: teamKey}]
+	if !ok || !realmMatches(d.events[eventKey].RealmID, realmID) {
+		return EventTeam{}, ErrNoResults{fmt.Errorf("team %s at event %s does not exist", teamKey, eventKey)}
+	}
+
+	return t, nil
+}
+
+// GetEventTeamsForRealm retrieves all teams from an event specified by eventKey
+// with a null or matching realm ID.
+func (m *Memory) GetEventTeamsForRealm(ctx context.Context, eventKey string, realmID *int64) ([]EventTeam, error) {
+	d := m.snapshot()
+
+	teams := []EventTeam{}
+	if !realmMatches(d.events[eventKey].RealmID, realmID) {
+		return teams, nil
+	}
+
+	for id, t := range d.eventTeams {
+		if id.eventKey == eventKey {
+			teams = append(teams, t)
+		}
+	}
+
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Key < teams[j].Key })
+
+	return teams, nil
+}
+
+// GetTeam retrieves general team info for a specific team, including the names
+// of their robots.
+func (m *Memory) GetTeam(ctx context.Context, teamKey string) (Team, error) {
+	d := m.snapshot()
+
+	t, ok := d.teams[teamKey]
+	if !ok {
+		return t, ErrNoResults{fmt.Errorf("team %s does not exist", teamKey)}
+	}
+
+	t.Robots = make([]Robot, 0)
+	for id, robot := range d.robots {
+		if id.teamKey == teamKey {
+			t.Robots = append(t.Robots, robot)
+		}
+	}
+
+	sort.Slice(t.Robots, func(i, j int) bool { return t.Robots[i].Year < t.Robots[j].Year })
+
+	return t, nil
+}
+
+// GetTeamEventsForRealm retrieves every event a team attended with a null or
+// matching realm ID, along with the team's ranking at each event. Specify year
+// to only retrieve events from that year.
+func (m *Memory) GetTeamEventsForRealm(ctx context.Context, teamKey string, realmID *int64, year *int) ([]TeamEvent, error) {
+	d := m.snapshot()
+
+	events := make([]TeamEvent, 0)
+	for id, t := range d.eventTeams {
+		e, ok := d.events[id.eventKey]
+		if id.key != teamKey || !ok || !realmMatches(e.RealmID, realmID) || e.TBADeleted ||
+			(year != nil && e.StartDate.Year() != *year) {
+			continue
+		}
+
+		events = append(events, TeamEvent{
+			EventTeam:    t,
+			EventName:    e.Name,
+			EventRealmID: e.RealmID,
+			StartDate:    e.StartDate,
+			SchemaID:     d.eventSchemaID(e),
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].StartDate.Equal(events[j].StartDate) {
+			return events[i].StartDate.Before(events[j].StartDate)
+		}
+		return events[i].EventKey < events[j].EventKey
+	})
+
+	return events, nil
+}
+
+// GetYearTeamKeys retrieves the keys of every team attending an event in the
+// given year.
+func (m *Memory) GetYearTeamKeys(ctx context.Context, year int) ([]string, error) {
+	d := m.snapshot()
+
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for id := range d.eventTeams {
+		e, ok := d.events[id.eventKey]
+		if ok && e.StartDate.Year() == year && !seen[id.key] {
+			seen[id.key] = true
+			keys = append(keys, id.key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// EventTeamsUpsert upserts multiple teams for a specific event.
+func (m *Memory) EventTeamsUpsert(ctx context.Context, teams []EventTeam) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for _, t := range teams {
+			if _, ok := d.events[t.EventKey]; !ok {
+				return ErrFKeyViolation{fmt.Errorf("event %s does not exist", t.EventKey)}
+			}
+
+			if _, ok := d.teams[t.Key]; !ok {
+				d.teams[t.Key] = Team{Key: t.Key}
+			}
+
+			d.eventTeams[eventTeamID{eventKey: t.EventKey, key: t.Key}] = t
+		}
+
+		return nil
+	})
+}
+
+// TeamsUpsert upserts multiple teams.
+func (m *Memory) TeamsUpsert(ctx context.Context, teams []Team) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for _, t := range teams {
+			t.Robots = nil
+			d.teams[t.Key] = t
+		}
+
+		return nil
+	})
+}
+
+// RobotsUpsert upserts the robot names of multiple teams.
+func (m *Memory) RobotsUpsert(ctx context.Context, robots []Robot) error {
+	return m.update(ctx, func(d *memoryData) error {
+		for _, robot := range robots {
+			if _, ok := d.teams[robot.TeamKey]; !ok {
+				return ErrFKeyViolation{fmt.Errorf("unable to upsert robot for team %q: team does not exist", robot.TeamKey)}
+			}
+
+			d.robots[robotID{teamKey: robot.TeamKey, year: robot.Year}] = robot
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMemoryTransactions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	var changed []string
+	m.OnEventChange(func(eventKey string) {
+		changed = append(changed, eventKey)
+	})
+
+	event := Event{Key: "2019orwil", Name: "Wilsonville", StartDate: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := m.EventsUpsert(ctx, []Event{event}); err != nil {
+		t.Fatalf("did not expect error upserting event: %v", err)
+	}
+
+	match := Match{Key: "qm1", EventKey: event.Key, RedAlliance: []string{"frc1", "frc2", "frc3"}, BlueAlliance: []string{"frc4", "frc5", "frc6"}}
+
+	errRollback := errors.New("rollback")
+	err := m.DoTransaction(ctx, func(tx *Tx) error {
+		if err := m.UpsertMatchTx(ctx, tx, match); err != nil {
+			return err
+		}
+
+		if _, err := m.GetMatchForRealm(ctx, event.Key, match.Key, nil); !errors.Is(err, ErrNoResults{}) {
+			t.Errorf("expected uncommitted match to not be visible outside of transaction, got error %v", err)
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Errorf("expected rollback error, got %v", err)
+	}
+
+	if _, err := m.GetMatchForRealm(ctx, event.Key, match.Key, nil); !errors.Is(err, ErrNoResults{}) {
+		t.Errorf("expected rolled back match to not exist, got error %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("expected no event changes from rolled back transaction, got %v", changed)
+	}
+
+	err = m.DoTransaction(ctx, func(tx *Tx) error {
+		return m.UpsertMatchTx(ctx, tx, match)
+	})
+	if err != nil {
+		t.Fatalf("did not expect error committing match: %v", err)
+	}
+
+	if _, err := m.GetMatchForRealm(ctx, event.Key, match.Key, nil); err != nil {
+		t.Errorf("expected committed match to exist, got error %v", err)
+	}
+	if !cmp.Equal(changed, []string{event.Key}) {
+		t.Errorf("expected event change after commit, got %v", changed)
+	}
+
+	teams, err := m.GetEventTeamsForRealm(ctx, event.Key, nil)
+	if err != nil {
+		t.Fatalf("did not expect error getting event teams: %v", err)
+	}
+	if len(teams) != 6 {
+		t.Errorf("expected alliance teams to be added to the event, got %v", teams)
+	}
+
+	// changing an event's schema changes its stats
+	changed = nil
+	schemaID := int64(1)
+	event.SchemaID = &schemaID
+	err = m.DoTransaction(ctx, func(tx *Tx) error {
+		return m.UpsertEventTx(ctx, tx, event)
+	})
+	if err != nil {
+		t.Fatalf("did not expect error upserting event: %v", err)
+	}
+	if !cmp.Equal(changed, []string{event.Key}) {
+		t.Errorf("expected event change after upserting event, got %v", changed)
+	}
+
+	if err := m.UpsertMatchTx(ctx, &Tx{}, match); err == nil {
+		t.Errorf("expected error using inactive transaction")
+	}
+}
+
+func TestMemoryReportVisibility(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	sharedID, err := m.InsertRealm(ctx, Realm{Name: "Shared", ShareReports: true})
+	if err != nil {
+		t.Fatalf("did not expect error inserting realm: %v", err)
+	}
+	privateID, err := m.InsertRealm(ctx, Realm{Name: "Private"})
+	if err != nil {
+		t.Fatalf("did not expect error inserting realm: %v", err)
+	}
+	if _, err := m.InsertRealm(ctx, Realm{Name: "Private"}); !errors.Is(err, ErrExists{}) {
+		t.Errorf("expected ErrExists inserting duplicate realm, got %v", err)
+	}
+
+	event := Event{Key: "2019orwil", StartDate: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := m.EventsUpsert(ctx, []Event{event}); err != nil {
+		t.Fatalf("did not expect error upserting event: %v", err)
+	}
+	if err := m.UpdateTBAMatches(ctx, []Match{{Key: "qm1", EventKey: event.Key, RedAlliance: []string{"frc1"}, BlueAlliance: []string{"frc2"}}}); err != nil {
+		t.Fatalf("did not expect error upserting match: %v", err)
+	}
+
+	for _, realmID := range []int64{sharedID, privateID} {
+		realmID := realmID
+		if _, _, err := m.UpsertReport(ctx, Report{EventKey: event.Key, MatchKey: "qm1", TeamKey: "frc1", RealmID: &realmID}); err != nil {
+			t.Fatalf("did not expect error upserting report: %v", err)
+		}
+	}
+
+	partnerID, err := m.InsertRealm(ctx, Realm{Name: "Partner"})
+	if err != nil {
+		t.Fatalf("did not expect error inserting realm: %v", err)
+	}
+	otherYearID, err := m.InsertRealm(ctx, Realm{Name: "Other Year"})
+	if err != nil {
+		t.Fatalf("did not expect error inserting realm: %v", err)
+	}
+
+	year := 2020
+	for _, share := range []RealmShare{
+		{RealmID: privateID, PartnerRealmID: partnerID, EventKey: &event.Key},
+		{RealmID: privateID, PartnerRealmID: otherYearID, Year: &year},
+	} {
+		id, err := m.InsertRealmShare(ctx, share)
+		if err != nil {
+			t.Fatalf("did not expect error inserting realm share: %v", err)
+		}
+		if err := m.AcceptRealmShare(ctx, id, time.Now()); err != nil {
+			t.Fatalf("did not expect error accepting realm share: %v", err)
+		}
+	}
+
+	if _, err := m.InsertRealmShare(ctx, RealmShare{RealmID: privateID, PartnerRealmID: partnerID, EventKey: &event.Key}); !errors.Is(err, ErrExists{}) {
+		t.Errorf("expected ErrExists inserting duplicate realm share, got %v", err)
+	}
+
+	pendingID, err := m.InsertRealm(ctx, Realm{Name: "Pending"})
+	if err != nil {
+		t.Fatalf("did not expect error inserting realm: %v", err)
+	}
+	if _, err := m.InsertRealmShare(ctx, RealmShare{RealmID: privateID, PartnerRealmID: pendingID}); err != nil {
+		t.Fatalf("did not expect error inserting realm share: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		realmID     *int64
+		expectedIDs []int64
+	}{
+		{name: "no realm", realmID: nil, expectedIDs: []int64{1}},
+		{name: "shared realm", realmID: &sharedID, expectedIDs: []int64{1}},
+		{name: "private realm", realmID: &privateID, expectedIDs: []int64{1, 2}},
+		{name: "partner for event", realmID: &partnerID, expectedIDs: []int64{1, 2}},
+		{name: "partner for other year", realmID: &otherYearID, expectedIDs: []int64{1}},
+		{name: "pending partner", realmID: &pendingID, expectedIDs: []int64{1}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, err := m.GetEventReportsForRealm(ctx, event.Key, tt.realmID)
+			if err != nil {
+				t.Fatalf("did not expect error getting reports: %v", err)
+			}
+
+			var ids []int64
+			for _, r := range reports {
+				ids = append(ids, r.ID)
+			}
+
+			if !cmp.Equal(ids, tt.expectedIDs) {
+				t.Errorf("expected report IDs to match, but got diff: %s", cmp.Diff(tt.expectedIDs, ids))
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// withStars returns the user with a non-nil list of stars.
+func withStars(u User) User {
+	if u.Stars == nil {
+		u.Stars = pq.StringArray{}
+	}
+
+	return u
+}
+
+// withoutStars returns the user without stars, like users read straight from
+// the users table.
+func withoutStars(u User) User {
+	u.Stars = nil
+	return u
+}
+
+func (d *memoryData) checkStars(stars []string) error {
+	for _, star := range stars {
+		if _, ok := d.events[star]; !ok {
+			return ErrFKeyViolation{fmt.Errorf("user stars event key fk violation: event %s does not exist", star)}
+		}
+	}
+
+	return nil
+}
+
+func (d *memoryData) checkUsername(u User) error {
+	for _, existing := range d.users {
+		if existing.ID != u.ID && existing.Username == u.Username {
+			return ErrExists{fmt.Errorf("username %q already exists", u.Username)}
+		}
+	}
+
+	return nil
+}
+
+// deleteUser deletes a user along with their API keys, sessions, identities,
+// and memberships, removing them as the reporter of their reports.
+func (d *memoryData) deleteUser(id int64) {
+	delete(d.users, id)
+
+	for keyID, key := range d.apiKeys {
+		if key.UserID == id {
+			delete(d.apiKeys, keyID)
+		}
+	}
+
+	for sessionID, session := range d.sessions {
+		if session.UserID == id {
+			delete(d.sessions, sessionID)
+		}
+	}
+
+	for identityID, identity := range d.identities {
+		if identity.UserID == id {
+			delete(d.identities, identityID)
+		}
+	}
+
+	for membershipID, membership := range d.memberships {
+		if membership.UserID == id {
+			delete(d.memberships, membershipID)
+		}
+	}
+
+	for hash, reset := range d.passwordResets {
+		if reset.UserID == id {
+			delete(d.passwordResets, hash)
+		}
+	}
+
+	for failureID, f := range d.loginFailures {
+		if f.UserID != nil && *f.UserID == id {
+			delete(d.loginFailures, failureID)
+		}
+	}
+
+	for inviteID, invite := range d.invites {
+		if invite.CreatedBy != nil && *invite.CreatedBy == id {
+			invite.CreatedBy = nil
+			d.invites[inviteID] = invite
+		}
+	}
+
+	for reportID, r := range d.reports {
+		if r.ReporterID != nil && *r.ReporterID == id {
+			r.ReporterID = nil
+			d.reports[reportID] = r
+		}
+	}
+}
+
+func (d *memoryData) getUsers(include func(User) bool) []User {
+	users := []User{}
+	for _, u := range d.users {
+		if include(u) {
+			users = append(users, withStars(u))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users
+}
+
+// GetUserByUsername retrieves a user by username. It does not retrieve the
+// users stars.
+func (m *Memory) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	for _, u := range m.snapshot().users {
+		if u.Username == username {
+			return withoutStars(u), nil
+		}
+	}
+
+	return User{}, ErrNoResults{fmt.Errorf("user %q does not exist", username)}
+}
+
+// GetUsersByEmail retrieves the users with an email address, ignoring case. It
+// does not retrieve the users stars.
+func (m *Memory) GetUsersByEmail(ctx context.Context, email string) ([]User, error) {
+	users := m.snapshot().getUsers(func(u User) bool { return strings.EqualFold(u.Email, email) })
+	for i := range users {
+		users[i] = withoutStars(users[i])
+	}
+
+	return users, nil
+}
+
+// GetUserByID retrieves a user by id.
+func (m *Memory) GetUserByID(ctx context.Context, id int64) (User, error) {
+	u, ok := m.snapshot().users[id]
+	if !ok {
+		return User{}, ErrNoResults{fmt.Errorf("user %d does not exist", id)}
+	}
+
+	return withStars(u), nil
+}
+
+// GetUsers retrieves all users.
+func (m *Memory) GetUsers(ctx context.Context) ([]User, error) {
+	return m.snapshot().getUsers(func(User) bool { return true }), nil
+}
+
+// GetUsersByRealm retrieves all users in a specific realm.
+func (m *Memory) GetUsersByRealm(ctx context.Context, realmID int64) ([]User, error) {
+	return m.snapshot().getUsers(func(u User) bool { return u.RealmID == realmID }), nil
+}
+
+// CheckSimilarUsernameExists checks whether a user with (case insensitive) the
+// same username exists. It returns an ErrExists if a similar user exists. If an
+// id is given, it will ignore the user with that id.
+func (m *Memory) CheckSimilarUsernameExists(ctx context.Context, username string, id *int64) error {
+	for _, u := range m.snapshot().users {
+		if strings.EqualFold(u.Username, username) && (id == nil || u.ID != *id) {
+			return ErrExists{errors.New("user with similar username exists")}
+		}
+	}
+
+	return nil
+}
+
+// CreateUser creates a given user.
+func (m *Memory) CreateUser(ctx context.Context, u User) error {
+	return m.update(ctx, func(d *memoryData) error {
+		_, err := d.createUser(u)
+		return err
+	})
+}
+
+// CreateUserTx creates a given user using the given transaction, returning
+// their ID.
+func (m *Memory) CreateUserTx(ctx context.Context, tx *Tx, u User) (int64, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.createUser(u)
+}
+
+func (d *memoryData) createUser(u User) (int64, error) {
+	u.ID = 0
+	u.PasswordChanged = time.Now()
+	u.LastActiveAt = u.PasswordChanged
+
+	if err := d.checkUsername(u); err != nil {
+		return 0, err
+	}
+
+	if _, ok := d.realms[u.RealmID]; !ok {
+		return 0, ErrFKeyViolation{fmt.Errorf("user fk violation on realm ID %d", u.RealmID)}
+	}
+
+	if err := d.checkStars(u.Stars); err != nil {
+		return 0, err
+	}
+
+	d.lastUserID++
+	u.ID = d.lastUserID
+	u.Role, u.Permissions = defaultRole(u.Role, u.Permissions)
+	u.Stars = cloneStrings(u.Stars)
+	d.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+// PatchUser updates a user by their ID.
+func (m *Memory) PatchUser(ctx context.Context, pu PatchUser) error {
+	return m.update(ctx, func(d *memoryData) error {
+		u, ok := d.users[pu.ID]
+		if !ok {
+			return ErrNoResults{fmt.Errorf("user ID %d not found", pu.ID)}
+		}
+
+		if pu.Username != nil {
+			u.Username = *pu.Username
+			if err := d.checkUsername(u); err != nil {
+				return err
+			}
+		}
+		if pu.HashedPassword != nil {
+			u.HashedPassword = *pu.HashedPassword
+			u.PasswordChanged = time.Now()
+		}
+		if pu.FirstName != nil {
+			u.FirstName = *pu.FirstName
+		}
+		if pu.LastName != nil {
+			u.LastName = *pu.LastName
+		}
+		if pu.Email != nil {
+			u.Email = *pu.Email
+		}
+		if pu.Role != nil {
+			u.Role = *pu.Role
+		}
+		if pu.Permissions != nil {
+			u.Permissions = append(Permissions{}, pu.Permissions...)
+		}
+		if pu.Stars != nil {
+			if err := d.checkStars(pu.Stars); err != nil {
+				return err
+			}
+			u.Stars = cloneStrings(pu.Stars)
+		}
+
+		d.users[u.ID] = u
+
+		return nil
+	})
+}
+
+// DeleteUserByID deletes a specific user.
+func (m *Memory) DeleteUserByID(ctx context.Context, id int64) error {
+	return m.update(ctx, func(d *memoryData) error {
+		if _, ok := d.users[id]; !ok {
+			return ErrNoResults{errors.New("got 0 affected rows")}
+		}
+
+		d.deleteUser(id)
+
+		return nil
+	})
+}
+
+// LockUser retrieves a user. It does not retrieve the users stars.
+func (m *Memory) LockUser(ctx context.Context, tx *Tx, id int64) (User, error) {
+	d, err := m.txData(tx)
+	if err != nil {
+		return User{}, err
+	}
+
+	u, ok := d.users[id]
+	if !ok {
+		return User{}, ErrNoResults{fmt.Errorf("user %d does not exist", id)}
+	}
+
+	return withoutStars(u), nil
+}
+
+// ExclusiveLockUsersTx is a no-op, since transactions are serialized.
+func (m *Memory) ExclusiveLockUsersTx(ctx context.Context, tx *Tx) error {
+	return m.lockTx(tx)
+}
+
+// DeleteUserByIDRealmTx deletes a specific user in a specific realm.
+func (m *Memory) DeleteUserByIDRealmTx(ctx context.Context, tx *Tx, id, realmID int64) error {
+	d, err := m.txData(tx)
+	if err != nil {
+		return err
+	}
+
+	if u, ok := d.users[id]; !ok || u.RealmID != realmID {
+		return ErrNoResults{errors.New("got 0 affected rows")}
+	}
+
+	d.deleteUser(id)
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PasswordReset lets a user who forgot their password choose a new one. Only
+// a hash of the reset token is stored, and it can only be used once.
+type PasswordReset struct {
+	Hash      string    `db:"hash"`
+	UserID    int64     `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// CreatePasswordReset inserts a password reset. Expired resets of the same
+// user are cleaned up.
+func (s *Service) CreatePasswordReset(ctx context.Context, reset PasswordReset, now time.Time) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM password_resets WHERE user_id = $1 AND expires_at <= $2", reset.UserID, now)
+		if err != nil {
+			return fmt.Errorf("unable to delete expired password resets: %w", err)
+		}
+
+		_, err = tx.NamedExecContext(ctx, `
+		INSERT
+			INTO
+				password_resets (hash, user_id, expires_at)
+			VALUES (:hash, :user_id, :expires_at)
+		`, reset)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgFKeyViolation {
+			return ErrFKeyViolation{fmt.Errorf("password reset fk violation on user ID %d: %w", reset.UserID, err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to insert password reset: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword replaces the password of the user a password reset with the
+// given token hash belongs to, returning their ID, and unlocks them. Changing
+// the password invalidates the user's refresh tokens, so their sessions and
+// any other password resets are deleted too. ErrNoResults is returned if the reset
+// doesn't exist or has expired.
+func (s *Service) ResetPassword(ctx context.Context, hash string, now time.Time, hashedPassword string) (userID int64, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		var reset PasswordReset
+		err := tx.GetContext(ctx, &reset, "DELETE FROM password_resets WHERE hash = $1 RETURNING *", hash)
+		if err == sql.ErrNoRows {
+			return ErrNoResults{fmt.Errorf("password reset does not exist: %w", err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to delete password reset: %w", err)
+		}
+
+		if !now.Before(reset.ExpiresAt) {
+			return ErrNoResults{fmt.Errorf("password reset for user %d has expired", reset.UserID)}
+		}
+		userID = reset.UserID
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE users
+		SET hashed_password = $1, password_changed = $2, failed_logins = 0, locked_until = NULL
+		WHERE id = $3
+		`, hashedPassword, time.Now(), userID)
+		if err != nil {
+			return fmt.Errorf("unable to update password: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM password_resets WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("unable to delete password resets: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("unable to delete sessions: %w", err)
+		}
+
+		return nil
+	})
+
+	return userID, err
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"database/sql/driver"
+
+	"github.com/lib/pq"
+)
+
+// Permission allows a user to perform a kind of action. Permissions are named
+// like resource:action.
+type Permission string
+
+const (
+	// PermReportsWrite allows submitting reports and editing or deleting your
+	// own reports.
+	PermReportsWrite Permission = "reports:write"
+	// PermReportsManage allows editing and deleting any report in your realm.
+	PermReportsManage Permission = "reports:manage"
+	// PermPicklistsEdit allows editing your realm's pick lists.
+	PermPicklistsEdit Permission = "picklists:edit"
+	// PermSchemasManage allows creating schemas for your realm.
+	PermSchemasManage Permission = "schemas:manage"
+	// PermEventsManage allows creating and editing your realm's events and
+	// their matches.
+	PermEventsManage Permission = "events:manage"
+	// PermUsersManage allows creating, editing, and deleting users in your
+	// realm, and giving them any of your own permissions.
+	PermUsersManage Permission = "users:manage"
+	// PermRealmsManage allows editing and deleting your realm.
+	PermRealmsManage Permission = "realms:manage"
+	// PermRefreshManage allows viewing the status of and triggering refreshes
+	// from TBA.
+	PermRefreshManage Permission = "refresh:manage"
+	// PermGlobal extends your other permissions to every realm, and to events
+	// and schemas that don't belong to any realm.
+	PermGlobal Permission = "global"
+)
+
+// Role is a named set of permissions given to a user.
+type Role string
+
+const (
+	// RoleViewer can only read data.
+	RoleViewer Role = "viewer"
+	// RoleScout can submit reports.
+	RoleScout Role = "scout"
+	// RoleStrategist can submit reports and edit pick lists.
+	RoleStrategist Role = "strategist"
+	// RoleRealmAdmin can manage everything in their realm.
+	RoleRealmAdmin Role = "realmAdmin"
+	// RoleSuperAdmin can manage everything in every realm.
+	RoleSuperAdmin Role = "superAdmin"
+)
+
+var rolePermissions = map[Role]Permissions{
+	RoleViewer:     {},
+	RoleScout:      {PermReportsWrite},
+	RoleStrategist: {PermReportsWrite, PermPicklistsEdit},
+	RoleRealmAdmin: {
+		PermReportsWrite, PermReportsManage, PermPicklistsEdit, PermSchemasManage,
+		PermEventsManage, PermUsersManage, PermRealmsManage,
+	},
+	RoleSuperAdmin: {
+		PermReportsWrite, PermReportsManage, PermPicklistsEdit, PermSchemasManage,
+		PermEventsManage, PermUsersManage, PermRealmsManage, PermRefreshManage, PermGlobal,
+	},
+}
+
+// Valid returns whether the role is one of the defined roles.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Permissions returns the default permissions of the role.
+func (r Role) Permissions() Permissions {
+	return append(Permissions{}, rolePermissions[r]...)
+}
+
+// Permissions is a set of permissions a user has. It's stored as a TEXT[].
+type Permissions []Permission
+
+// Has returns whether the permissions include perm.
+func (p Permissions) Has(perm Permission) bool {
+	for _, have := range p {
+		if have == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contains returns whether every permission in other is also in p.
+func (p Permissions) Contains(other Permissions) bool {
+	for _, perm := range other {
+		if !p.Has(perm) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Valid returns whether every permission is one of the defined permissions.
+func (p Permissions) Valid() bool {
+	return rolePermissions[RoleSuperAdmin].Contains(p)
+}
+
+// Value is provided for storing Permissions as a PostgreSQL TEXT[]. Nil
+// permissions are stored as NULL.
+func (p Permissions) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	strs := make(pq.StringArray, len(p))
+	for i, perm := range p {
+		strs[i] = string(perm)
+	}
+
+	return strs.Value()
+}
+
+// Scan is provided for scanning Permissions from a PostgreSQL TEXT[].
+func (p *Permissions) Scan(src interface{}) error {
+	var strs pq.StringArray
+	if err := strs.Scan(src); err != nil {
+		return err
+	}
+
+	*p = make(Permissions, len(strs))
+	for i, str := range strs {
+		(*p)[i] = Permission(str)
+	}
+
+	return nil
+}
+
+// defaultRole returns the role and permissions a new user is created with. A
+// user with no role is a viewer, and a user with no permissions is given their
+// role's permissions.
+func defaultRole(role Role, perms Permissions) (Role, Permissions) {
+	if role == "" {
+		role = RoleViewer
+	}
+
+	if perms == nil {
+		return role, role.Permissions()
+	}
+
+	return role, append(Permissions{}, perms...)
+}
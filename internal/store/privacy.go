@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetReportsByReporter retrieves every report a user submitted, in any realm.
+func (s *Service) GetReportsByReporter(ctx context.Context, reporterID int64) ([]Report, error) {
+	reports := []Report{}
+
+	err := s.db.SelectContext(ctx, &reports, "SELECT * FROM reports WHERE reporter_id = $1 ORDER BY id", reporterID)
+	if err != nil {
+		return reports, fmt.Errorf("unable to select reports by reporter: %w", err)
+	}
+
+	return reports, nil
+}
+
+// DeleteReportsByReporterTx deletes every report a user submitted using the
+// given transaction.
+func (s *Service) DeleteReportsByReporterTx(ctx context.Context, tx *Tx, reporterID int64) error {
+	var eventKeys []string
+
+	err := tx.SelectContext(ctx, &eventKeys, "DELETE FROM reports WHERE reporter_id = $1 RETURNING event_key", reporterID)
+	if err != nil {
+		return fmt.Errorf("unable to delete reports by reporter: %w", err)
+	}
+
+	for _, eventKey := range eventKeys {
+		s.eventChangedTx(tx, eventKey)
+	}
+
+	return nil
+}
+
+// DeleteUserByIDTx deletes a specific user using the given transaction.
+func (s *Service) DeleteUserByIDTx(ctx context.Context, tx *Tx, id int64) error {
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("unable to delete user %d: %w", id, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoResults{errors.New("got 0 affected rows")}
+	}
+
+	return nil
+}
+
+// PurgeInactiveUsers deletes the users who haven't been active since
+// activeBefore, returning how many were deleted. Their reports are kept
+// without a reporter. Users with global permissions are never purged.
+func (s *Service) PurgeInactiveUsers(ctx context.Context, activeBefore time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+	DELETE FROM users
+	WHERE
+		last_active_at < $1 AND
+		NOT ($2 = ANY(permissions))
+	`, activeBefore, PermGlobal)
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge inactive users: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get rows affected purging inactive users: %w", err)
+	}
+
+	return n, nil
+}
@@ -3,17 +3,67 @@ package store
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
-// Realm holds the name of a realm, and whether to share the realms reports.
+// Realm holds the name of a realm, whether to share the realms reports, and
+// its settings.
 type Realm struct {
-	ID           int64  `json:"id" db:"id"`
-	Name         string `json:"name" db:"name" validate:"omitempty,gte=1,lte=32"`
-	ShareReports bool   `json:"shareReports" db:"share_reports"`
+	ID           int64         `json:"id" db:"id"`
+	Name         string        `json:"name" db:"name" validate:"omitempty,gte=1,lte=32"`
+	ShareReports bool          `json:"shareReports" db:"share_reports"`
+	Settings     RealmSettings `json:"settings" db:"settings"`
+}
+
+// Report visibilities decide which reports a realm's stats and report lists
+// use.
+const (
+	// ReportVisibilityShared uses the realm's reports and every report shared
+	// with it. It's the default.
+	ReportVisibilityShared = "shared"
+	// ReportVisibilityRealm only uses the realm's own reports.
+	ReportVisibilityRealm = "realm"
+)
+
+// RealmSettings customizes a realm. Clients use the home team, timezone, logo,
+// and colors for display, the rest changes what the realm's users get.
+type RealmSettings struct {
+	HomeTeamKey string `json:"homeTeamKey,omitempty" validate:"omitempty,startswith=frc"`
+	// Timezone is an IANA time zone name like America/Los_Angeles.
+	Timezone string `json:"timezone,omitempty"`
+	// DefaultSchemas maps years to the schema used for stats at events of
+	// that year that don't belong to the realm.
+	DefaultSchemas map[int]int64 `json:"defaultSchemas,omitempty"`
+	// DefaultStars are the event keys new users of the realm start out
+	// starring.
+	DefaultStars     []string `json:"defaultStars,omitempty" validate:"dive,required"`
+	ReportVisibility string   `json:"reportVisibility,omitempty" validate:"omitempty,oneof=shared realm"`
+	LogoURL          string   `json:"logoUrl,omitempty" validate:"omitempty,url"`
+	PrimaryColor     string   `json:"primaryColor,omitempty" validate:"omitempty,hexcolor"`
+	AccentColor      string   `json:"accentColor,omitempty" validate:"omitempty,hexcolor"`
+}
+
+// OnlyOwnReports returns whether the realm only uses its own reports.
+func (rs RealmSettings) OnlyOwnReports() bool {
+	return rs.ReportVisibility == ReportVisibilityRealm
+}
+
+// Value implements driver.Valuer to return JSON for the DB from RealmSettings.
+func (rs RealmSettings) Value() (driver.Value, error) { return json.Marshal(rs) }
+
+// Scan implements sql.Scanner to scan JSON from the DB into RealmSettings.
+func (rs *RealmSettings) Scan(src interface{}) error {
+	j, ok := src.([]byte)
+	if !ok {
+		return errors.New("got invalid type for RealmSettings")
+	}
+
+	return json.Unmarshal(j, rs)
 }
 
 // GetRealms returns all realms in the database.
@@ -35,7 +85,7 @@ func (s *Service) GetRealm(ctx context.Context, id int64) (realm Realm, err erro
 }
 
 // GetRealmExistsTx returns whether the given realm exists using the given transaction.
-func (s *Service) GetRealmExistsTx(ctx context.Context, tx *sqlx.Tx, id int64) (exists bool, err error) {
+func (s *Service) GetRealmExistsTx(ctx context.Context, tx *Tx, id int64) (exists bool, err error) {
 	err = tx.GetContext(ctx, &exists, "SELECT EXISTS(SELECT id FROM realms WHERE id = $1)", id)
 	if err != nil {
 		return false, fmt.Errorf("unable to get whether realm %d exists: %w", id, err)
@@ -45,7 +95,7 @@ func (s *Service) GetRealmExistsTx(ctx context.Context, tx *sqlx.Tx, id int64) (
 }
 
 // ExclusiveLockRealmsTx locks the entire realm table while doing an update.
-func (s *Service) ExclusiveLockRealmsTx(ctx context.Context, tx *sqlx.Tx) error {
+func (s *Service) ExclusiveLockRealmsTx(ctx context.Context, tx *Tx) error {
 	_, err := tx.ExecContext(ctx, "LOCK TABLE realms IN EXCLUSIVE MODE")
 	if err != nil {
 		return fmt.Errorf("unable to lock realms: %w", err)
@@ -55,14 +105,24 @@ func (s *Service) ExclusiveLockRealmsTx(ctx context.Context, tx *sqlx.Tx) error
 }
 
 // InsertRealm inserts a realm into the database.
-func (s *Service) InsertRealm(ctx context.Context, realm Realm) (int64, error) {
+func (s *Service) InsertRealm(ctx context.Context, realm Realm) (realmID int64, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		realmID, err = s.InsertRealmTx(ctx, tx, realm)
+		return err
+	})
+
+	return realmID, err
+}
+
+// InsertRealmTx inserts a realm using the given transaction.
+func (s *Service) InsertRealmTx(ctx context.Context, tx *Tx, realm Realm) (int64, error) {
 	var realmID int64
 
-	err := s.db.GetContext(ctx, &realmID, `
-	    INSERT INTO realms (name, share_reports)
-		    VALUES ($1, $2)
+	err := tx.GetContext(ctx, &realmID, `
+	    INSERT INTO realms (name, share_reports, settings)
+		    VALUES ($1, $2, $3)
 	        RETURNING id
-		`, realm.Name, realm.ShareReports)
+		`, realm.Name, realm.ShareReports, realm.Settings)
 	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgExists {
 		return 0, ErrExists{fmt.Errorf("realm with name: %s already exists: %w", realm.Name, err)}
 	} else if err != nil {
@@ -73,17 +133,20 @@ func (s *Service) InsertRealm(ctx context.Context, realm Realm) (int64, error) {
 }
 
 // DeleteRealmTx deletes a realm from the database using the given transaction.
-func (s *Service) DeleteRealmTx(ctx context.Context, tx *sqlx.Tx, id int64) error {
+func (s *Service) DeleteRealmTx(ctx context.Context, tx *Tx, id int64) error {
 	_, err := tx.ExecContext(ctx, "DELETE FROM realms WHERE id = $1", id)
 	if err != nil {
 		return fmt.Errorf("unable to delete realm: %w", err)
 	}
 
+	s.eventChangedTx(tx, "")
+
 	return nil
 }
 
-// UpdateRealmTx updates a realm using the given transaction.
-func (s *Service) UpdateRealmTx(ctx context.Context, tx *sqlx.Tx, realm Realm) error {
+// UpdateRealmTx updates the name of a realm and whether it shares reports
+// using the given transaction. Its settings are left as they are.
+func (s *Service) UpdateRealmTx(ctx context.Context, tx *Tx, realm Realm) error {
 	res, err := tx.NamedExecContext(ctx, `
 	UPDATE realms
 	    SET
@@ -100,5 +163,26 @@ func (s *Service) UpdateRealmTx(ctx context.Context, tx *sqlx.Tx, realm Realm) e
 		return fmt.Errorf("unable to update realm: %w", err)
 	}
 
+	s.eventChangedTx(tx, "")
+
+	return nil
+}
+
+// UpdateRealmSettingsTx replaces the settings of a realm using the given
+// transaction.
+func (s *Service) UpdateRealmSettingsTx(ctx context.Context, tx *Tx, id int64, settings RealmSettings) error {
+	res, err := tx.ExecContext(ctx, "UPDATE realms SET settings = $2 WHERE id = $1", id, settings)
+	if err != nil {
+		return fmt.Errorf("unable to update realm settings: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected updating realm settings: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("could not update settings of non-existent realm %d", id)}
+	}
+
+	s.eventChangedTx(tx, "")
+
 	return nil
 }
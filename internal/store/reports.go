@@ -8,7 +8,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
@@ -54,7 +53,7 @@ type Leaderboard []struct {
 }
 
 // LockReport retrieves a report and locks it for update
-func (s *Service) LockReport(ctx context.Context, tx *sqlx.Tx, id int64) (Report, error) {
+func (s *Service) LockReport(ctx context.Context, tx *Tx, id int64) (Report, error) {
 	var report Report
 
 	err := tx.GetContext(ctx, &report, "SELECT * FROM reports WHERE id = $1 FOR UPDATE", id)
@@ -74,12 +73,9 @@ func (s *Service) GetReportForRealm(ctx context.Context, id int64, realmID *int6
 	err := s.db.GetContext(ctx, &report, `
 	SELECT reports.*
 		FROM reports
-	LEFT JOIN realms
-		ON realms.id = reports.realm_id
 	WHERE
 		reports.id = $1 AND
-		(reports.realm_id IS NULL OR realms.share_reports = true OR realms.id = $2)
-	`, id, realmID)
+		`+reportVisible("$2"), id, realmID)
 	if err == sql.ErrNoRows {
 		return report, ErrNoResults{fmt.Errorf("report with ID %d does not exist", report.ID)}
 	} else if err != nil {
@@ -94,51 +90,59 @@ func (s *Service) GetReportForRealm(ctx context.Context, id int64, realmID *int6
 // returns a boolean that is true when the report was created, and false when it
 // was updated.
 func (s *Service) UpsertReport(ctx context.Context, r Report) (created bool, id int64, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		created, id, err = s.UpsertReportTx(ctx, tx, r)
+		return err
+	})
+
+	return created, id, err
+}
+
+// UpsertReportTx is like UpsertReport, but uses the given transaction.
+func (s *Service) UpsertReportTx(ctx context.Context, tx *Tx, r Report) (created bool, id int64, err error) {
 	var existed bool
 
-	err = s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
-		err = tx.QueryRowContext(ctx, `
-			SELECT EXISTS(
-				SELECT FROM reports
-				WHERE
-					event_key = $1 AND
-					match_key = $2 AND
-					team_key = $3 AND
-					reporter_id = $4
-			)
-			`, r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID).Scan(&existed)
-		if err != nil {
-			return fmt.Errorf("unable to determine if report exists: %w", err)
-		}
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT FROM reports
+			WHERE
+				event_key = $1 AND
+				match_key = $2 AND
+				team_key = $3 AND
+				reporter_id = $4
+		)
+		`, r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID).Scan(&existed)
+	if err != nil {
+		return false, id, fmt.Errorf("unable to determine if report exists: %w", err)
+	}
 
-		reportStmt, err := tx.PrepareNamedContext(ctx, `INSERT INTO
-				reports (event_key, match_key, team_key, reporter_id, realm_id, data, comment)
-			VALUES (:event_key, :match_key, :team_key, :reporter_id, :realm_id, :data, :comment)
-			ON CONFLICT (event_key, match_key, team_key, reporter_id)
-				DO UPDATE SET data = :data, realm_id = :realm_id, comment = :comment
-			RETURNING id
-		`)
-		if err != nil {
-			return fmt.Errorf("unable to prepare user insert statement: %w", err)
-		}
+	reportStmt, err := tx.PrepareNamedContext(ctx, `INSERT INTO
+			reports (event_key, match_key, team_key, reporter_id, realm_id, data, comment)
+		VALUES (:event_key, :match_key, :team_key, :reporter_id, :realm_id, :data, :comment)
+		ON CONFLICT (event_key, match_key, team_key, reporter_id)
+			DO UPDATE SET data = :data, realm_id = :realm_id, comment = :comment
+		RETURNING id
+	`)
+	if err != nil {
+		return false, id, fmt.Errorf("unable to prepare user insert statement: %w", err)
+	}
 
-		err = reportStmt.GetContext(ctx, &id, r)
-		if err != nil {
-			if err, ok := err.(*pq.Error); ok {
-				if err.Code == pgExists {
-					return ErrExists{fmt.Errorf("report unique violation: %s, %s, %s, %d", r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID)}
-				}
-				if err.Code == pgFKeyViolation {
-					return ErrFKeyViolation{fmt.Errorf("report fk violation %s", err.Constraint)}
-				}
+	err = reportStmt.GetContext(ctx, &id, r)
+	if err != nil {
+		if err, ok := err.(*pq.Error); ok {
+			if err.Code == pgExists {
+				return false, id, ErrExists{fmt.Errorf("report unique violation: %s, %s, %s, %d", r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID)}
+			}
+			if err.Code == pgFKeyViolation {
+				return false, id, ErrFKeyViolation{fmt.Errorf("report fk violation %s", err.Constraint)}
 			}
-			return fmt.Errorf("unable to upsert report: %w", err)
 		}
+		return false, id, fmt.Errorf("unable to upsert report: %w", err)
+	}
 
-		return nil
-	})
+	s.eventChangedTx(tx, r.EventKey)
 
-	return !existed, id, err
+	return !existed, id, nil
 }
 
 // ErrConflictingReport is returned when an existing report conflicts with the report we're trying
@@ -158,7 +162,13 @@ func (err ErrConflictingReport) Error() string {
 }
 
 // UpdateReportTx updates an existing report in the db
-func (s *Service) UpdateReportTx(ctx context.Context, tx *sqlx.Tx, r Report, replace bool) error {
+func (s *Service) UpdateReportTx(ctx context.Context, tx *Tx, r Report, replace bool) error {
+	var oldEventKey string
+	if err := tx.GetContext(ctx, &oldEventKey, "SELECT event_key FROM reports WHERE id = $1", r.ID); err == nil {
+		s.eventChangedTx(tx, oldEventKey)
+	}
+	s.eventChangedTx(tx, r.EventKey)
+
 	var id int64
 	err := tx.GetContext(ctx, &id, `
 		SELECT id
@@ -167,7 +177,8 @@ func (s *Service) UpdateReportTx(ctx context.Context, tx *sqlx.Tx, r Report, rep
 			event_key = $1 AND
 			match_key = $2 AND
 			team_key = $3 AND
-			reporter_id = $4`, r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID)
+			reporter_id = $4 AND
+			id != $5`, r.EventKey, r.MatchKey, r.TeamKey, r.ReporterID, r.ID)
 	if err != nil && err != sql.ErrNoRows {
 		return fmt.Errorf("unable to check if report exists: %w", err)
 	} else if err == nil && !replace {
@@ -214,21 +225,11 @@ func (s *Service) GetReports(ctx context.Context, eventKey *string, matchKey *st
 	var query = `
 	SELECT reports.*
 	FROM reports
-	LEFT JOIN realms
-		ON realms.id = reports.realm_id
 	WHERE
-	`
+	` + reportVisible("$1")
 
-	var parameters []interface{}
-	filters := 1
-
-	if realmID != nil {
-		query += `(reports.realm_id IS NULL OR realms.share_reports = true OR realms.id = $1)`
-		filters++
-		parameters = append(parameters, *realmID)
-	} else {
-		query += `(reports.realm_id IS NULL OR realms.share_reports = true)`
-	}
+	parameters := []interface{}{realmID}
+	filters := 2
 
 	if eventKey != nil {
 		query += fmt.Sprintf(` AND reports.event_key = $%d`, filters)
@@ -260,29 +261,27 @@ func (s *Service) GetReports(ctx context.Context, eventKey *string, matchKey *st
 
 // GetEventReportsForRealm returns all event reports for a specific event and realm.
 func (s *Service) GetEventReportsForRealm(ctx context.Context, eventKey string, realmID *int64) ([]Report, error) {
-	const query = `
+	query := `
 	SELECT reports.*
 	FROM reports
-	INNER JOIN realms
-		ON realms.id = reports.realm_id AND
-		(realms.share_reports = true OR realms.id = $2)
 	WHERE
+		reports.realm_id IS NOT NULL AND
+		` + reportVisible("$2") + ` AND
 		reports.event_key = $1`
 
 	reports := []Report{}
 	return reports, s.db.SelectContext(ctx, &reports, query, eventKey, realmID)
 }
 
-// GetEventTeamReportsForRealm retrieves all reports for a specific team and event, filtering to only retrieve reports for realms
-// that are sharing reports or have a matching realm ID.
+// GetEventTeamReportsForRealm retrieves all reports for a specific team and event, filtering to only retrieve reports from realms
+// that are visible to the given realm.
 func (s *Service) GetEventTeamReportsForRealm(ctx context.Context, eventKey string, teamKey string, realmID *int64) (reports []Report, err error) {
-	const query = `
+	query := `
 	SELECT reports.*
 	FROM reports
-	INNER JOIN realms
-		ON realms.id = reports.realm_id AND
-		(realms.share_reports = true OR realms.id = $3)
 	WHERE
+		reports.realm_id IS NOT NULL AND
+		` + reportVisible("$3") + ` AND
 		reports.event_key = $1 AND
 		reports.team_key = $2`
 
@@ -290,16 +289,15 @@ func (s *Service) GetEventTeamReportsForRealm(ctx context.Context, eventKey stri
 	return reports, s.db.SelectContext(ctx, &reports, query, eventKey, teamKey, realmID)
 }
 
-// GetMatchTeamReportsForRealm retrieves all reports for a specific match, team, and event, filtering to only retrieve reports for realms
-// that are sharing reports or have a matching realm ID.
+// GetMatchTeamReportsForRealm retrieves all reports for a specific match, team, and event, filtering to only retrieve reports from realms
+// that are visible to the given realm.
 func (s *Service) GetMatchTeamReportsForRealm(ctx context.Context, eventKey, matchKey string, teamKey string, realmID *int64) (reports []Report, err error) {
-	const query = `
+	query := `
 	SELECT reports.*
 	FROM reports
-	INNER JOIN realms
-		ON realms.id = reports.realm_id AND
-		(realms.share_reports = true OR realms.id = $4)
 	WHERE
+		reports.realm_id IS NOT NULL AND
+		` + reportVisible("$4") + ` AND
 		reports.event_key = $1 AND
 		reports.match_key = $2 AND
 		reports.team_key = $3`
@@ -309,18 +307,23 @@ func (s *Service) GetMatchTeamReportsForRealm(ctx context.Context, eventKey, mat
 }
 
 // DeleteReportTx deletes specified report from the database using the given transaction.
-func (s *Service) DeleteReportTx(ctx context.Context, tx *sqlx.Tx, id int64) error {
-	_, err := tx.ExecContext(ctx, "DELETE FROM reports WHERE id = $1", id)
-	if err != nil {
+func (s *Service) DeleteReportTx(ctx context.Context, tx *Tx, id int64) error {
+	var eventKey string
+	err := tx.GetContext(ctx, &eventKey, "DELETE FROM reports WHERE id = $1 RETURNING event_key", id)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
 		return fmt.Errorf("unable to delete report: %w", err)
 	}
 
+	s.eventChangedTx(tx, eventKey)
+
 	return nil
 }
 
 // GetLeaderboardForRealm retrieves leaderboard information from the reports and users table for users
-// in the given realm. Specify year to filter for reports for events in the given year. Leave unspecified
-// for all years.
+// and members of the given realm, counting the reports they submitted for the realm. Specify year to
+// filter for reports for events in the given year. Leave unspecified for all years.
 func (s *Service) GetLeaderboardForRealm(ctx context.Context, realmID int64, year *int) (Leaderboard, error) {
 	leaderboard := make(Leaderboard, 0)
 
@@ -329,11 +332,11 @@ func (s *Service) GetLeaderboardForRealm(ctx context.Context, realmID int64, yea
 		users.id AS reporter_id, COUNT(reports.reporter_id) AS num_reports
 	FROM users
 	LEFT JOIN reports
-		ON (users.id = reports.reporter_id)
+		ON (users.id = reports.reporter_id AND reports.realm_id = $1)
 	LEFT JOIN events
 		ON (reports.event_key = events.key)
 	WHERE
-		users.realm_id = $1 AND
+		(users.realm_id = $1 OR users.id IN (SELECT user_id FROM memberships WHERE realm_id = $1)) AND
 		(EXTRACT(YEAR FROM events.start_date) = $2 OR $2 IS NULL)
 	GROUP BY users.id
 	ORDER BY num_reports DESC;
@@ -9,7 +9,6 @@ import (
 
 	"errors"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
@@ -66,24 +65,37 @@ func (sd *SchemaFields) Scan(src interface{}) error {
 
 // CreateSchema creates a new schema
 func (s *Service) CreateSchema(ctx context.Context, schema Schema) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
-		_, err := tx.NamedExecContext(ctx, `
-		INSERT
-			INTO
-				schemas (year, realm_id, schema)
-			VALUES (:year, :realm_id, :schema)
-		`, schema)
-
-		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == pgExists {
-			return &ErrExists{fmt.Errorf("schema already exists: %v", err.Error())}
-		} else if err != nil {
-			return fmt.Errorf("unable to insert schema: %w", err)
-		}
-
-		return nil
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		_, err := s.CreateSchemaTx(ctx, tx, schema)
+		return err
 	})
 }
 
+// CreateSchemaTx creates a new schema using the given transaction, returning
+// its ID.
+func (s *Service) CreateSchemaTx(ctx context.Context, tx *Tx, schema Schema) (int64, error) {
+	stmt, err := tx.PrepareNamedContext(ctx, `
+	INSERT
+		INTO
+			schemas (year, realm_id, schema)
+		VALUES (:year, :realm_id, :schema)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare schema insert statement: %w", err)
+	}
+
+	var id int64
+	err = stmt.GetContext(ctx, &id, schema)
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == pgExists {
+		return 0, &ErrExists{fmt.Errorf("schema already exists: %v", err.Error())}
+	} else if err != nil {
+		return 0, fmt.Errorf("unable to insert schema: %w", err)
+	}
+
+	return id, nil
+}
+
 // GetSchemaByID retrieves a schema given its ID
 func (s *Service) GetSchemaByID(ctx context.Context, id int64) (Schema, error) {
 	var schema Schema
@@ -113,7 +125,7 @@ func (s *Service) GetSchemaByYear(ctx context.Context, year int) (Schema, error)
 }
 
 // GetSchemasForRealm retrieves schemas from the database frm a specific realm,
-// from realms with public events, and standard FRC schemas. If the realm ID is
+// from realms sharing with it, and standard FRC schemas. If the realm ID is
 // nil, no private realms' schemas will be retrieved.
 func (s *Service) GetSchemasForRealm(ctx context.Context, realmID *int64) ([]Schema, error) {
 	schemas := []Schema{}
@@ -121,12 +133,9 @@ func (s *Service) GetSchemasForRealm(ctx context.Context, realmID *int64) ([]Sch
 	err := s.db.SelectContext(ctx, &schemas, `
 	SELECT schemas.*
 	FROM schemas
-	LEFT JOIN realms
-		ON realms.id = schemas.realm_id
 	WHERE
 		schemas.year IS NULL OR
-		realms.id = NULL OR
-		(realms.share_reports = true OR realms.id = $1)
+		(schemas.realm_id IS NOT NULL AND `+visibleToRealm("schemas.realm_id", "NULL", "schemas.year", "$1")+`)
 	`, realmID)
 	if err != nil {
 		return schemas, fmt.Errorf("unable to retrieve schemas: %w", err)
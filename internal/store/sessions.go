@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Session is a login on a device. Every refresh token belongs to a session,
+// and each use of a refresh token replaces it with a new one, so only the
+// latest token ID of a session is valid.
+type Session struct {
+	ID         int64     `json:"id" db:"id"`
+	UserID     int64     `json:"userId" db:"user_id"`
+	TokenID    string    `json:"-" db:"token_id"`
+	DeviceName string    `json:"deviceName" db:"device_name"`
+	IPAddress  string    `json:"ipAddress" db:"ip_address"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	LastUsedAt time.Time `json:"lastUsedAt" db:"last_used_at"`
+	ExpiresAt  time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// CreateSession inserts a session, returning its ID. Expired sessions of the
+// same user are cleaned up, and the user is marked active.
+func (s *Service) CreateSession(ctx context.Context, session Session) (id int64, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1 AND expires_at <= $2", session.UserID, session.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("unable to delete expired sessions: %w", err)
+		}
+
+		stmt, err := tx.PrepareNamedContext(ctx, `
+		INSERT
+			INTO
+				sessions (user_id, token_id, device_name, ip_address, created_at, last_used_at, expires_at)
+			VALUES (:user_id, :token_id, :device_name, :ip_address, :created_at, :last_used_at, :expires_at)
+			RETURNING id
+		`)
+		if err != nil {
+			return fmt.Errorf("unable to prepare session insert statement: %w", err)
+		}
+
+		err = stmt.GetContext(ctx, &id, session)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgFKeyViolation {
+			return ErrFKeyViolation{fmt.Errorf("session fk violation on user ID %d: %w", session.UserID, err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to insert session: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET last_active_at = $2 WHERE id = $1", session.UserID, session.CreatedAt); err != nil {
+			return fmt.Errorf("unable to mark user active: %w", err)
+		}
+
+		return nil
+	})
+
+	return id, err
+}
+
+// GetSessions retrieves the unexpired sessions of a user.
+func (s *Service) GetSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error) {
+	sessions := []Session{}
+
+	err := s.db.SelectContext(ctx, &sessions, `
+	SELECT *
+	FROM sessions
+	WHERE user_id = $1 AND expires_at > $2
+	ORDER BY id
+	`, userID, now)
+	if err != nil {
+		return sessions, fmt.Errorf("unable to select sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RotateSession replaces the token ID, last use, IP address, and expiry of a
+// session if its current token ID is oldTokenID. If the session has a
+// different token ID, an old refresh token has been reused, so the session is
+// deleted and rotated is false. The user is marked active if the session is
+// rotated. ErrNoResults is returned if the session doesn't exist or has
+// expired.
+func (s *Service) RotateSession(ctx context.Context, session Session, oldTokenID string) (rotated bool, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		var tokenID string
+		err := tx.GetContext(ctx, &tokenID, `
+		SELECT token_id
+		FROM sessions
+		WHERE id = $1 AND user_id = $2 AND expires_at > $3
+		FOR UPDATE
+		`, session.ID, session.UserID, session.LastUsedAt)
+		if err == sql.ErrNoRows {
+			return ErrNoResults{fmt.Errorf("session %d does not exist: %w", session.ID, err)}
+		} else if err != nil {
+			return fmt.Errorf("unable to lock session: %w", err)
+		}
+
+		if tokenID != oldTokenID {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = $1", session.ID); err != nil {
+				return fmt.Errorf("unable to delete reused session: %w", err)
+			}
+
+			return nil
+		}
+
+		_, err = tx.NamedExecContext(ctx, `
+		UPDATE sessions
+			SET
+				token_id = :token_id,
+				ip_address = :ip_address,
+				last_used_at = :last_used_at,
+				expires_at = :expires_at
+			WHERE id = :id
+		`, session)
+		if err != nil {
+			return fmt.Errorf("unable to update session: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET last_active_at = $2 WHERE id = $1", session.UserID, session.LastUsedAt); err != nil {
+			return fmt.Errorf("unable to mark user active: %w", err)
+		}
+
+		rotated = true
+		return nil
+	})
+
+	return rotated, err
+}
+
+// DeleteSession revokes a session of a user.
+func (s *Service) DeleteSession(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("unable to delete session: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to get rows affected deleting session: %w", err)
+	} else if n == 0 {
+		return ErrNoResults{fmt.Errorf("session %d of user %d does not exist", id, userID)}
+	}
+
+	return nil
+}
+
+// DeleteSessions revokes every session of a user.
+func (s *Service) DeleteSessions(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("unable to delete sessions: %w", err)
+	}
+
+	return nil
+}
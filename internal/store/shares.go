@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RealmShare shares the reports of a realm with a partner realm. A share with
+// an event key covers only that event, one with only a year covers every
+// event that year, and one with neither covers everything. The partner realm
+// has to accept a share before it takes effect, and either realm can revoke
+// it by deleting it.
+type RealmShare struct {
+	ID             int64      `json:"id" db:"id"`
+	RealmID        int64      `json:"realmId" db:"realm_id"`
+	PartnerRealmID int64      `json:"partnerRealmId" db:"partner_realm_id" validate:"required"`
+	EventKey       *string    `json:"eventKey,omitempty" db:"event_key"`
+	Year           *int       `json:"year,omitempty" db:"year" validate:"omitempty,gte=1992"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty" db:"accepted_at"`
+}
+
+// visibleToRealm returns an SQL condition for whether data owned by the realm
+// in realmColumn is visible to the realm in the viewer parameter. Data with no
+// realm is visible to everyone, as is data of realms sharing reports publicly,
+// and accepted shares make data visible to the partner realm. eventColumn and
+// yearColumn scope the data, and eventColumn may be NULL for data that isn't
+// tied to an event, which any share for its year covers.
+//
+// This is the only place realm visibility is decided for queries, the Memory
+// store mirrors it with memoryData.visibleToRealm.
+func visibleToRealm(realmColumn, eventColumn, yearColumn, viewer string) string {
+	return fmt.Sprintf(`(
+		%[1]s IS NULL OR
+		%[1]s = %[4]s OR
+		EXISTS (SELECT 1 FROM realms WHERE realms.id = %[1]s AND realms.share_reports = true) OR
+		EXISTS (
+			SELECT 1
+			FROM realm_shares
+			WHERE
+				realm_shares.realm_id = %[1]s AND
+				realm_shares.partner_realm_id = %[4]s AND
+				realm_shares.accepted_at IS NOT NULL AND
+				(realm_shares.event_key IS NULL OR %[2]s IS NULL OR realm_shares.event_key = %[2]s) AND
+				(realm_shares.year IS NULL OR realm_shares.year = %[3]s)
+		)
+	)`, realmColumn, eventColumn, yearColumn, viewer)
+}
+
+// reportVisible is the visibleToRealm condition for reports, with the viewing
+// realm in the given parameter.
+func reportVisible(viewer string) string {
+	return visibleToRealm(
+		"reports.realm_id",
+		"reports.event_key",
+		"(SELECT EXTRACT(YEAR FROM events.start_date) FROM events WHERE events.key = reports.event_key)",
+		viewer,
+	)
+}
+
+// GetRealmShares retrieves the shares a realm has offered to other realms and
+// the shares other realms have offered to it.
+func (s *Service) GetRealmShares(ctx context.Context, realmID int64) ([]RealmShare, error) {
+	shares := []RealmShare{}
+
+	err := s.db.SelectContext(ctx, &shares, `
+	SELECT *
+	FROM realm_shares
+	WHERE realm_id = $1 OR partner_realm_id = $1
+	ORDER BY id
+	`, realmID)
+	if err != nil {
+		return shares, fmt.Errorf("unable to select realm shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+// GetRealmShare retrieves a specific realm share.
+func (s *Service) GetRealmShare(ctx context.Context, id int64) (RealmShare, error) {
+	var share RealmShare
+
+	err := s.db.GetContext(ctx, &share, "SELECT * FROM realm_shares WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return share, ErrNoResults{fmt.Errorf("realm share %d does not exist: %w", id, err)}
+	} else if err != nil {
+		return share, fmt.Errorf("unable to get realm share: %w", err)
+	}
+
+	return share, nil
+}
+
+// InsertRealmShare offers a new share to a partner realm, returning its ID.
+// ErrExists is returned if the realms already have a share with the same
+// scope, and ErrFKeyViolation if either realm or the event doesn't exist.
+func (s *Service) InsertRealmShare(ctx context.Context, share RealmShare) (int64, error) {
+	var id int64
+
+	stmt, err := s.db.PrepareNamedContext(ctx, `
+	INSERT
+		INTO
+			realm_shares (realm_id, partner_realm_id, event_key, year, created_at)
+		VALUES (:realm_id, :partner_realm_id, :event_key, :year, :created_at)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare realm share insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.GetContext(ctx, &id, share)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgExists {
+		return 0, ErrExists{fmt.Errorf("realm %d already shares with realm %d: %w", share.RealmID, share.PartnerRealmID, err)}
+	} else if ok && pqErr.Code == pgFKeyViolation {
+		return 0, ErrFKeyViolation{fmt.Errorf("realm share fk violation: %w", err)}
+	} else if err != nil {
+		return 0, fmt.Errorf("unable to insert realm share: %w", err)
+	}
+
+	return id, nil
+}
+
+// AcceptRealmShare accepts a realm share on behalf of the partner realm.
+// Accepting a share that's already accepted keeps the original time.
+func (s *Service) AcceptRealmShare(ctx context.Context, id int64, acceptedAt time.Time) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE realm_shares SET accepted_at = COALESCE(accepted_at, $2) WHERE id = $1", id, acceptedAt)
+		if err != nil {
+			return fmt.Errorf("unable to accept realm share: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("unable to get rows affected accepting realm share: %w", err)
+		} else if n == 0 {
+			return ErrNoResults{fmt.Errorf("realm share %d does not exist", id)}
+		}
+
+		// the partner realm now sees the sharing realm's reports, and a share
+		// can cover a whole year, so every event's stats may have changed
+		s.eventChangedTx(tx, "")
+
+		return nil
+	})
+}
+
+// DeleteRealmShare revokes or declines a realm share.
+func (s *Service) DeleteRealmShare(ctx context.Context, id int64) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM realm_shares WHERE id = $1", id)
+		if err != nil {
+			return fmt.Errorf("unable to delete realm share: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("unable to get rows affected deleting realm share: %w", err)
+		} else if n == 0 {
+			return ErrNoResults{fmt.Errorf("realm share %d does not exist", id)}
+		}
+
+		s.eventChangedTx(tx, "")
+
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SigningKey is a private key that tokens are signed with. The newest key
+// that hasn't been retired signs new tokens, retired keys only verify tokens
+// they signed before they were retired.
+type SigningKey struct {
+	ID        string `db:"id"`
+	Algorithm string `db:"algorithm"`
+	// PrivateKey is the PKCS #8 DER encoded private key.
+	PrivateKey []byte     `db:"private_key"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RetiredAt  *time.Time `db:"retired_at"`
+}
+
+// GetSigningKeys retrieves every signing key, oldest first.
+func (s *Service) GetSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	keys := []SigningKey{}
+
+	err := s.db.SelectContext(ctx, &keys, "SELECT * FROM signing_keys ORDER BY created_at, id")
+	if err != nil {
+		return keys, fmt.Errorf("unable to select signing keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RotateSigningKey inserts a key and retires every other key at the time the
+// key was created, unless a key that hasn't been retired was created after
+// rotateBefore. That means another server already rotated the key, so nothing
+// changes and rotated is false.
+func (s *Service) RotateSigningKey(ctx context.Context, key SigningKey, rotateBefore time.Time) (rotated bool, err error) {
+	err = s.DoTransaction(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE signing_keys IN EXCLUSIVE MODE"); err != nil {
+			return fmt.Errorf("unable to lock signing keys: %w", err)
+		}
+
+		var newer bool
+		err := tx.GetContext(ctx, &newer, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM signing_keys
+			WHERE retired_at IS NULL AND created_at > $1
+		)
+		`, rotateBefore)
+		if err != nil {
+			return fmt.Errorf("unable to check for newer signing keys: %w", err)
+		} else if newer {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE signing_keys SET retired_at = $1 WHERE retired_at IS NULL", key.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("unable to retire signing keys: %w", err)
+		}
+
+		_, err = tx.NamedExecContext(ctx, `
+		INSERT
+			INTO
+				signing_keys (id, algorithm, private_key, created_at)
+			VALUES (:id, :algorithm, :private_key, :created_at)
+		`, key)
+		if err != nil {
+			return fmt.Errorf("unable to insert signing key: %w", err)
+		}
+
+		rotated = true
+		return nil
+	})
+
+	return rotated, err
+}
+
+// DeleteSigningKeys deletes the keys that were retired before retiredBefore,
+// once no token they signed can still be valid.
+func (s *Service) DeleteSigningKeys(ctx context.Context, retiredBefore time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM signing_keys WHERE retired_at < $1", retiredBefore)
+	if err != nil {
+		return fmt.Errorf("unable to delete signing keys: %w", err)
+	}
+
+	return nil
+}
@@ -2,13 +2,17 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sync"
 
 	"errors"
 
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // Register lib/pq PostreSQL driver
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrNoResults indicates that no data matching the query was found.
@@ -49,21 +53,38 @@ const (
 	pgFKeyViolation = "23503"
 )
 
+// Tx is a transaction started by DoTransaction. It is only valid within the
+// function passed to DoTransaction. Stores that are not backed by SQL leave the
+// embedded transaction nil.
+type Tx struct {
+	*sqlx.Tx
+	// span is the span of the transaction, which statements run with the
+	// transaction are traced as children of.
+	span trace.Span
+}
+
 // Service provides methods for storing data in a PostgreSQL database.
 type Service struct {
 	db     *sqlx.DB
 	logger *logrus.Logger
+
+	mu        sync.Mutex
+	listeners []func(eventKey string)
+	pending   map[*Tx][]string
 }
 
 // New creates a new store service from a dataSourceName. The logger is used to
 // log errors that would not otherwise be returned such as issues rolling back
-// transactions. The context passed is used for pinging the database.
+// transactions. The context passed is used for pinging the database. Queries
+// are traced with spans that are children of the span in their context.
 func New(ctx context.Context, dsn string, logger *logrus.Logger) (*Service, error) {
-	db, err := sqlx.Open("postgres", dsn)
+	connector, err := pq.NewConnector(dsn)
 	if err != nil {
 		return nil, err
 	}
 
+	db := sqlx.NewDb(sql.OpenDB(tracedConnector{connector}), "postgres")
+
 	s := &Service{db: db, logger: logger}
 	return s, s.Ping(ctx)
 }
@@ -78,6 +99,12 @@ func (s *Service) Ping(ctx context.Context) error {
 	return errors.New("not connected to postgresql")
 }
 
+// Stats returns connection pool statistics for the underlying postgresql
+// database.
+func (s *Service) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
 // Close closes the underlying postgresql database.
 func (s *Service) Close() error {
 	if s.db != nil {
@@ -93,13 +120,72 @@ func (s *Service) logErr(err error) {
 	}
 }
 
+// OnEventChange registers a function to be called with an event key whenever
+// the reports or matches of that event change. It is called with an empty key
+// when a change may affect every event, such as a realm changing whether it
+// shares reports. Changes made in a transaction are only announced once the
+// transaction commits.
+func (s *Service) OnEventChange(f func(eventKey string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, f)
+}
+
+func (s *Service) eventChanged(eventKeys ...string) {
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	for _, eventKey := range eventKeys {
+		for _, f := range listeners {
+			f(eventKey)
+		}
+	}
+}
+
+// eventChangedTx queues an event change to be announced when the transaction
+// commits.
+func (s *Service) eventChangedTx(tx *Tx, eventKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		s.pending = make(map[*Tx][]string)
+	}
+
+	s.pending[tx] = append(s.pending[tx], eventKey)
+}
+
+// finishTx discards the queued event changes for a transaction, announcing them
+// if the transaction was committed.
+func (s *Service) finishTx(tx *Tx, committed bool) {
+	s.mu.Lock()
+	eventKeys := s.pending[tx]
+	delete(s.pending, tx)
+	s.mu.Unlock()
+
+	if committed {
+		s.eventChanged(eventKeys...)
+	}
+}
+
 // DoTransaction opens a SQL transaction and calls txWrapper with the transaction. If the txWrapper
 // return an error, the transaction will be rolled back.
-func (s *Service) DoTransaction(ctx context.Context, txWrapper func(*sqlx.Tx) error) error {
-	tx, err := s.db.BeginTxx(ctx, nil)
+func (s *Service) DoTransaction(ctx context.Context, txWrapper func(*Tx) error) (err error) {
+	ctx, span := tracing.Start(ctx, "store.DoTransaction")
+	defer func() { tracing.End(span, err) }()
+
+	sqlTx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("unable to begin transaction: %w", err)
 	}
+	tx := &Tx{Tx: sqlTx, span: span}
+
+	committed := false
+	defer func() {
+		s.finishTx(tx, committed)
+	}()
 
 	if err := txWrapper(tx); err != nil {
 		if rbErr := tx.Rollback(); rbErr != nil && ctx.Err() != context.Canceled {
@@ -113,5 +199,7 @@ func (s *Service) DoTransaction(ctx context.Context, txWrapper func(*sqlx.Tx) er
 		return fmt.Errorf("unable to commit transaction: %w", err)
 	}
 
+	committed = true
+
 	return nil
 }
@@ -3,23 +3,110 @@ package store
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
-
-	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 // EventTeam holds data about a single FRC team at a specific event.
 type EventTeam struct {
-	Key          string   `json:"team" db:"key"`
-	EventKey     string   `json:"-" db:"event_key"`
-	Rank         *int     `json:"rank,omitempty" db:"rank"`
-	RankingScore *float64 `json:"rankingScore,omitempty" db:"ranking_score"`
+	Key           string     `json:"team" db:"key"`
+	EventKey      string     `json:"-" db:"event_key"`
+	Rank          *int       `json:"rank,omitempty" db:"rank"`
+	RankingScore  *float64   `json:"rankingScore,omitempty" db:"ranking_score"`
+	SortOrders    SortOrders `json:"sortOrders,omitempty" db:"sort_orders"`
+	Record        *Record    `json:"record,omitempty" db:"record"`
+	DQ            *int       `json:"dq,omitempty" db:"dq"`
+	MatchesPlayed *int       `json:"matchesPlayed,omitempty" db:"matches_played"`
+	QualAverage   *float64   `json:"qualAverage,omitempty" db:"qual_average"`
+	ExtraStats    SortOrders `json:"extraStats,omitempty" db:"extra_stats"`
+}
+
+// SortOrder is a single named ranking value, such as a ranking score or a
+// tiebreaker.
+type SortOrder struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// SortOrders holds the named ranking values of a team at an event in the order
+// they are used for ranking.
+type SortOrders []SortOrder
+
+// Value implements driver.Valuer to return JSON for the DB from SortOrders.
+func (so SortOrders) Value() (driver.Value, error) {
+	if so == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(so)
+}
+
+// Scan implements sql.Scanner to scan JSON from the DB into SortOrders.
+func (so *SortOrders) Scan(src interface{}) error {
+	if src == nil {
+		*so = nil
+		return nil
+	}
+
+	j, ok := src.([]byte)
+	if !ok {
+		return errors.New("got invalid type for SortOrders")
+	}
+
+	return json.Unmarshal(j, so)
+}
+
+// Record holds the win-loss-tie record of a team at an event.
+type Record struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Ties   int `json:"ties"`
+}
+
+// Value implements driver.Valuer to return JSON for the DB from a Record.
+func (r Record) Value() (driver.Value, error) { return json.Marshal(r) }
+
+// Scan implements sql.Scanner to scan JSON from the DB into a Record.
+func (r *Record) Scan(src interface{}) error {
+	j, ok := src.([]byte)
+	if !ok {
+		return errors.New("got invalid type for Record")
+	}
+
+	return json.Unmarshal(j, r)
 }
 
 // Team holds non-event-specific team info.
 type Team struct {
-	Key      string `json:"key" db:"key"`
-	Nickname string `json:"nickname" db:"nickname"`
+	Key        string  `json:"key" db:"key"`
+	Nickname   string  `json:"nickname" db:"nickname"`
+	RookieYear *int    `json:"rookieYear,omitempty" db:"rookie_year"`
+	City       *string `json:"city,omitempty" db:"city"`
+	StateProv  *string `json:"stateProv,omitempty" db:"state_prov"`
+	Country    *string `json:"country,omitempty" db:"country"`
+	SchoolName *string `json:"schoolName,omitempty" db:"school_name"`
+	Website    *string `json:"website,omitempty" db:"website"`
+	Robots     []Robot `json:"robots,omitempty" db:"-"`
+}
+
+// Robot holds the name a team gave their robot in a specific year.
+type Robot struct {
+	TeamKey string `json:"-" db:"team_key"`
+	Year    int    `json:"year" db:"year"`
+	Name    string `json:"name" db:"name"`
+}
+
+// TeamEvent holds a team's ranking at an event along with general information
+// about the event.
+type TeamEvent struct {
+	EventTeam
+	EventName    string    `db:"event_name"`
+	EventRealmID *int64    `db:"event_realm_id"`
+	StartDate    time.Time `db:"start_date"`
+	SchemaID     *int64    `db:"schema_id"`
 }
 
 const allTeamsKeyUpsert = `
@@ -62,7 +149,8 @@ func (s *Service) GetEventTeamsForRealm(ctx context.Context, eventKey string, re
 		(events.realm_id IS NULL OR events.realm_id = $2)`, eventKey, realmID)
 }
 
-// GetTeam retrieves general team info for a specific team
+// GetTeam retrieves general team info for a specific team, including the names
+// of their robots.
 func (s *Service) GetTeam(ctx context.Context, teamKey string) (Team, error) {
 	var t Team
 	err := s.db.GetContext(ctx, &t, "SELECT * FROM all_teams WHERE key = $1", teamKey)
@@ -72,12 +160,69 @@ func (s *Service) GetTeam(ctx context.Context, teamKey string) (Team, error) {
 		return t, fmt.Errorf("unable to get team: %w", err)
 	}
 
+	t.Robots = make([]Robot, 0)
+	err = s.db.SelectContext(ctx, &t.Robots, "SELECT * FROM robots WHERE team_key = $1 ORDER BY year", teamKey)
+	if err != nil {
+		return t, fmt.Errorf("unable to get team robots: %w", err)
+	}
+
 	return t, nil
 }
 
+// GetTeamEventsForRealm retrieves every event a team attended with a null or
+// matching realm ID, along with the team's ranking at each event. Specify year
+// to only retrieve events from that year.
+func (s *Service) GetTeamEventsForRealm(ctx context.Context, teamKey string, realmID *int64, year *int) ([]TeamEvent, error) {
+	events := make([]TeamEvent, 0)
+
+	err := s.db.SelectContext(ctx, &events, `
+	SELECT
+		teams.*,
+		events.name AS event_name,
+		events.realm_id AS event_realm_id,
+		events.start_date,
+		COALESCE(events.schema_id, s.id) AS schema_id
+	FROM teams
+	INNER JOIN events
+		ON events.key = teams.event_key
+	LEFT JOIN schemas s
+		ON s.year = EXTRACT(YEAR FROM events.start_date)
+	WHERE
+		teams.key = $1 AND
+		(events.realm_id IS NULL OR events.realm_id = $2) AND
+		(EXTRACT(YEAR FROM events.start_date) = $3 OR $3 IS NULL) AND
+		NOT events.tba_deleted
+	ORDER BY events.start_date
+	`, teamKey, realmID, year)
+	if err != nil {
+		return events, fmt.Errorf("unable to get team events: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetYearTeamKeys retrieves the keys of every team attending an event in the
+// given year.
+func (s *Service) GetYearTeamKeys(ctx context.Context, year int) ([]string, error) {
+	keys := make([]string, 0)
+
+	err := s.db.SelectContext(ctx, &keys, `
+	SELECT DISTINCT teams.key
+	FROM teams
+	INNER JOIN events
+		ON events.key = teams.event_key
+	WHERE EXTRACT(YEAR FROM events.start_date) = $1
+	`, year)
+	if err != nil {
+		return keys, fmt.Errorf("unable to get team keys: %w", err)
+	}
+
+	return keys, nil
+}
+
 // EventTeamsUpsert upserts multiple teams for a specific event into the database.
 func (s *Service) EventTeamsUpsert(ctx context.Context, teams []EventTeam) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
 		allTeamsStmt, err := tx.PrepareNamedContext(ctx, allTeamsKeyUpsert)
 		if err != nil {
 			return fmt.Errorf("unable to prepare all_teams upsert statement: %w", err)
@@ -91,11 +236,19 @@ func (s *Service) EventTeamsUpsert(ctx context.Context, teams []EventTeam) error
 		}
 
 		stmt, err := tx.PrepareNamedContext(ctx, `
-		INSERT INTO teams (key, event_key, rank, ranking_score)
-		VALUES (:key, :event_key, :rank, :ranking_score)
+		INSERT INTO teams (key, event_key, rank, ranking_score, sort_orders, record, dq, matches_played, qual_average, extra_stats)
+		VALUES (:key, :event_key, :rank, :ranking_score, :sort_orders, :record, :dq, :matches_played, :qual_average, :extra_stats)
 		ON CONFLICT (key, event_key)
 			DO UPDATE
-				SET rank = $3, ranking_score = $4
+				SET
+					rank = :rank,
+					ranking_score = :ranking_score,
+					sort_orders = :sort_orders,
+					record = :record,
+					dq = :dq,
+					matches_played = :matches_played,
+					qual_average = :qual_average,
+					extra_stats = :extra_stats
 		`)
 		if err != nil {
 			return fmt.Errorf("unable to prepare teams upsert statement: %w", err)
@@ -114,14 +267,21 @@ func (s *Service) EventTeamsUpsert(ctx context.Context, teams []EventTeam) error
 
 // TeamsUpsert upserts multiple teams into the database.
 func (s *Service) TeamsUpsert(ctx context.Context, teams []Team) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
 		stmt, err := tx.PrepareNamedContext(ctx, `
-		INSERT INTO all_teams (key, nickname)
-		VALUES (:key, :nickname)
+		INSERT INTO all_teams (key, nickname, rookie_year, city, state_prov, country, school_name, website)
+		VALUES (:key, :nickname, :rookie_year, :city, :state_prov, :country, :school_name, :website)
 		ON CONFLICT (key)
 		DO
 			UPDATE
-				SET nickname = $2
+				SET
+					nickname = :nickname,
+					rookie_year = :rookie_year,
+					city = :city,
+					state_prov = :state_prov,
+					country = :country,
+					school_name = :school_name,
+					website = :website
 		`)
 		if err != nil {
 			return fmt.Errorf("unable to prepare all_teams upsert statement: %w", err)
@@ -137,8 +297,33 @@ func (s *Service) TeamsUpsert(ctx context.Context, teams []Team) error {
 	})
 }
 
+// RobotsUpsert upserts the robot names of multiple teams into the database.
+func (s *Service) RobotsUpsert(ctx context.Context, robots []Robot) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		stmt, err := tx.PrepareNamedContext(ctx, `
+		INSERT INTO robots (team_key, year, name)
+		VALUES (:team_key, :year, :name)
+		ON CONFLICT (team_key, year)
+		DO
+			UPDATE
+				SET name = :name
+		`)
+		if err != nil {
+			return fmt.Errorf("unable to prepare robots upsert statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, robot := range robots {
+			if _, err = stmt.ExecContext(ctx, robot); err != nil {
+				return fmt.Errorf("unable to upsert robot for team %q: %w", robot.TeamKey, err)
+			}
+		}
+		return nil
+	})
+}
+
 // EventTeamKeysUpsertTx upserts multiple team keys from a single event into the database in the given transaction.
-func (s *Service) EventTeamKeysUpsertTx(ctx context.Context, tx *sqlx.Tx, eventKey string, keys []string) error {
+func (s *Service) EventTeamKeysUpsertTx(ctx context.Context, tx *Tx, eventKey string, keys []string) error {
 	allTeamsStmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO all_teams (key)
 		VALUES ($1)
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanContext returns ctx with the span of the transaction, so statements run
+// with the transaction are traced as its children rather than as children of
+// whatever span the caller's context has.
+func (tx *Tx) spanContext(ctx context.Context) context.Context {
+	if tx.span == nil {
+		return ctx
+	}
+
+	return trace.ContextWithSpan(ctx, tx.span)
+}
+
+// ExecContext executes a query in the transaction.
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(tx.spanContext(ctx), query, args...)
+}
+
+// QueryContext runs a query in the transaction.
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(tx.spanContext(ctx), query, args...)
+}
+
+// QueryRowContext runs a query that returns at most one row in the transaction.
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(tx.spanContext(ctx), query, args...)
+}
+
+// GetContext scans a single row from a query in the transaction into dest.
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.GetContext(tx.spanContext(ctx), dest, query, args...)
+}
+
+// SelectContext scans the rows from a query in the transaction into dest.
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.SelectContext(tx.spanContext(ctx), dest, query, args...)
+}
+
+// NamedExecContext executes a query with named parameters in the transaction.
+func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return tx.Tx.NamedExecContext(tx.spanContext(ctx), query, arg)
+}
+
+// tracedConnector opens connections that start a span for every query and
+// exec. Statements run through prepared statements are not traced one by one,
+// since upserts run them thousands of times; they are covered by the span of
+// their transaction instead.
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tracedConn{conn}, nil
+}
+
+type tracedConn struct {
+	driver.Conn
+}
+
+func startQuery(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgres, semconv.DBStatementKey.String(query)),
+	)
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuery(ctx, "db.query", query)
+	defer func() { tracing.End(span, err) }()
+
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuery(ctx, "db.exec", query)
+	defer func() { tracing.End(span, err) }()
+
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+
+	return c.Conn.Prepare(query)
+}
+
+func (c tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	return c.Conn.Begin()
+}
+
+func (c tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
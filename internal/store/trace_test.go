@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTxSpanContext(t *testing.T) {
+	tracer := oteltest.NewTracerProvider().Tracer("test")
+
+	ctx, callerSpan := tracer.Start(context.Background(), "caller")
+	_, txSpan := tracer.Start(ctx, "store.DoTransaction")
+
+	tx := &Tx{span: txSpan}
+	if span := trace.SpanFromContext(tx.spanContext(ctx)); span != txSpan {
+		t.Errorf("expected statements to be children of the transaction span, got %v", span)
+	}
+
+	if span := trace.SpanFromContext((&Tx{}).spanContext(ctx)); span != callerSpan {
+		t.Errorf("expected context to be unchanged without a transaction span, got %v", span)
+	}
+}
@@ -3,40 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
-	"database/sql/driver"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
-// Roles holds information about a users roles and permissions such as whether
-// they are an administrator.
-type Roles struct {
-	IsSuperAdmin bool `json:"isSuperAdmin" yaml:"isSuperAdmin"`
-	IsAdmin      bool `json:"isAdmin" yaml:"isAdmin"`
-	IsVerified   bool `json:"isVerified" yaml:"isVerified"`
-}
-
-// Value is provided for returning the value of Roles as marshalled JSON for
-// PostgreSQL's JSONB type.
-func (r Roles) Value() (driver.Value, error) {
-	return json.Marshal(r)
-}
-
-// Scan is provided for scanning data from PostgreSQL's JSONB type into Roles.
-func (r *Roles) Scan(src interface{}) error {
-	bytes, ok := src.([]byte)
-	if !ok {
-		return errors.New("got incorrect type for jsonb")
-	}
-
-	return json.Unmarshal(bytes, r)
-}
-
 // User holds information about a user such as their id, username, and hashed
 // password.
 type User struct {
@@ -47,10 +20,29 @@ type User struct {
 	RealmID         int64          `json:"realmId" db:"realm_id"`
 	FirstName       string         `json:"firstName" db:"first_name"`
 	LastName        string         `json:"lastName" db:"last_name"`
-	Roles           Roles          `json:"roles" db:"roles"`
+	Email           string         `json:"email,omitempty" db:"email"`
+	Role            Role           `json:"role" db:"role"`
+	Permissions     Permissions    `json:"permissions" db:"permissions"`
+	FailedLogins    int            `json:"-" db:"failed_logins"`
+	LockedUntil     *time.Time     `json:"lockedUntil,omitempty" db:"locked_until"`
+	PendingSince    *time.Time     `json:"pendingSince,omitempty" db:"pending_since"`
+	RejectedAt      *time.Time     `json:"rejectedAt,omitempty" db:"rejected_at"`
+	RejectionReason string         `json:"rejectionReason,omitempty" db:"rejection_reason"`
+	LastActiveAt    time.Time      `json:"lastActiveAt" db:"last_active_at"`
 	Stars           pq.StringArray `json:"stars" db:"stars"`
 }
 
+// Pending returns whether the user signed themselves up and is still waiting
+// for an admin of their realm to approve them.
+func (u User) Pending() bool {
+	return u.PendingSince != nil
+}
+
+// Locked returns whether the user is locked out of logging in as of now.
+func (u User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
 // PatchUser is like User but with all nullable fields (besides id and realmID) for patching.
 type PatchUser struct {
 	ID              int64          `json:"id" db:"id"`
@@ -59,7 +51,9 @@ type PatchUser struct {
 	PasswordChanged *time.Time     `json:"-" db:"password_changed"`
 	FirstName       *string        `json:"firstName" db:"first_name"`
 	LastName        *string        `json:"lastName" db:"last_name"`
-	Roles           *Roles         `json:"roles" db:"roles"`
+	Email           *string        `json:"email" db:"email"`
+	Role            *Role          `json:"role" db:"role"`
+	Permissions     Permissions    `json:"permissions" db:"permissions"`
 	Stars           pq.StringArray `json:"stars"`
 }
 
@@ -78,51 +72,73 @@ func (s *Service) GetUserByUsername(ctx context.Context, username string) (User,
 	return u, nil
 }
 
+// GetUsersByEmail retrieves the users with an email address, ignoring case. It
+// does not retrieve the users stars.
+func (s *Service) GetUsersByEmail(ctx context.Context, email string) ([]User, error) {
+	users := []User{}
+
+	err := s.db.SelectContext(ctx, &users, "SELECT * FROM users WHERE lower(email) = lower($1) ORDER BY id", email)
+	if err != nil {
+		return users, fmt.Errorf("unable to select users: %w", err)
+	}
+
+	return users, nil
+}
+
 // CreateUser creates a given user.
 func (s *Service) CreateUser(ctx context.Context, u User) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
-		u.PasswordChanged = time.Now()
-
-		userStmt, err := tx.PrepareNamedContext(ctx, `
-		INSERT
-			INTO
-				users (username, hashed_password, password_changed, realm_id, first_name, last_name, roles)
-			VALUES (:username, :hashed_password, :password_changed, :realm_id, :first_name, :last_name, :roles)
-			RETURNING id
-		`)
-		if err != nil {
-			return fmt.Errorf("unable to prepare user insert statement: %w", err)
-		}
+	return s.DoTransaction(ctx, func(tx *Tx) error {
+		_, err := s.CreateUserTx(ctx, tx, u)
+		return err
+	})
+}
 
-		err = userStmt.GetContext(ctx, &u.ID, u)
-		if err != nil {
-			if err, ok := err.(*pq.Error); ok {
-				if err.Code == pgExists {
-					return ErrExists{fmt.Errorf("username %q already exists: %w", u.Username, err)}
-				}
-				if err.Code == pgFKeyViolation {
-					return ErrFKeyViolation{fmt.Errorf("user fk violation on realm ID %d: %w", u.RealmID, err)}
-				}
+// CreateUserTx creates a given user using the given transaction, returning
+// their ID.
+func (s *Service) CreateUserTx(ctx context.Context, tx *Tx, u User) (int64, error) {
+	u.PasswordChanged = time.Now()
+	u.LastActiveAt = u.PasswordChanged
+	u.Role, u.Permissions = defaultRole(u.Role, u.Permissions)
+
+	userStmt, err := tx.PrepareNamedContext(ctx, `
+	INSERT
+		INTO
+			users (username, hashed_password, password_changed, realm_id, first_name, last_name, email, role, permissions, pending_since, last_active_at)
+		VALUES (:username, :hashed_password, :password_changed, :realm_id, :first_name, :last_name, :email, :role, :permissions, :pending_since, :last_active_at)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare user insert statement: %w", err)
+	}
+
+	err = userStmt.GetContext(ctx, &u.ID, u)
+	if err != nil {
+		if err, ok := err.(*pq.Error); ok {
+			if err.Code == pgExists {
+				return 0, ErrExists{fmt.Errorf("username %q already exists: %w", u.Username, err)}
+			}
+			if err.Code == pgFKeyViolation {
+				return 0, ErrFKeyViolation{fmt.Errorf("user fk violation on realm ID %d: %w", u.RealmID, err)}
 			}
-			return fmt.Errorf("unable to insert user: %w", err)
 		}
+		return 0, fmt.Errorf("unable to insert user: %w", err)
+	}
 
-		starsStmt, err := tx.PrepareContext(ctx, "INSERT INTO stars (user_id, event_key) VALUES ($1, $2)")
-		if err != nil {
-			return fmt.Errorf("unable to prepare stars insert statement: %w", err)
-		}
+	starsStmt, err := tx.PrepareContext(ctx, "INSERT INTO stars (user_id, event_key) VALUES ($1, $2)")
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare stars insert statement: %w", err)
+	}
 
-		for _, star := range u.Stars {
-			if _, err := starsStmt.ExecContext(ctx, u.ID, star); err != nil {
-				if err, ok := err.(*pq.Error); ok && err.Code == pgFKeyViolation {
-					return ErrFKeyViolation{fmt.Errorf("user stars event key fk violation: %v", err)}
-				}
-				return fmt.Errorf("unable to insert star for user: %w", err)
+	for _, star := range u.Stars {
+		if _, err := starsStmt.ExecContext(ctx, u.ID, star); err != nil {
+			if err, ok := err.(*pq.Error); ok && err.Code == pgFKeyViolation {
+				return 0, ErrFKeyViolation{fmt.Errorf("user stars event key fk violation: %v", err)}
 			}
+			return 0, fmt.Errorf("unable to insert star for user: %w", err)
 		}
+	}
 
-		return nil
-	})
+	return u.ID, nil
 }
 
 // GetUsers retrieves all users.
@@ -138,7 +154,15 @@ func (s *Service) GetUsers(ctx context.Context) ([]User, error) {
 		realm_id,
 		first_name,
 		last_name,
-		roles,
+		email,
+		role,
+		permissions,
+		failed_logins,
+		locked_until,
+		pending_since,
+		rejected_at,
+		rejection_reason,
+		last_active_at,
 		array_remove(array_agg(stars.event_key), NULL) AS stars
 	FROM users
 	LEFT JOIN
@@ -167,7 +191,15 @@ func (s *Service) GetUsersByRealm(ctx context.Context, realmID int64) ([]User, e
 		realm_id,
 		first_name,
 		last_name,
-		roles,
+		email,
+		role,
+		permissions,
+		failed_logins,
+		locked_until,
+		pending_since,
+		rejected_at,
+		rejection_reason,
+		last_active_at,
 		array_remove(array_agg(stars.event_key), NULL) AS stars
 	FROM users
 	LEFT JOIN
@@ -197,7 +229,15 @@ func (s *Service) GetUserByID(ctx context.Context, id int64) (User, error) {
 		realm_id,
 		first_name,
 		last_name,
-		roles,
+		email,
+		role,
+		permissions,
+		failed_logins,
+		locked_until,
+		pending_since,
+		rejected_at,
+		rejection_reason,
+		last_active_at,
 		array_remove(array_agg(stars.event_key), NULL) AS stars
 	FROM users
 	LEFT JOIN
@@ -217,7 +257,7 @@ func (s *Service) GetUserByID(ctx context.Context, id int64) (User, error) {
 }
 
 // LockUser retrieves a user and locks it for update
-func (s *Service) LockUser(ctx context.Context, tx *sqlx.Tx, id int64) (User, error) {
+func (s *Service) LockUser(ctx context.Context, tx *Tx, id int64) (User, error) {
 	var u User
 
 	err := tx.GetContext(ctx, &u, `
@@ -237,7 +277,7 @@ func (s *Service) LockUser(ctx context.Context, tx *sqlx.Tx, id int64) (User, er
 
 // PatchUser updates a user by their ID.
 func (s *Service) PatchUser(ctx context.Context, pu PatchUser) error {
-	return s.DoTransaction(ctx, func(tx *sqlx.Tx) error {
+	return s.DoTransaction(ctx, func(tx *Tx) error {
 		if pu.HashedPassword != nil {
 			now := time.Now()
 			pu.PasswordChanged = &now
@@ -251,7 +291,9 @@ func (s *Service) PatchUser(ctx context.Context, pu PatchUser) error {
 				password_changed = COALESCE(:password_changed, password_changed),
 				first_name = COALESCE(:first_name, first_name),
 				last_name = COALESCE(:last_name, last_name),
-				roles = COALESCE(:roles, roles)
+				email = COALESCE(:email, email),
+				role = COALESCE(:role, role),
+				permissions = COALESCE(:permissions, permissions)
 			WHERE
 				id = :id
 		`, pu)
@@ -303,7 +345,7 @@ func (s *Service) DeleteUserByID(ctx context.Context, id int64) error {
 }
 
 // DeleteUserByIDRealmTx deletes a specific user from the database.
-func (s *Service) DeleteUserByIDRealmTx(ctx context.Context, tx *sqlx.Tx, id, realmID int64) error {
+func (s *Service) DeleteUserByIDRealmTx(ctx context.Context, tx *Tx, id, realmID int64) error {
 	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1 AND realm_id = $2", id, realmID)
 	if err != nil {
 		return fmt.Errorf("unable to delete user %d: %w", id, err)
@@ -346,7 +388,7 @@ func (s *Service) CheckSimilarUsernameExists(ctx context.Context, username strin
 
 // ExclusiveLockUsersTx locks the users table so no changes can be made to it by anything other
 // than the given transaction.
-func (s *Service) ExclusiveLockUsersTx(ctx context.Context, tx *sqlx.Tx) error {
+func (s *Service) ExclusiveLockUsersTx(ctx context.Context, tx *Tx) error {
 	_, err := tx.ExecContext(ctx, "LOCK TABLE users IN EXCLUSIVE MODE")
 	if err != nil {
 		return fmt.Errorf("unable to lock users: %w", err)
@@ -2,9 +2,14 @@ package summary
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
+
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Report defines a report for a single team in a single match at a single event, which is
@@ -24,12 +29,14 @@ type ScoreBreakdown map[string]interface{}
 // Match defines information relevant to summarizing matches (match key, reports, score
 // breakdowns, alliances). RobotPosition should be the one-indexed position of the robot
 // on the field, and the score breakdown should be the relevant score breakdown to the
-// alliance the robot was on.
+// alliance the robot was on. Weight sets how much the match counts towards averages
+// relative to other matches, and is treated as 1 if unset.
 type Match struct {
 	Key            string
 	Reports        []Report
 	RobotPosition  int
 	ScoreBreakdown ScoreBreakdown
+	Weight         float64
 }
 
 // Schema defines a list of schema fields for a schema. The Schema will outline how to summarize
@@ -71,9 +78,13 @@ type SummaryStat struct {
 
 // SummarizeTeam summarizes a singular team's performance in a single match. The matches
 // passed must be ONLY for the team being analyzed and have RobotPosition and ScoreBreakdown
-// set properly.
-func SummarizeTeam(schema Schema, matches []Match) (Summary, error) {
+// set properly. The context is only used for tracing.
+func SummarizeTeam(ctx context.Context, schema Schema, matches []Match) (summary Summary, err error) {
+	_, span := tracing.Start(ctx, "summary.SummarizeTeam", trace.WithAttributes(label.Int("matches", len(matches))))
+	defer func() { tracing.End(span, err) }()
+
 	records := make(map[string][]float64)
+	weights := make(map[string][]float64)
 
 	for _, match := range matches {
 		matchRecords, err := summarizeMatch(schema, match)
@@ -81,6 +92,11 @@ func SummarizeTeam(schema Schema, matches []Match) (Summary, error) {
 			return Summary{}, fmt.Errorf("unable to summarize match: %w", err)
 		}
 
+		weight := match.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
 		for statName, matchRecord := range matchRecords {
 			// if there are multiple reports for one match we need to
 			// average them so one match isn't weighted twice as much
@@ -92,15 +108,16 @@ func SummarizeTeam(schema Schema, matches []Match) (Summary, error) {
 			}
 
 			records[statName] = append(records[statName], sum/float64(len(matchRecord)))
+			weights[statName] = append(weights[statName], weight)
 		}
 	}
 
-	summary := make(Summary, 0)
+	summary = make(Summary, 0)
 	for statName, record := range records {
 		stat := SummaryStat{
 			FieldDescriptor: FieldDescriptor{Name: statName},
 			Max:             max(record),
-			Average:         sum(record) / float64(len(record)),
+			Average:         weightedAverage(record, weights[statName]),
 		}
 
 		summary = append(summary, stat)
@@ -119,12 +136,13 @@ func max(values []float64) float64 {
 	return max
 }
 
-func sum(values []float64) float64 {
-	var sum float64
-	for _, v := range values {
-		sum += v
+func weightedAverage(values, weights []float64) float64 {
+	var sum, totalWeight float64
+	for i, v := range values {
+		sum += v * weights[i]
+		totalWeight += weights[i]
 	}
-	return sum
+	return sum / totalWeight
 }
 
 func sumJSONValues(values []interface{}) float64 {
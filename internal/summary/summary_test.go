@@ -1,6 +1,7 @@
 package summary
 
 import (
+	"context"
 	"sort"
 	"testing"
 
@@ -8,7 +9,7 @@ import (
 )
 
 func TestSummarizeTeam(t *testing.T) {
-	actualSummary, err := SummarizeTeam(testSchema, testMatches)
+	actualSummary, err := SummarizeTeam(context.Background(), testSchema, testMatches)
 
 	if err != nil {
 		t.Errorf("did not expect error but got: %v\n", err)
@@ -27,6 +28,44 @@ func TestSummarizeTeam(t *testing.T) {
 	}
 }
 
+func TestSummarizeTeamWeighted(t *testing.T) {
+	schema := Schema{
+		{
+			FieldDescriptor: FieldDescriptor{Name: "Cargo Placed"},
+			ReportReference: "Cargo Placed",
+		},
+	}
+
+	matches := []Match{
+		{
+			Key:     "qm1",
+			Reports: []Report{{{Name: "Cargo Placed", Value: 2}}},
+		},
+		{
+			Key:     "qm2",
+			Reports: []Report{{{Name: "Cargo Placed", Value: 8}}},
+			Weight:  3,
+		},
+	}
+
+	expectedSummary := Summary{
+		{
+			FieldDescriptor: FieldDescriptor{Name: "Cargo Placed"},
+			Max:             8,
+			Average:         6.5,
+		},
+	}
+
+	actualSummary, err := SummarizeTeam(context.Background(), schema, matches)
+	if err != nil {
+		t.Errorf("did not expect error but got: %v\n", err)
+	}
+
+	if !cmp.Equal(actualSummary, expectedSummary) {
+		t.Errorf("expected actual summary to equal expected summary but got diff: %v\n", cmp.Diff(actualSummary, expectedSummary))
+	}
+}
+
 var testSchema Schema = []SchemaField{
 	{
 		FieldDescriptor: FieldDescriptor{Name: "Cargo Placed"},
@@ -7,18 +7,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Pigmice2733/peregrine-backend/internal/metrics"
 	"github.com/Pigmice2733/peregrine-backend/internal/store"
+	"github.com/Pigmice2733/peregrine-backend/internal/tracing"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Service provides methods for retrieving data from
 // The Blue Alliance API
 type Service struct {
-	URL       string
-	APIKey    string
+	URL    string
+	APIKey string
+	// Timeout bounds each request to TBA. If zero, requests time out after
+	// 10 seconds.
+	Timeout   time.Duration
 	etagStore *sync.Map
 }
 
@@ -76,15 +84,38 @@ type scoreBreakdown struct {
 	Blue map[string]interface{} `json:"blue"`
 }
 
+type team struct {
+	Key        string  `json:"key"`
+	Nickname   string  `json:"nickname"`
+	RookieYear *int    `json:"rookie_year"`
+	City       *string `json:"city"`
+	StateProv  *string `json:"state_prov"`
+	Country    *string `json:"country"`
+	SchoolName *string `json:"school_name"`
+	Website    *string `json:"website"`
+}
+
+type robot struct {
+	TeamKey   string `json:"team_key"`
+	Year      int    `json:"year"`
+	RobotName string `json:"robot_name"`
+}
+
 type rankings struct {
-	Rankings      []rank          `json:"rankings"`
-	SortOrderInfo []sortOrderInfo `json:"sort_order_info"`
+	Rankings       []rank          `json:"rankings"`
+	SortOrderInfo  []sortOrderInfo `json:"sort_order_info"`
+	ExtraStatsInfo []sortOrderInfo `json:"extra_stats_info"`
 }
 
 type rank struct {
-	Rank       int       `json:"rank"`
-	TeamKey    string    `json:"team_key"`
-	SortOrders []float64 `json:"sort_orders"`
+	Rank          int           `json:"rank"`
+	TeamKey       string        `json:"team_key"`
+	SortOrders    []float64     `json:"sort_orders"`
+	Record        *store.Record `json:"record"`
+	DQ            *int          `json:"dq"`
+	MatchesPlayed *int          `json:"matches_played"`
+	QualAverage   *float64      `json:"qual_average"`
+	ExtraStats    []float64     `json:"extra_stats"`
 }
 
 type sortOrderInfo struct {
@@ -95,8 +126,15 @@ type sortOrderInfo struct {
 // size of a typical /events/{year} response from TBA.
 const maxResponseSize int64 = 1.2e+6
 
-var tbaClient = &http.Client{
-	Timeout: time.Second * 10,
+const defaultTimeout = time.Second * 10
+
+func (s *Service) client() *http.Client {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &http.Client{Timeout: timeout}
 }
 
 // ErrNotModified is returned when a resource has not been modified since it was
@@ -120,11 +158,25 @@ func trimMatchKey(tbaKey string) (string, error) {
 	return parts[1], nil
 }
 
-func (s *Service) makeRequest(ctx context.Context, path string) (*http.Response, error) {
+// makeRequest requests the given path from TBA. The endpoint is the format
+// string the path was built from, and is used to group requests in metrics.
+func (s *Service) makeRequest(ctx context.Context, endpoint, path string) (resp *http.Response, err error) {
 	req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
 	if err != nil {
 		return nil, err
 	}
+
+	ctx, span := tracing.Start(ctx, "TBA GET "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+	)
+	defer func() {
+		if errors.Is(err, ErrNotModified{}) {
+			err = nil
+		}
+		tracing.End(span, err)
+	}()
+
 	req = req.WithContext(ctx)
 
 	if s.etagStore == nil {
@@ -137,12 +189,19 @@ func (s *Service) makeRequest(ctx context.Context, path string) (*http.Response,
 
 	req.Header.Set("X-TBA-Auth-Key", s.APIKey)
 
-	resp, err := tbaClient.Do(req)
+	start := time.Now()
+	resp, err = s.client().Do(req)
+	metrics.TBADuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.TBARequests.WithLabelValues(endpoint, "error").Inc()
 		return resp, err
 	}
 
+	metrics.TBARequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+
 	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
 		return resp, ErrNotModified{fmt.Errorf("got not modified for path: %s", path)}
 	}
 
@@ -153,6 +212,17 @@ func (s *Service) makeRequest(ctx context.Context, path string) (*http.Response,
 	return resp, nil
 }
 
+// ForgetEvent discards the cached ETags for an event's matches and rankings so
+// the next request for them will not return ErrNotModified.
+func (s *Service) ForgetEvent(eventKey string) {
+	if s.etagStore == nil {
+		return
+	}
+
+	s.etagStore.Delete(fmt.Sprintf("/event/%s/matches", eventKey))
+	s.etagStore.Delete(fmt.Sprintf("/event/%s/rankings", eventKey))
+}
+
 func webcastURL(webcastType, channel string) (string, error) {
 	switch webcastType {
 	case "twitch":
@@ -181,22 +251,25 @@ func (s *Service) Ping(ctx context.Context) error {
 	}
 	req = req.WithContext(ctx)
 
-	_, err = tbaClient.Do(req)
+	resp, err := s.client().Do(req)
 	if err != nil {
 		return fmt.Errorf("doing request: %w", err)
 	}
+	resp.Body.Close()
 
 	return nil
 }
 
 // GetEvents retrieves all events from the given year (e.g. 2018).
 func (s *Service) GetEvents(ctx context.Context, year int) ([]store.Event, error) {
-	path := fmt.Sprintf("/events/%d", year)
+	const endpoint = "/events/%d"
+	path := fmt.Sprintf(endpoint, year)
 
-	response, err := s.makeRequest(ctx, path)
+	response, err := s.makeRequest(ctx, endpoint, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
@@ -209,71 +282,106 @@ func (s *Service) GetEvents(ctx context.Context, year int) ([]store.Event, error
 
 	var events []store.Event
 	for _, tbaEvent := range tbaEvents {
-		var districtAbbreviation, districtFullName *string
-		if tbaEvent.District != nil {
-			districtAbbreviation = &tbaEvent.District.Abbreviation
-			districtFullName = &tbaEvent.District.FullName
-		}
-
-		timeZone, err := time.LoadLocation(tbaEvent.Timezone)
+		e, err := tbaEvent.storeEvent()
 		if err != nil {
 			return nil, err
 		}
 
-		startDate, err := time.ParseInLocation("2006-01-02", tbaEvent.StartDate, timeZone)
-		if err != nil {
-			return nil, err
-		}
-		startDate = startDate.Add(time.Hour * 12) // assume events start at noon
+		events = append(events, e)
+	}
 
-		endDate, err := time.ParseInLocation("2006-01-02", tbaEvent.EndDate, timeZone)
-		if err != nil {
-			return nil, err
-		}
-		endDate = endDate.Add(time.Hour * (12 + 7)) // assume events end at 7pm
+	return events, nil
+}
 
-		webcasts := make([]string, 0)
-		for _, webcast := range tbaEvent.Webcasts {
-			url, err := webcastURL(webcast.Type, webcast.Channel)
-			if err == nil {
-				webcasts = append(webcasts, url)
-			}
-		}
+// storeEvent converts a TBA event to a store event.
+func (tbaEvent event) storeEvent() (store.Event, error) {
+	var districtAbbreviation, districtFullName *string
+	if tbaEvent.District != nil {
+		districtAbbreviation = &tbaEvent.District.Abbreviation
+		districtFullName = &tbaEvent.District.FullName
+	}
 
-		name := tbaEvent.ShortName
-		if name == "" {
-			name = tbaEvent.Name
+	timeZone, err := time.LoadLocation(tbaEvent.Timezone)
+	if err != nil {
+		return store.Event{}, err
+	}
+
+	startDate, err := time.ParseInLocation("2006-01-02", tbaEvent.StartDate, timeZone)
+	if err != nil {
+		return store.Event{}, err
+	}
+	startDate = startDate.Add(time.Hour * 12) // assume events start at noon
+
+	endDate, err := time.ParseInLocation("2006-01-02", tbaEvent.EndDate, timeZone)
+	if err != nil {
+		return store.Event{}, err
+	}
+	endDate = endDate.Add(time.Hour * (12 + 7)) // assume events end at 7pm
+
+	webcasts := make([]string, 0)
+	for _, webcast := range tbaEvent.Webcasts {
+		url, err := webcastURL(webcast.Type, webcast.Channel)
+		if err == nil {
+			webcasts = append(webcasts, url)
 		}
+	}
 
-		events = append(events, store.Event{
-			Key:          tbaEvent.Key,
-			Name:         name,
-			District:     districtAbbreviation,
-			FullDistrict: districtFullName,
-			Week:         tbaEvent.Week,
-			StartDate:    startDate,
-			EndDate:      endDate,
-			Webcasts:     webcasts,
-			Lat:          tbaEvent.Lat,
-			Lon:          tbaEvent.Lng,
-			GMapsURL:     tbaEvent.GMapsURL,
-			LocationName: tbaEvent.LocationName,
-		})
+	name := tbaEvent.ShortName
+	if name == "" {
+		name = tbaEvent.Name
 	}
 
-	return events, nil
+	return store.Event{
+		Key:          tbaEvent.Key,
+		Name:         name,
+		District:     districtAbbreviation,
+		FullDistrict: districtFullName,
+		Week:         tbaEvent.Week,
+		StartDate:    startDate,
+		EndDate:      endDate,
+		Webcasts:     webcasts,
+		Lat:          tbaEvent.Lat,
+		Lon:          tbaEvent.Lng,
+		GMapsURL:     tbaEvent.GMapsURL,
+		LocationName: tbaEvent.LocationName,
+	}, nil
+}
+
+// GetEvent retrieves a single event given its key (e.g. 2018orwil).
+func (s *Service) GetEvent(ctx context.Context, eventKey string) (store.Event, error) {
+	const endpoint = "/event/%s"
+	path := fmt.Sprintf(endpoint, eventKey)
+
+	response, err := s.makeRequest(ctx, endpoint, path)
+	if err != nil {
+		return store.Event{}, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return store.Event{}, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
+	}
+
+	var tbaEvent event
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&tbaEvent); err != nil {
+		return store.Event{}, err
+	}
+
+	return tbaEvent.storeEvent()
 }
 
 const tbaURL = "https://www.thebluealliance.com"
 
 // GetMatches retrieves all matches from a specific event.
 func (s *Service) GetMatches(ctx context.Context, eventKey string) ([]store.Match, error) {
-	path := fmt.Sprintf("/event/%s/matches", eventKey)
+	const endpoint = "/event/%s/matches"
+	path := fmt.Sprintf(endpoint, eventKey)
 
-	response, err := s.makeRequest(ctx, path)
+	response, err := s.makeRequest(ctx, endpoint, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
@@ -354,20 +462,24 @@ func (s *Service) GetMatches(ctx context.Context, eventKey string) ([]store.Matc
 func (s *Service) GetTeams(ctx context.Context) ([]store.Team, error) {
 	allTeams := []store.Team{}
 	for page := 0; page < 50; page++ {
-		path := fmt.Sprintf("/teams/%d", page)
+		const endpoint = "/teams/%d"
+		path := fmt.Sprintf(endpoint, page)
 
-		response, err := s.makeRequest(ctx, path)
+		response, err := s.makeRequest(ctx, endpoint, path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to make request: %w", err)
 		}
 
 		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
 			return nil, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
 		}
 
-		teams := []store.Team{}
+		teams := []team{}
 
-		if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&teams); err != nil {
+		err = json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&teams)
+		response.Body.Close()
+		if err != nil {
 			return nil, err
 		}
 
@@ -375,19 +487,68 @@ func (s *Service) GetTeams(ctx context.Context) ([]store.Team, error) {
 			return allTeams, nil
 		}
 
-		allTeams = append(allTeams, teams...)
+		for _, t := range teams {
+			allTeams = append(allTeams, store.Team{
+				Key:        t.Key,
+				Nickname:   t.Nickname,
+				RookieYear: t.RookieYear,
+				City:       t.City,
+				StateProv:  t.StateProv,
+				Country:    t.Country,
+				SchoolName: t.SchoolName,
+				Website:    t.Website,
+			})
+		}
 	}
 	return allTeams, errors.New("TBA teams route gave >50 pages, either number of FRC teams exceeds 25,000 or TBA is broken")
 }
 
+// GetRobots retrieves the names of a team's robots for every year they named one.
+func (s *Service) GetRobots(ctx context.Context, teamKey string) ([]store.Robot, error) {
+	const endpoint = "/team/%s/robots"
+	path := fmt.Sprintf(endpoint, teamKey)
+
+	response, err := s.makeRequest(ctx, endpoint, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
+	}
+
+	var tbaRobots []robot
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&tbaRobots); err != nil {
+		return nil, err
+	}
+
+	robots := make([]store.Robot, 0, len(tbaRobots))
+	for _, r := range tbaRobots {
+		if r.RobotName == "" {
+			continue
+		}
+
+		robots = append(robots, store.Robot{
+			TeamKey: teamKey,
+			Year:    r.Year,
+			Name:    r.RobotName,
+		})
+	}
+
+	return robots, nil
+}
+
 // GetTeamRankings retrieves all team rankings from a specific event.
 func (s *Service) GetTeamRankings(ctx context.Context, eventKey string) ([]store.EventTeam, error) {
-	path := fmt.Sprintf("/event/%s/rankings", eventKey)
+	const endpoint = "/event/%s/rankings"
+	path := fmt.Sprintf(endpoint, eventKey)
 
-	response, err := s.makeRequest(ctx, path)
+	response, err := s.makeRequest(ctx, endpoint, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("got unexpected status for url %q: %d", response.Request.URL, response.StatusCode)
@@ -412,19 +573,45 @@ func (s *Service) GetTeamRankings(ctx context.Context, eventKey string) ([]store
 	var teams []store.EventTeam
 	for _, teamRank := range teamRankings.Rankings {
 		var rankingScore *float64
-		if rankingScoreIndex != -1 {
+		if rankingScoreIndex != -1 && rankingScoreIndex < len(teamRank.SortOrders) {
 			rankingScore = &teamRank.SortOrders[rankingScoreIndex]
 		}
 
 		rank := teamRank.Rank
 		team := store.EventTeam{
-			Key:          teamRank.TeamKey,
-			EventKey:     eventKey,
-			Rank:         &rank,
-			RankingScore: rankingScore,
+			Key:           teamRank.TeamKey,
+			EventKey:      eventKey,
+			Rank:          &rank,
+			RankingScore:  rankingScore,
+			SortOrders:    namedSortOrders(teamRankings.SortOrderInfo, teamRank.SortOrders),
+			Record:        teamRank.Record,
+			DQ:            teamRank.DQ,
+			MatchesPlayed: teamRank.MatchesPlayed,
+			QualAverage:   teamRank.QualAverage,
+			ExtraStats:    namedSortOrders(teamRankings.ExtraStatsInfo, teamRank.ExtraStats),
 		}
 		teams = append(teams, team)
 	}
 
 	return teams, nil
 }
+
+// namedSortOrders pairs ranking values with the names from their info. Values
+// without a matching name are dropped, since TBA pads sort orders with zeroes
+// for some events.
+func namedSortOrders(info []sortOrderInfo, values []float64) store.SortOrders {
+	if len(info) == 0 || len(values) == 0 {
+		return nil
+	}
+
+	sortOrders := make(store.SortOrders, 0, len(values))
+	for i, value := range values {
+		if i >= len(info) {
+			break
+		}
+
+		sortOrders = append(sortOrders, store.SortOrder{Name: info[i].Name, Value: value})
+	}
+
+	return sortOrders
+}
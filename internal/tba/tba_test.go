@@ -17,9 +17,11 @@ import (
 type tbaServer struct {
 	*httptest.Server
 	getEventsHandler       func(w http.ResponseWriter, r *http.Request)
+	getEventHandler        func(w http.ResponseWriter, r *http.Request)
 	getMatchesHandler      func(w http.ResponseWriter, r *http.Request)
 	getTeamRankingsHandler func(w http.ResponseWriter, r *http.Request)
 	getTeamsHandler        func(w http.ResponseWriter, r *http.Request)
+	getRobotsHandler       func(w http.ResponseWriter, r *http.Request)
 }
 
 const testingYear = 2018
@@ -45,9 +47,11 @@ func newTBAServer() *tbaServer {
 
 	r := mux.NewRouter()
 	r.HandleFunc("/events/"+strconv.Itoa(testingYear), func(w http.ResponseWriter, r *http.Request) { ts.getEventsHandler(w, r) })
+	r.HandleFunc("/event/{eventKey}", func(w http.ResponseWriter, r *http.Request) { ts.getEventHandler(w, r) })
 	r.HandleFunc("/event/{eventKey}/matches", func(w http.ResponseWriter, r *http.Request) { ts.getMatchesHandler(w, r) })
 	r.HandleFunc("/event/{eventKey}/rankings", func(w http.ResponseWriter, r *http.Request) { ts.getTeamRankingsHandler(w, r) })
 	r.HandleFunc("/teams/{page}", func(w http.ResponseWriter, r *http.Request) { ts.getTeamsHandler(w, r) })
+	r.HandleFunc("/team/{teamKey}/robots", func(w http.ResponseWriter, r *http.Request) { ts.getRobotsHandler(w, r) })
 
 	ts.Server = httptest.NewServer(r)
 
@@ -249,6 +253,92 @@ func TestGetEvents(t *testing.T) {
 	}
 }
 
+func TestGetEvent(t *testing.T) {
+	server := newTBAServer()
+	defer server.Close()
+
+	s := Service{URL: server.URL, APIKey: "notARealKey"}
+
+	testCases := []struct {
+		name            string
+		getEventHandler func(w http.ResponseWriter, r *http.Request)
+		event           store.Event
+		expectErr       bool
+	}{
+		{
+			name: "tba event route gives 404",
+			getEventHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expectErr: true,
+		},
+		{
+			name: "tba gives event data",
+			getEventHandler: func(w http.ResponseWriter, r *http.Request) {
+				if mux.Vars(r)["eventKey"] != "2018orwil" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(`
+				{
+					"key": "2018orwil",
+					"name": "PNW District Wilsonville Event",
+					"short_name": "Wilsonville",
+					"district": {
+						"abbreviation": "pnw",
+						"display_name": "Pacific Northwest"
+					},
+					"week": 1,
+					"start_date": "2018-04-05",
+					"end_date": "2018-04-07",
+					"webcasts": [],
+					"lat": 45.3,
+					"lng": -122.77,
+					"gmaps_url": null,
+					"location_name": "Wilsonville High School",
+					"timezone": "America/Los_Angeles"
+				}
+				`))
+
+				if err != nil {
+					t.Errorf("failed to write test data")
+				}
+			},
+			event: store.Event{
+				Key:          "2018orwil",
+				Name:         "Wilsonville",
+				District:     newString("pnw"),
+				FullDistrict: newString("Pacific Northwest"),
+				Week:         newInt(1),
+				StartDate:    time.Date(2018, 4, 5, 7+12, 0, 0, 0, time.UTC),
+				EndDate:      time.Date(2018, 4, 7, 7+12+7, 0, 0, 0, time.UTC),
+				Lat:          45.3,
+				Lon:          -122.77,
+				LocationName: "Wilsonville High School",
+				Webcasts:     []string{},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server.getEventHandler = tt.getEventHandler
+
+			event, err := s.GetEvent(context.TODO(), "2018orwil")
+			if !tt.expectErr && err != nil {
+				t.Errorf("did not expect an error but got one: %v", err)
+			} else if tt.expectErr && err == nil {
+				t.Errorf("expected error but didnt get one: %v", err)
+			}
+
+			if !cmp.Equal(event, tt.event) {
+				t.Errorf("expected event does not equal actual event, got dif: %s", cmp.Diff(tt.event, event))
+			}
+		})
+	}
+}
+
 func TestGetMatches(t *testing.T) {
 	server := newTBAServer()
 	defer server.Close()
@@ -621,6 +711,7 @@ func TestGetTeams(t *testing.T) {
 						"nickname": "Pigmice",
 						"postal_code": "97202",
 						"rookie_year": 2009,
+						"school_name": "Cleveland High School",
 						"state_prov": "Oregon",
 						"team_number": 2733,
 						"website": "https://www.pigmice.com"
@@ -640,16 +731,30 @@ func TestGetTeams(t *testing.T) {
 			},
 			teams: []store.Team{
 				{
-					Key:      "frc7500",
-					Nickname: "MARAUDERS",
+					Key:        "frc7500",
+					Nickname:   "MARAUDERS",
+					RookieYear: newInt(2019),
+					City:       newString("Fort Lauderdale"),
+					StateProv:  newString("Florida"),
+					Country:    newString("USA"),
 				},
 				{
-					Key:      "frc7502",
-					Nickname: "",
+					Key:        "frc7502",
+					Nickname:   "",
+					RookieYear: newInt(2019),
+					City:       newString("Middlebury"),
+					StateProv:  newString("Indiana"),
+					Country:    newString("USA"),
 				},
 				{
-					Key:      "frc2733",
-					Nickname: "Pigmice",
+					Key:        "frc2733",
+					Nickname:   "Pigmice",
+					RookieYear: newInt(2009),
+					City:       newString("Portland"),
+					StateProv:  newString("Oregon"),
+					Country:    newString("USA"),
+					SchoolName: newString("Cleveland High School"),
+					Website:    newString("https://www.pigmice.com"),
 				},
 			},
 			expectErr: false,
@@ -674,6 +779,85 @@ func TestGetTeams(t *testing.T) {
 	}
 }
 
+func TestGetRobots(t *testing.T) {
+	server := newTBAServer()
+	defer server.Close()
+
+	s := Service{URL: server.URL, APIKey: "notARealKey"}
+
+	testCases := []struct {
+		name             string
+		getRobotsHandler func(w http.ResponseWriter, r *http.Request)
+		robots           []store.Robot
+		expectErr        bool
+	}{
+		{
+			name: "tba robots route gives 500",
+			getRobotsHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			robots:    nil,
+			expectErr: true,
+		},
+		{
+			name: "tba gives robots",
+			getRobotsHandler: func(w http.ResponseWriter, r *http.Request) {
+				if key := mux.Vars(r)["teamKey"]; key != "frc2733" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(`
+				[
+					{
+						"key": "frc2733_2018",
+						"robot_name": "Pigmice 9",
+						"team_key": "frc2733",
+						"year": 2018
+					},
+					{
+						"key": "frc2733_2019",
+						"robot_name": "",
+						"team_key": "frc2733",
+						"year": 2019
+					}
+				]
+				`))
+
+				if err != nil {
+					t.Errorf("failed to write test data")
+				}
+			},
+			robots: []store.Robot{
+				{
+					TeamKey: "frc2733",
+					Year:    2018,
+					Name:    "Pigmice 9",
+				},
+			},
+			expectErr: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server.getRobotsHandler = tt.getRobotsHandler
+
+			robots, err := s.GetRobots(context.TODO(), "frc2733")
+			if !tt.expectErr && err != nil {
+				t.Errorf("did not expect an error but got one: %v", err)
+			} else if tt.expectErr && err == nil {
+				t.Errorf("expected error but didnt get one: %v", err)
+			}
+
+			if !cmp.Equal(robots, tt.robots) {
+				t.Errorf("expected robots do not equal actual robots, got dif: %s", cmp.Diff(tt.robots, robots))
+			}
+		})
+	}
+}
+
 func TestGetTeamRankings(t *testing.T) {
 	server := newTBAServer()
 	defer server.Close()
@@ -756,12 +940,20 @@ func TestGetTeamRankings(t *testing.T) {
 					EventKey:     "2018abca",
 					Rank:         newInt(1),
 					RankingScore: newFloat64(5.25),
+					SortOrders: store.SortOrders{
+						{Name: "Irrelevant Score", Value: 3243},
+						{Name: "Ranking Score", Value: 5.25},
+					},
 				},
 				{
 					Key:          "frc254",
 					EventKey:     "2018abca",
 					Rank:         newInt(2),
 					RankingScore: newFloat64(2.00),
+					SortOrders: store.SortOrders{
+						{Name: "Irrelevant Score", Value: 2453},
+						{Name: "Ranking Score", Value: 2.00},
+					},
 				},
 			},
 			expectErr: false,
@@ -832,18 +1024,102 @@ func TestGetTeamRankings(t *testing.T) {
 					EventKey:     "2018abca",
 					Rank:         newInt(1),
 					RankingScore: nil,
+					SortOrders: store.SortOrders{
+						{Name: "Irrelevant Score", Value: 3243},
+						{Name: "Random Score", Value: 5.25},
+					},
 				},
 				{
 					Key:          "frc254",
 					EventKey:     "2018abca",
 					Rank:         newInt(2),
 					RankingScore: nil,
+					SortOrders: store.SortOrders{
+						{Name: "Irrelevant Score", Value: 23},
+						{Name: "Random Score", Value: 2.0001},
+					},
 				},
 				{
 					Key:          "frc24",
 					EventKey:     "2018abca",
 					Rank:         newInt(12),
 					RankingScore: nil,
+					SortOrders: store.SortOrders{
+						{Name: "Irrelevant Score", Value: 0},
+						{Name: "Random Score", Value: 2.000001},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "tba gives full ranking rows",
+			getTeamRankingsHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(`
+				{
+					"rankings": [
+						{
+							"rank": 1,
+							"team_key": "frc2733",
+							"sort_orders": [
+								2.5,
+								41,
+								0
+							],
+							"record": {
+								"wins": 9,
+								"losses": 2,
+								"ties": 1
+							},
+							"dq": 0,
+							"matches_played": 12,
+							"qual_average": 71.5,
+							"extra_stats": [
+								30
+							]
+						}
+					],
+					"sort_order_info": [
+						{
+							"name": "Ranking Score",
+							"precision": 2
+						},
+						{
+							"name": "Cargo",
+							"precision": 0
+						}
+					],
+					"extra_stats_info": [
+						{
+							"name": "Total Ranking Points",
+							"precision": 0
+						}
+					]
+				}
+				`))
+
+				if err != nil {
+					t.Errorf("failed to write test data")
+				}
+			},
+			teams: []store.EventTeam{
+				{
+					Key:          "frc2733",
+					EventKey:     "2018abca",
+					Rank:         newInt(1),
+					RankingScore: newFloat64(2.5),
+					SortOrders: store.SortOrders{
+						{Name: "Ranking Score", Value: 2.5},
+						{Name: "Cargo", Value: 41},
+					},
+					Record:        &store.Record{Wins: 9, Losses: 2, Ties: 1},
+					DQ:            newInt(0),
+					MatchesPlayed: newInt(12),
+					QualAverage:   newFloat64(71.5),
+					ExtraStats: store.SortOrders{
+						{Name: "Total Ranking Points", Value: 30},
+					},
 				},
 			},
 			expectErr: false,
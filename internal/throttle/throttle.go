@@ -0,0 +1,108 @@
+// Package throttle slows down repeated failures, like failed logins, with
+// exponential backoff.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle tracks consecutive failures by key. After a number of free
+// failures, each failure makes the key wait twice as long as the last before
+// it's allowed again. Keys are forgotten once they haven't failed for a while.
+type Throttle struct {
+	free   int
+	base   time.Duration
+	max    time.Duration
+	forget time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// New creates a throttle that allows free failures before waiting base, and
+// then doubles the wait with each failure up to max. Keys are forgotten after
+// forget without failures.
+func New(free int, base, max, forget time.Duration) *Throttle {
+	return &Throttle{
+		free:    free,
+		base:    base,
+		max:     max,
+		forget:  forget,
+		entries: make(map[string]entry),
+	}
+}
+
+// Wait returns how long until the key is allowed again, or zero if it's
+// allowed now.
+func (t *Throttle) Wait(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok || !now.Before(e.until) {
+		return 0
+	}
+
+	return e.until.Sub(now)
+}
+
+// Fail records a failure for the key.
+func (t *Throttle) Fail(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	e := t.entries[key]
+	if now.Sub(e.last) >= t.forget {
+		e = entry{}
+	}
+
+	e.failures++
+	e.last = now
+	e.until = now
+
+	if over := e.failures - t.free; over > 0 {
+		wait := t.max
+		// Stop doubling before it could overflow.
+		if over < 32 {
+			if d := t.base << uint(over-1); d > 0 && d < t.max {
+				wait = d
+			}
+		}
+		e.until = now.Add(wait)
+	}
+
+	t.entries[key] = e
+}
+
+// Reset forgets the failures of a key.
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, key)
+}
+
+// sweep forgets keys that haven't failed recently, at most once per forget
+// period, so keys that fail once and never again don't pile up.
+func (t *Throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.forget {
+		return
+	}
+	t.lastSweep = now
+
+	for key, e := range t.entries {
+		if now.Sub(e.last) >= t.forget && !now.Before(e.until) {
+			delete(t.entries, key)
+		}
+	}
+}
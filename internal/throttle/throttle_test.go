@@ -0,0 +1,51 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	start := time.Unix(1558050528, 0)
+	th := New(2, time.Second, time.Second*5, time.Hour)
+
+	expectWait := func(key string, now time.Time, expected time.Duration) {
+		t.Helper()
+		if wait := th.Wait(key, now); wait != expected {
+			t.Errorf("expected %s to wait %s, got %s", key, expected, wait)
+		}
+	}
+
+	expectWait("franklin", start, 0)
+
+	// Free failures don't wait.
+	th.Fail("franklin", start)
+	th.Fail("franklin", start)
+	expectWait("franklin", start, 0)
+
+	// Then the wait doubles up to the max.
+	now := start
+	for _, expected := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5} {
+		th.Fail("franklin", now)
+		expectWait("franklin", now, expected)
+		expectWait("franklin", now.Add(expected), 0)
+		now = now.Add(expected)
+	}
+
+	// Other keys aren't affected.
+	expectWait("ada", now, 0)
+
+	th.Fail("franklin", now)
+	th.Reset("franklin")
+	expectWait("franklin", now, 0)
+
+	// Failures are forgotten after a while without any.
+	th.Fail("ada", now)
+	th.Fail("ada", now)
+	th.Fail("ada", now)
+	expectWait("ada", now, time.Second)
+
+	later := now.Add(time.Hour)
+	th.Fail("ada", later)
+	expectWait("ada", later, 0)
+}
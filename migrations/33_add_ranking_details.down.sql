@@ -0,0 +1,7 @@
+ALTER TABLE teams
+    DROP COLUMN sort_orders,
+    DROP COLUMN record,
+    DROP COLUMN dq,
+    DROP COLUMN matches_played,
+    DROP COLUMN qual_average,
+    DROP COLUMN extra_stats;
\ No newline at end of file
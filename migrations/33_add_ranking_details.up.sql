@@ -0,0 +1,7 @@
+ALTER TABLE teams
+    ADD COLUMN sort_orders JSONB,
+    ADD COLUMN record JSONB,
+    ADD COLUMN dq INTEGER,
+    ADD COLUMN matches_played INTEGER,
+    ADD COLUMN qual_average REAL,
+    ADD COLUMN extra_stats JSONB;
\ No newline at end of file
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS robots;
+
+ALTER TABLE all_teams
+    DROP COLUMN rookie_year,
+    DROP COLUMN city,
+    DROP COLUMN state_prov,
+    DROP COLUMN country,
+    DROP COLUMN school_name,
+    DROP COLUMN website;
\ No newline at end of file
@@ -0,0 +1,15 @@
+ALTER TABLE all_teams
+    ADD COLUMN rookie_year INTEGER,
+    ADD COLUMN city TEXT,
+    ADD COLUMN state_prov TEXT,
+    ADD COLUMN country TEXT,
+    ADD COLUMN school_name TEXT,
+    ADD COLUMN website TEXT;
+
+CREATE TABLE IF NOT EXISTS robots (
+    team_key TEXT NOT NULL REFERENCES all_teams ON DELETE CASCADE,
+    year INTEGER NOT NULL,
+    name TEXT NOT NULL,
+
+    PRIMARY KEY(team_key, year)
+);
\ No newline at end of file
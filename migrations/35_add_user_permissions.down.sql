@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN roles JSONB;
+
+UPDATE users SET roles = jsonb_build_object(
+    'isSuperAdmin', 'global' = ANY(permissions),
+    'isAdmin', 'users:manage' = ANY(permissions),
+    'isVerified', 'reports:write' = ANY(permissions)
+);
+
+ALTER TABLE users
+    DROP COLUMN role,
+    DROP COLUMN permissions;
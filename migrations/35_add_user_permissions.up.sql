@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer',
+    ADD COLUMN permissions TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE users SET role = CASE
+    WHEN (roles->>'isSuperAdmin')::BOOLEAN THEN 'superAdmin'
+    WHEN (roles->>'isAdmin')::BOOLEAN THEN 'realmAdmin'
+    WHEN (roles->>'isVerified')::BOOLEAN THEN 'scout'
+    ELSE 'viewer'
+END;
+
+UPDATE users SET permissions = CASE role
+    WHEN 'superAdmin' THEN ARRAY['reports:write', 'reports:manage', 'picklists:edit', 'schemas:manage', 'events:manage', 'users:manage', 'realms:manage', 'refresh:manage', 'global']
+    WHEN 'realmAdmin' THEN ARRAY['reports:write', 'reports:manage', 'picklists:edit', 'schemas:manage', 'events:manage', 'users:manage', 'realms:manage']
+    WHEN 'scout' THEN ARRAY['reports:write']
+    ELSE '{}'
+END;
+
+ALTER TABLE users DROP COLUMN roles;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_email_idx ON users (lower(email));
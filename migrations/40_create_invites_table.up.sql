@@ -0,0 +1,11 @@
+CREATE TABLE invites (
+    id SERIAL PRIMARY KEY,
+    hash TEXT NOT NULL UNIQUE,
+    realm_id INTEGER NOT NULL REFERENCES realms ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    email TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
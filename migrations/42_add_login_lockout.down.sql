@@ -0,0 +1,5 @@
+DROP TABLE login_failures;
+
+ALTER TABLE users
+    DROP COLUMN failed_logins,
+    DROP COLUMN locked_until;
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE TABLE login_failures (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    user_id INTEGER REFERENCES users ON DELETE CASCADE,
+    ip_address TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_failures_created_at_idx ON login_failures (created_at);
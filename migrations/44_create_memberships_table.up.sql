@@ -0,0 +1,10 @@
+CREATE TABLE memberships (
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    realm_id INTEGER NOT NULL REFERENCES realms ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, realm_id)
+);
+
+CREATE INDEX memberships_realm_id_idx ON memberships (realm_id);
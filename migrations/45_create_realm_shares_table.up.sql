@@ -0,0 +1,13 @@
+CREATE TABLE realm_shares (
+    id SERIAL PRIMARY KEY,
+    realm_id INTEGER NOT NULL REFERENCES realms ON DELETE CASCADE,
+    partner_realm_id INTEGER NOT NULL REFERENCES realms ON DELETE CASCADE,
+    event_key TEXT REFERENCES events ON DELETE CASCADE,
+    year INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    accepted_at TIMESTAMPTZ,
+    CHECK (realm_id <> partner_realm_id)
+);
+
+CREATE UNIQUE INDEX realm_shares_scope_idx ON realm_shares (realm_id, partner_realm_id, COALESCE(event_key, ''), COALESCE(year, 0));
+CREATE INDEX realm_shares_partner_realm_id_idx ON realm_shares (partner_realm_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN pending_since,
+    DROP COLUMN rejected_at,
+    DROP COLUMN rejection_reason;
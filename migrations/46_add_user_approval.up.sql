@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN pending_since TIMESTAMPTZ,
+    ADD COLUMN rejected_at TIMESTAMPTZ,
+    ADD COLUMN rejection_reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_pending_realm_id_idx ON users (realm_id) WHERE pending_since IS NOT NULL;
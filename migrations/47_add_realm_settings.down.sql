@@ -0,0 +1,2 @@
+ALTER TABLE realms
+    DROP COLUMN settings;
@@ -0,0 +1,2 @@
+ALTER TABLE realms
+    ADD COLUMN settings JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN last_active_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX users_last_active_at_idx ON users (last_active_at);